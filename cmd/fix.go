@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	diff "notashelf.dev/flint/internal/diff"
+	flake "notashelf.dev/flint/internal/flake"
+	flakenix "notashelf.dev/flint/internal/flakenix"
+)
+
+var writeFix bool
+
+func init() {
+	fixCmd.Flags().BoolVarP(&writeFix, "write", "w", false, "edit flake.nix in place instead of printing a diff")
+
+	rootCmd.AddCommand(fixCmd)
+}
+
+// Returns the flake.nix to use, defaulting to the one next to the lockfile.
+func resolveFlakePath() string {
+	if flakePath != "" {
+		return flakePath
+	}
+	return filepath.Join(filepath.Dir(lockPath), "flake.nix")
+}
+
+var fixCmd = &cobra.Command{
+	Use:   "fix",
+	Short: "Add follows declarations to flake.nix to deduplicate inputs",
+	Long: `Derive the follows declarations that would collapse duplicate inputs onto the
+versions declared by the root flake, and add them to flake.nix next to the
+existing declarations of each input.
+
+By default a unified diff is printed for review; pass --write to edit
+flake.nix in place. Run 'nix flake lock' afterwards to update the lockfile.`,
+	Example: `  flint fix
+  flint fix | git apply
+  flint fix --write --flake=/path/to/flake.nix --lockfile=/path/to/flake.lock`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flakeLock, err := readFlakeLock(lockPath)
+		if err != nil {
+			return err
+		}
+
+		file, err := readFlakeNix(resolveFlakePath())
+		if err != nil {
+			return err
+		}
+		path, src := file.Path, file.Src
+
+		identities, err := identityLock(flakeLock)
+		if err != nil {
+			return err
+		}
+		plan := flake.PlanFollows(identities)
+
+		var edits []flakenix.Edit
+		for _, suggestion := range plan.Follows {
+			edit, err := file.AddFollows(suggestion.Path[0], suggestion.Path[1:], suggestion.Follows)
+			if err != nil {
+				warnf("skipping %s: %v", strings.Join(suggestion.Path, "/"), err)
+				continue
+			}
+			if edit != nil {
+				edits = append(edits, *edit)
+			}
+		}
+
+		for _, unresolved := range plan.Unresolved {
+			warnf("cannot deduplicate %s (%s): %s",
+				unresolved.Identity, strings.Join(unresolved.Nodes, ", "), unresolved.Reason)
+		}
+
+		if len(edits) == 0 {
+			if !quiet {
+				fmt.Fprintln(os.Stderr, "No follows declarations to add.")
+			}
+			return nil
+		}
+
+		patched := flakenix.Apply(src, edits)
+
+		if writeFix {
+			info, err := os.Stat(path)
+			if err != nil {
+				return fmt.Errorf("error reading flake.nix: %w", err)
+			}
+			if err := os.WriteFile(path, patched, info.Mode().Perm()); err != nil {
+				return fmt.Errorf("error writing flake.nix: %w", err)
+			}
+			if !quiet {
+				fmt.Fprintf(os.Stderr, "Added %d follows declarations to %s\n", len(edits), path)
+				fmt.Fprintln(os.Stderr, "Run 'nix flake lock' to update the lockfile.")
+			}
+			return nil
+		}
+
+		oldName, newName := diffNames(path)
+		fmt.Print(diff.Unified(oldName, newName, string(src), string(patched)))
+		return nil
+	},
+}
+
+// Returns git-style a/ and b/ names for files below the working directory,
+// so that the diff can be piped into `git apply`, and the plain path otherwise.
+func diffNames(path string) (string, string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, abs); err == nil && !strings.HasPrefix(rel, "..") {
+				rel = filepath.ToSlash(rel)
+				return "a/" + rel, "b/" + rel
+			}
+		}
+	}
+	return path, path
+}
+
+// Prints a warning to stderr unless quiet mode is enabled.
+func warnf(format string, args ...any) {
+	if quiet {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: "+format+"\n", args...)
+}
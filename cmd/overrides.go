@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	flake "notashelf.dev/flint/internal/flake"
+	output "notashelf.dev/flint/internal/output"
+)
+
+var overridesFormat string
+
+func init() {
+	overridesCmd.Flags().StringVarP(&overridesFormat, "output", "o", "args", "output format: args, shell, or json")
+
+	rootCmd.AddCommand(overridesCmd)
+}
+
+var overridesCmd = &cobra.Command{
+	Use:   "overrides",
+	Short: "Print --override-input arguments that deduplicate inputs without editing flake.nix",
+	Long: `Turn the deduplication plan used by 'flint fix' into --override-input arguments
+for 'nix flake lock'. Each nested input is pinned to the exact revision the
+root flake already locks, so the resulting lockfile is deduplicated without
+touching flake.nix. This is useful for vendored or generated flakes.
+
+The default output prints one argument per line, suitable for reading into a
+shell array. Use --output=shell for a ready-to-run command, or --output=json
+for a JSON array of arguments.`,
+	Example: `  flint overrides --output=shell
+  mapfile -t args < <(flint overrides) && nix flake lock "${args[@]}"
+  flint overrides --output=json`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flakeLock, err := readFlakeLock(lockPath)
+		if err != nil {
+			return err
+		}
+
+		identities, err := identityLock(flakeLock)
+		if err != nil {
+			return err
+		}
+		plan := flake.PlanFollows(identities)
+		for _, unresolved := range plan.Unresolved {
+			warnf("cannot deduplicate %s (%s): %s",
+				unresolved.Identity, strings.Join(unresolved.Nodes, ", "), unresolved.Reason)
+		}
+
+		overrides, err := flake.PlanOverrides(flakeLock, plan)
+		if err != nil {
+			return fmt.Errorf("error planning overrides: %w", err)
+		}
+
+		formatted, err := output.FormatOverrides(overrides, overridesFormat)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(overrides) == 0 && !quiet {
+			fmt.Fprintln(os.Stderr, "No overrides needed.")
+		}
+
+		fmt.Print(formatted)
+		return nil
+	},
+}
@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	cache "notashelf.dev/flint/internal/cache"
+	config "notashelf.dev/flint/internal/config"
+	flake "notashelf.dev/flint/internal/flake"
+)
+
+var (
+	configPath   string
+	resolverName string
+	nixBinary    string
+	checkAll     bool
+	checkDepth   int
+	checkJobs    int
+	checkRetries int
+	timeout      time.Duration
+	totalTimeout time.Duration
+	cacheTTL     time.Duration
+	refresh      bool
+	offline      bool
+	cooldown     string
+	graphQL      bool
+)
+
+// Registers the flags that control how inputs are checked for updates.
+func addUpdateFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&resolverName, "resolver", "",
+		fmt.Sprintf("how to look up the latest revision of inputs: %s (default %q)",
+			strings.Join(flake.ResolverNames(), ", "), flake.DefaultResolver))
+	cmd.Flags().StringVar(&nixBinary, "nix-binary", "", `path to the nix binary (default "nix")`)
+	cmd.Flags().BoolVar(&checkAll, "all", false, "check every input in the lockfile, not just the root inputs")
+	cmd.Flags().IntVar(&checkDepth, "depth", 1, "how many levels of inputs to check for updates")
+	cmd.Flags().IntVarP(&checkJobs, "jobs", "j", flake.DefaultParallelism, "how many inputs to check at once")
+	cmd.Flags().DurationVar(&timeout, "timeout", 30*time.Second, "give up on an input after this long (0 for no limit)")
+	cmd.Flags().DurationVar(&totalTimeout, "total-timeout", 0, "stop checking after this long and report what was checked (0 for no limit)")
+	cmd.Flags().IntVar(&checkRetries, "retries", 2, "how often to retry inputs that fail with transient errors")
+	cmd.Flags().DurationVar(&cacheTTL, "cache-ttl", time.Hour, "reuse cached update lookups for this long (0 to always revalidate)")
+	cmd.Flags().BoolVar(&refresh, "refresh", false, "ignore cached update lookups")
+	cmd.Flags().BoolVar(&offline, "offline", false, "only use cached update lookups, failing inputs that are not cached")
+	cmd.Flags().BoolVar(&graphQL, "github-graphql", false, "look up GitHub inputs in batches through the GraphQL API (needs a token)")
+	cmd.Flags().StringVar(&cooldown, "cooldown", "", `how old upstream commits must be to count as updates, e.g. "72h" or "3d" (default from config, else none)`)
+}
+
+// Returns the update check options selected on the command line and in the
+// configuration file.
+func updateOptions(resolver flake.Resolver, cfg config.Config) (flake.UpdateOptions, error) {
+	if checkDepth < 1 {
+		return flake.UpdateOptions{}, fmt.Errorf("invalid depth %d: must be at least 1", checkDepth)
+	}
+	if checkJobs < 1 {
+		return flake.UpdateOptions{}, fmt.Errorf("invalid number of jobs %d: must be at least 1", checkJobs)
+	}
+
+	opts := flake.UpdateOptions{
+		Resolver:    resolver,
+		Depth:       checkDepth,
+		Parallelism: checkJobs,
+		Timeout:     timeout,
+		Retries:     max(checkRetries, 0),
+	}
+	if checkAll {
+		opts.Depth = -1
+	}
+
+	for name, input := range cfg.Inputs {
+		if input.MaxBump == "" {
+			continue
+		}
+		bump, err := flake.ParseBump(input.MaxBump)
+		if err != nil {
+			return flake.UpdateOptions{}, fmt.Errorf("invalid maxBump for input %s: %w", name, err)
+		}
+		if opts.MaxBump == nil {
+			opts.MaxBump = make(map[string]flake.Bump)
+		}
+		opts.MaxBump[name] = bump
+	}
+
+	policy, err := updatePolicy(cfg)
+	if err != nil {
+		return flake.UpdateOptions{}, err
+	}
+	opts.Policy = policy
+	return opts, nil
+}
+
+// Builds the update policy from the configuration file and --cooldown.
+func updatePolicy(cfg config.Config) (flake.UpdatePolicy, error) {
+	policy := flake.UpdatePolicy{Groups: cfg.Updates.Groups}
+
+	value := cfg.Updates.Cooldown
+	if cooldown != "" {
+		value = cooldown
+	}
+	if value != "" {
+		duration, err := config.ParseDuration(value)
+		if err != nil {
+			return policy, fmt.Errorf("invalid cooldown: %w", err)
+		}
+		policy.Cooldown = duration
+	}
+
+	// An input in two groups could not be updated with either on its own
+	member := make(map[string]string)
+	for group, inputs := range cfg.Updates.Groups {
+		for _, input := range inputs {
+			if other, ok := member[input]; ok && other != group {
+				first, second := min(group, other), max(group, other)
+				return policy, fmt.Errorf("input %s is in both the %s and %s update groups", input, first, second)
+			}
+			member[input] = group
+		}
+	}
+
+	for name, input := range cfg.Inputs {
+		var rule flake.InputPolicy
+		if input.Cooldown != "" {
+			duration, err := config.ParseDuration(input.Cooldown)
+			if err != nil {
+				return policy, fmt.Errorf("invalid cooldown for input %s: %w", name, err)
+			}
+			rule.Cooldown = &duration
+		}
+		if input.Until != "" {
+			if !input.Ignore {
+				return policy, fmt.Errorf("input %s sets until without ignore", name)
+			}
+			until, err := config.ParseDate(input.Until)
+			if err != nil {
+				return policy, fmt.Errorf("invalid until for input %s: %w", name, err)
+			}
+			rule.Until = until
+		}
+		rule.Ignore = input.Ignore
+		rule.Reason = input.Reason
+
+		if rule != (flake.InputPolicy{}) {
+			if policy.Inputs == nil {
+				policy.Inputs = make(map[string]flake.InputPolicy)
+			}
+			policy.Inputs[name] = rule
+		}
+	}
+	return policy, nil
+}
+
+// Reads the configuration file, either the one passed with --config or the
+// first one found next to the lockfile or in the user's config directory.
+func loadConfig() (config.Config, error) {
+	return config.Find(configPath, lockPath)
+}
+
+// Returns a context for an update check that is cancelled on Ctrl-C or when
+// --total-timeout expires. A second Ctrl-C exits immediately.
+func updateContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(parent, os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if totalTimeout <= 0 {
+		return ctx, stop
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, totalTimeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// Opens the cache of update lookups. Checks work without it, so a cache that
+// cannot be opened is only reported in verbose mode, unless --offline needs it.
+func openCache() (*cache.Store, error) {
+	if refresh && offline {
+		return nil, fmt.Errorf("--refresh and --offline cannot be used together")
+	}
+
+	dir, err := cache.DefaultDir()
+	if err == nil {
+		var store *cache.Store
+		if store, err = cache.Open(dir); err == nil {
+			return store, nil
+		}
+	}
+
+	if offline {
+		return nil, err
+	}
+	if verbose && !quiet {
+		warnf("update lookups are not cached: %v", err)
+	}
+	return nil, nil
+}
+
+// Prints what the cache did for an update check in verbose mode.
+func printCacheStats(store *cache.Store) {
+	if store == nil || !verbose || quiet {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Cache: %s (%s)\n", store.Stats(), store.Dir)
+}
+
+// Creates the resolver selected on the command line, falling back to the
+// configuration file and then the default. Lookups go through store when it
+// is not nil.
+func newResolver(cfg config.Config, store *cache.Store) (flake.Resolver, error) {
+	name := cfg.Resolver
+	if resolverName != "" {
+		name = resolverName
+	}
+
+	opts := flake.ResolverOptions{
+		NixBinary:     cfg.NixBinary,
+		Verbose:       verbose && !quiet,
+		ForgeHosts:    cfg.ForgeHosts,
+		Credentials:   flake.LoadCredentials(os.Getenv),
+		GitHubGraphQL: cfg.GitHubGraphQL || graphQL,
+	}
+	if nixBinary != "" {
+		opts.NixBinary = nixBinary
+	}
+	if opts.Verbose {
+		for _, source := range opts.Credentials.Sources() {
+			fmt.Fprintf(os.Stderr, "Using credentials for %s\n", source)
+		}
+	}
+
+	if store != nil {
+		opts.HTTPClient = &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &cache.Transport{Store: store},
+		}
+	}
+
+	rewrites, err := urlRewrites(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver, err := flake.NewResolver(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	if store != nil {
+		resolver = &flake.CachingResolver{
+			Resolver: resolver,
+			Store:    store,
+			TTL:      cacheTTL,
+			Refresh:  refresh,
+			Offline:  offline,
+		}
+	}
+
+	// Rewriting happens first so that lookups are cached under where they
+	// were sent
+	if len(rewrites) > 0 {
+		resolver = &flake.RewritingResolver{Resolver: resolver, Rewrites: rewrites}
+	}
+	return resolver, nil
+}
+
+// Returns the URL rewrite rules of the configuration file.
+func urlRewrites(cfg config.Config) (flake.Rewrites, error) {
+	var rewrites flake.Rewrites
+	for i, rule := range cfg.Rewrites {
+		if rule.URL == "" || rule.InsteadOf == "" {
+			return nil, fmt.Errorf("invalid rewrite %d: url and insteadOf are required", i+1)
+		}
+		rewrites = append(rewrites, flake.Rewrite{URL: rule.URL, InsteadOf: rule.InsteadOf, Identity: rule.Identity})
+	}
+	return rewrites, nil
+}
+
+// Returns the lockfile as duplicate detection sees it, with the identity
+// rewrites of the configuration file applied.
+func identityLock(flakeLock flake.FlakeLock) (flake.FlakeLock, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return flakeLock, err
+	}
+	rewrites, err := urlRewrites(cfg)
+	if err != nil {
+		return flakeLock, err
+	}
+	return rewrites.RewriteLock(flakeLock), nil
+}
@@ -3,10 +3,15 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/spf13/cobra"
+	advisory "notashelf.dev/flint/internal/advisory"
 	flake "notashelf.dev/flint/internal/flake"
+	flakenix "notashelf.dev/flint/internal/flakenix"
 	output "notashelf.dev/flint/internal/output"
 )
 
@@ -19,16 +24,32 @@ var (
 	merge                  bool
 	quiet                  bool
 	checkUpdates           bool
+	checkLock              bool
+	flakePath              string
+	changelog              bool
+	changelogLimit         int
+	checkReachable         bool
+	checkRepos             bool
+	advisoriesPath         string
 )
 
 func init() {
-	rootCmd.Flags().StringVarP(&lockPath, "lockfile", "l", "flake.lock", "path to flake.lock")
-	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "enable verbose output")
+	rootCmd.PersistentFlags().StringVarP(&lockPath, "lockfile", "l", "flake.lock", "path to flake.lock")
+	rootCmd.PersistentFlags().StringVarP(&flakePath, "flake", "f", "", "path to flake.nix (default: next to the lockfile)")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "enable verbose output")
+	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "path to a config file (default: .flint.json next to the lockfile, then the user config)")
 	rootCmd.Flags().BoolVar(&failIfMultipleVersions, "fail-if-multiple-versions", false, "exit with error if multiple versions found")
-	rootCmd.Flags().StringVarP(&outputFormat, "output", "o", "pretty", "output format: plain, pretty, or json")
+	rootCmd.Flags().StringVarP(&outputFormat, "output", "o", "pretty", "output format: plain, pretty, json, github, or gitlab (markdown for updates)")
 	rootCmd.Flags().BoolVarP(&merge, "merge", "m", false, "merge all dependants into one list for each input")
-	rootCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "suppress all non-error output")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "suppress all non-error output")
 	rootCmd.Flags().BoolVarP(&checkUpdates, "check-updates", "u", false, "check for available updates for flake inputs")
+	rootCmd.Flags().BoolVar(&checkLock, "check-lock", false, "cross-check the inputs declared in flake.nix against flake.lock")
+	rootCmd.Flags().BoolVar(&changelog, "changelog", false, "list the upstream commits and releases of each update (implies --check-updates)")
+	rootCmd.Flags().IntVar(&changelogLimit, "changelog-limit", flake.DefaultChangelogCommits, "how many commits to list for each update")
+	rootCmd.Flags().BoolVar(&checkReachable, "check-reachability", false, "report locked revisions that are no longer on their branch upstream (implies --check-updates)")
+	rootCmd.Flags().BoolVar(&checkRepos, "check-repositories", false, "report inputs whose upstream repository was archived, moved or deleted (implies --check-updates)")
+	rootCmd.Flags().StringVar(&advisoriesPath, "advisories", "", "report locked inputs affected by the advisories in a JSON file or directory (also supports sarif output)")
+	addUpdateFlags(rootCmd)
 
 	rootCmd.SetVersionTemplate(`{{printf "%s version %s\n" .Name .Version}}`)
 }
@@ -40,40 +61,147 @@ var rootCmd = &cobra.Command{
   flint --lockfile=/path/to/flake.lock --output=json
   flint --lockfile=/path/to/flake.lock --output=plain
   flint --merge
-  flint --check-updates`,
+  flint --check-updates
+  flint --changelog --output=markdown
+  flint --check-reachability
+  flint --check-repositories
+  flint --check-lock
+  flint --advisories=./advisories --output=sarif
+  flint fix --write`,
 
 	RunE: func(cmd *cobra.Command, args []string) error {
-
-		data, err := os.ReadFile(lockPath)
+		flakeLock, err := readFlakeLock(lockPath)
 		if err != nil {
-			return fmt.Errorf("error reading flake.lock: %w", err)
+			return err
+		}
+
+		if checkLock {
+			file, err := readFlakeNix(resolveFlakePath())
+			if err != nil {
+				return err
+			}
+
+			mismatches := flakenix.CheckLock(file, flakeLock)
+
+			options := output.Options{
+				OutputFormat: outputFormat,
+				Verbose:      verbose,
+				Quiet:        quiet,
+			}
+
+			if err := output.PrintMismatches(mismatches, file.Path, options); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			// A stale lockfile is always an error, so that CI catches it
+			if len(mismatches) > 0 {
+				os.Exit(1)
+			}
+			return nil
 		}
 
-		var flakeLock flake.FlakeLock
-		if err := json.Unmarshal(data, &flakeLock); err != nil {
-			return fmt.Errorf("error decoding flake.lock: %w", err)
+		if advisoriesPath != "" {
+			advisories, err := advisory.Load(advisoriesPath)
+			if err != nil {
+				return err
+			}
+
+			// Rewrites treating mirrors as their upstream apply here too, so
+			// that inputs locked from a mirror match upstream advisories
+			identities, err := identityLock(flakeLock)
+			if err != nil {
+				return err
+			}
+			matches := advisory.Check(identities, advisories)
+
+			options := output.Options{
+				OutputFormat: outputFormat,
+				Verbose:      verbose,
+				Quiet:        quiet,
+				LockPath:     lockPath,
+			}
+			if file := optionalFlakeNix(); file != nil {
+				options.Locations = flakenix.NodeLocations(file, flakeLock)
+			}
+
+			if err := output.PrintAdvisories(matches, advisories, options); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			if len(matches) > 0 {
+				os.Exit(1)
+			}
+			return nil
 		}
 
-		if checkUpdates {
-			updates, err := flake.CheckUpdates(flakeLock, verbose)
+		if checkUpdates || changelog || checkReachable || checkRepos {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			store, err := openCache()
+			if err != nil {
+				return err
+			}
+
+			resolver, err := newResolver(cfg, store)
+			if err != nil {
+				return err
+			}
+
+			opts, err := updateOptions(resolver, cfg)
+			if err != nil {
+				return err
+			}
+			if changelog {
+				if changelogLimit < 1 {
+					return fmt.Errorf("invalid changelog limit %d: must be at least 1", changelogLimit)
+				}
+				opts.Changelog = changelogLimit
+			}
+			opts.CheckReachability = checkReachable
+			opts.CheckRepositories = checkRepos
+
+			ctx, cancel := updateContext(cmd.Context())
+			defer cancel()
+
+			updates, err := flake.CheckUpdatesWith(ctx, flakeLock, opts)
 			if err != nil {
 				return fmt.Errorf("error checking updates: %w", err)
 			}
+			printCacheStats(store)
+			warnUnchecked(updates)
 
 			options := output.Options{
 				OutputFormat: outputFormat,
 				Verbose:      verbose,
 				Quiet:        quiet,
+				LockPath:     lockPath,
+			}
+			if file := optionalFlakeNix(); file != nil {
+				options.Locations = flakenix.InputLocations(file)
 			}
 
 			if err := output.PrintUpdates(updates, options); err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
+
+			if updates.Incomplete {
+				warnf("update check interrupted; results are incomplete")
+				os.Exit(1)
+			}
 			return nil
 		}
 
-		flakeData := flake.AnalyzeFlake(flakeLock)
+		identities, err := identityLock(flakeLock)
+		if err != nil {
+			return err
+		}
+		flakeData := flake.AnalyzeFlake(identities)
 
 		options := output.Options{
 			OutputFormat:           outputFormat,
@@ -81,6 +209,10 @@ var rootCmd = &cobra.Command{
 			Merge:                  merge,
 			FailIfMultipleVersions: failIfMultipleVersions,
 			Quiet:                  quiet,
+			LockPath:               lockPath,
+		}
+		if file := optionalFlakeNix(); file != nil {
+			options.Locations = flakenix.NodeLocations(file, flakeLock)
 		}
 
 		// Print dependencies
@@ -98,6 +230,77 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+// Warns about the optional checks that were asked for but that the resolver
+// could not run, so that a clean report is not mistaken for a clean bill of
+// health.
+func warnUnchecked(results flake.UpdateResults) {
+	unchecked := make(map[string][]string)
+	for _, update := range results.Updates {
+		for _, check := range update.Unchecked {
+			unchecked[check] = append(unchecked[check], update.InputName)
+		}
+	}
+
+	for _, check := range slices.Sorted(maps.Keys(unchecked)) {
+		inputs := unchecked[check]
+		if check == "changes" {
+			warnf("could not tell whether %d inputs without revisions changed upstream (%s); flint compares what the server sends with what it saw on an earlier run, which needs the cache",
+				len(inputs), strings.Join(inputs, ", "))
+			continue
+		}
+		if check == "tags" {
+			warnf("%d inputs may be locked to tags of repositories with too many tags to list (%s); newer releases were not checked",
+				len(inputs), strings.Join(inputs, ", "))
+			continue
+		}
+		warnf("the resolver cannot check the %s of %d inputs (%s); the native resolver can check github, gitlab and gitea inputs",
+			check, len(inputs), strings.Join(inputs, ", "))
+	}
+}
+
+func readFlakeLock(path string) (flake.FlakeLock, error) {
+	var flakeLock flake.FlakeLock
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return flakeLock, fmt.Errorf("error reading flake.lock: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &flakeLock); err != nil {
+		return flakeLock, fmt.Errorf("error decoding flake.lock: %w", err)
+	}
+
+	return flakeLock, nil
+}
+
+func readFlakeNix(path string) (*flakenix.File, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading flake.nix: %w", err)
+	}
+
+	file, err := flakenix.Parse(path, src)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing flake.nix: %w", err)
+	}
+
+	return file, nil
+}
+
+// Parses flake.nix when it exists so that findings can point at the lines to
+// change. Reports are still useful without it, so failures are only mentioned
+// in verbose mode.
+func optionalFlakeNix() *flakenix.File {
+	file, err := readFlakeNix(resolveFlakePath())
+	if err != nil {
+		if verbose && !quiet {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		return nil
+	}
+	return file
+}
+
 func Execute() {
 	if Version != "" {
 		rootCmd.Version = Version
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/spf13/cobra"
+	config "notashelf.dev/flint/internal/config"
+	flake "notashelf.dev/flint/internal/flake"
+	flakenix "notashelf.dev/flint/internal/flakenix"
+	output "notashelf.dev/flint/internal/output"
+)
+
+var (
+	dryRun              bool
+	updateFormat        string
+	failOnNewDuplicates bool
+)
+
+func init() {
+	updateCmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "show what would be updated without running anything")
+	updateCmd.Flags().StringVarP(&updateFormat, "output", "o", "pretty", "output format: plain, pretty, json, github, or gitlab")
+	updateCmd.Flags().BoolVar(&failOnNewDuplicates, "fail-on-new-duplicates", false, "exit with error if the update introduces duplicate inputs")
+	addUpdateFlags(updateCmd)
+
+	rootCmd.AddCommand(updateCmd)
+}
+
+var updateCmd = &cobra.Command{
+	Use:   "update [input or group...]",
+	Short: "Apply available updates and report what changed in the lockfile",
+	Long: `Check inputs for updates like --check-updates, then run 'nix flake update'
+for exactly the inputs that have one, and compare the new lockfile with the old.
+The report lists every input that changed, including transitive ones, and any
+repository the update left locked at more than one version.
+
+Pass input names or update group names to limit the update to them. Naming
+one input of a group updates the whole group. Ignored inputs and inputs still
+cooling down are never updated.
+
+The command can be changed with "updateCommand" in the config file; the input
+names are appended to it. Pass --dry-run to see what would be updated first.
+The dry run reads the flake.lock each input has upstream at its latest
+revision, when the resolver can, to predict the duplicates the update would
+introduce.`,
+	Example: `  flint update --dry-run
+  flint update nixpkgs home-manager
+  flint update nixpkgs-family --output=json`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Fail before anything changes rather than after
+		if err := output.ValidateOutputFormat(updateFormat); err != nil {
+			return err
+		}
+
+		flakeLock, err := readFlakeLock(lockPath)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		store, err := openCache()
+		if err != nil {
+			return err
+		}
+
+		resolver, err := newResolver(cfg, store)
+		if err != nil {
+			return err
+		}
+
+		opts, err := updateOptions(resolver, cfg)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := updateContext(cmd.Context())
+		defer cancel()
+
+		results, err := flake.CheckUpdatesWith(ctx, flakeLock, opts)
+		if err != nil {
+			return fmt.Errorf("error checking updates: %w", err)
+		}
+		printCacheStats(store)
+
+		if results.Incomplete {
+			return fmt.Errorf("update check interrupted; nothing was updated")
+		}
+
+		selected, skipped, err := flake.SelectUpdates(results, args)
+		if err != nil {
+			return err
+		}
+		for _, skip := range skipped {
+			warnf("not updating %s: %s", skip.InputName, skip.Reason)
+		}
+
+		var command []string
+		if len(selected) > 0 {
+			command = append(updateCommand(cfg), flake.UpdateInputNames(selected)...)
+		}
+
+		diff := flake.LockDiff{DryRun: dryRun}
+		updated := flakeLock
+		switch {
+		case len(selected) == 0:
+		case dryRun:
+			predicted, failures := flake.PreviewUpdates(ctx, flakeLock, selected, opts)
+			for _, name := range slices.Sorted(maps.Keys(failures)) {
+				warnf("cannot preview the inputs %s pulls in: %v", name, failures[name])
+			}
+
+			updated = predicted
+			diff = flake.DiffLocks(flakeLock, predicted)
+			diff.DryRun = true
+		default:
+			// Keep stdout for the report
+			runner := &flake.ExecRunner{Stdout: os.Stderr, Stderr: os.Stderr, Verbose: verbose && !quiet}
+			if err := runner.Run(ctx, filepath.Dir(lockPath), command); err != nil {
+				return fmt.Errorf("error updating inputs: %w", err)
+			}
+
+			if updated, err = readFlakeLock(lockPath); err != nil {
+				return err
+			}
+			diff = flake.DiffLocks(flakeLock, updated)
+		}
+		diff.Command = command
+
+		options := output.Options{
+			OutputFormat: updateFormat,
+			Verbose:      verbose,
+			Quiet:        quiet,
+			LockPath:     lockPath,
+		}
+		if file := optionalFlakeNix(); file != nil {
+			options.Locations = flakenix.NodeLocations(file, updated)
+		}
+
+		if err := output.PrintLockDiff(diff, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if failOnNewDuplicates && len(diff.NewDuplicates) > 0 {
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+// Returns the command that updates inputs, without the input names.
+func updateCommand(cfg config.Config) []string {
+	if len(cfg.UpdateCommand) > 0 {
+		return slices.Clone(cfg.UpdateCommand)
+	}
+
+	binary := "nix"
+	if cfg.NixBinary != "" {
+		binary = cfg.NixBinary
+	}
+	if nixBinary != "" {
+		binary = nixBinary
+	}
+	return []string{binary, "--extra-experimental-features", "nix-command flakes", "flake", "update"}
+}
@@ -0,0 +1,328 @@
+package advisory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	config "notashelf.dev/flint/internal/config"
+	flake "notashelf.dev/flint/internal/flake"
+)
+
+// How bad an advisory is, from low to critical.
+type Severity string
+
+const (
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+)
+
+var severities = []Severity{SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical}
+
+// A known problem with some revisions of a repository, such as a compromised
+// commit or a vulnerable release.
+type Advisory struct {
+	// A stable identifier, used as the rule of findings, e.g. "FLINT-2025-001"
+	// or a CVE or GHSA identifier
+	ID string `json:"id"`
+
+	// The affected repository as a flake reference, e.g. "github:owner/repo";
+	// refs and revisions in it are ignored
+	Repository string `json:"repository"`
+
+	Severity    Severity `json:"severity"`
+	Summary     string   `json:"summary"`
+	Description string   `json:"description,omitempty"`
+
+	// A page with more information
+	URL string `json:"url,omitempty"`
+
+	// What is affected: locked revisions, releases the input is locked to,
+	// and ranges of commit dates. A locked input matching any of them is
+	// affected.
+	Revs     []string       `json:"revs,omitempty"`
+	Versions []VersionRange `json:"versions,omitempty"`
+	Dates    []DateRange    `json:"dates,omitempty"`
+
+	identity string
+	versions [][2]*flake.Version
+	dates    [][2]time.Time
+}
+
+// Releases from Introduced up to but not including Fixed. Either end may be
+// left open.
+type VersionRange struct {
+	Introduced string `json:"introduced,omitempty"`
+	Fixed      string `json:"fixed,omitempty"`
+}
+
+// Commit dates from From up to but not including Until, as YYYY-MM-DD or RFC
+// 3339 timestamps. Either end may be left open.
+type DateRange struct {
+	From  string `json:"from,omitempty"`
+	Until string `json:"until,omitempty"`
+}
+
+// The shortest revision prefix an advisory may list.
+const minRevLength = 7
+
+// Checks an advisory and parses its ranges.
+func (a *Advisory) prepare() error {
+	if a.ID == "" {
+		return fmt.Errorf("advisory without an id")
+	}
+	if a.Summary == "" {
+		return fmt.Errorf("advisory %s: summary is required", a.ID)
+	}
+	if !slices.Contains(severities, a.Severity) {
+		return fmt.Errorf("advisory %s: invalid severity '%s'. Valid severities are: low, medium, high, critical", a.ID, a.Severity)
+	}
+
+	identity, err := flake.RefIdentity(a.Repository)
+	if err != nil {
+		return fmt.Errorf("advisory %s: invalid repository: %w", a.ID, err)
+	}
+	a.identity = identityKey(identity)
+
+	if len(a.Revs) == 0 && len(a.Versions) == 0 && len(a.Dates) == 0 {
+		return fmt.Errorf("advisory %s: affects nothing; list revs, versions or dates", a.ID)
+	}
+	for _, rev := range a.Revs {
+		if len(rev) < minRevLength {
+			return fmt.Errorf("advisory %s: revision %q is too short", a.ID, rev)
+		}
+	}
+
+	a.versions = nil
+	for _, r := range a.Versions {
+		var bounds [2]*flake.Version
+		for i, tag := range []string{r.Introduced, r.Fixed} {
+			if tag == "" {
+				continue
+			}
+			version, ok := flake.ParseVersion(tag)
+			if !ok {
+				return fmt.Errorf("advisory %s: %q is not a version", a.ID, tag)
+			}
+			bounds[i] = &version
+		}
+		if bounds[0] == nil && bounds[1] == nil {
+			return fmt.Errorf("advisory %s: version range without bounds", a.ID)
+		}
+		a.versions = append(a.versions, bounds)
+	}
+
+	a.dates = nil
+	for _, r := range a.Dates {
+		var bounds [2]time.Time
+		for i, value := range []string{r.From, r.Until} {
+			if value == "" {
+				continue
+			}
+			date, err := config.ParseDate(value)
+			if err != nil {
+				return fmt.Errorf("advisory %s: %w", a.ID, err)
+			}
+			bounds[i] = date
+		}
+		if bounds[0].IsZero() && bounds[1].IsZero() {
+			return fmt.Errorf("advisory %s: date range without bounds", a.ID)
+		}
+		a.dates = append(a.dates, bounds)
+	}
+	return nil
+}
+
+// Reads advisories from a JSON file, or from every JSON file in a directory.
+// A file holds either a single advisory or an object listing them under
+// "advisories". Unknown keys are rejected so that typos do not go unnoticed.
+func Load(path string) ([]Advisory, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading advisories: %w", err)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("error reading advisories: %w", err)
+		}
+		sort.Strings(files)
+	}
+
+	var advisories []Advisory
+	seen := make(map[string]string)
+	for _, file := range files {
+		loaded, err := loadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, advisory := range loaded {
+			if other, ok := seen[advisory.ID]; ok {
+				return nil, fmt.Errorf("advisory %s is defined in both %s and %s", advisory.ID, other, file)
+			}
+			seen[advisory.ID] = file
+			advisories = append(advisories, advisory)
+		}
+	}
+	return advisories, nil
+}
+
+func loadFile(path string) ([]Advisory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading advisories: %w", err)
+	}
+
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("error decoding advisories %s: %w", path, err)
+	}
+
+	var file struct {
+		Advisories []Advisory `json:"advisories"`
+	}
+	target := any(&file)
+	if _, ok := probe["advisories"]; !ok {
+		file.Advisories = make([]Advisory, 1)
+		target = &file.Advisories[0]
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return nil, fmt.Errorf("error decoding advisories %s: %w", path, err)
+	}
+
+	for i := range file.Advisories {
+		if err := file.Advisories[i].prepare(); err != nil {
+			return nil, fmt.Errorf("error in %s: %w", path, err)
+		}
+	}
+	return file.Advisories, nil
+}
+
+// A locked node affected by an advisory.
+type Match struct {
+	Advisory Advisory
+
+	// The lock node and the shortest input path to it from the root flake,
+	// empty for nodes nothing refers to anymore
+	Node string
+	Path []string
+
+	// What the node is locked to, and which part of the advisory it matched,
+	// e.g. "revision 0123456", "release v1.2.3" or "commit date 2025-01-02"
+	Rev    string
+	Reason string
+}
+
+// Checks every locked node in a lockfile against the advisories. Matches are
+// sorted by input path, then by advisory.
+func Check(flakeLock flake.FlakeLock, advisories []Advisory) []Match {
+	paths := flake.InputPaths(flakeLock)
+	root := flake.RootName(flakeLock)
+
+	var matches []Match
+	for name, node := range flakeLock.Nodes {
+		if name == root || node.Locked == nil {
+			continue
+		}
+
+		identity := identityKey(flake.LockedIdentity(node.Locked))
+		for _, advisory := range advisories {
+			if identity == "" || identity != advisory.identity {
+				continue
+			}
+			if reason, ok := advisory.affects(node); ok {
+				matches = append(matches, Match{
+					Advisory: advisory,
+					Node:     name,
+					Path:     paths[name],
+					Rev:      node.Locked.Rev,
+					Reason:   reason,
+				})
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := strings.Join(matches[i].Path, "/"), strings.Join(matches[j].Path, "/")
+		if a != b {
+			return a < b
+		}
+		if matches[i].Node != matches[j].Node {
+			return matches[i].Node < matches[j].Node
+		}
+		return matches[i].Advisory.ID < matches[j].Advisory.ID
+	})
+	return matches
+}
+
+// Normalizes a repository identity so that spellings of the same repository
+// compare equal, e.g. "git:https://host/Owner/repo.git/" and
+// "git:https://host/owner/repo".
+func identityKey(identity string) string {
+	identity = strings.ToLower(strings.TrimSuffix(identity, "/"))
+	return strings.TrimSuffix(identity, ".git")
+}
+
+// Reports whether a locked node is affected, and why.
+func (a Advisory) affects(node flake.Node) (string, bool) {
+	locked := node.Locked
+
+	for _, rev := range a.Revs {
+		if locked.Rev != "" && strings.HasPrefix(locked.Rev, strings.ToLower(rev)) {
+			return "revision " + shortRev(locked.Rev), true
+		}
+	}
+
+	// Releases are only known for inputs declared with a tag
+	if node.Original != nil {
+		if version, ok := flake.ParseVersion(node.Original.Ref); ok {
+			for _, bounds := range a.versions {
+				if inVersionRange(version, bounds) {
+					return "release " + version.String(), true
+				}
+			}
+		}
+	}
+
+	if locked.LastModified > 0 {
+		date := time.Unix(locked.LastModified, 0).UTC()
+		for _, bounds := range a.dates {
+			if (bounds[0].IsZero() || !date.Before(bounds[0])) && (bounds[1].IsZero() || date.Before(bounds[1])) {
+				return "commit date " + date.Format(time.DateOnly), true
+			}
+		}
+	}
+	return "", false
+}
+
+// Reports whether a version lies within a range. Versions with a different
+// prefix than the bounds are never in range.
+func inVersionRange(version flake.Version, bounds [2]*flake.Version) bool {
+	if introduced := bounds[0]; introduced != nil && (introduced.Prefix != version.Prefix || version.Compare(*introduced) < 0) {
+		return false
+	}
+	if fixed := bounds[1]; fixed != nil && (fixed.Prefix != version.Prefix || version.Compare(*fixed) >= 0) {
+		return false
+	}
+	return true
+}
+
+func shortRev(rev string) string {
+	if len(rev) > minRevLength {
+		return rev[:minRevLength]
+	}
+	return rev
+}
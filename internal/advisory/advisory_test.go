@@ -0,0 +1,130 @@
+package advisory
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	flake "notashelf.dev/flint/internal/flake"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "b.json"), `{"advisories": [
+		{"id": "B-1", "repository": "github:owner/tool", "severity": "high", "summary": "Bad release", "versions": [{"introduced": "v1.2.0", "fixed": "v1.2.3"}]},
+		{"id": "B-2", "repository": "git+https://example.com/tool.git", "severity": "low", "summary": "Bad week", "dates": [{"from": "2025-01-01"}]}
+	]}`)
+	writeFile(t, filepath.Join(dir, "a.json"), `{"id": "A-1", "repository": "github:owner/tool", "severity": "critical", "summary": "Compromised", "revs": ["0123456789"]}`)
+	writeFile(t, filepath.Join(dir, "notes.txt"), "not an advisory")
+
+	advisories, err := Load(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var ids []string
+	for _, a := range advisories {
+		ids = append(ids, a.ID)
+	}
+	if strings.Join(ids, ",") != "A-1,B-1,B-2" {
+		t.Errorf("expected advisories from every JSON file in order, got %v", ids)
+	}
+
+	single, err := Load(filepath.Join(dir, "a.json"))
+	if err != nil || len(single) != 1 {
+		t.Errorf("expected a single advisory, got %v, %v", single, err)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"unknown key", `{"id": "X", "repository": "github:o/r", "severity": "low", "summary": "s", "revs": ["0123456"], "rev": "x"}`, "unknown field"},
+		{"severity", `{"id": "X", "repository": "github:o/r", "severity": "bad", "summary": "s", "revs": ["0123456"]}`, "invalid severity"},
+		{"repository", `{"id": "X", "repository": "nixpkgs", "severity": "low", "summary": "s", "revs": ["0123456"]}`, "invalid repository"},
+		{"nothing affected", `{"id": "X", "repository": "github:o/r", "severity": "low", "summary": "s"}`, "affects nothing"},
+		{"short rev", `{"id": "X", "repository": "github:o/r", "severity": "low", "summary": "s", "revs": ["012"]}`, "too short"},
+		{"version", `{"id": "X", "repository": "github:o/r", "severity": "low", "summary": "s", "versions": [{"fixed": "latest"}]}`, "not a version"},
+		{"date", `{"id": "X", "repository": "github:o/r", "severity": "low", "summary": "s", "dates": [{"from": "yesterday"}]}`, "yesterday"},
+		{"duplicate", `{"advisories": [
+			{"id": "X", "repository": "github:o/r", "severity": "low", "summary": "s", "revs": ["0123456"]},
+			{"id": "X", "repository": "github:o/r", "severity": "low", "summary": "s", "revs": ["0123456"]}
+		]}`, "defined in both"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "advisories.json")
+			writeFile(t, path, tc.content)
+
+			_, err := Load(path)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected an error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	lock := flake.FlakeLock{
+		Root: "root",
+		Nodes: map[string]flake.Node{
+			"root": {Inputs: map[string]any{"tool": "tool", "home-manager": "home-manager", "mirror": "mirror"}},
+			"tool": {
+				Locked:   &flake.Locked{Type: "github", Owner: "Owner", Repo: "tool", Rev: "0123456789abcdef", LastModified: 1735776000},
+				Original: &flake.Original{Type: "github", Owner: "Owner", Repo: "tool", Ref: "v1.2.1"},
+			},
+			"home-manager": {
+				Inputs: map[string]any{"tool": "tool_2"},
+				Locked: &flake.Locked{Type: "github", Owner: "nix-community", Repo: "home-manager", Rev: "fedcba9876543210"},
+			},
+			"tool_2": {
+				Locked:   &flake.Locked{Type: "github", Owner: "owner", Repo: "tool", Rev: "aaaaaaaaaaaaaaaa", LastModified: 1704067200},
+				Original: &flake.Original{Type: "github", Owner: "owner", Repo: "tool", Ref: "v1.2.3"},
+			},
+			"mirror": {
+				Locked: &flake.Locked{Type: "git", URL: "https://example.com/Tool.git", Rev: "bbbbbbbbbbbbbbbb", LastModified: 1735776000},
+			},
+		},
+	}
+
+	advisories := []Advisory{
+		{ID: "REV", Repository: "github:owner/tool", Severity: SeverityCritical, Summary: "s", Revs: []string{"0123456", "AAAAAAA"}},
+		{ID: "VERSION", Repository: "github:owner/tool/main", Severity: SeverityHigh, Summary: "s", Versions: []VersionRange{{Introduced: "v1.2.0", Fixed: "v1.2.3"}}},
+		{ID: "DATE", Repository: "git+https://example.com/tool", Severity: SeverityLow, Summary: "s", Dates: []DateRange{{From: "2025-01-01", Until: "2025-02-01"}}},
+		{ID: "OTHER", Repository: "github:other/tool", Severity: SeverityLow, Summary: "s", Revs: []string{"0123456"}},
+	}
+	for i := range advisories {
+		if err := advisories[i].prepare(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	matches := Check(lock, advisories)
+
+	// Transitive inputs are checked too, and tool_2 has the fixed release
+	expected := []string{
+		"home-manager/tool REV revision aaaaaaa",
+		"mirror DATE commit date 2025-01-02",
+		"tool REV revision 0123456",
+		"tool VERSION release v1.2.1",
+	}
+	var got []string
+	for _, match := range matches {
+		got = append(got, strings.Join(match.Path, "/")+" "+match.Advisory.ID+" "+match.Reason)
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected matches:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
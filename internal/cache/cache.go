@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Returns the default cache directory, $XDG_CACHE_HOME/flint on Linux.
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding cache directory: %w", err)
+	}
+	return filepath.Join(dir, "flint"), nil
+}
+
+// A directory of JSON entries addressed by arbitrary string keys. Stores are
+// safe for concurrent use; concurrent writers of the same key race, but
+// entries are replaced atomically so readers never see partial writes.
+type Store struct {
+	Dir string
+
+	hits, misses, expired, revalidated, writes atomic.Int64
+}
+
+// What happened to cache lookups, for verbose output.
+type Stats struct {
+	Hits        int64
+	Misses      int64
+	Expired     int64
+	Revalidated int64
+	Writes      int64
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d hits, %d misses, %d expired, %d revalidated, %d written",
+		s.Hits, s.Misses, s.Expired, s.Revalidated, s.Writes)
+}
+
+// Opens the store in dir, creating it if needed.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating cache directory: %w", err)
+	}
+	return &Store{Dir: dir}, nil
+}
+
+type entry struct {
+	Key      string          `json:"key"`
+	StoredAt time.Time       `json:"storedAt"`
+	Value    json.RawMessage `json:"value"`
+}
+
+func (s *Store) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(s.Dir, name[:2], name+".json")
+}
+
+// Reads the entry stored under key into v, returning when it was stored.
+// Missing and unreadable entries are reported as not found.
+func (s *Store) Get(key string, v any) (time.Time, bool) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil || e.Key != key {
+		return time.Time{}, false
+	}
+	if err := json.Unmarshal(e.Value, v); err != nil {
+		return time.Time{}, false
+	}
+	return e.StoredAt, true
+}
+
+// Stores v under key.
+func (s *Store) Put(key string, v any) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error encoding cache entry: %w", err)
+	}
+
+	data, err := json.Marshal(entry{Key: key, StoredAt: time.Now(), Value: value})
+	if err != nil {
+		return fmt.Errorf("error encoding cache entry: %w", err)
+	}
+
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("error writing cache entry: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".entry-*")
+	if err != nil {
+		return fmt.Errorf("error writing cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing cache entry: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing cache entry: %w", err)
+	}
+
+	s.writes.Add(1)
+	return nil
+}
+
+// Records a lookup that was answered from the cache.
+func (s *Store) Hit() { s.hits.Add(1) }
+
+// Records a lookup that found nothing in the cache.
+func (s *Store) Miss() { s.misses.Add(1) }
+
+// Records a lookup that found an entry too old to use.
+func (s *Store) Expire() { s.expired.Add(1) }
+
+// Records a conditional request that confirmed a cached response.
+func (s *Store) Revalidate() { s.revalidated.Add(1) }
+
+func (s *Store) Stats() Stats {
+	return Stats{
+		Hits:        s.hits.Load(),
+		Misses:      s.misses.Load(),
+		Expired:     s.expired.Load(),
+		Revalidated: s.revalidated.Load(),
+		Writes:      s.writes.Load(),
+	}
+}
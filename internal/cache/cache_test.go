@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var value string
+	if _, found := store.Get("missing", &value); found {
+		t.Fatal("found an entry that was never stored")
+	}
+
+	before := time.Now()
+	if err := store.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	storedAt, found := store.Get("key", &value)
+	if !found || value != "value" {
+		t.Fatalf("Get() = %q, %v; want \"value\", true", value, found)
+	}
+	if storedAt.Before(before) {
+		t.Errorf("storedAt = %v, want after %v", storedAt, before)
+	}
+
+	if got := store.Stats().Writes; got != 1 {
+		t.Errorf("Writes = %d, want 1", got)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	requests := 0
+	conditional := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"sha":"abc"}`)
+	}))
+	defer server.Close()
+
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &Transport{Store: store}}
+
+	for i := range 2 {
+		resp, err := client.Get(server.URL + "/commits/main")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK || string(body) != `{"sha":"abc"}` {
+			t.Errorf("request %d: got %d %q", i, resp.StatusCode, body)
+		}
+		if got := resp.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("request %d: Content-Type = %q", i, got)
+		}
+	}
+
+	if requests != 2 || conditional != 1 {
+		t.Errorf("got %d requests, %d conditional; want 2, 1", requests, conditional)
+	}
+	if got := store.Stats().Revalidated; got != 1 {
+		t.Errorf("Revalidated = %d, want 1", got)
+	}
+}
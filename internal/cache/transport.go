@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// An http.RoundTripper that makes GET and HEAD requests conditional on the
+// ETag of the last successful response, and replays that response when the
+// server answers 304 Not Modified. Forges typically do not count such
+// requests against rate limits.
+type Transport struct {
+	Base  http.RoundTripper
+	Store *Store
+}
+
+type cachedResponse struct {
+	ETag        string              `json:"etag"`
+	ContentType string              `json:"contentType,omitempty"`
+	Header      map[string][]string `json:"header,omitempty"`
+	Body        []byte              `json:"body"`
+}
+
+// Headers that describe a resource rather than a response, replayed along
+// with cached bodies.
+var cachedHeaders = []string{"Last-Modified", "Link"}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// Keys responses by URL and the headers that change their content, hashing
+// credentials so that they are not written to disk.
+func responseKey(req *http.Request) string {
+	key := "http\x00" + req.Method + "\x00" + req.URL.String() + "\x00" + req.Header.Get("Accept") + "\x00" + req.Header.Get("Git-Protocol")
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		key += "\x00" + hex.EncodeToString(sum[:])
+	}
+	return key
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if (req.Method != http.MethodGet && req.Method != http.MethodHead) || t.Store == nil {
+		return t.base().RoundTrip(req)
+	}
+
+	key := responseKey(req)
+	var cached cachedResponse
+	_, found := t.Store.Get(key, &cached)
+
+	if found && cached.ETag != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	resp, err := t.base().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && found {
+		resp.Body.Close()
+		t.Store.Revalidate()
+
+		header := resp.Header.Clone()
+		header.Set("Content-Type", cached.ContentType)
+		for name, values := range cached.Header {
+			header[name] = values
+		}
+		header.Set("Content-Length", strconv.Itoa(len(cached.Body)))
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(cached.Body)),
+			ContentLength: int64(len(cached.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// Failing to cache a response is not worth failing the request over
+	cached = cachedResponse{ETag: etag, ContentType: resp.Header.Get("Content-Type"), Body: body}
+	for _, name := range cachedHeaders {
+		if values := resp.Header.Values(name); len(values) > 0 {
+			if cached.Header == nil {
+				cached.Header = make(map[string][]string)
+			}
+			cached.Header[name] = values
+		}
+	}
+	_ = t.Store.Put(key, cached)
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
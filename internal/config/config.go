@@ -0,0 +1,168 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The name of the per-project configuration file, looked up next to the
+// lockfile.
+const ProjectFile = ".flint.json"
+
+// Flint's configuration. Every field is optional; command line flags take
+// precedence over the values set here.
+type Config struct {
+	// The resolver used to look up the latest revision of inputs
+	Resolver string `json:"resolver,omitempty"`
+
+	// Path to the nix binary used by the nix resolvers
+	NixBinary string `json:"nixBinary,omitempty"`
+
+	// The command 'flint update' runs to update inputs, with their names
+	// appended. Defaults to `nix flake update` using NixBinary.
+	UpdateCommand []string `json:"updateCommand,omitempty"`
+
+	// Maps self-hosted forges to the software they run (github, gitlab,
+	// gitea or sourcehut), for the forge resolver
+	ForgeHosts map[string]string `json:"forgeHosts,omitempty"`
+
+	// Look up GitHub inputs in batches through the GraphQL API, which needs
+	// a token, instead of one REST request per input
+	GitHubGraphQL bool `json:"githubGraphQL,omitempty"`
+
+	// Rules sending inputs elsewhere to be checked, such as to a mirror
+	Rewrites []RewriteConfig `json:"rewrites,omitempty"`
+
+	// Per-input settings, keyed by input path such as "nixpkgs" or
+	// "home-manager/nixpkgs"
+	Inputs map[string]InputConfig `json:"inputs,omitempty"`
+
+	// Rules deciding which upstream changes are reported as updates
+	Updates UpdatesConfig `json:"updates,omitzero"`
+}
+
+// A rule rewriting flake references that start with InsteadOf to start with
+// URL instead, like git's url.<base>.insteadOf.
+type RewriteConfig struct {
+	URL       string `json:"url"`
+	InsteadOf string `json:"insteadOf"`
+
+	// Also treats inputs locked from URL as the same source as those locked
+	// from InsteadOf when looking for duplicates
+	Identity bool `json:"identity,omitempty"`
+}
+
+// Settings for a single input.
+type InputConfig struct {
+	// The largest release change suggested for an input locked to a tag:
+	// patch, minor or major (the default)
+	MaxBump string `json:"maxBump,omitempty"`
+
+	// Overrides the cooldown in UpdatesConfig for this input
+	Cooldown string `json:"cooldown,omitempty"`
+
+	// Stops the input from being checked, until the given date if any, for
+	// the given reason
+	Ignore bool   `json:"ignore,omitempty"`
+	Until  string `json:"until,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Settings for update checks as a whole.
+type UpdatesConfig struct {
+	// How old an upstream commit must be before it counts as an update, as a
+	// duration such as "72h" or "3d"
+	Cooldown string `json:"cooldown,omitempty"`
+
+	// Named groups of inputs that are reported and updated together
+	Groups map[string][]string `json:"groups,omitempty"`
+}
+
+// Parses a duration as time.ParseDuration does, also accepting whole days
+// ("3d") and weeks ("2w").
+func ParseDuration(value string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if number, ok := strings.CutSuffix(value, suffix); ok {
+			n, err := strconv.Atoi(number)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return duration, nil
+}
+
+// Parses a date such as "2025-06-30", meaning its start in UTC, or an RFC 3339
+// timestamp.
+func ParseDate(value string) (time.Time, error) {
+	if date, err := time.Parse(time.DateOnly, value); err == nil {
+		return date, nil
+	}
+	date, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: expected YYYY-MM-DD or an RFC 3339 timestamp", value)
+	}
+	return date, nil
+}
+
+// Reads a configuration file. Unknown keys are rejected so that typos do not
+// go unnoticed.
+func Load(path string) (Config, error) {
+	var config Config
+
+	file, err := os.Open(path)
+	if err != nil {
+		return config, fmt.Errorf("error reading config: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("error decoding config %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// Returns the paths searched for a configuration file when none is given
+// explicitly, in order of precedence: the project file next to the lockfile,
+// then the user's config.json.
+func SearchPaths(lockPath string) []string {
+	paths := []string{filepath.Join(filepath.Dir(lockPath), ProjectFile)}
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "flint", "config.json"))
+	}
+	return paths
+}
+
+// Loads the configuration at path, or the first one found in the search
+// paths when path is empty. Having no configuration at all is not an error.
+func Find(path, lockPath string) (Config, error) {
+	if path != "" {
+		return Load(path)
+	}
+
+	for _, candidate := range SearchPaths(lockPath) {
+		config, err := Load(candidate)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return config, err
+	}
+
+	return Config{}, nil
+}
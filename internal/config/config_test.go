@@ -0,0 +1,102 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("HOME", home)
+
+	lockPath := filepath.Join(dir, "flake.lock")
+
+	// Nothing to load
+	config, err := Find("", lockPath)
+	if err != nil || config.Resolver != "" || config.NixBinary != "" {
+		t.Fatalf("expected an empty config, got %+v (%v)", config, err)
+	}
+
+	// The user config is used when the project has none
+	writeFile(t, filepath.Join(home, "flint", "config.json"), `{"resolver": "nix-legacy"}`)
+	config, err = Find("", lockPath)
+	if err != nil || config.Resolver != "nix-legacy" {
+		t.Fatalf("expected the user config, got %+v (%v)", config, err)
+	}
+
+	// The project config takes precedence
+	writeFile(t, filepath.Join(dir, ProjectFile), `{"resolver": "nix", "nixBinary": "/run/current-system/sw/bin/nix"}`)
+	config, err = Find("", lockPath)
+	if err != nil || config.Resolver != "nix" || config.NixBinary != "/run/current-system/sw/bin/nix" {
+		t.Fatalf("expected the project config, got %+v (%v)", config, err)
+	}
+
+	// An explicit path must exist
+	if _, err := Find(filepath.Join(dir, "missing.json"), lockPath); err == nil {
+		t.Error("expected an error for a missing explicit config")
+	}
+}
+
+func TestLoad_UnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeFile(t, path, `{"resolvr": "nix"}`)
+
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "resolvr") {
+		t.Errorf("expected an error naming the unknown field, got %v", err)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected time.Duration
+		err      bool
+	}{
+		{value: "72h", expected: 72 * time.Hour},
+		{value: "3d", expected: 72 * time.Hour},
+		{value: "2w", expected: 14 * 24 * time.Hour},
+		{value: "0", expected: 0},
+		{value: "-1d", err: true},
+		{value: "-5m", err: true},
+		{value: "soon", err: true},
+	}
+
+	for _, tc := range testCases {
+		duration, err := ParseDuration(tc.value)
+		if tc.err != (err != nil) || duration != tc.expected {
+			t.Errorf("ParseDuration(%q): expected %s (error %v), got %s (%v)", tc.value, tc.expected, tc.err, duration, err)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	date, err := ParseDate("2025-06-30")
+	if err != nil || !date.Equal(time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the start of the day in UTC, got %s (%v)", date, err)
+	}
+
+	date, err = ParseDate("2025-06-30T12:00:00+02:00")
+	if err != nil || !date.Equal(time.Date(2025, 6, 30, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the timestamp, got %s (%v)", date, err)
+	}
+
+	if _, err := ParseDate("30/06/2025"); err == nil {
+		t.Error("expected an error for an unsupported date format")
+	}
+}
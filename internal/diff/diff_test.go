@@ -0,0 +1,91 @@
+package diff
+
+import (
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	testCases := []struct {
+		name     string
+		old      string
+		new      string
+		expected string
+	}{
+		{
+			name:     "identical",
+			old:      "a\nb\n",
+			new:      "a\nb\n",
+			expected: "",
+		},
+		{
+			name: "insertion",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n",
+			new:  "1\n2\n3\n4\nnew\n5\n6\n7\n8\n",
+			expected: `--- a/f
++++ b/f
+@@ -2,6 +2,7 @@
+ 2
+ 3
+ 4
++new
+ 5
+ 6
+ 7
+`,
+		},
+		{
+			name: "replacement",
+			old:  "a\nb\nc\n",
+			new:  "a\nB\nc\n",
+			expected: `--- a/f
++++ b/f
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`,
+		},
+		{
+			name: "separate hunks",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			new:  "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n",
+			expected: `--- a/f
++++ b/f
+@@ -1,3 +1,4 @@
++0
+ 1
+ 2
+ 3
+@@ -10,3 +11,4 @@
+ 10
+ 11
+ 12
++13
+`,
+		},
+		{
+			name: "missing trailing newline",
+			old:  "a",
+			new:  "a\nb",
+			expected: `--- a/f
++++ b/f
+@@ -1 +1,2 @@
+-a
+\ No newline at end of file
++a
++b
+\ No newline at end of file
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := Unified("a/f", "b/f", tc.old, tc.new)
+			if result != tc.expected {
+				t.Errorf("unexpected diff:\n%s\nexpected:\n%s", result, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package flake
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// An update that was asked for but will not be applied, and why.
+type SkippedUpdate struct {
+	InputName string
+	Reason    string
+}
+
+// Picks the updates to apply from the results of an update check: every
+// available update, or only those for the inputs and groups named. Naming one
+// member of a group selects the other members with updates too, so that the
+// group moves together. Inputs whose update was narrowed by a cooldown are
+// skipped, since `nix flake update` would lock the newest commit instead, and
+// so are newer release tags, since it would lock the same tag again. A group
+// with a member skipped for any of these reasons, for its policy or because
+// it could not be checked, is skipped whole rather than moved in part.
+func SelectUpdates(results UpdateResults, names []string) ([]UpdateStatus, []SkippedUpdate, error) {
+	wanted := make(map[string]bool)
+	groups := make(map[string]bool)
+	for _, name := range names {
+		found := false
+		for _, update := range results.Updates {
+			if update.InputName == name {
+				wanted[name] = true
+				found = true
+			}
+			if update.Group == name {
+				groups[name] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("no input or update group named %s", name)
+		}
+	}
+
+	// Pull in the groups of the inputs asked for
+	for _, update := range results.Updates {
+		if wanted[update.InputName] && update.Group != "" {
+			groups[update.Group] = true
+		}
+	}
+
+	// The first member holding back each group, and why
+	held := make(map[string]string)
+	for _, update := range results.Updates {
+		if update.Group == "" || held[update.Group] != "" {
+			continue
+		}
+		if _, hold := skipReason(update); hold != "" {
+			held[update.Group] = fmt.Sprintf("group %s: member %s %s", update.Group, update.InputName, hold)
+		}
+	}
+
+	var selected []UpdateStatus
+	var skipped []SkippedUpdate
+	for _, update := range results.Updates {
+		named := wanted[update.InputName] || groups[update.Group]
+		if len(names) > 0 && !named {
+			continue
+		}
+
+		reason, _ := skipReason(update)
+		switch {
+		case reason != "":
+		case update.IsUpdate && held[update.Group] != "":
+			reason = held[update.Group]
+		case update.IsUpdate:
+			selected = append(selected, update)
+			continue
+		case wanted[update.InputName]:
+			// Up to date inputs are only worth mentioning when named
+			reason = "already up to date"
+		}
+
+		// Without names, only mention inputs that might have been expected to
+		// update; ignored inputs are left alone quietly
+		if reason != "" && (named || update.Error != "" || update.IsUpdate) {
+			skipped = append(skipped, SkippedUpdate{InputName: update.InputName, Reason: reason})
+		}
+	}
+	return selected, skipped, nil
+}
+
+// Returns why an update cannot be applied, if it cannot, and for reasons that
+// hold back the rest of its group, a short form to name them by.
+func skipReason(update UpdateStatus) (reason, hold string) {
+	switch {
+	case update.Error != "":
+		return "could not be checked: " + update.Error, "could not be checked"
+	case update.Pinned:
+		return "pinned to a revision", ""
+	case update.Policy == PolicyIgnored:
+		return "ignored by policy", "ignored by policy"
+	case update.Policy == PolicyCooldown:
+		return "cooling down; nix flake update would lock a commit newer than the cooldown allows", "cooling down"
+	case update.IsUpdate && update.LatestRef != "":
+		return fmt.Sprintf("locked to tag %s; change the ref to %s in flake.nix", update.Ref, update.LatestRef), "locked to tag " + update.Ref
+	}
+	return "", ""
+}
+
+// Returns the input names of updates, as passed to `nix flake update`.
+func UpdateInputNames(updates []UpdateStatus) []string {
+	names := make([]string, 0, len(updates))
+	for _, update := range updates {
+		names = append(names, update.InputName)
+	}
+	return names
+}
+
+// Runs the commands that apply updates, so that they can be replaced in tests
+// or wrapped.
+type CommandRunner interface {
+	Run(ctx context.Context, dir string, command []string) error
+}
+
+// Runs commands as child processes, passing their output through.
+type ExecRunner struct {
+	Stdout  io.Writer
+	Stderr  io.Writer
+	Verbose bool
+}
+
+func (r *ExecRunner) Run(ctx context.Context, dir string, command []string) error {
+	if len(command) == 0 {
+		return fmt.Errorf("no command to run")
+	}
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = dir
+	cmd.Stdout = r.Stdout
+	cmd.Stderr = r.Stderr
+
+	// Don't wait on processes the command spawned once it has been killed
+	cmd.WaitDelay = time.Second
+
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "Running: %s\n", strings.Join(cmd.Args, " "))
+	}
+
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("%s: %w", command[0], ctxErr)
+		}
+		return fmt.Errorf("%s failed: %w", strings.Join(command, " "), err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package flake
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSelectUpdates(t *testing.T) {
+	results := UpdateResults{Updates: []UpdateStatus{
+		{InputName: "nixpkgs", IsUpdate: true, Group: "nixpkgs-family"},
+		{InputName: "home-manager", IsUpdate: true, Group: "nixpkgs-family"},
+		{InputName: "nix-darwin", Group: "nixpkgs-family"},
+		{InputName: "flake-utils", IsUpdate: true},
+		{InputName: "hyprland", Policy: PolicyIgnored},
+		{InputName: "treefmt-nix", IsUpdate: true, Policy: PolicyCooldown},
+		{InputName: "broken", Error: "not found"},
+		{InputName: "agenix"},
+		{InputName: "tool", Ref: "v1.4.2", IsUpdate: true, LatestRef: "v1.5.0"},
+		{InputName: "fenix", IsUpdate: true, Group: "rust"},
+		{InputName: "crane", IsUpdate: true, Group: "rust", Policy: PolicyCooldown},
+	}}
+
+	testCases := []struct {
+		name     string
+		names    []string
+		selected []string
+		skipped  []string
+		err      bool
+	}{
+		{
+			name:     "everything available",
+			selected: []string{"nixpkgs", "home-manager", "flake-utils"},
+			skipped:  []string{"treefmt-nix", "broken", "tool", "fenix", "crane"},
+		},
+		{
+			name:    "held back member holds back the group",
+			names:   []string{"fenix"},
+			skipped: []string{"fenix", "crane"},
+		},
+		{
+			name:     "group member pulls in the group",
+			names:    []string{"nix-darwin"},
+			selected: []string{"nixpkgs", "home-manager"},
+			skipped:  []string{"nix-darwin"},
+		},
+		{
+			name:     "group by name",
+			names:    []string{"nixpkgs-family", "flake-utils"},
+			selected: []string{"nixpkgs", "home-manager", "flake-utils"},
+		},
+		{
+			name:    "held back inputs named explicitly",
+			names:   []string{"agenix", "hyprland", "treefmt-nix", "tool"},
+			skipped: []string{"hyprland", "treefmt-nix", "agenix", "tool"},
+		},
+		{
+			name:  "unknown name",
+			names: []string{"nixpkgs", "bogus"},
+			err:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			selected, skipped, err := SelectUpdates(results, tc.names)
+			if tc.err {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var skippedNames []string
+			for _, skip := range skipped {
+				skippedNames = append(skippedNames, skip.InputName)
+			}
+			if names := UpdateInputNames(selected); !slices.Equal(names, tc.selected) {
+				t.Errorf("expected %v to be selected, got %v", tc.selected, names)
+			}
+			if !slices.Equal(skippedNames, tc.skipped) {
+				t.Errorf("expected %v to be skipped, got %v", tc.skipped, skippedNames)
+			}
+		})
+	}
+}
+
+func TestSelectUpdates_HeldGroup(t *testing.T) {
+	results := UpdateResults{Updates: []UpdateStatus{
+		{InputName: "nixpkgs", IsUpdate: true, Group: "nixpkgs-family"},
+		{InputName: "home-manager", Group: "nixpkgs-family", Error: "rate limited"},
+		{InputName: "flake-utils", IsUpdate: true},
+	}}
+
+	selected, skipped, err := SelectUpdates(results, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if names := UpdateInputNames(selected); !slices.Equal(names, []string{"flake-utils"}) {
+		t.Errorf("expected only flake-utils to be selected, got %v", names)
+	}
+
+	expected := []SkippedUpdate{
+		{InputName: "nixpkgs", Reason: "group nixpkgs-family: member home-manager could not be checked"},
+		{InputName: "home-manager", Reason: "could not be checked: rate limited"},
+	}
+	if !slices.Equal(skipped, expected) {
+		t.Errorf("expected %+v to be skipped, got %+v", expected, skipped)
+	}
+}
+
+func TestDiffLocks(t *testing.T) {
+	before := FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root":    {Inputs: map[string]any{"nixpkgs": "nixpkgs", "hm": "hm", "old": "old"}},
+			"nixpkgs": {Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "a", LastModified: 1}},
+			"hm":      {Inputs: map[string]any{"nixpkgs": []any{"nixpkgs"}}, Locked: &Locked{Type: "github", Owner: "nix-community", Repo: "home-manager", Rev: "b"}},
+			"old":     {Locked: &Locked{Type: "github", Owner: "owner", Repo: "old", Rev: "c"}},
+		},
+	}
+	after := FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root":      {Inputs: map[string]any{"nixpkgs": "nixpkgs", "hm": "hm"}},
+			"nixpkgs":   {Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "d", LastModified: 2}},
+			"hm":        {Inputs: map[string]any{"nixpkgs": "nixpkgs_2"}, Locked: &Locked{Type: "github", Owner: "nix-community", Repo: "home-manager", Rev: "b"}},
+			"nixpkgs_2": {Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "e"}},
+		},
+	}
+
+	diff := DiffLocks(before, after)
+
+	expected := []InputChange{
+		{Input: "hm/nixpkgs", NewURL: "github:NixOS/nixpkgs?rev=e", NewRev: "e"},
+		{Input: "nixpkgs", OldURL: "github:NixOS/nixpkgs?rev=a", NewURL: "github:NixOS/nixpkgs?rev=d", OldRev: "a", NewRev: "d", OldDate: 1, NewDate: 2},
+		{Input: "old", OldURL: "github:owner/old?rev=c", OldRev: "c"},
+	}
+	if !slices.Equal(diff.Changes, expected) {
+		t.Errorf("expected changes %+v, got %+v", expected, diff.Changes)
+	}
+
+	urls := diff.NewDuplicates["github:NixOS/nixpkgs"]
+	if len(diff.NewDuplicates) != 1 || len(urls) != 2 {
+		t.Fatalf("expected nixpkgs to become duplicated, got %v", diff.NewDuplicates)
+	}
+	if dependants := diff.Dependants["github:NixOS/nixpkgs?rev=e"]; !slices.Equal(dependants, []string{"hm"}) {
+		t.Errorf("expected hm to depend on the new copy, got %v", dependants)
+	}
+
+	// Duplicates that were already there are not news
+	if diff := DiffLocks(after, after); len(diff.Changes) != 0 || len(diff.NewDuplicates) != 0 {
+		t.Errorf("expected no changes against itself, got %+v", diff)
+	}
+}
+
+func TestExecRunner_FakeNix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake nix binary is a shell script")
+	}
+
+	dir := t.TempDir()
+	updated := FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root":    {Inputs: map[string]any{"nixpkgs": "nixpkgs"}},
+			"nixpkgs": {Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "new"}},
+		},
+	}
+	data, err := json.Marshal(updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new.lock"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Records its arguments and writes the updated lockfile in its working
+	// directory, like nix flake update
+	nix := filepath.Join(dir, "nix")
+	script := "#!/bin/sh\necho \"$@\" > args\ncp new.lock flake.lock\n"
+	if err := os.WriteFile(nix, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &ExecRunner{}
+	if err := runner.Run(context.Background(), dir, []string{nix, "flake", "update", "nixpkgs"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	if err != nil || strings.TrimSpace(string(args)) != "flake update nixpkgs" {
+		t.Errorf("expected the input names to be passed, got %q (%v)", args, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "flake.lock")); err != nil {
+		t.Errorf("expected the command to run in the flake directory: %v", err)
+	}
+
+	failing := filepath.Join(dir, "failing")
+	if err := os.WriteFile(failing, []byte("#!/bin/sh\nexit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Run(context.Background(), dir, []string{failing}); err == nil {
+		t.Error("expected a failing command to be reported")
+	}
+}
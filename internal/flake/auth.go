@@ -0,0 +1,320 @@
+package flake
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Credentials for a host or a prefix of its repositories.
+type Credential struct {
+	// Sent as a bearer token to forge APIs, and as the password over git
+	Token string
+
+	// Basic auth credentials, as found in ~/.netrc
+	Username, Password string
+
+	// Where the credential was found, e.g. "GITHUB_TOKEN" or "~/.netrc"
+	Source string
+}
+
+// Returns the token to send to forge APIs.
+func (c Credential) token() string {
+	if c.Token != "" {
+		return c.Token
+	}
+	return c.Password
+}
+
+// Returns the username and password to send over basic auth. Forges accept
+// tokens as the password with any username.
+func (c Credential) basicAuth() (string, string) {
+	if c.Token != "" {
+		return "x-access-token", c.Token
+	}
+	return c.Username, c.Password
+}
+
+// The credentials Flint knows about, keyed by host or by a host and path
+// prefix such as "github.com/my-org", like Nix's access-tokens setting.
+type Credentials struct {
+	entries []credentialEntry
+}
+
+type credentialEntry struct {
+	prefix     string
+	credential Credential
+}
+
+// Adds a credential for a host or host and path prefix. Credentials added
+// first take precedence over later ones for the same prefix.
+func (c *Credentials) Add(prefix string, credential Credential) {
+	prefix = strings.ToLower(strings.Trim(prefix, "/"))
+	if prefix == "" {
+		return
+	}
+	c.entries = append(c.entries, credentialEntry{prefix: prefix, credential: credential})
+}
+
+// Returns the credential for a repository on a host, preferring the longest
+// matching prefix.
+func (c *Credentials) Lookup(host, path string) (Credential, bool) {
+	if c == nil {
+		return Credential{}, false
+	}
+
+	target := strings.ToLower(host)
+	if path = strings.Trim(path, "/"); path != "" {
+		target += "/" + path
+	}
+
+	var best *credentialEntry
+	for i, entry := range c.entries {
+		if target != entry.prefix && !strings.HasPrefix(target, entry.prefix+"/") {
+			continue
+		}
+		if best == nil || len(entry.prefix) > len(best.prefix) {
+			best = &c.entries[i]
+		}
+	}
+	if best == nil {
+		return Credential{}, false
+	}
+	return best.credential, true
+}
+
+// Lists the prefixes credentials are known for and where each came from,
+// without the credentials themselves.
+func (c *Credentials) Sources() []string {
+	if c == nil {
+		return nil
+	}
+	var sources []string
+	for _, entry := range c.entries {
+		source := entry.prefix + " (" + entry.credential.Source + ")"
+		if !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// Environment variables holding a token for a well-known forge, in order of
+// precedence.
+var tokenVariables = []struct{ name, host string }{
+	{"GH_TOKEN", "github.com"},
+	{"GITHUB_TOKEN", "github.com"},
+	{"GITLAB_TOKEN", "gitlab.com"},
+	{"CODEBERG_TOKEN", "codeberg.org"},
+}
+
+// Collects credentials from, in order of precedence: FLINT_ACCESS_TOKENS and
+// the forge token variables such as GITHUB_TOKEN, the access-tokens setting
+// of Nix (NIX_CONFIG, then the nix.conf files Nix reads), and ~/.netrc.
+// getenv looks up environment variables; files that cannot be read are
+// skipped.
+func LoadCredentials(getenv func(string) string) *Credentials {
+	credentials := &Credentials{}
+
+	for prefix, token := range parseAccessTokens(getenv("FLINT_ACCESS_TOKENS")) {
+		credentials.Add(prefix, Credential{Token: token, Source: "FLINT_ACCESS_TOKENS"})
+	}
+	for _, variable := range tokenVariables {
+		if token := strings.TrimSpace(getenv(variable.name)); token != "" {
+			credentials.Add(variable.host, Credential{Token: token, Source: variable.name})
+		}
+	}
+
+	tokens, source := nixAccessTokens(getenv)
+	for _, prefix := range slices.Sorted(maps.Keys(tokens)) {
+		credentials.Add(prefix, Credential{Token: tokens[prefix], Source: source[prefix]})
+	}
+
+	netrc := getenv("NETRC")
+	if netrc == "" && getenv("HOME") != "" {
+		netrc = filepath.Join(getenv("HOME"), ".netrc")
+	}
+	if netrc != "" {
+		if data, err := os.ReadFile(netrc); err == nil {
+			for _, machine := range parseNetrc(string(data)) {
+				credentials.Add(machine.host, Credential{Username: machine.login, Password: machine.password, Source: "~/.netrc"})
+			}
+		}
+	}
+
+	return credentials
+}
+
+// Parses the value of Nix's access-tokens setting: whitespace-separated
+// host=token pairs, where the host may be followed by a path prefix. GitLab
+// tokens may carry a "PAT:" or "OAuth2:" type, which is dropped as both kinds
+// work as bearer tokens.
+func parseAccessTokens(value string) map[string]string {
+	tokens := make(map[string]string)
+	for _, field := range strings.Fields(value) {
+		prefix, token, ok := strings.Cut(field, "=")
+		if !ok || prefix == "" || token == "" {
+			continue
+		}
+		if kind, rest, ok := strings.Cut(token, ":"); ok && (kind == "PAT" || kind == "OAuth2") {
+			token = rest
+		}
+		tokens[prefix] = token
+	}
+	return tokens
+}
+
+// Reads the access tokens Nix would use, applying nix.conf files in the order
+// Nix does so that later ones override earlier ones, and NIX_CONFIG last.
+// Returns the tokens and which file each came from.
+func nixAccessTokens(getenv func(string) string) (map[string]string, map[string]string) {
+	settings := nixTokenSettings{tokens: make(map[string]string), source: make(map[string]string)}
+
+	confDir := getenv("NIX_CONF_DIR")
+	if confDir == "" {
+		confDir = "/etc/nix"
+	}
+	settings.readFile(filepath.Join(confDir, "nix.conf"), 0)
+
+	if files := getenv("NIX_USER_CONF_FILES"); files != "" {
+		for _, file := range filepath.SplitList(files) {
+			settings.readFile(file, 0)
+		}
+	} else {
+		dirs := filepath.SplitList(getenv("XDG_CONFIG_DIRS"))
+		if len(dirs) == 0 {
+			dirs = []string{"/etc/xdg"}
+		}
+		home := getenv("XDG_CONFIG_HOME")
+		if home == "" && getenv("HOME") != "" {
+			home = filepath.Join(getenv("HOME"), ".config")
+		}
+		if home != "" {
+			dirs = append([]string{home}, dirs...)
+		}
+
+		// The first directory takes precedence, so it is read last
+		for _, dir := range slices.Backward(dirs) {
+			settings.readFile(filepath.Join(dir, "nix", "nix.conf"), 0)
+		}
+	}
+
+	settings.apply(getenv("NIX_CONFIG"), "NIX_CONFIG", "", 0)
+	return settings.tokens, settings.source
+}
+
+// The access tokens set so far while reading Nix configuration.
+type nixTokenSettings struct {
+	tokens, source map[string]string
+}
+
+// Guards against include cycles.
+const maxNixConfIncludes = 10
+
+func (s *nixTokenSettings) readFile(path string, depth int) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	s.apply(string(data), path, filepath.Dir(path), depth)
+}
+
+// Applies nix.conf lines, following includes relative to dir.
+func (s *nixTokenSettings) apply(conf, source, dir string, depth int) {
+	scanner := bufio.NewScanner(strings.NewReader(conf))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+
+		if include, ok := strings.CutPrefix(line, "include "); ok || strings.HasPrefix(line, "!include ") {
+			if !ok {
+				include = strings.TrimPrefix(line, "!include ")
+			}
+			include = strings.TrimSpace(include)
+			if !filepath.IsAbs(include) {
+				include = filepath.Join(dir, include)
+			}
+			if depth < maxNixConfIncludes {
+				s.readFile(include, depth+1)
+			}
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(name) {
+		case "access-tokens":
+			clear(s.tokens)
+			clear(s.source)
+			fallthrough
+		case "extra-access-tokens":
+			for prefix, token := range parseAccessTokens(value) {
+				s.tokens[prefix] = token
+				s.source[prefix] = fmt.Sprintf("access-tokens in %s", source)
+			}
+		}
+	}
+}
+
+// A machine entry of a netrc file.
+type netrcMachine struct {
+	host, login, password string
+}
+
+// Parses a netrc file. Default entries are ignored, as Flint only sends
+// credentials to hosts they were given for.
+func parseNetrc(data string) []netrcMachine {
+	var machines []netrcMachine
+	var current *netrcMachine
+	inMacro := false
+
+	for line := range strings.Lines(data) {
+		// Macro definitions run until the next empty line
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			var value string
+			if i+1 < len(fields) {
+				value = fields[i+1]
+			}
+
+			switch fields[i] {
+			case "machine":
+				machines = append(machines, netrcMachine{host: value})
+				current = &machines[len(machines)-1]
+				i++
+			case "default":
+				current = nil
+			case "login":
+				if current != nil {
+					current.login = value
+				}
+				i++
+			case "password":
+				if current != nil {
+					current.password = value
+				}
+				i++
+			case "account":
+				i++
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+
+	return slices.DeleteFunc(machines, func(m netrcMachine) bool {
+		return m.host == "" || m.password == ""
+	})
+}
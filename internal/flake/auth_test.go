@@ -0,0 +1,166 @@
+package flake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadCredentials(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// The system configuration includes a secrets file, like NixOS setups
+	// that keep tokens out of the store
+	write("etc/nix/nix.conf", "experimental-features = nix-command flakes\n!include secrets.conf\ninclude missing.conf\n")
+	write("etc/nix/secrets.conf", "access-tokens = github.com=system-gh gitlab.com=PAT:system-gl git.example.com=stale\n")
+	write("home/.config/nix/nix.conf", "# user settings\nextra-access-tokens = github.com/my-org=org-token\n")
+	write("home/.netrc", "machine git.example.com\n  login alice\n  password netrc-secret\nmacdef init\ncd /\n\ndefault login anonymous password guest\n")
+
+	env := map[string]string{
+		"HOME":            filepath.Join(dir, "home"),
+		"NIX_CONF_DIR":    filepath.Join(dir, "etc/nix"),
+		"XDG_CONFIG_DIRS": filepath.Join(dir, "xdg"),
+		"NIX_CONFIG":      "extra-access-tokens = codeberg.org=from-env",
+		"GITLAB_TOKEN":    "env-gl",
+	}
+	credentials := LoadCredentials(func(name string) string { return env[name] })
+
+	testCases := []struct {
+		host, path string
+		token      string
+		username   string
+		source     string
+	}{
+		{host: "github.com", path: "NixOS/nixpkgs", token: "system-gh", source: "access-tokens in " + filepath.Join(dir, "etc/nix/secrets.conf")},
+		{host: "github.com", path: "my-org/private", token: "org-token"},
+		{host: "GitHub.com", path: "my-org-other/repo", token: "system-gh"},
+		{host: "gitlab.com", path: "group/project", token: "env-gl", source: "GITLAB_TOKEN"},
+		{host: "codeberg.org", token: "from-env", source: "access-tokens in NIX_CONFIG"},
+		{host: "git.example.com", token: "stale"},
+		{host: "unknown.example.com"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.host+"/"+tc.path, func(t *testing.T) {
+			credential, ok := credentials.Lookup(tc.host, tc.path)
+			if tc.token == "" {
+				if ok {
+					t.Errorf("expected no credential, got one from %s", credential.Source)
+				}
+				return
+			}
+			if credential.token() != tc.token {
+				t.Errorf("expected token %q, got %q from %s", tc.token, credential.token(), credential.Source)
+			}
+			if tc.source != "" && credential.Source != tc.source {
+				t.Errorf("expected the credential from %q, got %q", tc.source, credential.Source)
+			}
+		})
+	}
+
+	// access-tokens replaces what was set before it
+	env["NIX_CONFIG"] = "access-tokens = codeberg.org=only"
+	credentials = LoadCredentials(func(name string) string { return env[name] })
+	if credential, _ := credentials.Lookup("github.com", "NixOS/nixpkgs"); credential.Token != "" {
+		t.Errorf("expected NIX_CONFIG to replace the access tokens, got %q", credential.Token)
+	}
+	if credential, _ := credentials.Lookup("git.example.com", ""); credential.Username != "alice" || credential.Password != "netrc-secret" {
+		t.Errorf("expected the netrc entry, got %+v", credential)
+	}
+	if sources := credentials.Sources(); !slices.Contains(sources, "git.example.com (~/.netrc)") || strings.Contains(strings.Join(sources, " "), "netrc-secret") {
+		t.Errorf("unexpected sources %v", sources)
+	}
+}
+
+func TestParseNetrc(t *testing.T) {
+	netrc := "machine a.example.com login alice password one\n" +
+		"machine b.example.com\n\tlogin bob\n\taccount ignored\n\tpassword two\n" +
+		"machine nopassword.example.com login carol\n" +
+		"default login anonymous password guest\n"
+
+	expected := []netrcMachine{
+		{host: "a.example.com", login: "alice", password: "one"},
+		{host: "b.example.com", login: "bob", password: "two"},
+	}
+	if machines := parseNetrc(netrc); !slices.Equal(machines, expected) {
+		t.Errorf("expected %+v, got %+v", expected, machines)
+	}
+}
+
+func TestForgeResolver_Credentials(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/repos/owner/private/commits/HEAD":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("X-RateLimit-Remaining", "4999")
+			fmt.Fprint(w, `{"sha": "private-head"}`)
+		case "/repos/owner/limited/commits/HEAD":
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	credentials := &Credentials{}
+	credentials.Add("github.com/owner/private", Credential{Token: "secret", Source: "GITHUB_TOKEN"})
+	resolver := &ForgeResolver{Client: server.Client(), APIBase: map[string]string{"github.com": server.URL}, Credentials: credentials}
+	query := func(repo string) Query {
+		return Query{Locked: &Locked{Type: "github", Owner: "owner", Repo: repo}}
+	}
+
+	resolution, err := resolver.Resolve(context.Background(), query("private"))
+	if err != nil || resolution.Rev != "private-head" {
+		t.Errorf("expected the private repository to resolve with its token, got %+v (%v)", resolution, err)
+	}
+
+	// Repositories without a token get a hint rather than a bare 404
+	_, err = resolver.Resolve(context.Background(), query("other"))
+	if err == nil || !strings.Contains(err.Error(), "set a token for github.com") {
+		t.Errorf("expected a hint about tokens, got %v", err)
+	}
+
+	// An exhausted rate limit is reported, and the host is left alone until
+	// it resets
+	requests.Store(0)
+	for range 2 {
+		_, err = resolver.Resolve(context.Background(), query("limited"))
+		var rateErr *RateLimitError
+		if !errors.As(err, &rateErr) || rateErr.Reset.IsZero() || IsTransient(err) {
+			t.Errorf("expected a lasting rate limit error, got %v", err)
+		}
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected a single request once the limit was exhausted, got %d", requests.Load())
+	}
+	if _, err := resolver.Resolve(context.Background(), query("private")); err == nil {
+		t.Error("expected other repositories on the host to wait for the reset too")
+	}
+}
@@ -0,0 +1,447 @@
+package flake
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// What changed upstream between the locked and latest revisions of an input.
+type Changelog struct {
+	// The newest commits in between, newest first
+	Commits []Commit
+
+	// How many commits there are in between, which is more than len(Commits)
+	// when the list was truncated
+	TotalCommits int
+
+	// For inputs locked to a release tag: the releases up to and including
+	// the latest tag, newest first
+	Releases []Release `json:",omitempty"`
+
+	// Why the releases could not be listed, when they were asked for, so
+	// that the changelog does not pass for complete without them
+	ReleasesError string `json:",omitempty"`
+}
+
+type Commit struct {
+	Rev     string
+	Summary string
+	Author  string `json:",omitempty"`
+	Date    int64  `json:",omitempty"`
+	URL     string `json:",omitempty"`
+}
+
+type Release struct {
+	Tag   string
+	Name  string `json:",omitempty"`
+	Notes string `json:",omitempty"`
+	Date  int64  `json:",omitempty"`
+	URL   string `json:",omitempty"`
+}
+
+// The revisions a changelog covers. FromTag and ToTag are set for inputs
+// locked to a release tag, and Limit bounds how many commits are listed.
+type ChangelogSpan struct {
+	Base, Head     string
+	FromTag, ToTag string
+	Limit          int
+}
+
+// Implemented by resolvers that can list the commits and releases between two
+// revisions of an input. Fetchers return ErrUnsupported for inputs they
+// cannot handle.
+type ChangelogFetcher interface {
+	FetchChangelog(ctx context.Context, query Query, span ChangelogSpan) (Changelog, error)
+}
+
+const (
+	// The number of commits listed per update when UpdateOptions asks for
+	// changelogs without a limit
+	DefaultChangelogCommits = 10
+
+	// Longer commit summaries and release notes are cut off
+	maxSummaryLength = 100
+	maxNotesLines    = 20
+	maxNotesLength   = 2000
+
+	// Releases past this many are left out of a changelog
+	maxReleases = 5
+)
+
+// Fills in the changelog of each available update, when the resolver can
+// fetch them. Failed fetches are left out, as the update itself is still
+// valid.
+func fetchChangelogs(ctx context.Context, updates []UpdateStatus, pending []*pendingQuery, opts UpdateOptions) {
+	fetcher, ok := opts.Resolver.(ChangelogFetcher)
+	if !ok || opts.Changelog <= 0 {
+		return
+	}
+
+	type pendingChangelog struct {
+		key     string
+		query   Query
+		span    ChangelogSpan
+		updates []int
+	}
+
+	changelogs := make(map[string]*pendingChangelog)
+	for _, p := range pending {
+		for _, i := range p.updates {
+			update := updates[i]
+			if !update.IsUpdate || update.CurrentRev == "" || update.LatestRev == "" {
+				continue
+			}
+
+			span := ChangelogSpan{Base: update.CurrentRev, Head: update.LatestRev, Limit: opts.Changelog}
+			if update.LatestRef != "" {
+				span.FromTag, span.ToTag = update.Ref, update.LatestRef
+			}
+
+			key := p.key + "\x00" + span.key()
+			if changelogs[key] == nil {
+				changelogs[key] = &pendingChangelog{key: key, query: p.query, span: span}
+			}
+			changelogs[key].updates = append(changelogs[key].updates, i)
+		}
+	}
+
+	runAll(ctx, slices.SortedFunc(maps.Values(changelogs), func(a, b *pendingChangelog) int {
+		return strings.Compare(a.key, b.key)
+	}), opts, func(c *pendingChangelog) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		changelog, err := withRetry(ctx, opts, func(ctx context.Context) (Changelog, error) {
+			return fetcher.FetchChangelog(ctx, c.query, c.span)
+		})
+		if err != nil {
+			return
+		}
+
+		for _, i := range c.updates {
+			updates[i].Changelog = &changelog
+		}
+	})
+}
+
+func (s ChangelogSpan) key() string {
+	return fmt.Sprintf("%s...%s\x00%s...%s\x00%d", s.Base, s.Head, s.FromTag, s.ToTag, s.Limit)
+}
+
+// Fetches a changelog with the first member that supports the input.
+func (c ChainResolver) FetchChangelog(ctx context.Context, query Query, span ChangelogSpan) (Changelog, error) {
+	return chainCall(c, "fetch changelogs", func(fetcher ChangelogFetcher) (Changelog, error) {
+		return fetcher.FetchChangelog(ctx, query, span)
+	})
+}
+
+// Fetches changelogs through the wrapped resolver. What happened between two
+// fixed revisions never changes, so cached changelogs are used regardless of
+// TTL.
+func (c *CachingResolver) FetchChangelog(ctx context.Context, query Query, span ChangelogSpan) (Changelog, error) {
+	fetcher, err := capabilityOf[ChangelogFetcher](c.Resolver, "fetch changelogs")
+	if err != nil {
+		return Changelog{}, err
+	}
+
+	key := "changelog\x00" + c.Resolver.Name() + "\x00" + queryKey(query) + "\x00" + span.key()
+	offline := fmt.Errorf("%s is not cached and flint is offline", query.URL)
+	return cachedCall(c, key, true, offline, func() (Changelog, error) {
+		return fetcher.FetchChangelog(ctx, query, span)
+	})
+}
+
+// Releases that failed to list are tried again next time.
+func (c Changelog) cacheable() bool {
+	return c.ReleasesError == ""
+}
+
+// A commit as listed by the GitHub and Gitea APIs.
+type forgeCommit struct {
+	SHA     string `json:"sha"`
+	HTMLURL string `json:"html_url"`
+	Commit  struct {
+		Message string `json:"message"`
+		Author  struct {
+			Name string `json:"name"`
+			Date string `json:"date"`
+		} `json:"author"`
+	} `json:"commit"`
+}
+
+func (c forgeCommit) commit() Commit {
+	return Commit{
+		Rev:     c.SHA,
+		Summary: summarize(c.Commit.Message),
+		Author:  c.Commit.Author.Name,
+		Date:    parseForgeDate(c.Commit.Author.Date),
+		URL:     c.HTMLURL,
+	}
+}
+
+// A release as listed by the GitHub and Gitea APIs.
+type forgeRelease struct {
+	TagName     string `json:"tag_name"`
+	Name        string `json:"name"`
+	Body        string `json:"body"`
+	HTMLURL     string `json:"html_url"`
+	PublishedAt string `json:"published_at"`
+}
+
+// Asks the forge for the commits between two revisions and, for inputs
+// locked to a release tag, the releases in between. sourcehut has no API for
+// this and is reported as unsupported.
+func (r *ForgeResolver) FetchChangelog(ctx context.Context, query Query, span ChangelogSpan) (Changelog, error) {
+	repo, err := r.forgeRepo(query)
+	if err != nil {
+		return Changelog{}, err
+	}
+
+	limit := span.Limit
+	if limit <= 0 {
+		limit = DefaultChangelogCommits
+	}
+
+	var changelog Changelog
+	var releases []Release
+	switch repo.Kind {
+	case "github":
+		if changelog, err = r.githubCommits(ctx, repo, span.Base, span.Head, limit); err != nil {
+			return Changelog{}, err
+		}
+		if span.ToTag != "" {
+			var listed []forgeRelease
+			endpoint := fmt.Sprintf("%s/repos/%s/%s/releases?per_page=100", r.apiBase(repo),
+				url.PathEscape(repo.Owner), url.PathEscape(repo.Repo))
+			err = r.getJSON(ctx, repo, endpoint, &listed)
+			releases = forgeReleases(listed)
+		}
+
+	case "gitea":
+		var result struct {
+			TotalCommits int           `json:"total_commits"`
+			Commits      []forgeCommit `json:"commits"`
+		}
+		endpoint := fmt.Sprintf("%s/repos/%s/%s/compare/%s...%s", r.apiBase(repo),
+			url.PathEscape(repo.Owner), url.PathEscape(repo.Repo), url.PathEscape(span.Base), url.PathEscape(span.Head))
+		if err := r.getJSON(ctx, repo, endpoint, &result); err != nil {
+			return Changelog{}, err
+		}
+		changelog = newestCommits(forgeCommits(result.Commits), max(result.TotalCommits, len(result.Commits)), limit)
+
+		if span.ToTag != "" {
+			var listed []forgeRelease
+			endpoint := fmt.Sprintf("%s/repos/%s/%s/releases?limit=50", r.apiBase(repo),
+				url.PathEscape(repo.Owner), url.PathEscape(repo.Repo))
+			err = r.getJSON(ctx, repo, endpoint, &listed)
+			releases = forgeReleases(listed)
+		}
+
+	case "gitlab":
+		owner, unescapeErr := url.PathUnescape(repo.Owner)
+		if unescapeErr != nil {
+			owner = repo.Owner
+		}
+		project := url.PathEscape(owner + "/" + repo.Repo)
+
+		// The commits listing is newest first already
+		listed, total, listErr := r.gitlabCommits(ctx, repo, span.Base, span.Head, min(limit, 100))
+		if listErr != nil {
+			return Changelog{}, listErr
+		}
+		changelog.TotalCommits = max(total, len(listed))
+		for _, c := range listed[:min(len(listed), limit)] {
+			changelog.Commits = append(changelog.Commits, Commit{Rev: c.ID, Summary: summarize(c.Title), Author: c.AuthorName, Date: parseForgeDate(c.CreatedAt), URL: c.WebURL})
+		}
+
+		if span.ToTag != "" {
+			var listed []struct {
+				TagName     string `json:"tag_name"`
+				Name        string `json:"name"`
+				Description string `json:"description"`
+				ReleasedAt  string `json:"released_at"`
+				Links       struct {
+					Self string `json:"self"`
+				} `json:"_links"`
+			}
+			endpoint := fmt.Sprintf("%s/projects/%s/releases?per_page=100", r.apiBase(repo), project)
+			err = r.getJSON(ctx, repo, endpoint, &listed)
+			for _, release := range listed {
+				releases = append(releases, Release{
+					Tag:   release.TagName,
+					Name:  release.Name,
+					Notes: release.Description,
+					Date:  parseForgeDate(release.ReleasedAt),
+					URL:   release.Links.Self,
+				})
+			}
+		}
+
+	default:
+		return Changelog{}, fmt.Errorf("%w: %s cannot list commits between revisions", ErrUnsupported, repo.Kind)
+	}
+
+	// Release notes are extra; the commits alone are still worth showing,
+	// as long as it is clear that the releases are missing
+	if err != nil {
+		changelog.ReleasesError = err.Error()
+	} else {
+		changelog.Releases = releasesBetween(releases, span.FromTag, span.ToTag)
+	}
+	return changelog, nil
+}
+
+// Lists the newest commits between two revisions through GitHub's compare
+// API, which pages through commits oldest first. When there are more commits
+// than fit in a page, the last pages are fetched to get the newest ones.
+func (r *ForgeResolver) githubCommits(ctx context.Context, repo forgeRepo, base, head string, limit int) (Changelog, error) {
+	perPage := min(limit, 100)
+	page := func(n int) ([]forgeCommit, int, error) {
+		var result struct {
+			TotalCommits int           `json:"total_commits"`
+			Commits      []forgeCommit `json:"commits"`
+		}
+		endpoint := fmt.Sprintf("%s/repos/%s/%s/compare/%s...%s?per_page=%d&page=%d", r.apiBase(repo),
+			url.PathEscape(repo.Owner), url.PathEscape(repo.Repo), url.PathEscape(base), url.PathEscape(head), perPage, n)
+		err := r.getJSON(ctx, repo, endpoint, &result)
+		return result.Commits, result.TotalCommits, err
+	}
+
+	commits, total, err := page(1)
+	if err != nil {
+		return Changelog{}, err
+	}
+
+	if last := (total + perPage - 1) / perPage; last > 1 {
+		// The last page may be short, in which case the one before it
+		// holds the rest of the newest commits
+		tail, _, err := page(last)
+		if err != nil {
+			return Changelog{}, err
+		}
+		if len(tail) < limit && last > 2 {
+			previous, _, err := page(last - 1)
+			if err != nil {
+				return Changelog{}, err
+			}
+			commits = previous
+		}
+		if len(tail) < limit {
+			commits = append(commits, tail...)
+		} else {
+			commits = tail
+		}
+	}
+
+	return newestCommits(forgeCommits(commits), max(total, len(commits)), limit), nil
+}
+
+// Turns commits listed oldest first into a changelog of the newest ones.
+func newestCommits(listed []Commit, total, limit int) Changelog {
+	changelog := Changelog{TotalCommits: total}
+	for i := len(listed) - 1; i >= 0 && len(changelog.Commits) < limit; i-- {
+		changelog.Commits = append(changelog.Commits, listed[i])
+	}
+	return changelog
+}
+
+func forgeCommits(listed []forgeCommit) []Commit {
+	commits := make([]Commit, len(listed))
+	for i, commit := range listed {
+		commits[i] = commit.commit()
+	}
+	return commits
+}
+
+func forgeReleases(listed []forgeRelease) []Release {
+	releases := make([]Release, len(listed))
+	for i, release := range listed {
+		releases[i] = Release{
+			Tag:   release.TagName,
+			Name:  release.Name,
+			Notes: release.Body,
+			Date:  parseForgeDate(release.PublishedAt),
+			URL:   release.HTMLURL,
+		}
+	}
+	return releases
+}
+
+// Selects the releases newer than from and up to to, newest first, with their
+// notes cut down to size.
+func releasesBetween(releases []Release, from, to string) []Release {
+	if to == "" {
+		return nil
+	}
+	upper, ok := ParseVersion(to)
+	if !ok {
+		return nil
+	}
+	lower, hasLower := ParseVersion(from)
+
+	type versioned struct {
+		version Version
+		release Release
+	}
+	var selected []versioned
+	for _, release := range releases {
+		version, ok := ParseVersion(release.Tag)
+		if !ok || version.Prefix != upper.Prefix || version.Compare(upper) > 0 {
+			continue
+		}
+		if hasLower && version.Compare(lower) <= 0 {
+			continue
+		}
+		release.Notes = truncateNotes(release.Notes)
+		selected = append(selected, versioned{version, release})
+	}
+
+	slices.SortFunc(selected, func(a, b versioned) int { return b.version.Compare(a.version) })
+	var result []Release
+	for _, v := range selected[:min(len(selected), maxReleases)] {
+		result = append(result, v.release)
+	}
+	return result
+}
+
+// Returns the first line of a commit message, cut off at maxSummaryLength.
+func summarize(message string) string {
+	summary, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	return truncate(strings.TrimSpace(summary), maxSummaryLength)
+}
+
+// Cuts release notes off at maxNotesLines lines or maxNotesLength
+// characters, whichever comes first.
+func truncateNotes(notes string) string {
+	notes = strings.TrimSpace(strings.ReplaceAll(notes, "\r\n", "\n"))
+	lines := strings.Split(notes, "\n")
+	if len(lines) > maxNotesLines {
+		notes = strings.Join(lines[:maxNotesLines], "\n") + "\n…"
+	}
+	return truncate(notes, maxNotesLength)
+}
+
+// Cuts s off at n characters, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
+
+// Parses the RFC 3339 dates forges report, returning 0 when there is none.
+func parseForgeDate(date string) int64 {
+	parsed, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return 0
+	}
+	return parsed.Unix()
+}
@@ -0,0 +1,185 @@
+package flake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// A resolver whose changelogs are answered by a function.
+type changelogResolver struct {
+	funcResolver
+	fetch func(span ChangelogSpan) (Changelog, error)
+}
+
+func (c changelogResolver) FetchChangelog(ctx context.Context, query Query, span ChangelogSpan) (Changelog, error) {
+	return c.fetch(span)
+}
+
+func TestCheckUpdatesWith_Changelog(t *testing.T) {
+	lock := FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root":    {Inputs: map[string]any{"nixpkgs": "nixpkgs", "tool": "tool"}},
+			"nixpkgs": {Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "old"}},
+			"tool":    {Locked: &Locked{Type: "github", Owner: "owner", Repo: "tool", Rev: "current"}},
+		},
+	}
+
+	var spans []ChangelogSpan
+	resolver := changelogResolver{
+		funcResolver: func(ctx context.Context, query Query) (Resolution, error) {
+			if query.Locked.Repo == "tool" {
+				return Resolution{Rev: "current"}, nil
+			}
+			return Resolution{Rev: "new"}, nil
+		},
+		fetch: func(span ChangelogSpan) (Changelog, error) {
+			spans = append(spans, span)
+			return Changelog{TotalCommits: 1, Commits: []Commit{{Rev: "new", Summary: "Bump"}}}, nil
+		},
+	}
+
+	results, err := CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(spans) != 0 {
+		t.Errorf("expected no changelogs unless asked for, fetched %+v", spans)
+	}
+
+	results, err = CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver, Changelog: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(spans, []ChangelogSpan{{Base: "old", Head: "new", Limit: 3}}) {
+		t.Errorf("expected one changelog for the update, fetched %+v", spans)
+	}
+	for _, update := range results.Updates {
+		if got := update.Changelog != nil; got != update.IsUpdate {
+			t.Errorf("%s: expected a changelog only with an update, got %+v", update.InputName, update.Changelog)
+		}
+	}
+}
+
+func TestForgeResolver_FetchChangelog(t *testing.T) {
+	// GitHub lists 25 commits, c1 oldest to c25 newest, a page at a time
+	githubCommits := func(page, perPage int) string {
+		var commits []string
+		for i := (page-1)*perPage + 1; i <= min(page*perPage, 25); i++ {
+			commits = append(commits, fmt.Sprintf(`{"sha": "c%d", "html_url": "https://github.com/o/r/commit/c%d", "commit": {"message": "Commit %d\n\nDetails", "author": {"name": "Alice", "date": "2025-01-02T03:04:05Z"}}}`, i, i, i))
+		}
+		return fmt.Sprintf(`{"total_commits": 25, "commits": [%s]}`, strings.Join(commits, ", "))
+	}
+	releases := `[
+		{"tag_name": "v1.3.0", "name": "Too new", "body": "no"},
+		{"tag_name": "v1.2.0", "name": "Faster", "body": "` + strings.Repeat("line\\n", 30) + `", "html_url": "https://github.com/o/r/releases/v1.2.0"},
+		{"tag_name": "v1.1.0", "body": "Fixes"},
+		{"tag_name": "v1.0.0", "body": "Already locked"},
+		{"tag_name": "nightly"}
+	]`
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.String())
+		switch r.URL.EscapedPath() {
+		case "/repos/o/r/compare/c0...c25":
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+			fmt.Fprint(w, githubCommits(page, perPage))
+		case "/repos/o/r/releases":
+			fmt.Fprint(w, releases)
+		case "/projects/group%2Fproject/repository/commits":
+			// Only the first page, newest first, of many more commits
+			w.Header().Set("X-Total", "40")
+			fmt.Fprint(w, `[{"id": "g2", "title": "Second", "author_name": "Bob", "web_url": "https://gitlab.com/group/project/-/commit/g2"}, {"id": "g1", "title": "First"}]`)
+		case "/repos/owner/repo/compare/t1...t2":
+			fmt.Fprint(w, `{"total_commits": 1, "commits": [{"sha": "t2", "commit": {"message": "`+strings.Repeat("x", 150)+`"}}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	resolver := &ForgeResolver{
+		Client: server.Client(),
+		Hosts:  map[string]string{"git.example.com": "gitea"},
+		APIBase: map[string]string{
+			"github.com":      server.URL,
+			"gitlab.com":      server.URL,
+			"git.example.com": server.URL,
+		},
+	}
+
+	t.Run("github newest commits and releases", func(t *testing.T) {
+		requests = nil
+		query := Query{Locked: &Locked{Type: "github", Owner: "o", Repo: "r"}}
+		changelog, err := resolver.FetchChangelog(context.Background(), query, ChangelogSpan{Base: "c0", Head: "c25", FromTag: "v1.0.0", ToTag: "v1.2.0", Limit: 10})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var revs []string
+		for _, commit := range changelog.Commits {
+			revs = append(revs, commit.Rev)
+		}
+		if expected := []string{"c25", "c24", "c23", "c22", "c21", "c20", "c19", "c18", "c17", "c16"}; !slices.Equal(revs, expected) {
+			t.Errorf("expected the newest commits %v, got %v (requests %v)", expected, revs, requests)
+		}
+		if changelog.TotalCommits != 25 {
+			t.Errorf("expected 25 commits in total, got %d", changelog.TotalCommits)
+		}
+		if commit := changelog.Commits[0]; commit.Summary != "Commit 25" || commit.Author != "Alice" || commit.Date == 0 {
+			t.Errorf("unexpected commit %+v", commit)
+		}
+
+		var tags []string
+		for _, release := range changelog.Releases {
+			tags = append(tags, release.Tag)
+		}
+		if !slices.Equal(tags, []string{"v1.2.0", "v1.1.0"}) {
+			t.Errorf("expected the releases after v1.0.0 up to v1.2.0, got %v", tags)
+		}
+		if notes := changelog.Releases[0].Notes; strings.Count(notes, "\n") != maxNotesLines || !strings.HasSuffix(notes, "…") {
+			t.Errorf("expected long release notes to be truncated, got %q", notes)
+		}
+	})
+
+	t.Run("gitlab without releases", func(t *testing.T) {
+		query := Query{Locked: &Locked{Type: "gitlab", Owner: "group", Repo: "project"}}
+		changelog, err := resolver.FetchChangelog(context.Background(), query, ChangelogSpan{Base: "g0", Head: "g2", FromTag: "v1", ToTag: "v2", Limit: 1})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if changelog.TotalCommits != 40 || len(changelog.Commits) != 1 || changelog.Commits[0].Author != "Bob" {
+			t.Errorf("expected only the newest of 40 commits, got %+v", changelog)
+		}
+		if changelog.ReleasesError == "" {
+			t.Errorf("expected the failure to list releases to be recorded, got %+v", changelog)
+		}
+	})
+
+	t.Run("gitea long summary", func(t *testing.T) {
+		query := Query{Locked: &Locked{Type: "git", URL: "https://git.example.com/owner/repo.git"}}
+		changelog, err := resolver.FetchChangelog(context.Background(), query, ChangelogSpan{Base: "t1", Head: "t2"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if summary := changelog.Commits[0].Summary; len([]rune(summary)) != maxSummaryLength || !strings.HasSuffix(summary, "…") {
+			t.Errorf("expected the summary to be truncated, got %q", summary)
+		}
+	})
+
+	t.Run("sourcehut unsupported", func(t *testing.T) {
+		query := Query{Locked: &Locked{Type: "sourcehut", Owner: "~user", Repo: "repo"}}
+		if _, err := resolver.FetchChangelog(context.Background(), query, ChangelogSpan{Base: "a", Head: "b"}); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("expected an unsupported error, got %v", err)
+		}
+	})
+}
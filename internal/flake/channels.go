@@ -0,0 +1,243 @@
+package flake
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// A release branch such as "nixos-24.05", "release-24.05" or
+// "nixpkgs-24.05-darwin": a prefix, a release number and an optional suffix
+// naming a variant of the release.
+type channelBranch struct {
+	Prefix  string
+	Version Version
+	Suffix  string
+}
+
+var channelPattern = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_-]*?[-_])(\d+\.\d+)((?:[-_][A-Za-z][A-Za-z0-9]*)*)$`)
+
+// Parses a branch name as a release branch, reporting whether it is one.
+func parseChannelBranch(branch string) (channelBranch, bool) {
+	match := channelPattern.FindStringSubmatch(strings.TrimPrefix(branch, "refs/heads/"))
+	if match == nil {
+		return channelBranch{}, false
+	}
+
+	version, ok := ParseVersion(match[2])
+	if !ok {
+		return channelBranch{}, false
+	}
+	return channelBranch{Prefix: match[1], Version: version, Suffix: match[3]}, true
+}
+
+// Returns the newest release branch of the same kind as current, or "" when
+// current is the newest.
+func newestBranch(current channelBranch, branches []string) string {
+	newest, newestName := current.Version, ""
+	for _, name := range branches {
+		branch, ok := parseChannelBranch(name)
+		if !ok || branch.Prefix != current.Prefix || branch.Suffix != current.Suffix {
+			continue
+		}
+		if branch.Version.Compare(newest) > 0 {
+			newest, newestName = branch.Version, strings.TrimPrefix(name, "refs/heads/")
+		}
+	}
+	return newestName
+}
+
+// Implemented by resolvers that can list the branches of an input's
+// repository whose names start with a prefix. Listers return ErrUnsupported
+// for inputs they cannot handle.
+type BranchLister interface {
+	ListBranches(ctx context.Context, query Query, prefix string) ([]string, error)
+}
+
+// Lists branches with the first member that supports the input.
+func (c ChainResolver) ListBranches(ctx context.Context, query Query, prefix string) ([]string, error) {
+	return chainCall(c, "list branches", func(lister BranchLister) ([]string, error) {
+		return lister.ListBranches(ctx, query, prefix)
+	})
+}
+
+// Lists branches through the wrapped resolver, caching them like
+// resolutions.
+func (c *CachingResolver) ListBranches(ctx context.Context, query Query, prefix string) ([]string, error) {
+	lister, err := capabilityOf[BranchLister](c.Resolver, "list branches")
+	if err != nil {
+		return nil, err
+	}
+
+	repository := query
+	repository.Ref = ""
+	key := "branches\x00" + c.Resolver.Name() + "\x00" + queryKey(repository) + "\x00" + prefix
+	offline := fmt.Errorf("branches of %s are not cached and flint is offline", query.URL)
+	return cachedCall(c, key, false, offline, func() ([]string, error) {
+		return lister.ListBranches(ctx, query, prefix)
+	})
+}
+
+// Lists the branches advertised by the remote.
+func (r *GitResolver) ListBranches(ctx context.Context, query Query, prefix string) ([]string, error) {
+	remote, _, err := gitRemote(query)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := r.listRefs(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	return branchesWithPrefix(slices.Collect(maps.Keys(refs.refs)), prefix), nil
+}
+
+// Asks the forge for the repository's branches.
+func (r *ForgeResolver) ListBranches(ctx context.Context, query Query, prefix string) ([]string, error) {
+	repo, err := r.forgeRepo(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	switch repo.Kind {
+	case "github":
+		// Matching refs are filtered by the server, which matters for
+		// repositories with thousands of branches
+		for page := 1; page <= maxTagPages; page++ {
+			var refs []struct {
+				Ref string `json:"ref"`
+			}
+			params := url.Values{"per_page": {"100"}, "page": {fmt.Sprint(page)}}
+			endpoint := fmt.Sprintf("%s/repos/%s/%s/git/matching-refs/heads/%s?%s", r.apiBase(repo),
+				url.PathEscape(repo.Owner), url.PathEscape(repo.Repo), url.PathEscape(prefix), params.Encode())
+			if err := r.getJSON(ctx, repo, endpoint, &refs); err != nil {
+				return nil, err
+			}
+			for _, ref := range refs {
+				names = append(names, ref.Ref)
+			}
+			if len(refs) < 100 {
+				break
+			}
+		}
+
+	case "gitlab", "gitea":
+		for page := 1; page <= maxTagPages; page++ {
+			var branches []struct {
+				Name string `json:"name"`
+			}
+
+			params := url.Values{"page": {fmt.Sprint(page)}}
+			var endpoint string
+			if repo.Kind == "gitlab" {
+				owner, err := url.PathUnescape(repo.Owner)
+				if err != nil {
+					owner = repo.Owner
+				}
+				params.Set("per_page", "100")
+				params.Set("search", "^"+prefix)
+				endpoint = fmt.Sprintf("%s/projects/%s/repository/branches?%s", r.apiBase(repo),
+					url.PathEscape(owner+"/"+repo.Repo), params.Encode())
+			} else {
+				params.Set("limit", "50")
+				endpoint = fmt.Sprintf("%s/repos/%s/%s/branches?%s", r.apiBase(repo),
+					url.PathEscape(repo.Owner), url.PathEscape(repo.Repo), params.Encode())
+			}
+
+			if err := r.getJSON(ctx, repo, endpoint, &branches); err != nil {
+				return nil, err
+			}
+			for _, branch := range branches {
+				names = append(names, "refs/heads/"+branch.Name)
+			}
+			if len(branches) == 0 || (repo.Kind == "gitlab" && len(branches) < 100) || (repo.Kind == "gitea" && len(branches) < 50) {
+				break
+			}
+		}
+
+	case "sourcehut":
+		refs, err := r.sourceHutRefs(ctx, repo)
+		if err != nil {
+			return nil, err
+		}
+		names = slices.Collect(maps.Keys(refs))
+	}
+
+	return branchesWithPrefix(names, prefix), nil
+}
+
+// Returns the sorted names of the branches among refs that start with prefix.
+func branchesWithPrefix(refs []string, prefix string) []string {
+	var branches []string
+	for _, ref := range refs {
+		if branch, ok := strings.CutPrefix(ref, "refs/heads/"); ok && strings.HasPrefix(branch, prefix) {
+			branches = append(branches, branch)
+		}
+	}
+	slices.Sort(branches)
+	return branches
+}
+
+// A branch listing shared by every input tracking a release branch of the
+// same repository.
+type pendingBranches struct {
+	key      string
+	query    Query
+	prefix   string
+	updates  []int
+	branches []string
+	err      error
+}
+
+// Looks for newer release branches of inputs that track one, such as
+// nixos-25.05 for an input still on nixos-24.05. Failures are left out, as
+// the regular update check already reports problems with the input.
+func suggestBranches(ctx context.Context, updates []UpdateStatus, pending []*pendingQuery, opts UpdateOptions) {
+	lister, ok := opts.Resolver.(BranchLister)
+	if !ok {
+		return
+	}
+
+	listings := make(map[string]*pendingBranches)
+	for _, p := range pending {
+		branch, ok := parseChannelBranch(p.query.Ref)
+		if !ok {
+			continue
+		}
+
+		repository := p.query
+		repository.Ref = ""
+		key := queryKey(repository) + "\x00" + branch.Prefix
+		if listings[key] == nil {
+			listings[key] = &pendingBranches{key: key, query: p.query, prefix: branch.Prefix}
+		}
+		listings[key].updates = append(listings[key].updates, p.updates...)
+	}
+
+	runAll(ctx, slices.SortedFunc(maps.Values(listings), func(a, b *pendingBranches) int {
+		return strings.Compare(a.key, b.key)
+	}), opts, func(p *pendingBranches) {
+		if ctx.Err() != nil {
+			return
+		}
+		p.branches, p.err = withRetry(ctx, opts, func(ctx context.Context) ([]string, error) {
+			return lister.ListBranches(ctx, p.query, p.prefix)
+		})
+	})
+
+	for _, p := range listings {
+		if p.err != nil {
+			continue
+		}
+		for _, i := range p.updates {
+			if current, ok := parseChannelBranch(updates[i].Ref); ok && updates[i].Error == "" {
+				updates[i].NewerBranch = newestBranch(current, p.branches)
+			}
+		}
+	}
+}
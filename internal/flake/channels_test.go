@@ -0,0 +1,144 @@
+package flake
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestParseChannelBranch(t *testing.T) {
+	testCases := []struct {
+		branch string
+		ok     bool
+		prefix string
+		suffix string
+	}{
+		{"nixos-24.05", true, "nixos-", ""},
+		{"release-24.05", true, "release-", ""},
+		{"nixpkgs-24.05-darwin", true, "nixpkgs-", "-darwin"},
+		{"nixos-24.05-small", true, "nixos-", "-small"},
+		{"refs/heads/nix-darwin-24.11", true, "nix-darwin-", ""},
+		{"nixos-unstable", false, "", ""},
+		{"main", false, "", ""},
+		{"v1.4", false, "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.branch, func(t *testing.T) {
+			branch, ok := parseChannelBranch(tc.branch)
+			if ok != tc.ok {
+				t.Fatalf("expected ok=%v, got %v", tc.ok, ok)
+			}
+			if ok && (branch.Prefix != tc.prefix || branch.Suffix != tc.suffix) {
+				t.Errorf("expected prefix %q and suffix %q, got %+v", tc.prefix, tc.suffix, branch)
+			}
+		})
+	}
+}
+
+func TestNewestBranch(t *testing.T) {
+	branches := []string{
+		"nixos-23.11", "nixos-24.05", "nixos-24.05-small", "nixos-24.11",
+		"nixos-25.05", "nixos-25.05-small", "nixos-unstable", "nixpkgs-25.05-darwin",
+	}
+
+	testCases := []struct {
+		current  string
+		expected string
+	}{
+		{"nixos-24.05", "nixos-25.05"},
+		{"nixos-24.05-small", "nixos-25.05-small"},
+		{"nixos-25.05", ""},
+		{"nixpkgs-24.11-darwin", "nixpkgs-25.05-darwin"},
+	}
+
+	for _, tc := range testCases {
+		current, _ := parseChannelBranch(tc.current)
+		if got := newestBranch(current, branches); got != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.current, tc.expected, got)
+		}
+	}
+}
+
+// A resolver that lists a fixed set of branches.
+type branchResolver struct {
+	*FakeResolver
+	branches []string
+}
+
+func (r branchResolver) ListBranches(ctx context.Context, query Query, prefix string) ([]string, error) {
+	return branchesWithPrefix(r.branches, prefix), nil
+}
+
+func TestCheckUpdatesWith_NewerBranch(t *testing.T) {
+	lock := FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root": {Inputs: map[string]any{"nixpkgs": "nixpkgs", "unstable": "unstable"}},
+			"nixpkgs": {
+				Locked:   &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "stable-head"},
+				Original: &Original{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Ref: "nixos-24.05"},
+			},
+			"unstable": {
+				Locked:   &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "old"},
+				Original: &Original{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Ref: "nixos-unstable"},
+			},
+		},
+	}
+
+	resolver := branchResolver{
+		FakeResolver: &FakeResolver{Results: map[string]Resolution{
+			"github:NixOS/nixpkgs/nixos-24.05":    {Rev: "stable-head"},
+			"github:NixOS/nixpkgs/nixos-unstable": {Rev: "new"},
+		}},
+		branches: []string{"refs/heads/nixos-24.05", "refs/heads/nixos-24.11", "refs/heads/nixos-unstable", "refs/heads/master"},
+	}
+
+	results, err := CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, update := range results.Updates {
+		got[update.InputName] = fmt.Sprintf("%v %s", update.IsUpdate, update.NewerBranch)
+	}
+	if got["nixpkgs"] != "false nixos-24.11" {
+		t.Errorf("expected nixpkgs to be up to date on an outdated branch, got %q", got["nixpkgs"])
+	}
+	if got["unstable"] != "true " {
+		t.Errorf("expected a plain update for unstable, got %q", got["unstable"])
+	}
+}
+
+func TestForgeResolver_ListBranches(t *testing.T) {
+	server := newForgeServer(t)
+	defer server.Close()
+
+	resolver := &ForgeResolver{
+		Client:  server.Client(),
+		APIBase: map[string]string{"github.com": server.URL},
+	}
+
+	branches, err := resolver.ListBranches(context.Background(), Query{Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs"}}, "nixos-")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(branches) != "[nixos-24.05 nixos-24.11]" {
+		t.Errorf("unexpected branches %v", branches)
+	}
+}
+
+func TestGitResolver_ListBranches(t *testing.T) {
+	server := newGitServer(t, true, "", "")
+	defer server.Close()
+
+	resolver := &GitResolver{Client: server.Client()}
+	branches, err := resolver.ListBranches(context.Background(), Query{Locked: &Locked{Type: "git", URL: server.URL + "/repo.git"}}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(branches) != "[dev main]" {
+		t.Errorf("unexpected branches %v", branches)
+	}
+}
@@ -0,0 +1,184 @@
+package flake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// How far a locked revision is behind the latest one.
+type Comparison struct {
+	CommitsBehind int
+
+	// A page on the forge listing the commits in between
+	URL string
+}
+
+// Implemented by resolvers that can count the commits between two revisions
+// of an input. Comparers return ErrUnsupported for inputs they cannot handle.
+type Comparer interface {
+	Compare(ctx context.Context, query Query, base, head string) (Comparison, error)
+}
+
+// Compares two revisions with the first member that supports the input.
+func (c ChainResolver) Compare(ctx context.Context, query Query, base, head string) (Comparison, error) {
+	return chainCall(c, "compare revisions", func(comparer Comparer) (Comparison, error) {
+		return comparer.Compare(ctx, query, base, head)
+	})
+}
+
+// Returns the forge page comparing two revisions of an input, or "" when the
+// input is not hosted on a forge Flint knows.
+func CompareURL(query Query, base, head string) string {
+	repo, err := lookupForgeRepo(query, nil)
+	if err != nil {
+		return ""
+	}
+	return repo.compareURL(base, head)
+}
+
+func (repo forgeRepo) compareURL(base, head string) string {
+	owner, err := url.PathUnescape(repo.Owner)
+	if err != nil {
+		owner = repo.Owner
+	}
+
+	switch repo.Kind {
+	case "github", "gitea":
+		return fmt.Sprintf("https://%s/%s/%s/compare/%s...%s", repo.Host, owner, repo.Repo, base, head)
+	case "gitlab":
+		return fmt.Sprintf("https://%s/%s/%s/-/compare/%s...%s", repo.Host, owner, repo.Repo, base, head)
+	default:
+		return ""
+	}
+}
+
+// Asks the forge how many commits head is ahead of base. sourcehut has no API
+// for this and is reported as unsupported.
+func (r *ForgeResolver) Compare(ctx context.Context, query Query, base, head string) (Comparison, error) {
+	repo, err := r.forgeRepo(query)
+	if err != nil {
+		return Comparison{}, err
+	}
+
+	comparison := Comparison{URL: repo.compareURL(base, head)}
+	switch repo.Kind {
+	case "github":
+		if behind, ok := r.prefetchedCompare(repo, base, head); ok {
+			comparison.CommitsBehind = behind
+			break
+		}
+
+		var result struct {
+			AheadBy int    `json:"ahead_by"`
+			HTMLURL string `json:"html_url"`
+		}
+		endpoint := fmt.Sprintf("%s/repos/%s/%s/compare/%s...%s?per_page=1", r.apiBase(repo),
+			url.PathEscape(repo.Owner), url.PathEscape(repo.Repo), url.PathEscape(base), url.PathEscape(head))
+		if err := r.getJSON(ctx, repo, endpoint, &result); err != nil {
+			return Comparison{}, err
+		}
+		comparison.CommitsBehind = result.AheadBy
+		if result.HTMLURL != "" {
+			comparison.URL = result.HTMLURL
+		}
+
+	case "gitlab":
+		_, total, err := r.gitlabCommits(ctx, repo, base, head, 1)
+		if err != nil {
+			return Comparison{}, err
+		}
+		comparison.CommitsBehind = total
+
+	case "gitea":
+		var result struct {
+			TotalCommits int        `json:"total_commits"`
+			Commits      []struct{} `json:"commits"`
+		}
+		endpoint := fmt.Sprintf("%s/repos/%s/%s/compare/%s...%s", r.apiBase(repo),
+			url.PathEscape(repo.Owner), url.PathEscape(repo.Repo), url.PathEscape(base), url.PathEscape(head))
+		if err := r.getJSON(ctx, repo, endpoint, &result); err != nil {
+			return Comparison{}, err
+		}
+		comparison.CommitsBehind = max(result.TotalCommits, len(result.Commits))
+
+	default:
+		return Comparison{}, fmt.Errorf("%w: %s cannot compare revisions", ErrUnsupported, repo.Kind)
+	}
+
+	return comparison, nil
+}
+
+// How many pages of 100 commits are counted when GitLab leaves out the total
+// of a listing.
+const gitlabCountPages = 10
+
+// A commit as listed by the GitLab API.
+type gitlabCommit struct {
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	AuthorName string `json:"author_name"`
+	CreatedAt  string `json:"created_at"`
+	WebURL     string `json:"web_url"`
+}
+
+// Lists the first page of commits between two revisions on GitLab, newest
+// first, and counts them all. Unlike the compare API, the commits listing
+// sends no diffs. The count comes from the X-Total header; servers may leave
+// it out of long listings, in which case up to gitlabCountPages pages are
+// counted, and longer ones are reported at that length.
+func (r *ForgeResolver) gitlabCommits(ctx context.Context, repo forgeRepo, base, head string, perPage int) ([]gitlabCommit, int, error) {
+	owner, err := url.PathUnescape(repo.Owner)
+	if err != nil {
+		owner = repo.Owner
+	}
+	page := func(n, perPage int) ([]gitlabCommit, http.Header, error) {
+		var commits []gitlabCommit
+		params := url.Values{"ref_name": {base + ".." + head}, "per_page": {strconv.Itoa(perPage)}, "page": {strconv.Itoa(n)}}
+		endpoint := fmt.Sprintf("%s/projects/%s/repository/commits?%s", r.apiBase(repo),
+			url.PathEscape(owner+"/"+repo.Repo), params.Encode())
+		header, err := r.getJSONPage(ctx, repo, endpoint, &commits)
+		return commits, header, err
+	}
+
+	commits, header, err := page(1, perPage)
+	if err != nil {
+		return nil, 0, err
+	}
+	if total, err := strconv.Atoi(header.Get("X-Total")); err == nil {
+		return commits, total, nil
+	}
+	if header.Get("X-Next-Page") == "" {
+		return commits, len(commits), nil
+	}
+
+	total := 0
+	for n := 1; n <= gitlabCountPages; n++ {
+		counted, header, err := page(n, 100)
+		if err != nil {
+			return nil, 0, err
+		}
+		total += len(counted)
+		if header.Get("X-Next-Page") == "" {
+			break
+		}
+	}
+	return commits, total, nil
+}
+
+// Compares revisions through the wrapped resolver. Comparisons between two
+// fixed revisions never change, so cached ones are used regardless of TTL.
+func (c *CachingResolver) Compare(ctx context.Context, query Query, base, head string) (Comparison, error) {
+	comparer, err := capabilityOf[Comparer](c.Resolver, "compare revisions")
+	if err != nil {
+		return Comparison{}, err
+	}
+
+	key := "compare\x00" + c.Resolver.Name() + "\x00" + queryKey(query) + "\x00" + base + "..." + head
+	offline := fmt.Errorf("%s is not cached and flint is offline", query.URL)
+	return cachedCall(c, key, true, offline, func() (Comparison, error) {
+		return comparer.Compare(ctx, query, base, head)
+	})
+}
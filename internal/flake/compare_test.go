@@ -0,0 +1,192 @@
+package flake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestForgeResolver_Compare(t *testing.T) {
+	server := newForgeServer(t)
+	defer server.Close()
+
+	resolver := &ForgeResolver{
+		Client: server.Client(),
+		Hosts:  map[string]string{"git.example.com": "gitea"},
+		APIBase: map[string]string{
+			"github.com":      server.URL,
+			"gitlab.com":      server.URL,
+			"git.example.com": server.URL,
+			"git.sr.ht":       server.URL,
+		},
+	}
+
+	testCases := []struct {
+		name   string
+		locked *Locked
+		behind int
+		url    string
+	}{
+		{
+			name:   "github",
+			locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs"},
+			behind: 42,
+			url:    "https://github.com/NixOS/nixpkgs/compare/old...new",
+		},
+		{
+			name:   "gitlab nested group",
+			locked: &Locked{Type: "gitlab", Owner: "group%2Fsub", Repo: "project"},
+			behind: 3,
+			url:    "https://gitlab.com/group/sub/project/-/compare/old...new",
+		},
+		{
+			name:   "gitea",
+			locked: &Locked{Type: "git", URL: "https://git.example.com/owner/repo.git"},
+			behind: 7,
+			url:    "https://git.example.com/owner/repo/compare/old...new",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			comparison, err := resolver.Compare(context.Background(), Query{Locked: tc.locked}, "old", "new")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if comparison.CommitsBehind != tc.behind || comparison.URL != tc.url {
+				t.Errorf("expected %d commits at %s, got %+v", tc.behind, tc.url, comparison)
+			}
+		})
+	}
+
+	_, err := resolver.Compare(context.Background(), Query{Locked: &Locked{Type: "sourcehut", Owner: "~user", Repo: "repo"}}, "old", "new")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected sourcehut to be unsupported, got %v", err)
+	}
+}
+
+func TestForgeResolver_GitLabCommitCount(t *testing.T) {
+	testCases := []struct {
+		name     string
+		commits  int
+		expected int
+	}{
+		{name: "counted page by page", commits: 240, expected: 240},
+		{name: "counted up to a limit", commits: 5000, expected: gitlabCountPages * 100},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Listings without X-Total only say whether there is a next page
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+				perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+				listed := min(max(tc.commits-(page-1)*perPage, 0), perPage)
+				if page*perPage < tc.commits {
+					w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+				}
+				fmt.Fprintf(w, "[%s]", strings.TrimSuffix(strings.Repeat(`{"id": "c"},`, listed), ","))
+			}))
+			defer server.Close()
+
+			resolver := &ForgeResolver{Client: server.Client(), APIBase: map[string]string{"gitlab.com": server.URL}}
+			comparison, err := resolver.Compare(context.Background(), Query{Locked: &Locked{Type: "gitlab", Owner: "group", Repo: "project"}}, "old", "new")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if comparison.CommitsBehind != tc.expected {
+				t.Errorf("expected %d commits, got %d", tc.expected, comparison.CommitsBehind)
+			}
+		})
+	}
+}
+
+// A resolver whose comparisons are answered by a function.
+type compareResolver struct {
+	funcResolver
+	compare func(base, head string) (Comparison, error)
+}
+
+func (c compareResolver) Compare(ctx context.Context, query Query, base, head string) (Comparison, error) {
+	return c.compare(base, head)
+}
+
+func TestCheckUpdatesWith_Compare(t *testing.T) {
+	lock := FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root": {Inputs: map[string]any{"nixpkgs": "nixpkgs", "local": "local"}},
+			"nixpkgs": {
+				Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "old", LastModified: 1000},
+			},
+			"local": {
+				Locked: &Locked{Type: "git", URL: "https://example.com/repo.git", Rev: "old", LastModified: 1000},
+			},
+		},
+	}
+
+	resolve := funcResolver(func(ctx context.Context, query Query) (Resolution, error) {
+		return Resolution{Rev: "new", LastModified: 1000 + 3*86400}, nil
+	})
+
+	testCases := []struct {
+		name     string
+		resolver Resolver
+		behind   int
+		url      string
+	}{
+		{
+			name:     "without comparer",
+			resolver: resolve,
+			url:      "https://github.com/NixOS/nixpkgs/compare/old...new",
+		},
+		{
+			name: "with comparer",
+			resolver: compareResolver{resolve, func(base, head string) (Comparison, error) {
+				return Comparison{CommitsBehind: 5}, nil
+			}},
+			behind: 5,
+			url:    "https://github.com/NixOS/nixpkgs/compare/old...new",
+		},
+		{
+			name: "failed comparison",
+			resolver: compareResolver{resolve, func(base, head string) (Comparison, error) {
+				return Comparison{}, errors.New("rate limited")
+			}},
+			url: "https://github.com/NixOS/nixpkgs/compare/old...new",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: tc.resolver})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, update := range results.Updates {
+				if update.Error != "" || !update.IsUpdate {
+					t.Fatalf("expected an update for %s, got %+v", update.InputName, update)
+				}
+				if update.AgeGap != 3*86400 {
+					t.Errorf("%s: expected an age gap of 3 days, got %d seconds", update.InputName, update.AgeGap)
+				}
+
+				url := tc.url
+				if update.InputName == "local" {
+					// Plain git hosts have no compare page
+					url = ""
+				}
+				if update.CommitsBehind != tc.behind || update.CompareURL != url {
+					t.Errorf("%s: expected %d commits at %q, got %d at %q",
+						update.InputName, tc.behind, url, update.CommitsBehind, update.CompareURL)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package flake
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// A single follows declaration that would remove a duplicate node from the
+// lockfile. Path is the input path from the root flake, e.g.
+// ["home-manager", "nixpkgs"] for inputs.home-manager.inputs.nixpkgs, and
+// Follows is the root input it should follow.
+type FollowsSuggestion struct {
+	Path     []string
+	Follows  string
+	Node     string
+	Target   string
+	Identity string
+}
+
+// A duplicated repository for which no follows declaration can be derived,
+// along with the reason why.
+type UnresolvedDuplicate struct {
+	Identity string
+	Nodes    []string
+	Reason   string
+}
+
+type FollowsPlan struct {
+	Follows    []FollowsSuggestion
+	Unresolved []UnresolvedDuplicate
+}
+
+// Returns the name of the root node, falling back to "root" for lockfiles
+// that do not declare one.
+func RootName(flakeLock FlakeLock) string {
+	if flakeLock.Root != "" {
+		return flakeLock.Root
+	}
+	return "root"
+}
+
+// Computes the shortest input path from the root node to every node that is
+// reachable through direct (non-follows) references.
+func InputPaths(flakeLock FlakeLock) map[string][]string {
+	root := RootName(flakeLock)
+	paths := map[string][]string{root: {}}
+	queue := []string{root}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		node := flakeLock.Nodes[current]
+		names := make([]string, 0, len(node.Inputs))
+		for name := range node.Inputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			target, ok := node.Inputs[name].(string)
+			if !ok {
+				continue
+			}
+			if _, seen := paths[target]; seen {
+				continue
+			}
+			if _, exists := flakeLock.Nodes[target]; !exists {
+				continue
+			}
+
+			paths[target] = append(slices.Clone(paths[current]), name)
+			queue = append(queue, target)
+		}
+	}
+
+	return paths
+}
+
+// Derives the follows declarations needed to collapse every duplicated
+// repository onto the version that the root flake already declares.
+func PlanFollows(flakeLock FlakeLock) FollowsPlan {
+	var plan FollowsPlan
+
+	root := RootName(flakeLock)
+	paths := InputPaths(flakeLock)
+
+	// Group reachable nodes by repository identity
+	groups := make(map[string][]string)
+	versions := make(map[string]map[string]struct{})
+	for nodeName, node := range flakeLock.Nodes {
+		if _, reachable := paths[nodeName]; !reachable {
+			continue
+		}
+
+		url := nodeURL(node)
+		if url == "" {
+			continue
+		}
+
+		identity := ExtractRepoIdentity(url)
+		groups[identity] = append(groups[identity], nodeName)
+		if versions[identity] == nil {
+			versions[identity] = make(map[string]struct{})
+		}
+		versions[identity][url] = struct{}{}
+	}
+
+	identities := make([]string, 0, len(groups))
+	for identity := range groups {
+		if len(versions[identity]) > 1 {
+			identities = append(identities, identity)
+		}
+	}
+	sort.Strings(identities)
+
+	rootNode := flakeLock.Nodes[root]
+	for _, identity := range identities {
+		nodes := groups[identity]
+		sort.Strings(nodes)
+
+		// Root inputs that point into this group, keyed by node name
+		rootInputs := make(map[string][]string)
+		for inputName, ref := range rootNode.Inputs {
+			target, ok := ref.(string)
+			if ok && slices.Contains(nodes, target) {
+				rootInputs[target] = append(rootInputs[target], inputName)
+			}
+		}
+
+		if len(rootInputs) == 0 {
+			plan.Unresolved = append(plan.Unresolved, UnresolvedDuplicate{
+				Identity: identity,
+				Nodes:    nodes,
+				Reason:   "no root input declares this repository",
+			})
+			continue
+		}
+
+		for _, nodeName := range nodes {
+			if _, declared := rootInputs[nodeName]; declared {
+				continue
+			}
+
+			target, ok := pickFollowsTarget(flakeLock, nodeName, rootInputs)
+			if !ok {
+				plan.Unresolved = append(plan.Unresolved, UnresolvedDuplicate{
+					Identity: identity,
+					Nodes:    []string{nodeName},
+					Reason:   "multiple root inputs declare this repository with different refs",
+				})
+				continue
+			}
+
+			followsName := slices.Min(rootInputs[target])
+			for _, parent := range referencingNodes(flakeLock, nodeName) {
+				parentPath, reachable := paths[parent.node]
+				if !reachable || parent.node == root {
+					continue
+				}
+
+				plan.Follows = append(plan.Follows, FollowsSuggestion{
+					Path:     append(slices.Clone(parentPath), parent.input),
+					Follows:  followsName,
+					Node:     nodeName,
+					Target:   target,
+					Identity: identity,
+				})
+			}
+		}
+	}
+
+	sort.Slice(plan.Follows, func(i, j int) bool {
+		return strings.Join(plan.Follows[i].Path, "/") < strings.Join(plan.Follows[j].Path, "/")
+	})
+
+	return plan
+}
+
+type inputEdge struct {
+	node  string
+	input string
+}
+
+// Lists the nodes that reference the given node directly, together with the
+// input name they use for it.
+func referencingNodes(flakeLock FlakeLock, target string) []inputEdge {
+	var edges []inputEdge
+	for nodeName, node := range flakeLock.Nodes {
+		for inputName, ref := range node.Inputs {
+			if name, ok := ref.(string); ok && name == target {
+				edges = append(edges, inputEdge{node: nodeName, input: inputName})
+			}
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].node != edges[j].node {
+			return edges[i].node < edges[j].node
+		}
+		return edges[i].input < edges[j].input
+	})
+	return edges
+}
+
+// Picks which root-declared node a duplicate should follow. With a single
+// candidate the choice is obvious; with several we only pick one whose
+// original ref matches the duplicate's.
+func pickFollowsTarget(flakeLock FlakeLock, nodeName string, candidates map[string][]string) (string, bool) {
+	if len(candidates) == 1 {
+		for target := range candidates {
+			return target, true
+		}
+	}
+
+	ref := originalRef(flakeLock.Nodes[nodeName])
+	var matches []string
+	for target := range candidates {
+		if originalRef(flakeLock.Nodes[target]) == ref {
+			matches = append(matches, target)
+		}
+	}
+
+	if len(matches) != 1 {
+		return "", false
+	}
+	return matches[0], true
+}
+
+func originalRef(node Node) string {
+	if node.Original == nil {
+		return ""
+	}
+	return node.Original.Ref
+}
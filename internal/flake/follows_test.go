@@ -0,0 +1,144 @@
+package flake
+
+import (
+	"slices"
+	"testing"
+)
+
+const duplicateNixpkgsLock = `
+{
+  "nodes": {
+    "nixpkgs": {
+      "locked": {"owner": "NixOS", "repo": "nixpkgs", "rev": "aaa", "type": "github"},
+      "original": {"owner": "NixOS", "repo": "nixpkgs", "ref": "nixos-unstable", "type": "github"}
+    },
+    "nixpkgs_2": {
+      "locked": {"owner": "NixOS", "repo": "nixpkgs", "rev": "bbb", "type": "github"},
+      "original": {"owner": "NixOS", "repo": "nixpkgs", "ref": "nixos-unstable", "type": "github"}
+    },
+    "nixpkgs_3": {
+      "locked": {"owner": "NixOS", "repo": "nixpkgs", "rev": "ccc", "type": "github"},
+      "original": {"owner": "NixOS", "repo": "nixpkgs", "type": "github"}
+    },
+    "home-manager": {
+      "inputs": {"nixpkgs": "nixpkgs_2"},
+      "locked": {"owner": "nix-community", "repo": "home-manager", "rev": "hm", "type": "github"}
+    },
+    "devshell": {
+      "inputs": {"nixpkgs": ["nixpkgs"], "systems": "systems"},
+      "locked": {"owner": "numtide", "repo": "devshell", "rev": "ds", "type": "github"}
+    },
+    "systems": {
+      "inputs": {"nixpkgs": "nixpkgs_3"},
+      "locked": {"owner": "nix-systems", "repo": "default", "rev": "sys", "type": "github"}
+    },
+    "root": {
+      "inputs": {"nixpkgs": "nixpkgs", "home-manager": "home-manager", "devshell": "devshell"}
+    }
+  },
+  "root": "root",
+  "version": 7
+}
+`
+
+func TestInputPaths(t *testing.T) {
+	lock := loadLock(t, duplicateNixpkgsLock)
+	paths := InputPaths(lock)
+
+	testCases := map[string][]string{
+		"root":         {},
+		"nixpkgs":      {"nixpkgs"},
+		"home-manager": {"home-manager"},
+		"nixpkgs_2":    {"home-manager", "nixpkgs"},
+		"systems":      {"devshell", "systems"},
+		"nixpkgs_3":    {"devshell", "systems", "nixpkgs"},
+	}
+
+	for node, expected := range testCases {
+		if got, ok := paths[node]; !ok || !slices.Equal(got, expected) {
+			t.Errorf("expected path %v for %s, got %v", expected, node, got)
+		}
+	}
+}
+
+func TestPlanFollows(t *testing.T) {
+	lock := loadLock(t, duplicateNixpkgsLock)
+	plan := PlanFollows(lock)
+
+	if len(plan.Unresolved) != 0 {
+		t.Fatalf("expected no unresolved duplicates, got %v", plan.Unresolved)
+	}
+
+	if len(plan.Follows) != 2 {
+		t.Fatalf("expected 2 follows suggestions, got %d: %v", len(plan.Follows), plan.Follows)
+	}
+
+	expected := []FollowsSuggestion{
+		{Path: []string{"devshell", "systems", "nixpkgs"}, Follows: "nixpkgs", Node: "nixpkgs_3", Target: "nixpkgs"},
+		{Path: []string{"home-manager", "nixpkgs"}, Follows: "nixpkgs", Node: "nixpkgs_2", Target: "nixpkgs"},
+	}
+	for i, want := range expected {
+		got := plan.Follows[i]
+		if !slices.Equal(got.Path, want.Path) || got.Follows != want.Follows || got.Node != want.Node || got.Target != want.Target {
+			t.Errorf("suggestion %d: expected %+v, got %+v", i, want, got)
+		}
+		if got.Identity != "github:NixOS/nixpkgs" {
+			t.Errorf("suggestion %d: unexpected identity %s", i, got.Identity)
+		}
+	}
+}
+
+func TestPlanFollows_Unresolved(t *testing.T) {
+	t.Run("no root input", func(t *testing.T) {
+		lock := loadLock(t, `
+{
+  "nodes": {
+    "a": {"inputs": {"nixpkgs": "nixpkgs"}, "locked": {"owner": "x", "repo": "a", "rev": "1", "type": "github"}},
+    "b": {"inputs": {"nixpkgs": "nixpkgs_2"}, "locked": {"owner": "x", "repo": "b", "rev": "2", "type": "github"}},
+    "nixpkgs": {"locked": {"owner": "NixOS", "repo": "nixpkgs", "rev": "aaa", "type": "github"}},
+    "nixpkgs_2": {"locked": {"owner": "NixOS", "repo": "nixpkgs", "rev": "bbb", "type": "github"}},
+    "root": {"inputs": {"a": "a", "b": "b"}}
+  },
+  "root": "root",
+  "version": 7
+}`)
+		plan := PlanFollows(lock)
+
+		if len(plan.Follows) != 0 {
+			t.Errorf("expected no suggestions, got %v", plan.Follows)
+		}
+		if len(plan.Unresolved) != 1 || plan.Unresolved[0].Identity != "github:NixOS/nixpkgs" {
+			t.Errorf("expected nixpkgs to be unresolved, got %v", plan.Unresolved)
+		}
+	})
+
+	t.Run("ambiguous root inputs", func(t *testing.T) {
+		lock := loadLock(t, `
+{
+  "nodes": {
+    "a": {"inputs": {"nixpkgs": "nixpkgs_3"}, "locked": {"owner": "x", "repo": "a", "rev": "1", "type": "github"}},
+    "nixpkgs": {
+      "locked": {"owner": "NixOS", "repo": "nixpkgs", "rev": "aaa", "type": "github"},
+      "original": {"owner": "NixOS", "repo": "nixpkgs", "ref": "nixos-unstable", "type": "github"}
+    },
+    "nixpkgs-stable": {
+      "locked": {"owner": "NixOS", "repo": "nixpkgs", "rev": "bbb", "type": "github"},
+      "original": {"owner": "NixOS", "repo": "nixpkgs", "ref": "nixos-24.05", "type": "github"}
+    },
+    "nixpkgs_3": {
+      "locked": {"owner": "NixOS", "repo": "nixpkgs", "rev": "ccc", "type": "github"},
+      "original": {"owner": "NixOS", "repo": "nixpkgs", "ref": "nixos-24.05", "type": "github"}
+    },
+    "root": {"inputs": {"a": "a", "nixpkgs": "nixpkgs", "nixpkgs-stable": "nixpkgs-stable"}}
+  },
+  "root": "root",
+  "version": 7
+}`)
+		plan := PlanFollows(lock)
+
+		// The duplicate tracks nixos-24.05, so it should follow the stable input
+		if len(plan.Follows) != 1 || plan.Follows[0].Follows != "nixpkgs-stable" {
+			t.Errorf("expected a/nixpkgs to follow nixpkgs-stable, got %v", plan.Follows)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package flake
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// How an input changed between two lockfiles.
+type InputChange struct {
+	// Input path such as "nixpkgs" or "home-manager/nixpkgs"
+	Input string
+
+	// The locked URLs before and after; OldURL is empty for added inputs and
+	// NewURL for removed ones
+	OldURL string `json:",omitempty"`
+	NewURL string `json:",omitempty"`
+
+	OldRev  string `json:",omitempty"`
+	NewRev  string `json:",omitempty"`
+	OldDate int64  `json:",omitempty"`
+	NewDate int64  `json:",omitempty"`
+}
+
+// The inputs changed by an update, and the repositories it left locked at more
+// than one version.
+type LockDiff struct {
+	// Set when the diff describes the updates that would be applied rather
+	// than ones that were
+	DryRun bool `json:",omitempty"`
+
+	// The command that applied the update, or would have
+	Command []string `json:",omitempty"`
+
+	Changes []InputChange
+
+	// Repositories duplicated after the update that were not before, keyed by
+	// identity and listing their versioned URLs
+	NewDuplicates map[string][]string `json:",omitempty"`
+
+	// The nodes depending on each URL in NewDuplicates
+	Dependants map[string][]string `json:",omitempty"`
+}
+
+// Compares two lockfiles input by input, following the shortest input path to
+// every node, and reports the repositories that became duplicated.
+func DiffLocks(before, after FlakeLock) LockDiff {
+	var diff LockDiff
+
+	oldNodes := nodesByPath(before)
+	newNodes := nodesByPath(after)
+	paths := slices.Collect(maps.Keys(oldNodes))
+	for path := range newNodes {
+		if _, ok := oldNodes[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+
+	for _, path := range paths {
+		oldNode, hadNode := oldNodes[path]
+		newNode, hasNode := newNodes[path]
+
+		var change InputChange
+		change.Input = path
+		if hadNode {
+			change.OldURL = nodeURL(oldNode)
+			if oldNode.Locked != nil {
+				change.OldRev, change.OldDate = oldNode.Locked.Rev, oldNode.Locked.LastModified
+			}
+		}
+		if hasNode {
+			change.NewURL = nodeURL(newNode)
+			if newNode.Locked != nil {
+				change.NewRev, change.NewDate = newNode.Locked.Rev, newNode.Locked.LastModified
+			}
+		}
+
+		if change.OldURL != change.NewURL {
+			diff.Changes = append(diff.Changes, change)
+		}
+	}
+
+	diff.NewDuplicates, diff.Dependants = newDuplicates(before, after)
+	return diff
+}
+
+// Maps the input path of every reachable node to the node.
+func nodesByPath(flakeLock FlakeLock) map[string]Node {
+	nodes := make(map[string]Node)
+	for name, path := range InputPaths(flakeLock) {
+		if len(path) > 0 {
+			nodes[strings.Join(path, "/")] = flakeLock.Nodes[name]
+		}
+	}
+	return nodes
+}
+
+// Returns the repositories locked at several versions in after but not in
+// before, and the dependants of each of their versions.
+func newDuplicates(before, after FlakeLock) (map[string][]string, map[string][]string) {
+	old := duplicateRepos(AnalyzeFlake(before).Deps)
+	relations := AnalyzeFlake(after)
+
+	var duplicates, dependants map[string][]string
+	for identity, urls := range duplicateRepos(relations.Deps) {
+		if len(urls) <= len(old[identity]) {
+			continue
+		}
+
+		if duplicates == nil {
+			duplicates, dependants = make(map[string][]string), make(map[string][]string)
+		}
+		slices.Sort(urls)
+		duplicates[identity] = urls
+		for _, url := range urls {
+			nodes := slices.Clone(relations.Deps[url])
+			slices.Sort(nodes)
+			dependants[url] = slices.Compact(nodes)
+		}
+	}
+	return duplicates, dependants
+}
+
+// Groups versioned URLs by repository, keeping the repositories locked at
+// more than one version.
+func duplicateRepos(deps map[string][]string) map[string][]string {
+	repos := make(map[string][]string)
+	for url := range deps {
+		identity := ExtractRepoIdentity(url)
+		repos[identity] = append(repos[identity], url)
+	}
+	maps.DeleteFunc(repos, func(_ string, urls []string) bool { return len(urls) < 2 })
+	return repos
+}
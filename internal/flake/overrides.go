@@ -0,0 +1,95 @@
+package flake
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An --override-input argument that pins a nested input to the exact
+// revision the root flake already locks, which deduplicates the lockfile
+// without editing flake.nix.
+type OverrideInput struct {
+	Path []string
+	URL  string
+
+	// The follows suggestion this override was derived from
+	Suggestion FollowsSuggestion
+}
+
+// Returns the input path in the slash-separated form Nix expects.
+func (o OverrideInput) InputPath() string {
+	return strings.Join(o.Path, "/")
+}
+
+// Returns the arguments to pass to nix for this override.
+func (o OverrideInput) Args() []string {
+	return []string{"--override-input", o.InputPath(), o.URL}
+}
+
+// Converts a follows plan into --override-input arguments. Every suggestion
+// is pinned to the locked reference of the node it would follow, so that
+// `nix flake lock` resolves both to the same source.
+func PlanOverrides(flakeLock FlakeLock, plan FollowsPlan) ([]OverrideInput, error) {
+	overrides := make([]OverrideInput, 0, len(plan.Follows))
+	for _, suggestion := range plan.Follows {
+		node, exists := flakeLock.Nodes[suggestion.Target]
+		if !exists || node.Locked == nil {
+			return nil, fmt.Errorf("node %s has no locked version", suggestion.Target)
+		}
+
+		url := LockedRef(node.Locked)
+		if url == "" {
+			return nil, fmt.Errorf("node %s has an unsupported type %q", suggestion.Target, node.Locked.Type)
+		}
+
+		overrides = append(overrides, OverrideInput{
+			Path:       suggestion.Path,
+			URL:        url,
+			Suggestion: suggestion,
+		})
+	}
+	return overrides, nil
+}
+
+// Formats locked information as a flake reference that resolves to exactly
+// the same source.
+func LockedRef(locked *Locked) string {
+	if locked == nil || locked.Type == "" {
+		return ""
+	}
+
+	original := Original{
+		Type:  locked.Type,
+		Owner: locked.Owner,
+		Repo:  locked.Repo,
+		Rev:   locked.Rev,
+		Host:  locked.Host,
+		Dir:   locked.Dir,
+		URL:   locked.URL,
+		Path:  locked.Path,
+	}
+
+	// Git references can carry both a ref and a rev; the rev alone pins them
+	switch locked.Type {
+	case "git", "hg":
+		original.Ref = locked.Ref
+	case "github", "gitlab", "sourcehut":
+		if original.Owner == "" || original.Repo == "" {
+			return ""
+		}
+	case "tarball", "file", "path":
+		ref := original.String()
+		if locked.NarHash != "" {
+			sep := "?"
+			if strings.Contains(ref, "?") {
+				sep = "&"
+			}
+			ref += sep + "narHash=" + locked.NarHash
+		}
+		return ref
+	case "indirect":
+		return ""
+	}
+
+	return original.String()
+}
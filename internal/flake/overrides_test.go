@@ -0,0 +1,49 @@
+package flake
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPlanOverrides(t *testing.T) {
+	lock := loadLock(t, duplicateNixpkgsLock)
+
+	overrides, err := PlanOverrides(lock, PlanFollows(lock))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := [][]string{
+		{"--override-input", "devshell/systems/nixpkgs", "github:NixOS/nixpkgs/aaa"},
+		{"--override-input", "home-manager/nixpkgs", "github:NixOS/nixpkgs/aaa"},
+	}
+
+	if len(overrides) != len(expected) {
+		t.Fatalf("expected %d overrides, got %d: %+v", len(expected), len(overrides), overrides)
+	}
+
+	for i, want := range expected {
+		if got := overrides[i].Args(); !slices.Equal(got, want) {
+			t.Errorf("override %d: expected %v, got %v", i, want, got)
+		}
+	}
+}
+
+func TestLockedRef(t *testing.T) {
+	testCases := []struct {
+		locked   Locked
+		expected string
+	}{
+		{Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "abc"}, "github:NixOS/nixpkgs/abc"},
+		{Locked{Type: "gitlab", Owner: "user", Repo: "project", Rev: "abc", Host: "gitlab.example.com"}, "gitlab:user/project/abc?host=gitlab.example.com"},
+		{Locked{Type: "git", URL: "https://example.com/repo.git", Ref: "main", Rev: "abc", Dir: "sub"}, "git+https://example.com/repo.git?ref=main&rev=abc&dir=sub"},
+		{Locked{Type: "tarball", URL: "https://example.com/a.tar.gz", NarHash: "sha256-x"}, "https://example.com/a.tar.gz?narHash=sha256-x"},
+		{Locked{Type: "indirect"}, ""},
+	}
+
+	for _, tc := range testCases {
+		if result := LockedRef(&tc.locked); result != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, result)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package flake
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// Rules deciding which upstream changes are reported as updates.
+type UpdatePolicy struct {
+	// How old an upstream commit must be before it counts as an update
+	Cooldown time.Duration
+
+	// Per-input rules, keyed by input path
+	Inputs map[string]InputPolicy
+
+	// Named groups of inputs that are reported and updated together, keyed by
+	// group name and listing input paths
+	Groups map[string][]string
+
+	// Returns the current time, for tests; defaults to time.Now
+	Now func() time.Time
+}
+
+// Rules for a single input.
+type InputPolicy struct {
+	// Overrides UpdatePolicy.Cooldown when set
+	Cooldown *time.Duration
+
+	// Ignore stops the input from being checked until Until, or for good when
+	// Until is zero. Reason is shown alongside.
+	Ignore bool
+	Until  time.Time
+	Reason string
+}
+
+// Values of UpdateStatus.Policy.
+const (
+	PolicyIgnored  = "ignored"
+	PolicyCooldown = "cooldown"
+)
+
+func (p UpdatePolicy) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+// Returns the group an input belongs to, or "".
+func (p UpdatePolicy) group(inputName string) string {
+	for name, members := range p.Groups {
+		if slices.Contains(members, inputName) {
+			return name
+		}
+	}
+	return ""
+}
+
+func (p UpdatePolicy) cooldown(inputName string) time.Duration {
+	if input, ok := p.Inputs[inputName]; ok && input.Cooldown != nil {
+		return *input.Cooldown
+	}
+	return p.Cooldown
+}
+
+// Marks an input that policy says not to check, reporting whether it was.
+// Ignore rules lapse once their Until date has passed.
+func (p UpdatePolicy) ignore(update *UpdateStatus) bool {
+	input, ok := p.Inputs[update.InputName]
+	if !ok || !input.Ignore || (!input.Until.IsZero() && !p.now().Before(input.Until)) {
+		return false
+	}
+
+	update.Policy = PolicyIgnored
+	update.PolicyReason = input.Reason
+	if !input.Until.IsZero() {
+		update.PolicyUntil = input.Until.Unix()
+	}
+	return true
+}
+
+// Implemented by resolvers that can find the newest commit of an input made
+// before a point in time, which lets a cooldown suggest an older update
+// instead of none at all.
+type HistoryResolver interface {
+	ResolveBefore(ctx context.Context, query Query, before time.Time) (Resolution, error)
+}
+
+// A cooldown check for an update whose latest commit is too recent.
+type pendingCooldown struct {
+	index  int
+	query  Query
+	before time.Time
+}
+
+// Holds back updates to commits younger than the cooldown. When the resolver
+// can look back in history, the newest commit old enough is suggested
+// instead; otherwise the update is reported as cooling down until the latest
+// commit is old enough. Updates without a commit date are left alone.
+func applyCooldown(ctx context.Context, updates []UpdateStatus, queries map[int]Query, opts UpdateOptions) {
+	policy := opts.Policy
+	now := policy.now()
+
+	var cooling []pendingCooldown
+	for i := range updates {
+		update := &updates[i]
+		cooldown := policy.cooldown(update.InputName)
+		if !update.IsUpdate || cooldown <= 0 || update.LatestDate == 0 || update.LatestRef != "" {
+			continue
+		}
+
+		latest := time.Unix(update.LatestDate, 0)
+		if now.Sub(latest) >= cooldown {
+			continue
+		}
+
+		update.IsUpdate = false
+		update.Policy = PolicyCooldown
+		update.PolicyUntil = latest.Add(cooldown).Unix()
+		cooling = append(cooling, pendingCooldown{index: i, query: queries[i], before: now.Add(-cooldown)})
+	}
+
+	history, ok := opts.Resolver.(HistoryResolver)
+	if !ok {
+		return
+	}
+
+	runAll(ctx, cooling, opts, func(c pendingCooldown) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		resolution, err := withRetry(ctx, opts, func(ctx context.Context) (Resolution, error) {
+			return history.ResolveBefore(ctx, c.query, c.before)
+		})
+		update := &updates[c.index]
+		if err != nil || resolution.Rev == "" || resolution.Rev == update.CurrentRev || resolution.LastModified <= update.CurrentDate {
+			return
+		}
+
+		update.IsUpdate = true
+		update.LatestRev = resolution.Rev
+		update.LatestDate = resolution.LastModified
+		update.AgeGap = 0
+		if update.CurrentDate > 0 && update.LatestDate > update.CurrentDate {
+			update.AgeGap = update.LatestDate - update.CurrentDate
+		}
+		update.PolicyUntil = 0
+	})
+}
+
+// Finds the newest commit of the tracked branch made before a point in time.
+func (r *ForgeResolver) ResolveBefore(ctx context.Context, query Query, before time.Time) (Resolution, error) {
+	repo, err := r.forgeRepo(query)
+	if err != nil {
+		return Resolution{}, err
+	}
+
+	until := before.UTC().Format(time.RFC3339)
+	var commits []struct {
+		SHA    string `json:"sha"`
+		ID     string `json:"id"`
+		Commit struct {
+			Committer struct {
+				Date time.Time `json:"date"`
+			} `json:"committer"`
+		} `json:"commit"`
+		CommittedDate time.Time `json:"committed_date"`
+	}
+
+	var endpoint string
+	switch repo.Kind {
+	case "github", "gitea":
+		params := url.Values{"until": {until}}
+		if repo.Kind == "github" {
+			params.Set("per_page", "1")
+		} else {
+			params.Set("limit", "1")
+		}
+		if repo.Ref != "" {
+			params.Set("sha", repo.Ref)
+		}
+		endpoint = fmt.Sprintf("%s/repos/%s/%s/commits?%s", r.apiBase(repo),
+			url.PathEscape(repo.Owner), url.PathEscape(repo.Repo), params.Encode())
+
+	case "gitlab":
+		owner, err := url.PathUnescape(repo.Owner)
+		if err != nil {
+			owner = repo.Owner
+		}
+		params := url.Values{"until": {until}, "per_page": {"1"}}
+		if repo.Ref != "" {
+			params.Set("ref_name", repo.Ref)
+		}
+		endpoint = fmt.Sprintf("%s/projects/%s/repository/commits?%s", r.apiBase(repo),
+			url.PathEscape(owner+"/"+repo.Repo), params.Encode())
+
+	default:
+		return Resolution{}, fmt.Errorf("%w: %s has no commit history API", ErrUnsupported, repo.Kind)
+	}
+
+	if err := r.getJSON(ctx, repo, endpoint, &commits); err != nil {
+		return Resolution{}, err
+	}
+	if len(commits) == 0 {
+		return Resolution{}, fmt.Errorf("no commit found before %s", until)
+	}
+
+	commit := commits[0]
+	resolution := Resolution{URL: query.URL, Rev: commit.SHA}
+	date := commit.Commit.Committer.Date
+	if resolution.Rev == "" {
+		resolution.Rev, date = commit.ID, commit.CommittedDate
+	}
+	if !date.IsZero() {
+		resolution.LastModified = date.Unix()
+	}
+	return resolution, nil
+}
+
+// Looks back in history with the first member that supports the input.
+func (c ChainResolver) ResolveBefore(ctx context.Context, query Query, before time.Time) (Resolution, error) {
+	return chainCall(c, "look back in history", func(history HistoryResolver) (Resolution, error) {
+		return history.ResolveBefore(ctx, query, before)
+	})
+}
+
+// Looks back in history through the wrapped resolver. The answer depends on
+// the point in time, which moves on every run, so it is not cached.
+func (c *CachingResolver) ResolveBefore(ctx context.Context, query Query, before time.Time) (Resolution, error) {
+	history, ok := c.Resolver.(HistoryResolver)
+	if !ok || c.Offline {
+		return Resolution{}, fmt.Errorf("%w: %s cannot look back in history", ErrUnsupported, c.Resolver.Name())
+	}
+	return history.ResolveBefore(ctx, query, before)
+}
@@ -0,0 +1,256 @@
+package flake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// A resolver that can also look back in history.
+type historyResolver struct {
+	funcResolver
+	before func(before time.Time) (Resolution, error)
+}
+
+func (h historyResolver) ResolveBefore(ctx context.Context, query Query, before time.Time) (Resolution, error) {
+	return h.before(before)
+}
+
+func policyLock() FlakeLock {
+	return FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root": {Inputs: map[string]any{"nixpkgs": "nixpkgs", "home-manager": "home-manager", "flake-utils": "flake-utils"}},
+			"nixpkgs": {
+				Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "old", LastModified: 1000},
+			},
+			"home-manager": {
+				Locked: &Locked{Type: "github", Owner: "nix-community", Repo: "home-manager", Rev: "old", LastModified: 1000},
+			},
+			"flake-utils": {
+				Locked: &Locked{Type: "github", Owner: "numtide", Repo: "flake-utils", Rev: "old", LastModified: 1000},
+			},
+		},
+	}
+}
+
+func TestCheckUpdatesWith_Ignore(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	var checked []string
+	resolver := funcResolver(func(ctx context.Context, query Query) (Resolution, error) {
+		checked = append(checked, query.Locked.Repo)
+		return Resolution{Rev: "new", LastModified: 2000}, nil
+	})
+
+	results, err := CheckUpdatesWith(context.Background(), policyLock(), UpdateOptions{
+		Resolver:    resolver,
+		Parallelism: 1,
+		Policy: UpdatePolicy{
+			Now: func() time.Time { return now },
+			Inputs: map[string]InputPolicy{
+				"nixpkgs":      {Ignore: true, Until: now.AddDate(0, 1, 0), Reason: "waiting for a fix"},
+				"home-manager": {Ignore: true, Until: now.AddDate(0, -1, 0)},
+				"flake-utils":  {Ignore: true},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	byName := make(map[string]UpdateStatus)
+	for _, update := range results.Updates {
+		byName[update.InputName] = update
+	}
+
+	if update := byName["nixpkgs"]; update.Policy != PolicyIgnored || update.IsUpdate ||
+		update.PolicyUntil != now.AddDate(0, 1, 0).Unix() || update.PolicyReason != "waiting for a fix" {
+		t.Errorf("expected nixpkgs to be ignored until next month, got %+v", update)
+	}
+	if update := byName["flake-utils"]; update.Policy != PolicyIgnored || update.PolicyUntil != 0 {
+		t.Errorf("expected flake-utils to be ignored for good, got %+v", update)
+	}
+	if update := byName["home-manager"]; update.Policy != "" || !update.IsUpdate {
+		t.Errorf("expected the expired rule for home-manager to lapse, got %+v", update)
+	}
+	if len(checked) != 1 || checked[0] != "home-manager" {
+		t.Errorf("expected only home-manager to be checked, got %v", checked)
+	}
+}
+
+func TestCheckUpdatesWith_Cooldown(t *testing.T) {
+	now := time.Unix(100*86400, 0)
+	recent := now.Add(-time.Hour).Unix()
+	old := now.AddDate(0, 0, -10).Unix()
+	latest := map[string]int64{"nixpkgs": recent, "home-manager": old, "flake-utils": recent}
+
+	resolve := funcResolver(func(ctx context.Context, query Query) (Resolution, error) {
+		return Resolution{Rev: "new", LastModified: latest[query.Locked.Repo]}, nil
+	})
+	policy := UpdatePolicy{
+		Cooldown: 3 * 24 * time.Hour,
+		Now:      func() time.Time { return now },
+		Inputs:   map[string]InputPolicy{"flake-utils": {Cooldown: new(time.Duration)}},
+	}
+
+	testCases := []struct {
+		name     string
+		resolver Resolver
+		nixpkgs  UpdateStatus
+	}{
+		{
+			name:     "held back",
+			resolver: resolve,
+			nixpkgs: UpdateStatus{
+				LatestRev: "new", Policy: PolicyCooldown,
+				PolicyUntil: now.Add(-time.Hour).Add(3 * 24 * time.Hour).Unix(),
+			},
+		},
+		{
+			name: "older commit suggested",
+			resolver: historyResolver{funcResolver: resolve, before: func(before time.Time) (Resolution, error) {
+				if !before.Equal(now.Add(-3 * 24 * time.Hour)) {
+					return Resolution{}, fmt.Errorf("unexpected cutoff %s", before)
+				}
+				return Resolution{Rev: "older", LastModified: old}, nil
+			}},
+			nixpkgs: UpdateStatus{LatestRev: "older", IsUpdate: true, Policy: PolicyCooldown},
+		},
+		{
+			name: "history unavailable",
+			resolver: historyResolver{funcResolver: resolve, before: func(before time.Time) (Resolution, error) {
+				return Resolution{}, ErrUnsupported
+			}},
+			nixpkgs: UpdateStatus{
+				LatestRev: "new", Policy: PolicyCooldown,
+				PolicyUntil: now.Add(-time.Hour).Add(3 * 24 * time.Hour).Unix(),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := CheckUpdatesWith(context.Background(), policyLock(), UpdateOptions{
+				Resolver:    tc.resolver,
+				Parallelism: 1,
+				Policy:      policy,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, update := range results.Updates {
+				switch update.InputName {
+				case "nixpkgs":
+					if update.LatestRev != tc.nixpkgs.LatestRev || update.IsUpdate != tc.nixpkgs.IsUpdate ||
+						update.Policy != tc.nixpkgs.Policy || update.PolicyUntil != tc.nixpkgs.PolicyUntil {
+						t.Errorf("expected nixpkgs %+v, got %+v", tc.nixpkgs, update)
+					}
+				case "home-manager", "flake-utils":
+					// Old enough, or with the cooldown turned off for the input
+					if !update.IsUpdate || update.Policy != "" {
+						t.Errorf("expected %s to be an update, got %+v", update.InputName, update)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCheckUpdatesWith_Groups(t *testing.T) {
+	resolver := funcResolver(func(ctx context.Context, query Query) (Resolution, error) {
+		return Resolution{Rev: "new"}, nil
+	})
+
+	results, err := CheckUpdatesWith(context.Background(), policyLock(), UpdateOptions{
+		Resolver: resolver,
+		Policy:   UpdatePolicy{Groups: map[string][]string{"nixpkgs-family": {"nixpkgs", "home-manager"}}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{"nixpkgs": "nixpkgs-family", "home-manager": "nixpkgs-family", "flake-utils": ""}
+	for _, update := range results.Updates {
+		if update.Group != expected[update.InputName] {
+			t.Errorf("expected %s in group %q, got %q", update.InputName, expected[update.InputName], update.Group)
+		}
+	}
+}
+
+func TestForgeResolver_ResolveBefore(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("until") != "2025-01-01T00:00:00Z" {
+			http.Error(w, "expected until", http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.EscapedPath() {
+		case "/repos/NixOS/nixpkgs/commits":
+			if query.Get("sha") != "nixos-unstable" || query.Get("per_page") != "1" {
+				http.Error(w, "expected sha and per_page", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `[{"sha": "gh-old", "commit": {"committer": {"date": "2024-12-30T00:00:00Z"}}}]`)
+		case "/projects/group%2Fproject/repository/commits":
+			fmt.Fprint(w, `[{"id": "gl-old", "committed_date": "2024-12-30T00:00:00Z"}]`)
+		case "/repos/owner/empty/commits":
+			fmt.Fprint(w, `[]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	resolver := &ForgeResolver{
+		Client:  server.Client(),
+		Hosts:   map[string]string{"git.example.com": "gitea"},
+		APIBase: map[string]string{"github.com": server.URL, "gitlab.com": server.URL, "git.example.com": server.URL},
+	}
+	before := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		query    Query
+		expected string
+		err      bool
+	}{
+		{
+			name:     "github branch",
+			query:    Query{Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs"}, Ref: "nixos-unstable"},
+			expected: "gh-old",
+		},
+		{
+			name:     "gitlab default branch",
+			query:    Query{Locked: &Locked{Type: "gitlab", Owner: "group", Repo: "project"}},
+			expected: "gl-old",
+		},
+		{
+			name:  "no commits",
+			query: Query{Locked: &Locked{Type: "git", URL: "https://git.example.com/owner/empty.git"}},
+			err:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resolution, err := resolver.ResolveBefore(context.Background(), tc.query, before)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", resolution)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resolution.Rev != tc.expected || resolution.LastModified != before.Add(-48*time.Hour).Unix() {
+				t.Errorf("expected %s from two days before, got %+v", tc.expected, resolution)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package flake
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Implemented by resolvers that can read the flake.lock of an input as it is
+// upstream at a given revision, which lets Flint predict what updating the
+// input does to the rest of the lockfile.
+type LockFetcher interface {
+	FetchLock(ctx context.Context, query Query, rev string) (FlakeLock, error)
+}
+
+// Predicts the lockfile after applying updates, by splicing the flake.lock
+// each updated input has upstream at its latest revision into the current
+// one. Follows in the current lockfile take precedence over the upstream
+// inputs they replace, as they would when locking. Inputs whose upstream
+// lockfile cannot be read are returned with the error, and only their own
+// revision changes in the prediction.
+func PreviewUpdates(ctx context.Context, flakeLock FlakeLock, updates []UpdateStatus, opts UpdateOptions) (FlakeLock, map[string]error) {
+	predicted := cloneLock(flakeLock)
+	failures := make(map[string]error)
+
+	fetcher, canFetch := opts.Resolver.(LockFetcher)
+	upstream := make([]*FlakeLock, len(updates))
+	var mu sync.Mutex
+
+	indices := make([]int, len(updates))
+	for i := range indices {
+		indices[i] = i
+	}
+
+	runAll(ctx, indices, opts, func(i int) {
+		update := updates[i]
+		nodeName, node, ok := nodeAtPath(flakeLock, update.Path)
+		if !ok || node.Locked == nil {
+			return
+		}
+
+		// Inputs that are not flakes have no inputs of their own
+		if node.Flake != nil && !*node.Flake {
+			upstream[i] = &FlakeLock{Root: "root", Nodes: map[string]Node{"root": {}}}
+			return
+		}
+
+		err := fmt.Errorf("%w: %s cannot read upstream lockfiles", ErrUnsupported, opts.Resolver.Name())
+		if canFetch && update.LatestRev != "" && ctx.Err() == nil {
+			query := updateQuery(update.InputName, nodeName, node)
+			var lock FlakeLock
+			lock, err = withRetry(ctx, opts, func(ctx context.Context) (FlakeLock, error) {
+				return fetcher.FetchLock(ctx, query, update.LatestRev)
+			})
+			if err == nil {
+				upstream[i] = &lock
+				return
+			}
+		}
+
+		mu.Lock()
+		failures[update.InputName] = err
+		mu.Unlock()
+	})
+
+	for i, update := range updates {
+		predicted = spliceLock(predicted, update, upstream[i])
+	}
+	return predicted, failures
+}
+
+// Returns the node an input path leads to through direct references.
+func nodeAtPath(flakeLock FlakeLock, inputPath []string) (string, Node, bool) {
+	name := RootName(flakeLock)
+	for _, input := range inputPath {
+		target, ok := flakeLock.Nodes[name].Inputs[input].(string)
+		if !ok {
+			return "", Node{}, false
+		}
+		name = target
+	}
+	node, ok := flakeLock.Nodes[name]
+	return name, node, ok && len(inputPath) > 0
+}
+
+// Copies a lockfile deeply enough that nodes and their inputs can be changed
+// without touching the original.
+func cloneLock(flakeLock FlakeLock) FlakeLock {
+	clone := flakeLock
+	clone.Nodes = make(map[string]Node, len(flakeLock.Nodes))
+	for name, node := range flakeLock.Nodes {
+		node.Inputs = maps.Clone(node.Inputs)
+		clone.Nodes[name] = node
+	}
+	return clone
+}
+
+// Moves the input an update is for to its latest revision and, when its
+// upstream lockfile is known, replaces the inputs below it with the upstream
+// ones. Nodes nothing refers to any more are dropped.
+func spliceLock(flakeLock FlakeLock, update UpdateStatus, upstream *FlakeLock) FlakeLock {
+	nodeName, node, ok := nodeAtPath(flakeLock, update.Path)
+	if !ok || node.Locked == nil {
+		return flakeLock
+	}
+
+	locked := *node.Locked
+	locked.Rev = update.LatestRev
+	locked.LastModified = update.LatestDate
+	locked.NarHash = update.LatestNarHash
+	if update.LatestRef != "" && locked.Ref != "" {
+		locked.Ref = update.LatestRef
+	}
+	node.Locked = &locked
+	flakeLock.Nodes[nodeName] = node
+
+	if upstream != nil {
+		splicer := splicer{target: flakeLock, upstream: *upstream, prefix: update.Path, copied: make(map[string]string)}
+		splicer.graft(nodeName, node, RootName(*upstream))
+	}
+
+	return pruneLock(flakeLock)
+}
+
+// Copies nodes from an upstream lockfile into the one being predicted, below
+// the input at prefix.
+type splicer struct {
+	target, upstream FlakeLock
+	prefix           []string
+
+	// Upstream node names to the names they were copied to
+	copied map[string]string
+}
+
+// Gives the target node the inputs of an upstream node. Inputs the target
+// node already follows elsewhere keep following it; the others are copied
+// from upstream, translating upstream follows to paths from the root.
+func (s *splicer) graft(name string, current Node, source string) {
+	inputs := make(map[string]any)
+	for input, ref := range s.upstream.Nodes[source].Inputs {
+		if follows, ok := current.Inputs[input].([]any); ok {
+			inputs[input] = follows
+			continue
+		}
+
+		switch ref := ref.(type) {
+		case []any:
+			inputs[input] = append(anySlice(s.prefix), ref...)
+		case string:
+			copied, done := s.copied[ref]
+			if !done {
+				copied = uniqueNodeName(s.target, ref)
+				s.copied[ref] = copied
+
+				node := s.upstream.Nodes[ref]
+				node.Inputs = nil
+				s.target.Nodes[copied] = node
+
+				// Follows declared below this input in the current lockfile
+				// still apply to the upstream version of it
+				var existing Node
+				if target, ok := current.Inputs[input].(string); ok {
+					existing = s.target.Nodes[target]
+				}
+				s.graft(copied, existing, ref)
+			}
+			inputs[input] = copied
+		}
+	}
+
+	node := s.target.Nodes[name]
+	node.Inputs = inputs
+	if len(inputs) == 0 {
+		node.Inputs = nil
+	}
+	s.target.Nodes[name] = node
+}
+
+func anySlice(values []string) []any {
+	result := make([]any, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
+
+// Returns name, or name with the first free numeric suffix, like Nix does for
+// nodes of the same name.
+func uniqueNodeName(flakeLock FlakeLock, name string) string {
+	base := name
+	if i := strings.LastIndex(name, "_"); i > 0 && i < len(name)-1 && strings.Trim(name[i+1:], "0123456789") == "" {
+		base = name[:i]
+	}
+
+	candidate := base
+	for n := 2; ; n++ {
+		if _, taken := flakeLock.Nodes[candidate]; !taken {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s_%d", base, n)
+	}
+}
+
+// Drops the nodes that cannot be reached from the root.
+func pruneLock(flakeLock FlakeLock) FlakeLock {
+	reachable := map[string]bool{RootName(flakeLock): true}
+	queue := []string{RootName(flakeLock)}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, ref := range flakeLock.Nodes[current].Inputs {
+			if target, ok := ref.(string); ok && !reachable[target] {
+				reachable[target] = true
+				queue = append(queue, target)
+			}
+		}
+	}
+
+	maps.DeleteFunc(flakeLock.Nodes, func(name string, _ Node) bool { return !reachable[name] })
+	return flakeLock
+}
+
+// Reads an input's flake.lock at a revision through the forge's file API, or
+// from sourcehut's blob view.
+func (r *ForgeResolver) FetchLock(ctx context.Context, query Query, rev string) (FlakeLock, error) {
+	repo, err := r.forgeRepo(query)
+	if err != nil {
+		return FlakeLock{}, err
+	}
+
+	file := "flake.lock"
+	if query.Locked.Dir != "" {
+		file = path.Join(query.Locked.Dir, file)
+	}
+
+	var data []byte
+	switch repo.Kind {
+	case "github", "gitea":
+		var content forgeFile
+		endpoint := fmt.Sprintf("%s/repos/%s/%s/contents/%s?ref=%s", r.apiBase(repo),
+			url.PathEscape(repo.Owner), url.PathEscape(repo.Repo), escapePath(file), url.QueryEscape(rev))
+		if err = r.getJSON(ctx, repo, endpoint, &content); err == nil {
+			data, err = content.decode()
+		}
+
+	case "gitlab":
+		owner, unescapeErr := url.PathUnescape(repo.Owner)
+		if unescapeErr != nil {
+			owner = repo.Owner
+		}
+		var content forgeFile
+		endpoint := fmt.Sprintf("%s/projects/%s/repository/files/%s?ref=%s", r.apiBase(repo),
+			url.PathEscape(owner+"/"+repo.Repo), url.PathEscape(file), url.QueryEscape(rev))
+		if err = r.getJSON(ctx, repo, endpoint, &content); err == nil {
+			data, err = content.decode()
+		}
+
+	case "sourcehut":
+		data, err = r.get(ctx, repo, fmt.Sprintf("%s/%s/%s/blob/%s/%s", r.apiBase(repo),
+			repo.Owner, repo.Repo, url.PathEscape(rev), escapePath(file)), "")
+
+	default:
+		return FlakeLock{}, fmt.Errorf("%w: %s cannot fetch files at a revision", ErrUnsupported, repo.Kind)
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		return FlakeLock{}, fmt.Errorf("no %s upstream at %s", file, rev)
+	}
+	if err != nil {
+		return FlakeLock{}, err
+	}
+	return parseLock(data)
+}
+
+// A file as returned by the GitHub, Gitea and GitLab file APIs.
+type forgeFile struct {
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+}
+
+func (f forgeFile) decode() ([]byte, error) {
+	if f.Encoding != "base64" {
+		return nil, fmt.Errorf("unexpected file encoding %q", f.Encoding)
+	}
+	return base64.StdEncoding.DecodeString(strings.ReplaceAll(f.Content, "\n", ""))
+}
+
+// Escapes each segment of a slash-separated path.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func parseLock(data []byte) (FlakeLock, error) {
+	var lock FlakeLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return lock, fmt.Errorf("failed to parse upstream flake.lock: %w", err)
+	}
+	if _, ok := lock.Nodes[RootName(lock)]; !ok {
+		return lock, fmt.Errorf("upstream flake.lock has no root node")
+	}
+	return lock, nil
+}
+
+// Reads an input's lockfile at a revision from the first member that can.
+func (c ChainResolver) FetchLock(ctx context.Context, query Query, rev string) (FlakeLock, error) {
+	return chainCall(c, "read upstream lockfiles", func(fetcher LockFetcher) (FlakeLock, error) {
+		return fetcher.FetchLock(ctx, query, rev)
+	})
+}
+
+// Reads an upstream lockfile through the wrapped resolver. The lockfile at a
+// revision never changes, so cached ones are used regardless of TTL.
+func (c *CachingResolver) FetchLock(ctx context.Context, query Query, rev string) (FlakeLock, error) {
+	fetcher, err := capabilityOf[LockFetcher](c.Resolver, "read upstream lockfiles")
+	if err != nil {
+		return FlakeLock{}, err
+	}
+
+	var dir string
+	if query.Locked != nil {
+		dir = query.Locked.Dir
+	}
+	key := "lock\x00" + c.Resolver.Name() + "\x00" + queryKey(query) + "\x00" + dir + "\x00" + rev
+	offline := fmt.Errorf("%s is not cached and flint is offline", query.URL)
+	return cachedCall(c, key, true, offline, func() (FlakeLock, error) {
+		return fetcher.FetchLock(ctx, query, rev)
+	})
+}
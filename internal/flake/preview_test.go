@@ -0,0 +1,231 @@
+package flake
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// A resolver that serves upstream lockfiles from a map keyed by revision.
+type lockResolver struct {
+	funcResolver
+	locks map[string]FlakeLock
+}
+
+func (l lockResolver) FetchLock(ctx context.Context, query Query, rev string) (FlakeLock, error) {
+	lock, ok := l.locks[rev]
+	if !ok {
+		return FlakeLock{}, fmt.Errorf("no flake.lock upstream at %s", rev)
+	}
+	return lock, nil
+}
+
+func previewLock(follows bool) FlakeLock {
+	hmInputs := map[string]any{"nixpkgs": "nixpkgs_2"}
+	if follows {
+		hmInputs["nixpkgs"] = []any{"nixpkgs"}
+	}
+
+	lock := FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root":    {Inputs: map[string]any{"nixpkgs": "nixpkgs", "hm": "hm"}},
+			"nixpkgs": {Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "n1"}},
+			"hm":      {Inputs: hmInputs, Locked: &Locked{Type: "github", Owner: "nix-community", Repo: "home-manager", Rev: "h1"}},
+		},
+	}
+	if !follows {
+		lock.Nodes["nixpkgs_2"] = Node{Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "n1"}}
+	}
+	return lock
+}
+
+// The upstream lockfile of home-manager at h2, which adds flake-utils
+// following its own systems input.
+var upstreamHomeManager = FlakeLock{
+	Root: "root",
+	Nodes: map[string]Node{
+		"root":        {Inputs: map[string]any{"nixpkgs": "nixpkgs", "flake-utils": "flake-utils", "systems": "systems"}},
+		"nixpkgs":     {Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "n0"}},
+		"flake-utils": {Inputs: map[string]any{"systems": []any{"systems"}}, Locked: &Locked{Type: "github", Owner: "numtide", Repo: "flake-utils", Rev: "f1"}},
+		"systems":     {Locked: &Locked{Type: "github", Owner: "nix-systems", Repo: "default", Rev: "s1"}},
+	},
+}
+
+func TestPreviewUpdates(t *testing.T) {
+	update := UpdateStatus{InputName: "hm", Path: []string{"hm"}, CurrentRev: "h1", LatestRev: "h2", IsUpdate: true}
+	resolver := lockResolver{locks: map[string]FlakeLock{"h2": upstreamHomeManager}}
+
+	t.Run("follows kept", func(t *testing.T) {
+		lock := previewLock(true)
+		predicted, failures := PreviewUpdates(context.Background(), lock, []UpdateStatus{update}, UpdateOptions{Resolver: resolver})
+		if len(failures) != 0 {
+			t.Fatalf("unexpected failures: %v", failures)
+		}
+
+		hm := predicted.Nodes["hm"]
+		if hm.Locked.Rev != "h2" {
+			t.Errorf("expected hm at h2, got %s", hm.Locked.Rev)
+		}
+		if follows, ok := hm.Inputs["nixpkgs"].([]any); !ok || !slices.Equal(follows, []any{"nixpkgs"}) {
+			t.Errorf("expected hm to keep following nixpkgs, got %v", hm.Inputs["nixpkgs"])
+		}
+
+		utils := predicted.Nodes[hm.Inputs["flake-utils"].(string)]
+		if follows, ok := utils.Inputs["systems"].([]any); !ok || !slices.Equal(follows, []any{"hm", "systems"}) {
+			t.Errorf("expected upstream follows to be rooted at hm, got %v", utils.Inputs["systems"])
+		}
+
+		diff := DiffLocks(lock, predicted)
+		if len(diff.NewDuplicates) != 0 {
+			t.Errorf("expected no new duplicates, got %v", diff.NewDuplicates)
+		}
+		var changed []string
+		for _, change := range diff.Changes {
+			changed = append(changed, change.Input)
+		}
+		if !slices.Equal(changed, []string{"hm", "hm/flake-utils", "hm/systems"}) {
+			t.Errorf("unexpected changes %v", changed)
+		}
+
+		// The lockfile previewed is left alone
+		if lock.Nodes["hm"].Locked.Rev != "h1" || len(lock.Nodes) != 3 {
+			t.Errorf("expected the current lockfile to be unchanged, got %+v", lock.Nodes)
+		}
+	})
+
+	t.Run("new duplicate", func(t *testing.T) {
+		lock := previewLock(false)
+		predicted, _ := PreviewUpdates(context.Background(), lock, []UpdateStatus{update}, UpdateOptions{Resolver: resolver})
+
+		diff := DiffLocks(lock, predicted)
+		urls := diff.NewDuplicates["github:NixOS/nixpkgs"]
+		if len(urls) != 2 || !slices.Contains(urls, "github:NixOS/nixpkgs?rev=n0") {
+			t.Errorf("expected hm's older nixpkgs to become a duplicate, got %v", diff.NewDuplicates)
+		}
+		if _, ok := predicted.Nodes["nixpkgs_2"]; ok && predicted.Nodes["nixpkgs_2"].Locked.Rev == "n1" {
+			t.Error("expected the replaced node to be dropped")
+		}
+	})
+
+	t.Run("lockfile unavailable", func(t *testing.T) {
+		unavailable := update
+		unavailable.LatestRev = "h3"
+		predicted, failures := PreviewUpdates(context.Background(), previewLock(true), []UpdateStatus{unavailable}, UpdateOptions{Resolver: resolver})
+		if failures["hm"] == nil {
+			t.Error("expected the missing lockfile to be reported")
+		}
+		if hm := predicted.Nodes["hm"]; hm.Locked.Rev != "h3" || len(hm.Inputs) != 1 {
+			t.Errorf("expected only hm's revision to change, got %+v", hm)
+		}
+	})
+
+	t.Run("resolver cannot fetch", func(t *testing.T) {
+		_, failures := PreviewUpdates(context.Background(), previewLock(true), []UpdateStatus{update}, UpdateOptions{Resolver: resolver.funcResolver})
+		if !errors.Is(failures["hm"], ErrUnsupported) {
+			t.Errorf("expected an unsupported error, got %v", failures["hm"])
+		}
+	})
+}
+
+func TestForgeResolver_FetchLock(t *testing.T) {
+	lock := `{"nodes": {"root": {"inputs": {"nixpkgs": "nixpkgs"}}, "nixpkgs": {"locked": {"type": "github", "owner": "NixOS", "repo": "nixpkgs", "rev": "abc"}}}, "root": "root", "version": 7}`
+	encoded := base64.StdEncoding.EncodeToString([]byte(lock))
+	file := fmt.Sprintf(`{"content": %q, "encoding": "base64"}`, encoded[:20]+"\n"+encoded[20:])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() + "?" + r.URL.RawQuery {
+		case "/repos/nix-community/home-manager/contents/flake.lock?ref=h2",
+			"/repos/owner/repo/contents/sub/dir/flake.lock?ref=h2",
+			"/projects/group%2Fproject/repository/files/flake.lock?ref=h2":
+			fmt.Fprint(w, file)
+		case "/~user/repo/blob/h2/flake.lock?":
+			fmt.Fprint(w, lock)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	resolver := &ForgeResolver{
+		Client: server.Client(),
+		Hosts:  map[string]string{"git.example.com": "gitea", "code.example.com": "pagure"},
+		APIBase: map[string]string{
+			"github.com":      server.URL,
+			"gitlab.com":      server.URL,
+			"git.example.com": server.URL,
+			"git.sr.ht":       server.URL,
+		},
+	}
+
+	testCases := []struct {
+		name   string
+		locked *Locked
+		rev    string
+		err    bool
+	}{
+		{name: "github", locked: &Locked{Type: "github", Owner: "nix-community", Repo: "home-manager"}, rev: "h2"},
+		{name: "gitea subdirectory", locked: &Locked{Type: "git", URL: "https://git.example.com/owner/repo.git", Dir: "sub/dir"}, rev: "h2"},
+		{name: "gitlab", locked: &Locked{Type: "gitlab", Owner: "group", Repo: "project"}, rev: "h2"},
+		{name: "sourcehut", locked: &Locked{Type: "sourcehut", Owner: "~user", Repo: "repo"}, rev: "h2"},
+		{name: "no lockfile", locked: &Locked{Type: "github", Owner: "nix-community", Repo: "home-manager"}, rev: "h3", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fetched, err := resolver.FetchLock(context.Background(), Query{Locked: tc.locked}, tc.rev)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", fetched)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fetched.Nodes["nixpkgs"].Locked == nil || fetched.Nodes["nixpkgs"].Locked.Rev != "abc" {
+				t.Errorf("unexpected lockfile %+v", fetched)
+			}
+		})
+	}
+	// Forges flint knows nothing about are left to other resolvers
+	_, err := resolver.FetchLock(context.Background(), Query{Locked: &Locked{Type: "git", URL: "https://code.example.com/owner/repo.git"}}, "h2")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected an unknown forge to be unsupported, got %v", err)
+	}
+}
+
+func TestNixResolver_FetchLock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake nix binary is a shell script")
+	}
+
+	// Prints metadata for the reference it was asked about, including the
+	// lockfile like nix flake metadata does
+	nix := filepath.Join(t.TempDir(), "nix")
+	script := `#!/bin/sh
+for ref; do :; done
+echo "{\"locked\": {\"type\": \"github\", \"rev\": \"h2\"}, \"locks\": {\"nodes\": {\"root\": {\"inputs\": {\"ref\": \"ref\"}}, \"ref\": {\"locked\": {\"type\": \"path\", \"path\": \"$ref\"}}}, \"root\": \"root\"}}"
+`
+	if err := os.WriteFile(nix, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := &NixResolver{Binary: nix}
+	query := Query{Locked: &Locked{Type: "github", Owner: "nix-community", Repo: "home-manager", Rev: "h1", NarHash: "sha256-old"}}
+	lock, err := resolver.FetchLock(context.Background(), query, "h2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref := lock.Nodes["ref"].Locked.Path; ref != "github:nix-community/home-manager/h2" {
+		t.Errorf("expected the lockfile at the new revision, got %q", ref)
+	}
+}
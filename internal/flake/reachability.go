@@ -0,0 +1,286 @@
+package flake
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Whether a locked revision can still be fetched from upstream.
+type Reachability string
+
+const (
+	// The revision is on the branch the input tracks
+	Reachable Reachability = "reachable"
+
+	// The revision still exists upstream, but is no longer on the branch
+	// the input tracks, as after a force-push. Forges keep such commits
+	// around for a while before they are garbage collected.
+	Orphaned Reachability = "orphaned"
+
+	// The revision cannot be found upstream, so the input can no longer be
+	// fetched from a fresh checkout
+	Unreachable Reachability = "unreachable"
+)
+
+// Implemented by resolvers that can tell whether a locked revision is still
+// reachable from the head of the ref an input tracks. Without a head, as for
+// inputs pinned to a revision, checkers only tell whether the revision still
+// exists. Checkers return ErrUnsupported for inputs they cannot handle.
+type ReachabilityChecker interface {
+	CheckReachability(ctx context.Context, query Query, rev, head string) (Reachability, error)
+}
+
+// Checks a revision with the first member that supports the input.
+func (c ChainResolver) CheckReachability(ctx context.Context, query Query, rev, head string) (Reachability, error) {
+	return chainCall(c, "check whether revisions are reachable", func(checker ReachabilityChecker) (Reachability, error) {
+		return checker.CheckReachability(ctx, query, rev, head)
+	})
+}
+
+// Checks revisions through the wrapped resolver. Whether a revision is
+// reachable from a given head rarely changes, and a new head is checked
+// afresh, so cached answers are used regardless of TTL.
+func (c *CachingResolver) CheckReachability(ctx context.Context, query Query, rev, head string) (Reachability, error) {
+	checker, err := capabilityOf[ReachabilityChecker](c.Resolver, "check whether revisions are reachable")
+	if err != nil {
+		return "", err
+	}
+
+	key := "reachability\x00" + c.Resolver.Name() + "\x00" + queryKey(query) + "\x00" + rev + "..." + head
+	offline := fmt.Errorf("%s is not cached and flint is offline", query.URL)
+	return cachedCall(c, key, true, offline, func() (Reachability, error) {
+		return checker.CheckReachability(ctx, query, rev, head)
+	})
+}
+
+func (r *RewritingResolver) CheckReachability(ctx context.Context, query Query, rev, head string) (Reachability, error) {
+	return rewrittenCall(r, query, "check whether revisions are reachable", func(checker ReachabilityChecker, moved Query) (Reachability, error) {
+		return checker.CheckReachability(ctx, moved, rev, head)
+	})
+}
+
+// Asks the forge whether the commit still exists, then whether head is
+// ahead of it rather than diverged from it. sourcehut has no API for this
+// and is reported as unsupported.
+func (r *ForgeResolver) CheckReachability(ctx context.Context, query Query, rev, head string) (Reachability, error) {
+	repo, err := r.forgeRepo(query)
+	if err != nil {
+		return "", err
+	}
+
+	// A revision compared with the head when prefetching exists, and is on
+	// the branch unless it is ahead of the head
+	if ahead, ok := r.prefetchedCompare(repo, head, rev); ok && head != "" {
+		if ahead > 0 {
+			return Orphaned, nil
+		}
+		return Reachable, nil
+	}
+
+	var endpoint string
+	switch repo.Kind {
+	case "github", "gitea":
+		endpoint = fmt.Sprintf("%s/repos/%s/%s/git/commits/%s", r.apiBase(repo),
+			url.PathEscape(repo.Owner), url.PathEscape(repo.Repo), url.PathEscape(rev))
+	case "gitlab":
+		owner, err := url.PathUnescape(repo.Owner)
+		if err != nil {
+			owner = repo.Owner
+		}
+		endpoint = fmt.Sprintf("%s/projects/%s/repository/commits/%s?stats=false", r.apiBase(repo),
+			url.PathEscape(owner+"/"+repo.Repo), url.PathEscape(rev))
+	default:
+		return "", fmt.Errorf("%w: %s cannot check whether revisions are reachable", ErrUnsupported, repo.Kind)
+	}
+
+	// GitHub answers 422 rather than 404 for some malformed or missing
+	// commits
+	var commit struct{}
+	var httpErr *HTTPError
+	err = r.getJSON(ctx, repo, endpoint, &commit)
+	if errors.As(err, &httpErr) && (httpErr.StatusCode == http.StatusNotFound || httpErr.StatusCode == http.StatusUnprocessableEntity) {
+		return Unreachable, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if head == "" {
+		return Reachable, nil
+	}
+
+	// A revision on the branch is never ahead of its head
+	comparison, err := r.Compare(ctx, query, head, rev)
+	if err != nil {
+		return "", err
+	}
+	if comparison.CommitsBehind > 0 {
+		return Orphaned, nil
+	}
+	return Reachable, nil
+}
+
+// Asks the remote for the locked commit alone, as a fresh fetch would,
+// without any of its trees. Servers only hand out commits reachable from
+// their refs, so a refusal means the commit can no longer be fetched; plain
+// git cannot tell which ref it is reachable from. Needs protocol v2 and a
+// server that supports filters, so that nothing large is downloaded.
+func (r *GitResolver) CheckReachability(ctx context.Context, query Query, rev, head string) (Reachability, error) {
+	remote, _, err := gitRemote(query)
+	if err != nil {
+		return "", err
+	}
+	if !IsRev(rev) {
+		return "", fmt.Errorf("%w: %s is not a commit hash", ErrUnsupported, rev)
+	}
+
+	lines, err := r.advertisement(ctx, remote)
+	if err != nil {
+		return "", err
+	}
+	if len(lines) == 0 || lines[0].text() != "version 2" || !fetchCapabilities(lines)["filter"] {
+		return "", fmt.Errorf("%w: %s cannot fetch single commits", ErrUnsupported, remote.Redacted())
+	}
+
+	var req bytes.Buffer
+	writePktLine(&req, "command=fetch\n")
+	writePktLine(&req, "agent=flint\n")
+	req.WriteString("0001")
+	writePktLine(&req, "want "+rev+"\n")
+	writePktLine(&req, "deepen 1\n")
+	writePktLine(&req, "filter tree:0\n")
+	writePktLine(&req, "no-progress\n")
+	writePktLine(&req, "done\n")
+	req.WriteString("0000")
+
+	endpoint := strings.TrimSuffix(remote.String(), "/") + "/git-upload-pack"
+	body, err := r.request(ctx, http.MethodPost, endpoint, &req, remote)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := readPktLines(body)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", remote.Redacted(), err)
+	}
+	for _, line := range response {
+		text := line.text()
+		switch {
+		case text == "packfile":
+			return Reachable, nil
+		case strings.Contains(text, "not our ref"):
+			return Unreachable, nil
+		case strings.HasPrefix(text, "ERR "):
+			return "", fmt.Errorf("%s: %s", remote.Redacted(), strings.TrimPrefix(text, "ERR "))
+		}
+	}
+	return "", fmt.Errorf("%s: unexpected response to fetch", remote.Redacted())
+}
+
+// Returns the features of the fetch command from a protocol v2
+// capability advertisement, such as "shallow" and "filter".
+func fetchCapabilities(lines []pktLine) map[string]bool {
+	features := make(map[string]bool)
+	for _, line := range lines {
+		if line.flush {
+			break
+		}
+		if value, ok := strings.CutPrefix(line.text(), "fetch="); ok {
+			for _, feature := range strings.Fields(value) {
+				features[feature] = true
+			}
+		}
+	}
+	return features
+}
+
+// A reachability check shared by every input locked to the same revision of
+// the same repository and ref.
+type pendingReachability struct {
+	key     string
+	query   Query
+	rev     string
+	head    string
+	updates []int
+}
+
+// Checks whether the locked revisions of inputs can still be fetched. Inputs
+// tracking a branch that has moved on are checked against its head; locked
+// revisions that are the head of their branch are reachable by definition.
+// Inputs without a head, such as those pinned to a revision or locked to a
+// tag, are only checked for whether the revision still exists. Failures are
+// left out, as the regular update check already reports problems with the
+// input, but inputs the resolver cannot check are marked as unchecked.
+func checkReachability(ctx context.Context, updates []UpdateStatus, pending []*pendingQuery, locked map[int]Query, opts UpdateOptions) {
+	if !opts.CheckReachability {
+		return
+	}
+	checker, ok := opts.Resolver.(ReachabilityChecker)
+
+	checks := make(map[string]*pendingReachability)
+	add := func(key string, query Query, rev, head string, i int) {
+		if checks[key] == nil {
+			checks[key] = &pendingReachability{key: key, query: query, rev: rev, head: head}
+		}
+		checks[key].updates = append(checks[key].updates, i)
+	}
+
+	covered := make(map[int]bool)
+	for _, p := range pending {
+		head := p.resolution.Rev
+		if p.err != nil || head == "" {
+			continue
+		}
+		for _, i := range p.updates {
+			covered[i] = true
+			rev := updates[i].CurrentRev
+			if updates[i].Error != "" || rev == "" || rev == head {
+				continue
+			}
+			add(p.key+"\x00"+rev+"..."+head, p.query, rev, head, i)
+		}
+	}
+
+	for i, query := range locked {
+		rev := updates[i].CurrentRev
+		if covered[i] || updates[i].Error != "" || rev == "" {
+			continue
+		}
+		add(queryKey(query)+"\x00"+rev, query, rev, "", i)
+	}
+
+	runAll(ctx, slices.SortedFunc(maps.Values(checks), func(a, b *pendingReachability) int {
+		return strings.Compare(a.key, b.key)
+	}), opts, func(c *pendingReachability) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		reachability, err := Reachability(""), fmt.Errorf("%w: %s cannot check whether revisions are reachable", ErrUnsupported, opts.Resolver.Name())
+		if ok {
+			reachability, err = withRetry(ctx, opts, func(ctx context.Context) (Reachability, error) {
+				return checker.CheckReachability(ctx, c.query, c.rev, c.head)
+			})
+		}
+		if errors.Is(err, ErrUnsupported) {
+			for _, i := range c.updates {
+				updates[i].Unchecked = append(updates[i].Unchecked, "reachability")
+			}
+			return
+		}
+		if err != nil || reachability == Reachable {
+			return
+		}
+
+		for _, i := range c.updates {
+			updates[i].Reachability = string(reachability)
+		}
+	})
+}
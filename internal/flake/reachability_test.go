@@ -0,0 +1,197 @@
+package flake
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestForgeResolver_CheckReachability(t *testing.T) {
+	server := newForgeServer(t)
+	defer server.Close()
+
+	resolver := &ForgeResolver{
+		Client:  server.Client(),
+		APIBase: map[string]string{"github.com": server.URL, "git.sr.ht": server.URL},
+	}
+	query := Query{Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs"}}
+
+	testCases := []struct {
+		name     string
+		rev      string
+		head     string
+		expected Reachability
+	}{
+		{"on branch", "old", "new", Reachable},
+		{"orphaned", "forked", "new", Orphaned},
+		{"gone", "gone", "new", Unreachable},
+		// Without a head, only whether the commit exists is checked
+		{"pinned", "forked", "", Reachable},
+		{"pinned and gone", "gone", "", Unreachable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reachability, err := resolver.CheckReachability(context.Background(), query, tc.rev, tc.head)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reachability != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, reachability)
+			}
+		})
+	}
+
+	_, err := resolver.CheckReachability(context.Background(), Query{Locked: &Locked{Type: "sourcehut", Owner: "~user", Repo: "repo"}}, "old", "new")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected sourcehut to be unsupported, got %v", err)
+	}
+}
+
+func TestGitResolver_CheckReachability(t *testing.T) {
+	for _, v2 := range []bool{false, true} {
+		name := "v0"
+		if v2 {
+			name = "v2"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			server := newGitServer(t, v2, "", "")
+			defer server.Close()
+
+			resolver := &GitResolver{Client: server.Client()}
+			query := Query{Locked: &Locked{Type: "git", URL: server.URL + "/repo.git"}}
+
+			reachability, err := resolver.CheckReachability(context.Background(), query, devOID, mainOID)
+			if !v2 {
+				if !errors.Is(err, ErrUnsupported) {
+					t.Errorf("expected protocol v0 to be unsupported, got %v", err)
+				}
+				return
+			}
+			if err != nil || reachability != Reachable {
+				t.Errorf("expected an advertised commit to be reachable, got %s, %v", reachability, err)
+			}
+
+			reachability, err = resolver.CheckReachability(context.Background(), query, strings.Repeat("9", 40), mainOID)
+			if err != nil || reachability != Unreachable {
+				t.Errorf("expected a missing commit to be unreachable, got %s, %v", reachability, err)
+			}
+		})
+	}
+}
+
+// A resolver whose reachability checks are answered by a function.
+type reachabilityResolver struct {
+	funcResolver
+	check func(rev, head string) (Reachability, error)
+}
+
+func (r reachabilityResolver) CheckReachability(ctx context.Context, query Query, rev, head string) (Reachability, error) {
+	return r.check(rev, head)
+}
+
+func TestCheckUpdatesWith_Reachability(t *testing.T) {
+	node := func(repo, rev, ref string) Node {
+		return Node{
+			Locked:   &Locked{Type: "github", Owner: "owner", Repo: repo, Rev: rev},
+			Original: &Original{Type: "github", Owner: "owner", Repo: repo, Ref: ref},
+		}
+	}
+	lock := FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root": {Inputs: map[string]any{
+				"current": "current", "behind": "behind", "forced": "forced", "deleted": "deleted", "failing": "failing",
+				"pinned": "pinned", "pinned-gone": "pinned-gone", "tagged": "tagged",
+			}},
+			"current": node("current", "head", ""),
+			"behind":  node("behind", "ancestor", ""),
+			"forced":  node("forced", "forced", "main"),
+			"deleted": node("deleted", "deleted", ""),
+			"failing": node("failing", "failing", ""),
+			"pinned": {
+				Locked:   &Locked{Type: "github", Owner: "owner", Repo: "pinned", Rev: "pinned"},
+				Original: &Original{Type: "github", Owner: "owner", Repo: "pinned", Rev: "pinned"},
+			},
+			"pinned-gone": {
+				Locked:   &Locked{Type: "github", Owner: "owner", Repo: "pinned-gone", Rev: "vanished"},
+				Original: &Original{Type: "github", Owner: "owner", Repo: "pinned-gone", Rev: "vanished"},
+			},
+			"tagged": node("tagged", "retagged", "v1.0.0"),
+		},
+	}
+
+	var checked []string
+	heads := make(map[string]string)
+	resolver := reachabilityResolver{
+		funcResolver(func(ctx context.Context, query Query) (Resolution, error) {
+			return Resolution{URL: query.URL, Rev: "head"}, nil
+		}),
+		func(rev, head string) (Reachability, error) {
+			checked = append(checked, rev)
+			heads[rev] = head
+			switch rev {
+			case "forced":
+				return Orphaned, nil
+			case "deleted", "vanished", "retagged":
+				return Unreachable, nil
+			case "failing":
+				return "", errors.New("rate limited")
+			}
+			return Reachable, nil
+		},
+	}
+
+	results, err := CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(checked) > 0 {
+		t.Errorf("expected no checks unless asked for, got %v", checked)
+	}
+
+	results, err = CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver, Parallelism: 1, CheckReachability: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"current": "", "behind": "", "forced": "orphaned", "deleted": "unreachable", "failing": "",
+		"pinned": "", "pinned-gone": "unreachable", "tagged": "unreachable",
+	}
+	for _, update := range results.Updates {
+		if update.Error != "" {
+			t.Errorf("%s: expected no error, got %s", update.InputName, update.Error)
+		}
+		if update.Reachability != expected[update.InputName] {
+			t.Errorf("%s: expected reachability %q, got %q", update.InputName, expected[update.InputName], update.Reachability)
+		}
+	}
+	for _, rev := range checked {
+		if rev == "head" {
+			t.Errorf("expected revisions at the head of their branch not to be checked")
+		}
+	}
+	// Pinned inputs have no branch to check against
+	if head, ok := heads["vanished"]; !ok || head != "" {
+		t.Errorf("expected the pinned revision to be checked without a head, got %q", head)
+	}
+
+	// Resolvers that cannot check revisions leave the inputs unchecked
+	results, err = CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver.funcResolver, CheckReachability: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, update := range results.Updates {
+		want := []string{"reachability"}
+		if update.InputName == "current" {
+			want = nil
+		}
+		if !slices.Equal(update.Unchecked, want) {
+			t.Errorf("%s: expected unchecked %v, got %v", update.InputName, want, update.Unchecked)
+		}
+	}
+}
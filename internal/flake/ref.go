@@ -0,0 +1,213 @@
+package flake
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var revPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Returns whether s looks like a full git commit hash.
+func IsRev(s string) bool {
+	return revPattern.MatchString(s)
+}
+
+// Parses a flake reference such as "github:NixOS/nixpkgs/nixos-unstable" or
+// "git+https://example.com/repo?ref=main" into the attributes Nix records as
+// the original of a locked input.
+func ParseRef(ref string) (Original, error) {
+	var original Original
+
+	if ref == "" {
+		return original, fmt.Errorf("empty flake reference")
+	}
+
+	// Bare paths
+	if strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, "./") || strings.HasPrefix(ref, "../") || ref == "." {
+		ref = "path:" + ref
+	}
+
+	scheme, rest, found := strings.Cut(ref, ":")
+	if !found || strings.ContainsAny(scheme, "/?") {
+		// Indirect references such as "nixpkgs" or "nixpkgs/nixos-unstable"
+		scheme, rest = "flake", ref
+	}
+
+	rest, rawQuery, _ := strings.Cut(rest, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return original, fmt.Errorf("invalid query in flake reference %q: %w", ref, err)
+	}
+
+	original.Ref = query.Get("ref")
+	original.Rev = query.Get("rev")
+	original.Dir = query.Get("dir")
+
+	switch scheme {
+	case "github", "gitlab", "sourcehut":
+		parts := strings.Split(rest, "/")
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			return original, fmt.Errorf("flake reference %q is missing owner/repo", ref)
+		}
+
+		original.Type = scheme
+		original.Owner = parts[0]
+		original.Repo = parts[1]
+		original.Host = query.Get("host")
+
+		if len(parts) > 2 {
+			refOrRev := strings.Join(parts[2:], "/")
+			if IsRev(refOrRev) {
+				original.Rev = refOrRev
+			} else {
+				original.Ref = refOrRev
+			}
+		}
+
+	case "flake":
+		parts := strings.Split(rest, "/")
+		original.Type = "indirect"
+		original.ID = parts[0]
+		if len(parts) > 1 {
+			refOrRev := strings.Join(parts[1:], "/")
+			if IsRev(refOrRev) {
+				original.Rev = refOrRev
+			} else {
+				original.Ref = refOrRev
+			}
+		}
+
+	case "path":
+		original.Type = "path"
+		original.Path = rest
+
+	case "http", "https":
+		original.Type = "tarball"
+		original.URL = scheme + ":" + withQuery(rest, query, "ref", "rev", "dir")
+
+	default:
+		// git+https, hg+ssh, tarball+https, file+https, ...
+		fetcher, transport, ok := strings.Cut(scheme, "+")
+		if !ok {
+			return original, fmt.Errorf("unsupported flake reference %q", ref)
+		}
+
+		switch fetcher {
+		case "git", "hg":
+			original.Type = fetcher
+			original.URL = transport + ":" + withQuery(rest, query, "ref", "rev", "dir", "shallow", "submodules", "narHash", "lfs")
+		case "tarball", "file":
+			original.Type = fetcher
+			original.URL = transport + ":" + withQuery(rest, query, "ref", "rev", "dir", "narHash")
+		default:
+			return original, fmt.Errorf("unsupported flake reference %q", ref)
+		}
+	}
+
+	return original, nil
+}
+
+// Re-appends the query parameters that are not flake attributes.
+func withQuery(rest string, query url.Values, consumed ...string) string {
+	remaining := url.Values{}
+	for key, values := range query {
+		if !slices.Contains(consumed, key) {
+			remaining[key] = values
+		}
+	}
+	if len(remaining) == 0 {
+		return rest
+	}
+	return rest + "?" + remaining.Encode()
+}
+
+// Formats an original back into a flake reference.
+func (o Original) String() string {
+	var ref string
+	var params []string
+
+	switch o.Type {
+	case "github", "gitlab", "sourcehut":
+		ref = fmt.Sprintf("%s:%s/%s", o.Type, o.Owner, o.Repo)
+		switch {
+		case o.Ref != "" && o.Rev != "":
+			params = append(params, "ref="+o.Ref, "rev="+o.Rev)
+		case o.Ref != "":
+			ref += "/" + o.Ref
+		case o.Rev != "":
+			ref += "/" + o.Rev
+		}
+		if o.Host != "" {
+			params = append(params, "host="+o.Host)
+		}
+
+	case "indirect":
+		ref = o.ID
+		switch {
+		case o.Ref != "" && o.Rev != "":
+			ref += "/" + o.Ref + "/" + o.Rev
+		case o.Ref != "":
+			ref += "/" + o.Ref
+		case o.Rev != "":
+			ref += "/" + o.Rev
+		}
+
+	case "path":
+		ref = "path:" + o.Path
+
+	case "tarball":
+		ref = o.URL
+
+	case "file":
+		ref = "file+" + o.URL
+
+	default:
+		ref = o.Type + "+" + o.URL
+		if o.Ref != "" {
+			params = append(params, "ref="+o.Ref)
+		}
+		if o.Rev != "" {
+			params = append(params, "rev="+o.Rev)
+		}
+	}
+
+	if o.Dir != "" {
+		params = append(params, "dir="+o.Dir)
+	}
+	if len(params) > 0 {
+		sep := "?"
+		if strings.Contains(ref, "?") {
+			sep = "&"
+		}
+		ref += sep + strings.Join(params, "&")
+	}
+	return ref
+}
+
+// Reports whether two originals refer to the same source. Owners and
+// repositories on forges are compared case-insensitively, as the forges
+// themselves do.
+func (o Original) Equal(other Original) bool {
+	forge := o.Type == "github" || o.Type == "gitlab" || o.Type == "sourcehut"
+
+	sameName := func(a, b string) bool {
+		if forge {
+			return strings.EqualFold(a, b)
+		}
+		return a == b
+	}
+
+	return o.Type == other.Type &&
+		sameName(o.Owner, other.Owner) &&
+		sameName(o.Repo, other.Repo) &&
+		o.Ref == other.Ref &&
+		o.Rev == other.Rev &&
+		strings.EqualFold(o.Host, other.Host) &&
+		strings.Trim(o.Dir, "/") == strings.Trim(other.Dir, "/") &&
+		strings.TrimSuffix(o.URL, "/") == strings.TrimSuffix(other.URL, "/") &&
+		o.Path == other.Path &&
+		o.ID == other.ID
+}
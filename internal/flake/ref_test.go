@@ -0,0 +1,132 @@
+package flake
+
+import (
+	"testing"
+)
+
+func TestParseRef(t *testing.T) {
+	testCases := []struct {
+		name     string
+		ref      string
+		expected Original
+	}{
+		{
+			name:     "github",
+			ref:      "github:NixOS/nixpkgs",
+			expected: Original{Type: "github", Owner: "NixOS", Repo: "nixpkgs"},
+		},
+		{
+			name:     "github with ref",
+			ref:      "github:NixOS/nixpkgs/nixos-24.05",
+			expected: Original{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Ref: "nixos-24.05"},
+		},
+		{
+			name:     "github with rev",
+			ref:      "github:NixOS/nixpkgs/0123456789abcdef0123456789abcdef01234567",
+			expected: Original{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "0123456789abcdef0123456789abcdef01234567"},
+		},
+		{
+			name:     "gitlab with host and dir",
+			ref:      "gitlab:user/project?host=gitlab.example.com&dir=sub",
+			expected: Original{Type: "gitlab", Owner: "user", Repo: "project", Host: "gitlab.example.com", Dir: "sub"},
+		},
+		{
+			name:     "sourcehut",
+			ref:      "sourcehut:~user/repo",
+			expected: Original{Type: "sourcehut", Owner: "~user", Repo: "repo"},
+		},
+		{
+			name:     "git over https",
+			ref:      "git+https://example.com/repo.git?ref=main&submodules=1",
+			expected: Original{Type: "git", URL: "https://example.com/repo.git", Ref: "main"},
+		},
+		{
+			name:     "tarball",
+			ref:      "https://example.com/archive.tar.gz",
+			expected: Original{Type: "tarball", URL: "https://example.com/archive.tar.gz"},
+		},
+		{
+			name:     "file",
+			ref:      "file+https://example.com/data.json",
+			expected: Original{Type: "file", URL: "https://example.com/data.json"},
+		},
+		{
+			name:     "path",
+			ref:      "path:./sub",
+			expected: Original{Type: "path", Path: "./sub"},
+		},
+		{
+			name:     "bare path",
+			ref:      "./sub",
+			expected: Original{Type: "path", Path: "./sub"},
+		},
+		{
+			name:     "indirect",
+			ref:      "nixpkgs/nixos-unstable",
+			expected: Original{Type: "indirect", ID: "nixpkgs", Ref: "nixos-unstable"},
+		},
+		{
+			name:     "explicit indirect",
+			ref:      "flake:nixpkgs",
+			expected: Original{Type: "indirect", ID: "nixpkgs"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ParseRef(tc.ref)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseRef_Errors(t *testing.T) {
+	for _, ref := range []string{"", "github:NixOS", "svn+https://example.com/repo"} {
+		if _, err := ParseRef(ref); err == nil {
+			t.Errorf("expected error for %q", ref)
+		}
+	}
+}
+
+func TestOriginalString(t *testing.T) {
+	testCases := []struct {
+		original Original
+		expected string
+	}{
+		{Original{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Ref: "nixos-unstable"}, "github:NixOS/nixpkgs/nixos-unstable"},
+		{Original{Type: "gitlab", Owner: "user", Repo: "project", Host: "gitlab.example.com"}, "gitlab:user/project?host=gitlab.example.com"},
+		{Original{Type: "git", URL: "https://example.com/repo.git", Ref: "main", Dir: "sub"}, "git+https://example.com/repo.git?ref=main&dir=sub"},
+		{Original{Type: "tarball", URL: "https://example.com/archive.tar.gz"}, "https://example.com/archive.tar.gz"},
+		{Original{Type: "indirect", ID: "nixpkgs"}, "nixpkgs"},
+	}
+
+	for _, tc := range testCases {
+		if result := tc.original.String(); result != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, result)
+		}
+
+		// Formatting should round-trip through ParseRef
+		parsed, err := ParseRef(tc.original.String())
+		if err != nil || !parsed.Equal(tc.original) {
+			t.Errorf("expected %s to round-trip, got %+v (%v)", tc.expected, parsed, err)
+		}
+	}
+}
+
+func TestOriginalEqual(t *testing.T) {
+	a := Original{Type: "github", Owner: "NixOS", Repo: "nixpkgs"}
+	b := Original{Type: "github", Owner: "nixos", Repo: "nixpkgs"}
+	if !a.Equal(b) {
+		t.Error("expected forge owners to compare case-insensitively")
+	}
+
+	c := Original{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Ref: "nixos-24.05"}
+	if a.Equal(c) {
+		t.Error("expected different refs to compare unequal")
+	}
+}
@@ -0,0 +1,226 @@
+package flake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// What became of an input's upstream repository.
+type RepositoryStatus struct {
+	// The repository is read-only and will not receive further updates
+	Archived bool `json:",omitempty"`
+
+	// The forge does not know the repository, because it was deleted or is
+	// private and no token gives access to it
+	Missing bool `json:",omitempty"`
+
+	// Where the forge now serves the repository from, when it was renamed or
+	// transferred, and the flake reference to point the input at instead
+	Owner   string `json:",omitempty"`
+	Repo    string `json:",omitempty"`
+	MovedTo string `json:",omitempty"`
+}
+
+// Reports whether anything happened to the repository worth reporting.
+func (s RepositoryStatus) notable() bool {
+	return s.Archived || s.Missing || s.Owner != "" || s.Repo != ""
+}
+
+// Implemented by resolvers that can tell whether an input's repository was
+// archived, moved or deleted. Checkers return ErrUnsupported for inputs they
+// cannot handle.
+type RepositoryChecker interface {
+	CheckRepository(ctx context.Context, query Query) (RepositoryStatus, error)
+}
+
+// Checks a repository with the first member that supports the input.
+func (c ChainResolver) CheckRepository(ctx context.Context, query Query) (RepositoryStatus, error) {
+	return chainCall(c, "check repositories", func(checker RepositoryChecker) (RepositoryStatus, error) {
+		return checker.CheckRepository(ctx, query)
+	})
+}
+
+// Checks repositories through the wrapped resolver, caching them like
+// resolutions.
+func (c *CachingResolver) CheckRepository(ctx context.Context, query Query) (RepositoryStatus, error) {
+	checker, err := capabilityOf[RepositoryChecker](c.Resolver, "check repositories")
+	if err != nil {
+		return RepositoryStatus{}, err
+	}
+
+	repository := query
+	repository.Ref = ""
+	key := "repository\x00" + c.Resolver.Name() + "\x00" + queryKey(repository)
+	offline := fmt.Errorf("repository of %s is not cached and flint is offline", query.URL)
+	return cachedCall(c, key, false, offline, func() (RepositoryStatus, error) {
+		return checker.CheckRepository(ctx, query)
+	})
+}
+
+// Checks the repository of inputs no rule applies to. Whether a mirror was
+// archived, moved or deleted says nothing about upstream, so rewritten
+// inputs are reported as unsupported, and go unchecked.
+func (r *RewritingResolver) CheckRepository(ctx context.Context, query Query) (RepositoryStatus, error) {
+	return rewrittenCall(r, query, "check repositories", func(checker RepositoryChecker, moved Query) (RepositoryStatus, error) {
+		if moved.URL != query.URL {
+			return RepositoryStatus{}, fmt.Errorf("%w: %s is looked up at %s, whose repository says nothing about upstream", ErrUnsupported, query.URL, moved.URL)
+		}
+		return checker.CheckRepository(ctx, moved)
+	})
+}
+
+// Asks the forge about the repository. Forges follow renames and transfers
+// to the repository's new location, which is reported when it differs from
+// the locked one. sourcehut has no API for this and is reported as
+// unsupported.
+func (r *ForgeResolver) CheckRepository(ctx context.Context, query Query) (RepositoryStatus, error) {
+	repo, err := r.forgeRepo(query)
+	if err != nil {
+		return RepositoryStatus{}, err
+	}
+
+	owner, err := url.PathUnescape(repo.Owner)
+	if err != nil {
+		owner = repo.Owner
+	}
+
+	var info struct {
+		Archived bool `json:"archived"`
+
+		// GitHub and Gitea
+		FullName string `json:"full_name"`
+
+		// GitLab
+		PathWithNamespace string `json:"path_with_namespace"`
+	}
+	var endpoint string
+	switch repo.Kind {
+	case "github", "gitea":
+		endpoint = fmt.Sprintf("%s/repos/%s/%s", r.apiBase(repo), url.PathEscape(repo.Owner), url.PathEscape(repo.Repo))
+	case "gitlab":
+		endpoint = fmt.Sprintf("%s/projects/%s", r.apiBase(repo), url.PathEscape(owner+"/"+repo.Repo))
+	default:
+		return RepositoryStatus{}, fmt.Errorf("%w: %s cannot check repositories", ErrUnsupported, repo.Kind)
+	}
+
+	var httpErr *HTTPError
+	err = r.getJSON(ctx, repo, endpoint, &info)
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		return RepositoryStatus{Missing: true}, nil
+	}
+	if err != nil {
+		return RepositoryStatus{}, err
+	}
+
+	status := RepositoryStatus{Archived: info.Archived}
+	fullName := info.FullName + info.PathWithNamespace
+	if slash := strings.LastIndex(fullName, "/"); slash > 0 && !strings.EqualFold(fullName, owner+"/"+repo.Repo) {
+		status.Owner, status.Repo = fullName[:slash], fullName[slash+1:]
+	}
+	return status, nil
+}
+
+// Returns the flake reference of an input moved to another owner and
+// repository on the same host, tracking the same ref, or "" for inputs that
+// cannot be moved, such as tarballs.
+func movedRef(query Query, owner, repo string) string {
+	if query.Locked == nil {
+		return ""
+	}
+
+	// Inputs from the registry are pointed at the repository directly
+	moved := Original{Type: query.Locked.Type, Host: query.Locked.Host, URL: query.Locked.URL, Ref: query.Ref, Dir: query.Locked.Dir}
+	if query.Original != nil && query.Original.Type != "indirect" {
+		moved = *query.Original
+	}
+
+	switch moved.Type {
+	case "github", "sourcehut":
+		moved.Owner, moved.Repo = owner, repo
+	case "gitlab":
+		moved.Owner, moved.Repo = strings.ReplaceAll(owner, "/", "%2F"), repo
+	case "git":
+		u, err := url.Parse(moved.URL)
+		if err != nil || u.Host == "" {
+			return ""
+		}
+		suffix := ""
+		if strings.HasSuffix(strings.TrimSuffix(u.Path, "/"), ".git") {
+			suffix = ".git"
+		}
+		u.Path = "/" + owner + "/" + repo + suffix
+		u.RawPath = ""
+		moved.URL = u.String()
+	default:
+		return ""
+	}
+	return moved.String()
+}
+
+// A repository check shared by every input from the same repository.
+type pendingRepository struct {
+	key     string
+	query   Query
+	updates []int
+}
+
+// Checks whether the repositories inputs come from were archived, moved or
+// deleted, for every locked input: pinned and ignored inputs too, and inputs
+// whose update check failed, since a deleted repository makes it fail.
+// Failed checks are left out, but inputs the resolver cannot check are
+// marked as unchecked.
+func checkRepositories(ctx context.Context, updates []UpdateStatus, locked map[int]Query, opts UpdateOptions) {
+	if !opts.CheckRepositories {
+		return
+	}
+	checker, ok := opts.Resolver.(RepositoryChecker)
+
+	checks := make(map[string]*pendingRepository)
+	for i, query := range locked {
+		repository := query
+		repository.Ref = ""
+		key := queryKey(repository)
+		if checks[key] == nil {
+			checks[key] = &pendingRepository{key: key, query: query}
+		}
+		checks[key].updates = append(checks[key].updates, i)
+	}
+
+	runAll(ctx, slices.SortedFunc(maps.Values(checks), func(a, b *pendingRepository) int {
+		return strings.Compare(a.key, b.key)
+	}), opts, func(c *pendingRepository) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		status, err := RepositoryStatus{}, fmt.Errorf("%w: %s cannot check repositories", ErrUnsupported, opts.Resolver.Name())
+		if ok {
+			status, err = withRetry(ctx, opts, func(ctx context.Context) (RepositoryStatus, error) {
+				return checker.CheckRepository(ctx, c.query)
+			})
+		}
+		if errors.Is(err, ErrUnsupported) {
+			for _, i := range c.updates {
+				updates[i].Unchecked = append(updates[i].Unchecked, "repository")
+			}
+			return
+		}
+		if err != nil || !status.notable() {
+			return
+		}
+
+		for _, i := range c.updates {
+			status := status
+			if status.Owner != "" {
+				status.MovedTo = movedRef(locked[i], status.Owner, status.Repo)
+			}
+			updates[i].Repository = &status
+		}
+	})
+}
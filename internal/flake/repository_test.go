@@ -0,0 +1,250 @@
+package flake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestForgeResolver_CheckRepository(t *testing.T) {
+	routes := map[string]string{
+		"/repos/nixos/nixpkgs":            `{"full_name": "NixOS/nixpkgs"}`,
+		"/repositories/42":                `{"full_name": "new-owner/tool-ng", "archived": true}`,
+		"/projects/group%2Fsub%2Fproject": `{"path_with_namespace": "group/other/project"}`,
+		"/repos/owner/repo":               `{"full_name": "owner/repo", "archived": true}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// GitHub redirects renamed and transferred repositories by ID
+		if r.URL.Path == "/repos/old-owner/tool" {
+			http.Redirect(w, r, "/repositories/42", http.StatusMovedPermanently)
+			return
+		}
+		body, ok := routes[r.URL.EscapedPath()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	resolver := &ForgeResolver{
+		Client: server.Client(),
+		Hosts:  map[string]string{"git.example.com": "gitea"},
+		APIBase: map[string]string{
+			"github.com":      server.URL,
+			"gitlab.com":      server.URL,
+			"git.example.com": server.URL,
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		locked   *Locked
+		expected RepositoryStatus
+	}{
+		{
+			name:   "unchanged",
+			locked: &Locked{Type: "github", Owner: "nixos", Repo: "nixpkgs"},
+		},
+		{
+			name:     "moved and archived",
+			locked:   &Locked{Type: "github", Owner: "old-owner", Repo: "tool"},
+			expected: RepositoryStatus{Archived: true, Owner: "new-owner", Repo: "tool-ng"},
+		},
+		{
+			name:     "missing",
+			locked:   &Locked{Type: "github", Owner: "gone", Repo: "tool"},
+			expected: RepositoryStatus{Missing: true},
+		},
+		{
+			name:     "gitlab nested group",
+			locked:   &Locked{Type: "gitlab", Owner: "group%2Fsub", Repo: "project"},
+			expected: RepositoryStatus{Owner: "group/other", Repo: "project"},
+		},
+		{
+			name:     "gitea",
+			locked:   &Locked{Type: "git", URL: "https://git.example.com/owner/repo.git"},
+			expected: RepositoryStatus{Archived: true},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, err := resolver.CheckRepository(context.Background(), Query{Locked: tc.locked})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if status != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, status)
+			}
+		})
+	}
+
+	_, err := resolver.CheckRepository(context.Background(), Query{Locked: &Locked{Type: "sourcehut", Owner: "~user", Repo: "repo"}})
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected sourcehut to be unsupported, got %v", err)
+	}
+}
+
+func TestMovedRef(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    Query
+		owner    string
+		repo     string
+		expected string
+	}{
+		{
+			name: "github branch",
+			query: Query{
+				Locked:   &Locked{Type: "github", Owner: "old", Repo: "tool"},
+				Original: &Original{Type: "github", Owner: "old", Repo: "tool", Ref: "main"},
+				Ref:      "main",
+			},
+			owner: "new", repo: "tool-ng",
+			expected: "github:new/tool-ng/main",
+		},
+		{
+			name: "gitlab nested group",
+			query: Query{
+				Locked:   &Locked{Type: "gitlab", Owner: "group%2Fsub", Repo: "project"},
+				Original: &Original{Type: "gitlab", Owner: "group%2Fsub", Repo: "project"},
+			},
+			owner: "group/other", repo: "project",
+			expected: "gitlab:group%2Fother/project",
+		},
+		{
+			name: "git url",
+			query: Query{
+				Locked:   &Locked{Type: "git", URL: "https://codeberg.org/old/tool.git"},
+				Original: &Original{Type: "git", URL: "https://codeberg.org/old/tool.git", Ref: "dev"},
+				Ref:      "dev",
+			},
+			owner: "new", repo: "tool",
+			expected: "git+https://codeberg.org/new/tool.git?ref=dev",
+		},
+		{
+			name: "registry",
+			query: Query{
+				Locked:   &Locked{Type: "github", Owner: "old", Repo: "tool"},
+				Original: &Original{Type: "indirect", ID: "tool"},
+			},
+			owner: "new", repo: "tool",
+			expected: "github:new/tool",
+		},
+		{
+			name: "tarball",
+			query: Query{
+				Locked: &Locked{Type: "tarball", URL: "https://example.com/tool.tar.gz"},
+			},
+			owner: "new", repo: "tool",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if moved := movedRef(tc.query, tc.owner, tc.repo); moved != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, moved)
+			}
+		})
+	}
+}
+
+// A resolver whose repository checks are answered by a function.
+type repositoryResolver struct {
+	funcResolver
+	check func(query Query) (RepositoryStatus, error)
+}
+
+func (r repositoryResolver) CheckRepository(ctx context.Context, query Query) (RepositoryStatus, error) {
+	return r.check(query)
+}
+
+func TestCheckUpdatesWith_Repositories(t *testing.T) {
+	node := func(owner, repo, ref string) Node {
+		return Node{
+			Locked:   &Locked{Type: "github", Owner: owner, Repo: repo, Rev: "old"},
+			Original: &Original{Type: "github", Owner: owner, Repo: repo, Ref: ref},
+		}
+	}
+	lock := FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root": {Inputs: map[string]any{
+				"stable": "stable", "unstable": "unstable", "gone": "gone", "fine": "fine",
+				"pinned": "pinned", "ignored": "ignored",
+			}},
+			"stable":   node("old", "tool", "release"),
+			"unstable": node("old", "tool", ""),
+			"gone":     node("owner", "gone", ""),
+			"fine":     node("owner", "fine", ""),
+			"pinned": {
+				Locked:   &Locked{Type: "github", Owner: "owner", Repo: "archived", Rev: "old"},
+				Original: &Original{Type: "github", Owner: "owner", Repo: "archived", Rev: "old"},
+			},
+			"ignored": node("owner", "deleted", ""),
+		},
+	}
+	policy := UpdatePolicy{Inputs: map[string]InputPolicy{"ignored": {Ignore: true}}}
+
+	checked := make(map[string]int)
+	resolver := repositoryResolver{
+		funcResolver(func(ctx context.Context, query Query) (Resolution, error) {
+			if query.Locked.Repo == "gone" {
+				return Resolution{}, &HTTPError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+			}
+			return Resolution{URL: query.URL, Rev: "new"}, nil
+		}),
+		func(query Query) (RepositoryStatus, error) {
+			checked[query.Locked.Owner+"/"+query.Locked.Repo]++
+			switch query.Locked.Repo {
+			case "tool":
+				return RepositoryStatus{Owner: "new", Repo: "tool"}, nil
+			case "gone", "deleted":
+				return RepositoryStatus{Missing: true}, nil
+			case "archived":
+				return RepositoryStatus{Archived: true}, nil
+			}
+			return RepositoryStatus{}, nil
+		},
+	}
+
+	results, err := CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver, Parallelism: 1, Policy: policy, CheckRepositories: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if checked["old/tool"] != 1 {
+		t.Errorf("expected inputs from the same repository to share a check, got %v", checked)
+	}
+
+	expected := map[string]*RepositoryStatus{
+		"stable":   {Owner: "new", Repo: "tool", MovedTo: "github:new/tool/release"},
+		"unstable": {Owner: "new", Repo: "tool", MovedTo: "github:new/tool"},
+		"gone":     {Missing: true},
+		// Pinned and ignored inputs are not resolved, but still checked
+		"pinned":  {Archived: true},
+		"ignored": {Missing: true},
+	}
+	for _, update := range results.Updates {
+		want, got := expected[update.InputName], update.Repository
+		if (want == nil) != (got == nil) || (want != nil && *want != *got) {
+			t.Errorf("%s: expected %+v, got %+v", update.InputName, want, got)
+		}
+	}
+
+	// Resolvers that cannot check repositories leave every input unchecked
+	results, err = CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver.funcResolver, CheckRepositories: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, update := range results.Updates {
+		if !slices.Equal(update.Unchecked, []string{"repository"}) {
+			t.Errorf("%s: expected the repository to be unchecked, got %v", update.InputName, update.Unchecked)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package flake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A request to find the latest revision of an input.
+type Query struct {
+	// The root input being checked and the lock node it refers to
+	Input string
+	Node  string
+
+	// The flake reference to resolve, and the lock entries it was built from
+	URL      string
+	Locked   *Locked
+	Original *Original
+
+	// The branch or tag the input tracks, empty for the default branch
+	Ref string
+}
+
+// The latest revision of an input, as reported by a Resolver. Inputs without
+// revisions, such as tarballs, are identified by their NAR hash, or by the
+// URL they redirect to and the validators the server sends for it.
+type Resolution struct {
+	URL          string
+	Rev          string
+	LastModified int64
+	NarHash      string
+	ETag         string
+
+	// For inputs without revisions: the validators the server sent when the
+	// locked contents were first seen, to compare the current ones against.
+	// Filled in by the CachingResolver.
+	LockedETag         string
+	LockedLastModified int64
+}
+
+// Finds the latest revision of flake inputs. Implementations must be safe for
+// concurrent use, as inputs are checked in parallel.
+type Resolver interface {
+	Name() string
+	Resolve(ctx context.Context, query Query) (Resolution, error)
+}
+
+// Settings shared by the built-in resolvers.
+type ResolverOptions struct {
+	// Path to the nix binary, defaults to "nix" on $PATH
+	NixBinary string
+	Verbose   bool
+
+	// Maps self-hosted forges to the software they run, see ForgeResolver
+	ForgeHosts map[string]string
+
+	// Used for requests made by the native resolvers, defaults to a client
+	// with a 30 second timeout
+	HTTPClient *http.Client
+
+	// Sent by the native resolvers to the hosts they are for
+	Credentials *Credentials
+
+	// Batches GitHub lookups through the GraphQL API, see ForgeResolver
+	GitHubGraphQL bool
+}
+
+var resolvers = map[string]func(ResolverOptions) (Resolver, error){
+	"nix": func(opts ResolverOptions) (Resolver, error) {
+		return &NixResolver{Binary: opts.NixBinary, Verbose: opts.Verbose}, nil
+	},
+	"nix-legacy": func(opts ResolverOptions) (Resolver, error) {
+		return &NixResolver{Binary: opts.NixBinary, Verbose: opts.Verbose, Legacy: true}, nil
+	},
+	"forge": newForgeResolver,
+	"git": func(opts ResolverOptions) (Resolver, error) {
+		return newGitResolver(opts), nil
+	},
+	"http": func(opts ResolverOptions) (Resolver, error) {
+		return &HTTPResolver{Client: opts.HTTPClient, Credentials: opts.Credentials}, nil
+	},
+	"native": func(opts ResolverOptions) (Resolver, error) {
+		forge, err := newForgeResolver(opts)
+		if err != nil {
+			return nil, err
+		}
+		return ChainResolver{forge, newGitResolver(opts), &HTTPResolver{Client: opts.HTTPClient, Credentials: opts.Credentials}}, nil
+	},
+}
+
+func newForgeResolver(opts ResolverOptions) (Resolver, error) {
+	for host, kind := range opts.ForgeHosts {
+		if !slices.Contains(forgeKinds, kind) {
+			return nil, fmt.Errorf("unknown forge '%s' for %s. Valid forges are: %s", kind, host, strings.Join(forgeKinds, ", "))
+		}
+	}
+	return &ForgeResolver{Client: opts.HTTPClient, Hosts: opts.ForgeHosts, Credentials: opts.Credentials, GraphQL: opts.GitHubGraphQL}, nil
+}
+
+func newGitResolver(opts ResolverOptions) *GitResolver {
+	resolver := &GitResolver{Client: opts.HTTPClient}
+	if opts.Credentials != nil {
+		resolver.Auth = func(remote *url.URL) (string, string, bool) {
+			credential, ok := opts.Credentials.Lookup(remote.Host, strings.TrimSuffix(remote.Path, ".git"))
+			username, password := credential.basicAuth()
+			return username, password, ok
+		}
+	}
+	return resolver
+}
+
+// The resolver used when none is configured.
+const DefaultResolver = "nix"
+
+// Returns the names of the available resolvers.
+func ResolverNames() []string {
+	return slices.Sorted(maps.Keys(resolvers))
+}
+
+// Creates a resolver by name.
+func NewResolver(name string, opts ResolverOptions) (Resolver, error) {
+	if name == "" {
+		name = DefaultResolver
+	}
+
+	newResolver, ok := resolvers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown resolver '%s'. Valid resolvers are: %s", name, strings.Join(ResolverNames(), ", "))
+	}
+	return newResolver(opts)
+}
+
+// Tries each resolver in turn, moving on to the next one only when a resolver
+// reports the input as unsupported.
+type ChainResolver []Resolver
+
+func (c ChainResolver) Name() string {
+	names := make([]string, len(c))
+	for i, resolver := range c {
+		names[i] = resolver.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+func (c ChainResolver) Resolve(ctx context.Context, query Query) (Resolution, error) {
+	err := fmt.Errorf("%w: no resolver configured", ErrUnsupported)
+	for _, resolver := range c {
+		var resolution Resolution
+		resolution, err = resolver.Resolve(ctx, query)
+		if !errors.Is(err, ErrUnsupported) {
+			return resolution, err
+		}
+	}
+	return Resolution{}, err
+}
+
+// Calls a capability of the first member that has it and supports the
+// input. action says what the capability does, for the error returned when
+// no member does.
+func chainCall[C, T any](c ChainResolver, action string, call func(C) (T, error)) (T, error) {
+	var zero T
+	err := fmt.Errorf("%w: no resolver can %s", ErrUnsupported, action)
+	for _, resolver := range c {
+		capability, ok := resolver.(C)
+		if !ok {
+			continue
+		}
+
+		result, callErr := call(capability)
+		if !errors.Is(callErr, ErrUnsupported) {
+			return result, callErr
+		}
+		err = callErr
+	}
+	return zero, err
+}
+
+// Returns a capability of a wrapped resolver, or ErrUnsupported saying that
+// the resolver cannot do action.
+func capabilityOf[C any](resolver Resolver, action string) (C, error) {
+	capability, ok := resolver.(C)
+	if !ok {
+		return capability, fmt.Errorf("%w: %s cannot %s", ErrUnsupported, resolver.Name(), action)
+	}
+	return capability, nil
+}
+
+// A resolver that answers from a fixed table, for tests and dry runs. Results
+// and errors are keyed by query URL; queries for unknown URLs fail.
+type FakeResolver struct {
+	Results map[string]Resolution
+	Errors  map[string]error
+
+	mu      sync.Mutex
+	queries []Query
+}
+
+func (f *FakeResolver) Name() string {
+	return "fake"
+}
+
+func (f *FakeResolver) Resolve(ctx context.Context, query Query) (Resolution, error) {
+	f.mu.Lock()
+	f.queries = append(f.queries, query)
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return Resolution{}, err
+	}
+	if err, ok := f.Errors[query.URL]; ok {
+		return Resolution{}, err
+	}
+	if resolution, ok := f.Results[query.URL]; ok {
+		return resolution, nil
+	}
+	return Resolution{}, fmt.Errorf("no result for %s", query.URL)
+}
+
+// Returns the queries received so far, sorted by URL.
+func (f *FakeResolver) Queries() []Query {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	queries := slices.Clone(f.queries)
+	sort.SliceStable(queries, func(i, j int) bool {
+		return queries[i].URL < queries[j].URL
+	})
+	return queries
+}
@@ -0,0 +1,116 @@
+package flake
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cache "notashelf.dev/flint/internal/cache"
+)
+
+// Remembers what another resolver returned, so that repeated checks within
+// TTL do not query anything. Entries are keyed by the resolver, the
+// repository and the ref checked; failures are never cached.
+type CachingResolver struct {
+	Resolver Resolver
+	Store    *cache.Store
+
+	// How long entries are used without asking the resolver again
+	TTL time.Duration
+
+	// Refresh ignores cached entries, still storing new ones. Offline
+	// answers from the cache only, however old the entries are, and fails
+	// for queries that were never cached.
+	Refresh bool
+	Offline bool
+}
+
+func (c *CachingResolver) Name() string {
+	return c.Resolver.Name()
+}
+
+func (c *CachingResolver) key(query Query) string {
+	return "resolution\x00" + c.Resolver.Name() + "\x00" + queryKey(query)
+}
+
+func (c *CachingResolver) Resolve(ctx context.Context, query Query) (Resolution, error) {
+	offline := fmt.Errorf("%s is not cached and flint is offline", query.URL)
+	resolution, err := cachedCall(c, c.key(query), false, offline, func() (Resolution, error) {
+		return c.Resolver.Resolve(ctx, query)
+	})
+	if err != nil {
+		return resolution, err
+	}
+	c.baseline(query, &resolution)
+	return resolution, nil
+}
+
+// Implemented by answers that are not always worth caching.
+type cacheable interface {
+	cacheable() bool
+}
+
+// Answers from the entry stored under key, or from fetch, storing what it
+// returns. Entries about fixed revisions never go stale, so they are used
+// regardless of TTL and Refresh. offline is returned when flint is offline
+// and nothing is cached.
+func cachedCall[T any](c *CachingResolver, key string, fixed bool, offline error, fetch func() (T, error)) (T, error) {
+	if fixed || !c.Refresh {
+		var cached T
+		storedAt, found := c.Store.Get(key, &cached)
+		switch {
+		case found && (fixed || c.Offline || c.fresh(storedAt)):
+			c.Store.Hit()
+			return cached, nil
+		case found:
+			c.Store.Expire()
+		default:
+			c.Store.Miss()
+		}
+	}
+
+	if c.Offline {
+		var zero T
+		return zero, offline
+	}
+
+	result, err := fetch()
+	if err != nil {
+		return result, err
+	}
+	if answer, ok := any(result).(cacheable); ok && !answer.cacheable() {
+		return result, nil
+	}
+
+	// A cache that cannot be written only costs the next run some time
+	_ = c.Store.Put(key, result)
+	return result, nil
+}
+
+// Fills in the validators served for an input's locked contents, for inputs
+// such as tarballs that are only identified by them. Servers do not say what
+// they served when the lockfile was written, so the validators seen the
+// first time flint checks a locked entry stand in for them, and are kept
+// until the entry is locked anew. The first time, there is nothing to
+// compare against yet, so nothing is filled in.
+func (c *CachingResolver) baseline(query Query, resolution *Resolution) {
+	locked := query.Locked
+	if locked == nil || locked.Rev != "" || resolution.NarHash != "" || (resolution.ETag == "" && resolution.LastModified == 0) {
+		return
+	}
+
+	key := "validators\x00" + c.Resolver.Name() + "\x00" + locked.URL + "\x00" + locked.NarHash
+	var seen Resolution
+	if _, found := c.Store.Get(key, &seen); !found {
+		_ = c.Store.Put(key, Resolution{ETag: resolution.ETag, LastModified: resolution.LastModified})
+		return
+	}
+	resolution.LockedETag = seen.ETag
+	resolution.LockedLastModified = seen.LastModified
+}
+
+// Reports whether an entry stored at storedAt can be used without asking the
+// wrapped resolver.
+func (c *CachingResolver) fresh(storedAt time.Time) bool {
+	return time.Since(storedAt) < c.TTL
+}
@@ -0,0 +1,120 @@
+package flake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cache "notashelf.dev/flint/internal/cache"
+)
+
+func TestCachingResolver(t *testing.T) {
+	query := Query{
+		URL:    "github:NixOS/nixpkgs/nixos-unstable",
+		Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs"},
+		Ref:    "nixos-unstable",
+	}
+	other := Query{URL: "github:nix-community/home-manager", Locked: &Locked{Type: "github", Owner: "nix-community", Repo: "home-manager"}}
+
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		refresh bool
+		offline bool
+		query   Query
+		queries int
+		wantErr bool
+	}{
+		{name: "fresh entry", ttl: time.Hour, query: query, queries: 0},
+		{name: "expired entry", ttl: 0, query: query, queries: 1},
+		{name: "refresh", ttl: time.Hour, refresh: true, query: query, queries: 1},
+		{name: "offline uses expired entry", ttl: 0, offline: true, query: query, queries: 0},
+		{name: "offline miss", ttl: time.Hour, offline: true, query: other, queries: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := cache.Open(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fake := &FakeResolver{Results: map[string]Resolution{
+				query.URL: {Rev: "new"},
+				other.URL: {Rev: "other"},
+			}}
+
+			// Prime the cache with an older answer
+			seed := &CachingResolver{Resolver: &FakeResolver{Results: map[string]Resolution{query.URL: {Rev: "cached"}}}, Store: store}
+			if _, err := seed.Resolve(context.Background(), query); err != nil {
+				t.Fatal(err)
+			}
+
+			resolver := &CachingResolver{Resolver: fake, Store: store, TTL: tt.ttl, Refresh: tt.refresh, Offline: tt.offline}
+			resolution, err := resolver.Resolve(context.Background(), tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := len(fake.Queries()); got != tt.queries {
+				t.Errorf("resolver queried %d times, want %d", got, tt.queries)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			want := "cached"
+			if tt.queries > 0 {
+				want = "new"
+			}
+			if resolution.Rev != want {
+				t.Errorf("Rev = %q, want %q", resolution.Rev, want)
+			}
+		})
+	}
+}
+
+func TestCachingResolver_Baseline(t *testing.T) {
+	store, err := cache.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := "https://example.com/src.tar.gz"
+	query := Query{URL: url, Locked: &Locked{Type: "tarball", URL: url, NarHash: "sha256-a"}}
+	resolve := func(etag string) Resolution {
+		t.Helper()
+		resolver := &CachingResolver{Resolver: &FakeResolver{Results: map[string]Resolution{url: {URL: url, ETag: etag}}}, Store: store}
+		resolution, err := resolver.Resolve(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resolution
+	}
+
+	// The first answer for a locked entry becomes its baseline, and says
+	// nothing about whether it changed
+	if first := resolve(`"a"`); first.LockedETag != "" {
+		t.Errorf("expected no baseline the first time, got %+v", first)
+	} else if _, known := contentChanged(query, first); known {
+		t.Errorf("expected the first answer to leave changes unknown, got %+v", first)
+	}
+	if same := resolve(`"a"`); same.LockedETag != `"a"` {
+		t.Errorf("expected the first answer to become the baseline, got %+v", same)
+	} else if changed, known := contentChanged(query, same); changed || !known {
+		t.Errorf("expected the same ETag to count as unchanged, got %+v", same)
+	}
+	if later := resolve(`"b"`); later.LockedETag != `"a"` {
+		t.Errorf("expected the baseline to be kept, got %+v", later)
+	} else if changed, _ := contentChanged(query, later); !changed {
+		t.Errorf("expected a new ETag to count as a change, got %+v", later)
+	}
+
+	// Locking the input anew starts from a new baseline
+	query.Locked = &Locked{Type: "tarball", URL: url, NarHash: "sha256-b"}
+	if relocked := resolve(`"b"`); relocked.LockedETag != "" {
+		t.Errorf("expected a new lock to start a new baseline, got %+v", relocked)
+	}
+	if relocked := resolve(`"b"`); relocked.LockedETag != `"b"` {
+		t.Errorf("expected a new lock to start a new baseline, got %+v", relocked)
+	}
+}
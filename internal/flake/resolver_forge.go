@@ -0,0 +1,460 @@
+package flake
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Returned by resolvers for inputs they cannot handle.
+var ErrUnsupported = errors.New("unsupported input")
+
+// The forge software each well-known host runs. Other hosts can be added
+// through ForgeResolver.Hosts.
+var defaultForgeHosts = map[string]string{
+	"github.com":   "github",
+	"gitlab.com":   "gitlab",
+	"git.sr.ht":    "sourcehut",
+	"codeberg.org": "gitea",
+}
+
+// The forge kinds ForgeResolver understands. Forgejo speaks the Gitea API.
+var forgeKinds = []string{"gitea", "github", "gitlab", "sourcehut"}
+
+// Resolves inputs hosted on GitHub, GitLab, sourcehut and Gitea/Forgejo by
+// asking the forge for the head commit of the tracked branch, without
+// involving Nix.
+type ForgeResolver struct {
+	Client *http.Client
+
+	// Maps hosts to the forge they run, e.g. "git.example.com": "gitea",
+	// for self-hosted instances referenced through git+https URLs
+	Hosts map[string]string
+
+	// Overrides the API base URL for a host, mainly for tests
+	APIBase map[string]string
+
+	// Tokens sent to forges, looked up by the repository's host and path
+	Credentials *Credentials
+
+	// Looks up the heads and tags of GitHub inputs, and how far behind their
+	// locked revisions are, in batches through the GraphQL API, see Prefetch
+	GraphQL bool
+
+	// When the rate limit of each API host resets, once it is exhausted, and
+	// the heads, tags and comparisons prefetched through GraphQL
+	mu          sync.Mutex
+	exhausted   map[string]time.Time
+	heads       map[string]prefetchedHead
+	tags        map[string][]Tag
+	comparisons map[string]prefetchedComparison
+}
+
+// A repository on a forge, along with the ref to track. An empty Ref tracks
+// the default branch.
+type forgeRepo struct {
+	Kind, Host, Owner, Repo, Ref string
+}
+
+func (r *ForgeResolver) Name() string {
+	return "forge"
+}
+
+func (r *ForgeResolver) Resolve(ctx context.Context, query Query) (Resolution, error) {
+	repo, err := r.forgeRepo(query)
+	if err != nil {
+		return Resolution{}, err
+	}
+
+	var rev string
+	var date time.Time
+	switch repo.Kind {
+	case "github":
+		rev, date, err = r.resolveGitHub(ctx, repo)
+	case "gitlab":
+		rev, date, err = r.resolveGitLab(ctx, repo)
+	case "gitea":
+		rev, date, err = r.resolveGitea(ctx, repo)
+	case "sourcehut":
+		rev, err = r.resolveSourceHut(ctx, repo)
+	}
+	if err != nil {
+		return Resolution{}, err
+	}
+
+	resolution := Resolution{URL: query.URL, Rev: rev}
+	if !date.IsZero() {
+		resolution.LastModified = date.Unix()
+	}
+	return resolution, nil
+}
+
+// Works out which forge and repository an input lives on.
+func (r *ForgeResolver) forgeRepo(query Query) (forgeRepo, error) {
+	return lookupForgeRepo(query, r.Hosts)
+}
+
+// Works out which forge and repository an input lives on, consulting hosts
+// before the well-known forges for git URLs.
+func lookupForgeRepo(query Query, hosts map[string]string) (forgeRepo, error) {
+	locked := query.Locked
+	if locked == nil {
+		return forgeRepo{}, fmt.Errorf("%w: no locked information", ErrUnsupported)
+	}
+
+	var repo forgeRepo
+	switch locked.Type {
+	case "github", "gitlab", "sourcehut":
+		repo = forgeRepo{Kind: locked.Type, Host: locked.Host, Owner: locked.Owner, Repo: locked.Repo}
+		if repo.Host == "" {
+			repo.Host = map[string]string{"github": "github.com", "gitlab": "gitlab.com", "sourcehut": "git.sr.ht"}[locked.Type]
+		}
+
+	case "git":
+		u, err := url.Parse(locked.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+			return forgeRepo{}, fmt.Errorf("%w: %s is not an http(s) git repository", ErrUnsupported, locked.URL)
+		}
+
+		path := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+		slash := strings.LastIndex(path, "/")
+		if slash <= 0 {
+			return forgeRepo{}, fmt.Errorf("%w: cannot find the owner and repository in %s", ErrUnsupported, locked.URL)
+		}
+
+		repo = forgeRepo{Host: u.Host, Owner: path[:slash], Repo: path[slash+1:]}
+		if repo.Kind = hosts[u.Host]; repo.Kind == "" {
+			repo.Kind = defaultForgeHosts[u.Host]
+		}
+		if repo.Kind == "" {
+			return forgeRepo{}, fmt.Errorf("%w: unknown forge %s", ErrUnsupported, u.Host)
+		}
+
+	default:
+		return forgeRepo{}, fmt.Errorf("%w: %s inputs are not hosted on a forge", ErrUnsupported, locked.Type)
+	}
+
+	repo.Ref = strings.TrimPrefix(query.Ref, "refs/heads/")
+	return repo, nil
+}
+
+// Returns the API base URL for a repository's forge.
+func (r *ForgeResolver) apiBase(repo forgeRepo) string {
+	if base, ok := r.APIBase[repo.Host]; ok {
+		return strings.TrimSuffix(base, "/")
+	}
+
+	switch repo.Kind {
+	case "github":
+		if repo.Host == "github.com" {
+			return "https://api.github.com"
+		}
+		return "https://" + repo.Host + "/api/v3"
+	case "gitlab":
+		return "https://" + repo.Host + "/api/v4"
+	case "gitea":
+		return "https://" + repo.Host + "/api/v1"
+	default:
+		return "https://" + repo.Host
+	}
+}
+
+// Performs a GET request for a repository, returning the body of successful
+// responses.
+func (r *ForgeResolver) get(ctx context.Context, repo forgeRepo, endpoint, accept string) ([]byte, error) {
+	return r.request(ctx, repo, http.MethodGet, endpoint, accept, nil)
+}
+
+// Performs a request for a repository, sending body as JSON if there is one,
+// and returns the body of successful responses. Requests carry the
+// repository's token when there is one, and are not sent at all while the
+// API host's rate limit is exhausted.
+func (r *ForgeResolver) request(ctx context.Context, repo forgeRepo, method, endpoint, accept string, body []byte) ([]byte, error) {
+	data, _, err := r.do(ctx, repo, method, endpoint, accept, body)
+	return data, err
+}
+
+// Performs a request like request, also returning the response headers.
+func (r *ForgeResolver) do(ctx context.Context, repo forgeRepo, method, endpoint, accept string, body []byte) ([]byte, http.Header, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", "flint")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	credential, authenticated := r.credential(repo, req.URL.Host)
+	if authenticated {
+		req.Header.Set("Authorization", "Bearer "+credential.token())
+	}
+
+	if reset, ok := r.exhaustedUntil(req.URL.Host); ok {
+		return nil, nil, &RateLimitError{Host: req.URL.Host, Reset: reset, Authenticated: authenticated}
+	}
+
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s %s: %w", method, endpoint, err)
+	}
+
+	exhausted, reset := rateLimited(resp)
+	if exhausted {
+		r.exhaust(req.URL.Host, reset)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return data, resp.Header, nil
+	}
+	if exhausted {
+		return nil, nil, &RateLimitError{Host: req.URL.Host, Reset: reset, Authenticated: authenticated}
+	}
+
+	httpErr := &HTTPError{Method: method, URL: endpoint, StatusCode: resp.StatusCode, Status: resp.Status}
+	switch {
+	case resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusNotFound:
+	case authenticated:
+		httpErr.Hint = "check the token from " + credential.Source
+	default:
+		httpErr.Hint = "if the repository is private, set a token for " + repo.Host
+	}
+	return nil, nil, httpErr
+}
+
+// Returns the credential for a repository, falling back to one for the API
+// host, as ~/.netrc often has entries for hosts like api.github.com.
+func (r *ForgeResolver) credential(repo forgeRepo, apiHost string) (Credential, bool) {
+	owner, err := url.PathUnescape(repo.Owner)
+	if err != nil {
+		owner = repo.Owner
+	}
+	if credential, ok := r.Credentials.Lookup(repo.Host, owner+"/"+repo.Repo); ok {
+		return credential, true
+	}
+	return r.Credentials.Lookup(apiHost, "")
+}
+
+// Returns when the rate limit of an API host resets, if it is exhausted.
+func (r *ForgeResolver) exhaustedUntil(host string) (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reset, ok := r.exhausted[host]
+	if ok && !time.Now().Before(reset) {
+		delete(r.exhausted, host)
+		return time.Time{}, false
+	}
+	return reset, ok
+}
+
+// Records that the rate limit of an API host is exhausted until reset.
+// Limits without a known reset are not remembered, as there is no telling
+// when to try again.
+func (r *ForgeResolver) exhaust(host string, reset time.Time) {
+	if reset.IsZero() {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.exhausted == nil {
+		r.exhausted = make(map[string]time.Time)
+	}
+	r.exhausted[host] = reset
+}
+
+// Performs a GET request and decodes the JSON response into v.
+func (r *ForgeResolver) getJSON(ctx context.Context, repo forgeRepo, endpoint string, v any) error {
+	_, err := r.getJSONPage(ctx, repo, endpoint, v)
+	return err
+}
+
+// Performs a GET request like getJSON, also returning the response headers,
+// which carry the pagination of listings.
+func (r *ForgeResolver) getJSONPage(ctx context.Context, repo forgeRepo, endpoint string, v any) (http.Header, error) {
+	body, header, err := r.do(ctx, repo, http.MethodGet, endpoint, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return nil, fmt.Errorf("GET %s: failed to parse response: %w", endpoint, err)
+	}
+	return header, nil
+}
+
+func (r *ForgeResolver) resolveGitHub(ctx context.Context, repo forgeRepo) (string, time.Time, error) {
+	if head, ok := r.prefetchedHead(repo); ok {
+		return head.rev, head.date, nil
+	}
+
+	ref := repo.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	var commit struct {
+		SHA    string `json:"sha"`
+		Commit struct {
+			Committer struct {
+				Date time.Time `json:"date"`
+			} `json:"committer"`
+		} `json:"commit"`
+	}
+
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/commits/%s", r.apiBase(repo),
+		url.PathEscape(repo.Owner), url.PathEscape(repo.Repo), url.PathEscape(ref))
+	if err := r.getJSON(ctx, repo, endpoint, &commit); err != nil {
+		return "", time.Time{}, err
+	}
+	if commit.SHA == "" {
+		return "", time.Time{}, fmt.Errorf("no commit found for %s", ref)
+	}
+
+	return commit.SHA, commit.Commit.Committer.Date, nil
+}
+
+func (r *ForgeResolver) resolveGitLab(ctx context.Context, repo forgeRepo) (string, time.Time, error) {
+	// Projects are addressed by their URL-encoded path, which may include
+	// nested groups
+	owner, err := url.PathUnescape(repo.Owner)
+	if err != nil {
+		owner = repo.Owner
+	}
+	project := fmt.Sprintf("%s/projects/%s", r.apiBase(repo), url.PathEscape(owner+"/"+repo.Repo))
+
+	ref := repo.Ref
+	if ref == "" {
+		var info struct {
+			DefaultBranch string `json:"default_branch"`
+		}
+		if err := r.getJSON(ctx, repo, project, &info); err != nil {
+			return "", time.Time{}, err
+		}
+		if info.DefaultBranch == "" {
+			return "", time.Time{}, fmt.Errorf("%s/%s has no default branch", owner, repo.Repo)
+		}
+		ref = info.DefaultBranch
+	}
+
+	var commit struct {
+		ID            string    `json:"id"`
+		CommittedDate time.Time `json:"committed_date"`
+	}
+	if err := r.getJSON(ctx, repo, project+"/repository/commits/"+url.PathEscape(ref), &commit); err != nil {
+		return "", time.Time{}, err
+	}
+	if commit.ID == "" {
+		return "", time.Time{}, fmt.Errorf("no commit found for %s", ref)
+	}
+
+	return commit.ID, commit.CommittedDate, nil
+}
+
+func (r *ForgeResolver) resolveGitea(ctx context.Context, repo forgeRepo) (string, time.Time, error) {
+	params := url.Values{"limit": {"1"}, "stat": {"false"}, "verification": {"false"}, "files": {"false"}}
+	if repo.Ref != "" {
+		params.Set("sha", repo.Ref)
+	}
+
+	var commits []struct {
+		SHA    string `json:"sha"`
+		Commit struct {
+			Committer struct {
+				Date time.Time `json:"date"`
+			} `json:"committer"`
+		} `json:"commit"`
+	}
+
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/commits?%s", r.apiBase(repo),
+		url.PathEscape(repo.Owner), url.PathEscape(repo.Repo), params.Encode())
+	if err := r.getJSON(ctx, repo, endpoint, &commits); err != nil {
+		return "", time.Time{}, err
+	}
+	if len(commits) == 0 || commits[0].SHA == "" {
+		return "", time.Time{}, fmt.Errorf("no commit found for %s", repo.Ref)
+	}
+
+	return commits[0].SHA, commits[0].Commit.Committer.Date, nil
+}
+
+// sourcehut has no unauthenticated REST API for commits, so this reads the
+// repository's HEAD and info/refs files like Nix does.
+func (r *ForgeResolver) resolveSourceHut(ctx context.Context, repo forgeRepo) (string, error) {
+	base := fmt.Sprintf("%s/%s/%s", r.apiBase(repo), repo.Owner, repo.Repo)
+
+	ref := repo.Ref
+	if ref == "" {
+		head, err := r.get(ctx, repo, base+"/HEAD", "")
+		if err != nil {
+			return "", err
+		}
+		target, ok := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: ")
+		if !ok {
+			return "", fmt.Errorf("unexpected HEAD in %s: %q", base, strings.TrimSpace(string(head)))
+		}
+		ref = target
+	}
+
+	found, err := r.sourceHutRefs(ctx, repo)
+	if err != nil {
+		return "", err
+	}
+
+	candidates := []string{ref, "refs/heads/" + ref, "refs/tags/" + ref}
+
+	// Annotated tags are listed a second time, peeled to the commit
+	for _, candidate := range candidates {
+		if hash, ok := found[candidate+"^{}"]; ok {
+			return hash, nil
+		}
+		if hash, ok := found[candidate]; ok {
+			return hash, nil
+		}
+	}
+
+	return "", fmt.Errorf("ref %s not found in %s", ref, base)
+}
+
+// Reads a sourcehut repository's info/refs file, mapping ref names to
+// object ids.
+func (r *ForgeResolver) sourceHutRefs(ctx context.Context, repo forgeRepo) (map[string]string, error) {
+	refs, err := r.get(ctx, repo, fmt.Sprintf("%s/%s/%s/info/refs", r.apiBase(repo), repo.Owner, repo.Repo), "")
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(string(refs)))
+	for scanner.Scan() {
+		hash, name, ok := strings.Cut(scanner.Text(), "\t")
+		if ok {
+			found[name] = hash
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,174 @@
+package flake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Serves canned responses for the API endpoints each forge resolver uses.
+func newForgeServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	routes := map[string]string{
+		// GitHub
+		"/repos/NixOS/nixpkgs/commits/HEAD":        `{"sha": "gh-head", "commit": {"committer": {"date": "2025-01-02T03:04:05Z"}}}`,
+		"/repos/NixOS/nixpkgs/commits/nixos-24.05": `{"sha": "gh-stable", "commit": {"committer": {"date": "2025-01-02T03:04:05Z"}}}`,
+		"/api/v3/repos/corp/tool/commits/HEAD":     `{"sha": "ghe-head"}`,
+		// GitLab
+		"/projects/group%2Fsub%2Fproject":                          `{"default_branch": "trunk"}`,
+		"/projects/group%2Fsub%2Fproject/repository/commits/trunk": `{"id": "gl-trunk", "committed_date": "2025-01-02T04:04:05+01:00"}`,
+		// Gitea
+		"/repos/owner/repo/commits": `[{"sha": "gitea-head", "commit": {"committer": {"date": "2025-01-02T03:04:05Z"}}}]`,
+		// sourcehut
+		"/~user/repo/HEAD":                                    "ref: refs/heads/master\n",
+		"/~user/repo/info/refs":                               "srht-master\trefs/heads/master\nsrht-tag\trefs/tags/v1.0\nsrht-peeled\trefs/tags/v1.0^{}\n",
+		"/repos/NixOS/nixpkgs/tags":                           `[{"name": "v2.0.0", "commit": {"sha": "gh-tag"}}]`,
+		"/repos/NixOS/nixpkgs/git/matching-refs/heads/nixos-": `[{"ref": "refs/heads/nixos-24.05"}, {"ref": "refs/heads/nixos-24.11"}]`,
+		// Comparisons
+		"/repos/NixOS/nixpkgs/compare/old...new":             `{"ahead_by": 42, "html_url": "https://github.com/NixOS/nixpkgs/compare/old...new"}`,
+		"/projects/group%2Fsub%2Fproject/repository/commits": `[{"id": "c3"}]`,
+		"/repos/owner/repo/compare/old...new":                `{"total_commits": 7, "commits": [{}]}`,
+		// Reachability
+		"/repos/NixOS/nixpkgs/git/commits/old":      `{"sha": "old"}`,
+		"/repos/NixOS/nixpkgs/git/commits/forked":   `{"sha": "forked"}`,
+		"/repos/NixOS/nixpkgs/compare/new...old":    `{"ahead_by": 0}`,
+		"/repos/NixOS/nixpkgs/compare/new...forked": `{"ahead_by": 2}`,
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") == "" {
+			http.Error(w, "missing user agent", http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/repos/owner/repo/commits" && r.URL.Query().Get("limit") != "1" {
+			http.Error(w, "expected a limit", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/projects/group/sub/project/repository/commits" {
+			if r.URL.Query().Get("ref_name") != "old..new" {
+				http.Error(w, "expected a revision range", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("X-Total", "3")
+		}
+
+		body, ok := routes[r.URL.EscapedPath()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+}
+
+func TestForgeResolver(t *testing.T) {
+	server := newForgeServer(t)
+	defer server.Close()
+
+	resolver := &ForgeResolver{
+		Client: server.Client(),
+		Hosts:  map[string]string{"git.example.com": "gitea"},
+		APIBase: map[string]string{
+			"github.com":      server.URL,
+			"ghe.example.com": server.URL + "/api/v3",
+			"gitlab.com":      server.URL,
+			"git.example.com": server.URL,
+			"git.sr.ht":       server.URL,
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		query    Query
+		expected string
+		modified int64
+	}{
+		{
+			name:     "github default branch",
+			query:    Query{Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs"}},
+			expected: "gh-head",
+			modified: 1735787045,
+		},
+		{
+			name: "github tracked branch",
+			query: Query{
+				Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs"},
+				Ref:    "nixos-24.05",
+			},
+			expected: "gh-stable",
+			modified: 1735787045,
+		},
+		{
+			name:     "github enterprise host",
+			query:    Query{Locked: &Locked{Type: "github", Owner: "corp", Repo: "tool", Host: "ghe.example.com"}},
+			expected: "ghe-head",
+		},
+		{
+			name:     "gitlab nested group",
+			query:    Query{Locked: &Locked{Type: "gitlab", Owner: "group%2Fsub", Repo: "project"}},
+			expected: "gl-trunk",
+			modified: 1735787045,
+		},
+		{
+			name:     "gitea over git+https",
+			query:    Query{Locked: &Locked{Type: "git", URL: "https://git.example.com/owner/repo.git"}},
+			expected: "gitea-head",
+			modified: 1735787045,
+		},
+		{
+			name:     "sourcehut default branch",
+			query:    Query{Locked: &Locked{Type: "sourcehut", Owner: "~user", Repo: "repo"}},
+			expected: "srht-master",
+		},
+		{
+			name: "sourcehut annotated tag",
+			query: Query{
+				Locked: &Locked{Type: "sourcehut", Owner: "~user", Repo: "repo"},
+				Ref:    "v1.0",
+			},
+			expected: "srht-peeled",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resolution, err := resolver.Resolve(context.Background(), tc.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resolution.Rev != tc.expected {
+				t.Errorf("expected rev %s, got %s", tc.expected, resolution.Rev)
+			}
+			if resolution.LastModified != tc.modified {
+				t.Errorf("expected last modified %d, got %d", tc.modified, resolution.LastModified)
+			}
+		})
+	}
+}
+
+func TestForgeResolver_Errors(t *testing.T) {
+	server := newForgeServer(t)
+	defer server.Close()
+
+	resolver := &ForgeResolver{Client: server.Client(), APIBase: map[string]string{"github.com": server.URL}}
+
+	unsupported := []Query{
+		{Locked: &Locked{Type: "tarball", URL: "https://example.com/a.tar.gz"}},
+		{Locked: &Locked{Type: "git", URL: "https://unknown.example.com/owner/repo"}},
+		{Locked: &Locked{Type: "git", URL: "ssh://git@github.com/owner/repo"}},
+	}
+	for _, query := range unsupported {
+		if _, err := resolver.Resolve(context.Background(), query); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("expected ErrUnsupported for %+v, got %v", query.Locked, err)
+		}
+	}
+
+	missing := Query{Locked: &Locked{Type: "github", Owner: "missing", Repo: "repo"}}
+	if _, err := resolver.Resolve(context.Background(), missing); err == nil {
+		t.Error("expected an error for a missing repository")
+	}
+}
@@ -0,0 +1,341 @@
+package flake
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resolves git inputs by listing the remote's refs over the git smart-HTTP
+// protocol, like `git ls-remote` but without cloning or needing git itself.
+// Protocol v2 is used when the server supports it, falling back to v0.
+type GitResolver struct {
+	Client *http.Client
+
+	// Returns basic auth credentials for a remote. Credentials embedded in
+	// the input URL take precedence.
+	Auth func(remote *url.URL) (username, password string, ok bool)
+}
+
+func (r *GitResolver) Name() string {
+	return "git"
+}
+
+func (r *GitResolver) Resolve(ctx context.Context, query Query) (Resolution, error) {
+	remote, ref, err := gitRemote(query)
+	if err != nil {
+		return Resolution{}, err
+	}
+
+	refs, err := r.listRefs(ctx, remote)
+	if err != nil {
+		return Resolution{}, err
+	}
+
+	rev, err := refs.lookup(ref)
+	if err != nil {
+		return Resolution{}, fmt.Errorf("%s: %w", remote.Redacted(), err)
+	}
+	return Resolution{URL: query.URL, Rev: rev}, nil
+}
+
+// Returns the http(s) remote an input can be fetched from and the ref it
+// tracks, which is empty for the remote's HEAD.
+func gitRemote(query Query) (*url.URL, string, error) {
+	locked := query.Locked
+	if locked == nil {
+		return nil, "", fmt.Errorf("%w: no locked information", ErrUnsupported)
+	}
+
+	var raw string
+	switch locked.Type {
+	case "git":
+		raw = locked.URL
+	case "github", "gitlab", "sourcehut":
+		host := locked.Host
+		if host == "" {
+			host = map[string]string{"github": "github.com", "gitlab": "gitlab.com", "sourcehut": "git.sr.ht"}[locked.Type]
+		}
+		owner, err := url.PathUnescape(locked.Owner)
+		if err != nil {
+			owner = locked.Owner
+		}
+		raw = fmt.Sprintf("https://%s/%s/%s", host, owner, locked.Repo)
+		if locked.Type != "sourcehut" {
+			raw += ".git"
+		}
+	default:
+		return nil, "", fmt.Errorf("%w: %s inputs are not git repositories", ErrUnsupported, locked.Type)
+	}
+
+	remote, err := url.Parse(raw)
+	if err != nil || (remote.Scheme != "https" && remote.Scheme != "http") {
+		return nil, "", fmt.Errorf("%w: %s is not an http(s) git repository", ErrUnsupported, raw)
+	}
+
+	return remote, query.Ref, nil
+}
+
+// The refs advertised by a remote.
+type gitRefs struct {
+	refs   map[string]string // ref name to object id
+	peeled map[string]string // tag name to the commit it points at
+	head   string            // symbolic target of HEAD, if advertised
+}
+
+// Finds the commit a ref points at, accepting both full ref names and short
+// branch or tag names. Annotated tags are peeled to their commit.
+func (g gitRefs) lookup(ref string) (string, error) {
+	if ref == "" || ref == "HEAD" {
+		if oid, ok := g.refs["HEAD"]; ok {
+			return oid, nil
+		}
+		if oid, ok := g.refs[g.head]; ok && g.head != "" {
+			return oid, nil
+		}
+		return "", fmt.Errorf("remote does not advertise HEAD")
+	}
+
+	for _, name := range []string{ref, "refs/heads/" + ref, "refs/tags/" + ref} {
+		if oid, ok := g.peeled[name]; ok {
+			return oid, nil
+		}
+		if oid, ok := g.refs[name]; ok {
+			return oid, nil
+		}
+	}
+	return "", fmt.Errorf("ref %s not found", ref)
+}
+
+// Lists the refs of a remote, preferring protocol v2.
+func (r *GitResolver) listRefs(ctx context.Context, remote *url.URL) (gitRefs, error) {
+	lines, err := r.advertisement(ctx, remote)
+	if err != nil {
+		return gitRefs{}, err
+	}
+
+	if len(lines) > 0 && lines[0].text() == "version 2" {
+		return r.lsRefs(ctx, remote)
+	}
+	return parseRefAdvertisement(lines), nil
+}
+
+// Returns what a remote advertises to git-upload-pack clients: its refs
+// under protocol v0, or its capabilities under protocol v2.
+func (r *GitResolver) advertisement(ctx context.Context, remote *url.URL) ([]pktLine, error) {
+	endpoint := strings.TrimSuffix(remote.String(), "/")
+	body, err := r.request(ctx, http.MethodGet, endpoint+"/info/refs?service=git-upload-pack", nil, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := readPktLines(body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", remote.Redacted(), err)
+	}
+
+	// Smart servers start with a service announcement followed by a flush
+	if len(lines) > 0 && strings.HasPrefix(lines[0].text(), "# service=") {
+		lines = lines[1:]
+		if len(lines) > 0 && lines[0].flush {
+			lines = lines[1:]
+		}
+	} else if len(lines) == 0 {
+		return nil, fmt.Errorf("%s: empty ref advertisement", remote.Redacted())
+	}
+	return lines, nil
+}
+
+// Runs the protocol v2 ls-refs command.
+func (r *GitResolver) lsRefs(ctx context.Context, remote *url.URL) (gitRefs, error) {
+	var req bytes.Buffer
+	writePktLine(&req, "command=ls-refs\n")
+	writePktLine(&req, "agent=flint\n")
+	req.WriteString("0001")
+	writePktLine(&req, "peel\n")
+	writePktLine(&req, "symrefs\n")
+	writePktLine(&req, "ref-prefix HEAD\n")
+	writePktLine(&req, "ref-prefix refs/heads/\n")
+	writePktLine(&req, "ref-prefix refs/tags/\n")
+	req.WriteString("0000")
+
+	endpoint := strings.TrimSuffix(remote.String(), "/") + "/git-upload-pack"
+	body, err := r.request(ctx, http.MethodPost, endpoint, &req, remote)
+	if err != nil {
+		return gitRefs{}, err
+	}
+
+	lines, err := readPktLines(body)
+	if err != nil {
+		return gitRefs{}, fmt.Errorf("%s: %w", remote.Redacted(), err)
+	}
+
+	refs := gitRefs{refs: map[string]string{}, peeled: map[string]string{}}
+	for _, line := range lines {
+		if line.flush {
+			break
+		}
+
+		fields := strings.Fields(line.text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		oid, name := fields[0], fields[1]
+		refs.refs[name] = oid
+		for _, attr := range fields[2:] {
+			if target, ok := strings.CutPrefix(attr, "symref-target:"); ok && name == "HEAD" {
+				refs.head = target
+			}
+			if peeled, ok := strings.CutPrefix(attr, "peeled:"); ok {
+				refs.peeled[name] = peeled
+			}
+		}
+	}
+	return refs, nil
+}
+
+// Parses a protocol v0 ref advertisement. The first ref carries the server's
+// capabilities after a NUL byte, including the target of HEAD.
+func parseRefAdvertisement(lines []pktLine) gitRefs {
+	refs := gitRefs{refs: map[string]string{}, peeled: map[string]string{}}
+	for i, line := range lines {
+		if line.flush {
+			break
+		}
+
+		text := line.text()
+		if i == 0 {
+			var caps string
+			text, caps, _ = strings.Cut(text, "\x00")
+			for _, capability := range strings.Fields(caps) {
+				if target, ok := strings.CutPrefix(capability, "symref=HEAD:"); ok {
+					refs.head = target
+				}
+			}
+		}
+
+		oid, name, ok := strings.Cut(text, " ")
+		if !ok {
+			continue
+		}
+
+		if tag, ok := strings.CutSuffix(name, "^{}"); ok {
+			refs.peeled[tag] = oid
+			continue
+		}
+		refs.refs[name] = oid
+	}
+	return refs
+}
+
+// Sends a smart-HTTP request, authenticating with the credentials in the
+// remote URL or from Auth.
+func (r *GitResolver) request(ctx context.Context, method, endpoint string, body io.Reader, remote *url.URL) ([]byte, error) {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	target.User = nil
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "git/2.0 (flint)")
+	req.Header.Set("Git-Protocol", "version=2")
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/x-git-upload-pack-request")
+		req.Header.Set("Accept", "application/x-git-upload-pack-result")
+	}
+
+	authenticated := false
+	if password, ok := remote.User.Password(); ok {
+		req.SetBasicAuth(remote.User.Username(), password)
+		authenticated = true
+	} else if r.Auth != nil {
+		if username, password, ok := r.Auth(remote); ok {
+			req.SetBasicAuth(username, password)
+			authenticated = true
+		}
+	}
+
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, target.Redacted(), err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized && authenticated:
+		return nil, fmt.Errorf("%s %s: authentication failed", method, target.Redacted())
+	case resp.StatusCode == http.StatusUnauthorized:
+		return nil, fmt.Errorf("%s %s: authentication required; add credentials for %s to ~/.netrc or access-tokens in nix.conf", method, target.Redacted(), target.Host)
+	case resp.StatusCode != http.StatusOK:
+		return nil, &HTTPError{Method: method, URL: target.Redacted(), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+}
+
+// A pkt-line as used by the git wire protocol. Flush (0000), delimiter
+// (0001) and response-end (0002) packets carry no data.
+type pktLine struct {
+	data  []byte
+	flush bool
+}
+
+func (p pktLine) text() string {
+	return strings.TrimSuffix(string(p.data), "\n")
+}
+
+func readPktLines(body []byte) ([]pktLine, error) {
+	var lines []pktLine
+	reader := bufio.NewReader(bytes.NewReader(body))
+
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(reader, header); err == io.EOF {
+			return lines, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("truncated pkt-line")
+		}
+
+		length, err := strconv.ParseUint(string(header), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pkt-line length %q", header)
+		}
+
+		switch {
+		case length == 0:
+			lines = append(lines, pktLine{flush: true})
+		case length <= 2:
+			// Delimiter and response-end packets separate sections
+			lines = append(lines, pktLine{})
+		case length < 4:
+			return nil, fmt.Errorf("invalid pkt-line length %q", header)
+		default:
+			data := make([]byte, length-4)
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return nil, fmt.Errorf("truncated pkt-line")
+			}
+			lines = append(lines, pktLine{data: data})
+		}
+	}
+}
+
+func writePktLine(w *bytes.Buffer, s string) {
+	fmt.Fprintf(w, "%04x%s", len(s)+4, s)
+}
@@ -0,0 +1,212 @@
+package flake
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const (
+	mainOID   = "1111111111111111111111111111111111111111"
+	devOID    = "2222222222222222222222222222222222222222"
+	tagOID    = "3333333333333333333333333333333333333333"
+	commitOID = "4444444444444444444444444444444444444444"
+)
+
+func pkt(s string) string {
+	var buf bytes.Buffer
+	writePktLine(&buf, s)
+	return buf.String()
+}
+
+// A stand-in for a git smart-HTTP server that advertises a fixed set of refs
+// over protocol v0 or v2, optionally requiring basic auth.
+func newGitServer(t *testing.T, v2 bool, username, password string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username != "" {
+			if u, p, ok := r.BasicAuth(); !ok || u != username || p != password {
+				w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		useV2 := v2 && r.Header.Get("Git-Protocol") == "version=2"
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repo.git/info/refs":
+			if r.URL.Query().Get("service") != "git-upload-pack" {
+				http.Error(w, "dumb protocol not supported", http.StatusForbidden)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+			io.WriteString(w, pkt("# service=git-upload-pack\n")+"0000")
+
+			if useV2 {
+				io.WriteString(w, pkt("version 2\n")+pkt("ls-refs=unborn\n")+pkt("fetch=shallow filter\n")+"0000")
+				return
+			}
+
+			io.WriteString(w, pkt(mainOID+" HEAD\x00multi_ack symref=HEAD:refs/heads/main agent=git/2.43\n")+
+				pkt(devOID+" refs/heads/dev\n")+
+				pkt(mainOID+" refs/heads/main\n")+
+				pkt(tagOID+" refs/tags/v1.0\n")+
+				pkt(commitOID+" refs/tags/v1.0^{}\n")+
+				"0000")
+
+		case r.Method == http.MethodPost && r.URL.Path == "/repo.git/git-upload-pack" && useV2:
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
+
+			// Fetches are answered with an empty pack for advertised
+			// commits only
+			if strings.Contains(string(body), "command=fetch") {
+				if !strings.Contains(string(body), "filter tree:0") {
+					http.Error(w, "expected a filter", http.StatusBadRequest)
+					return
+				}
+				for _, oid := range []string{mainOID, devOID, commitOID} {
+					if strings.Contains(string(body), "want "+oid) {
+						io.WriteString(w, pkt("shallow-info\n")+pkt("shallow "+oid+"\n")+"0001"+pkt("packfile\n")+pkt("\x01PACK")+"0000")
+						return
+					}
+				}
+				io.WriteString(w, pkt("ERR upload-pack: not our ref "+strings.Repeat("9", 40)+"\n"))
+				return
+			}
+
+			if !strings.Contains(string(body), "command=ls-refs") || !strings.Contains(string(body), "peel") {
+				http.Error(w, "unexpected request", http.StatusBadRequest)
+				return
+			}
+
+			io.WriteString(w, pkt(mainOID+" HEAD symref-target:refs/heads/main\n")+
+				pkt(devOID+" refs/heads/dev\n")+
+				pkt(mainOID+" refs/heads/main\n")+
+				pkt(tagOID+" refs/tags/v1.0 peeled:"+commitOID+"\n")+
+				"0000")
+
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestGitResolver(t *testing.T) {
+	for _, v2 := range []bool{false, true} {
+		name := "v0"
+		if v2 {
+			name = "v2"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			server := newGitServer(t, v2, "", "")
+			defer server.Close()
+
+			resolver := &GitResolver{Client: server.Client()}
+
+			testCases := []struct {
+				ref      string
+				expected string
+			}{
+				{"", mainOID},
+				{"dev", devOID},
+				{"refs/heads/dev", devOID},
+				{"v1.0", commitOID},
+			}
+
+			for _, tc := range testCases {
+				query := Query{
+					URL:    server.URL + "/repo.git",
+					Locked: &Locked{Type: "git", URL: server.URL + "/repo.git"},
+					Ref:    tc.ref,
+				}
+
+				resolution, err := resolver.Resolve(context.Background(), query)
+				if err != nil {
+					t.Fatalf("%q: unexpected error: %v", tc.ref, err)
+				}
+				if resolution.Rev != tc.expected {
+					t.Errorf("%q: expected %s, got %s", tc.ref, tc.expected, resolution.Rev)
+				}
+			}
+
+			missing := Query{
+				Locked: &Locked{Type: "git", URL: server.URL + "/repo.git"},
+				Ref:    "missing",
+			}
+			if _, err := resolver.Resolve(context.Background(), missing); err == nil {
+				t.Error("expected an error for a missing ref")
+			}
+		})
+	}
+}
+
+func TestGitResolver_BasicAuth(t *testing.T) {
+	server := newGitServer(t, true, "user", "secret")
+	defer server.Close()
+
+	remote, _ := url.Parse(server.URL + "/repo.git")
+
+	// Without credentials the server refuses
+	resolver := &GitResolver{Client: server.Client()}
+	_, err := resolver.Resolve(context.Background(), Query{Locked: &Locked{Type: "git", URL: remote.String()}})
+	if err == nil || !strings.Contains(err.Error(), "authentication required") {
+		t.Errorf("expected an authentication error, got %v", err)
+	}
+
+	// Credentials can come from the URL
+	remote.User = url.UserPassword("user", "secret")
+	resolution, err := resolver.Resolve(context.Background(), Query{Locked: &Locked{Type: "git", URL: remote.String()}})
+	if err != nil || resolution.Rev != mainOID {
+		t.Errorf("expected %s with URL credentials, got %s (%v)", mainOID, resolution.Rev, err)
+	}
+
+	// Or from the Auth callback
+	resolver.Auth = func(target *url.URL) (string, string, bool) {
+		return "user", "secret", target.Host == remote.Host
+	}
+	remote.User = nil
+	resolution, err = resolver.Resolve(context.Background(), Query{Locked: &Locked{Type: "git", URL: remote.String()}})
+	if err != nil || resolution.Rev != mainOID {
+		t.Errorf("expected %s with callback credentials, got %s (%v)", mainOID, resolution.Rev, err)
+	}
+}
+
+func TestGitResolver_Unsupported(t *testing.T) {
+	resolver := &GitResolver{}
+	for _, locked := range []*Locked{
+		{Type: "tarball", URL: "https://example.com/a.tar.gz"},
+		{Type: "git", URL: "ssh://git@example.com/repo.git"},
+		{Type: "git", URL: "file:///srv/repo.git"},
+	} {
+		if _, err := resolver.Resolve(context.Background(), Query{Locked: locked}); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("expected ErrUnsupported for %s, got %v", locked.URL, err)
+		}
+	}
+}
+
+func TestChainResolver(t *testing.T) {
+	first := &FakeResolver{Errors: map[string]error{"a": ErrUnsupported}}
+	second := &FakeResolver{Results: map[string]Resolution{"a": {Rev: "abc"}}}
+
+	resolution, err := ChainResolver{first, second}.Resolve(context.Background(), Query{URL: "a"})
+	if err != nil || resolution.Rev != "abc" {
+		t.Errorf("expected the second resolver to answer, got %+v (%v)", resolution, err)
+	}
+
+	// Other errors are final
+	first.Errors["a"] = errors.New("rate limited")
+	if _, err := (ChainResolver{first, second}).Resolve(context.Background(), Query{URL: "a"}); err == nil {
+		t.Error("expected the first resolver's error")
+	}
+}
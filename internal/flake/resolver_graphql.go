@@ -0,0 +1,416 @@
+package flake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Implemented by resolvers that can look up many inputs at once more cheaply
+// than one at a time. Prefetching is only a hint: the queries are still
+// resolved one by one afterwards, and whatever the prefetch could not answer
+// is looked up then.
+type Prefetcher interface {
+	// Heads are queries for the latest revision of a ref, which their locked
+	// revision may be compared against, tags queries for the tags of a
+	// repository
+	Prefetch(ctx context.Context, heads, tags []Query)
+}
+
+// Prefetches with every member that can.
+func (c ChainResolver) Prefetch(ctx context.Context, heads, tags []Query) {
+	for _, resolver := range c {
+		if prefetcher, ok := resolver.(Prefetcher); ok {
+			prefetcher.Prefetch(ctx, heads, tags)
+		}
+	}
+}
+
+// Prefetches the queries the cache cannot answer. Offline, nothing is.
+func (c *CachingResolver) Prefetch(ctx context.Context, heads, tags []Query) {
+	prefetcher, ok := c.Resolver.(Prefetcher)
+	if !ok || c.Offline {
+		return
+	}
+
+	cached := func(key string) bool {
+		var value json.RawMessage
+		storedAt, found := c.Store.Get(key, &value)
+		return !c.Refresh && found && c.fresh(storedAt)
+	}
+
+	heads = slices.DeleteFunc(slices.Clone(heads), func(query Query) bool {
+		return cached(c.key(query))
+	})
+	tags = slices.DeleteFunc(slices.Clone(tags), func(query Query) bool {
+		query.Ref = ""
+		return cached("tags\x00" + c.Resolver.Name() + "\x00" + queryKey(query))
+	})
+	if len(heads) > 0 || len(tags) > 0 {
+		prefetcher.Prefetch(ctx, heads, tags)
+	}
+}
+
+// The number of lookups sent in one GraphQL query. GitHub charges by the
+// number of nodes a query may return, which stays low at this size.
+const graphQLBatchSize = 50
+
+// How many tags a GraphQL lookup returns. Repositories with more are left to
+// the REST API, which pages through them.
+const graphQLTags = 100
+
+// A single lookup within a batched GraphQL query. Head lookups also compare
+// the head against the given revisions.
+type graphQLLookup struct {
+	repo forgeRepo
+	tags bool
+	revs []string
+}
+
+func (l graphQLLookup) key() string {
+	key := repositoryKey(l.repo)
+	if l.tags {
+		return key + "#tags"
+	}
+	return key + "#" + l.repo.Ref
+}
+
+func repositoryKey(repo forgeRepo) string {
+	return strings.ToLower(repo.Host + "/" + repo.Owner + "/" + repo.Repo)
+}
+
+// Identifies the comparison of a revision with a head in a repository.
+func comparisonKey(repo forgeRepo, rev, head string) string {
+	return repositoryKey(repo) + "#" + rev + "..." + head
+}
+
+// A head looked up ahead of time.
+type prefetchedHead struct {
+	rev  string
+	date time.Time
+}
+
+// A revision compared with a head ahead of time: how many commits the
+// revision has that the head lacks, and how many it lacks.
+type prefetchedComparison struct {
+	ahead, behind int
+}
+
+// Looks up the heads and tags of GitHub inputs in batches through the
+// GraphQL API, when enabled, so that resolving them afterwards needs no
+// further requests. Heads are compared against the locked revisions in the
+// same lookup, which answers comparisons and reachability checks later on.
+// Batches that fail are dropped, leaving their inputs to the REST API.
+func (r *ForgeResolver) Prefetch(ctx context.Context, heads, tags []Query) {
+	if !r.GraphQL {
+		return
+	}
+
+	// Lookups are grouped by the GraphQL endpoint that answers them, and
+	// each is only made once, with every revision to compare
+	batches := make(map[string][]*graphQLLookup)
+	seen := make(map[string]*graphQLLookup)
+	add := func(query Query, isTags bool) {
+		repo, err := r.forgeRepo(query)
+		if err != nil || repo.Kind != "github" {
+			return
+		}
+		lookup := &graphQLLookup{repo: repo, tags: isTags}
+		if !isTags && query.Locked.Rev != "" {
+			lookup.revs = []string{query.Locked.Rev}
+		}
+		if existing := seen[lookup.key()]; existing != nil {
+			for _, rev := range lookup.revs {
+				if !slices.Contains(existing.revs, rev) {
+					existing.revs = append(existing.revs, rev)
+				}
+			}
+			return
+		}
+		if r.prefetched(*lookup) {
+			return
+		}
+		seen[lookup.key()] = lookup
+		endpoint := r.graphQLEndpoint(repo)
+		batches[endpoint] = append(batches[endpoint], lookup)
+	}
+	for _, query := range heads {
+		add(query, false)
+	}
+	for _, query := range tags {
+		add(query, true)
+	}
+
+	for _, endpoint := range slices.Sorted(func(yield func(string) bool) {
+		for endpoint := range batches {
+			if !yield(endpoint) {
+				return
+			}
+		}
+	}) {
+		for batch := range slices.Chunk(batches[endpoint], graphQLBatchSize) {
+			if ctx.Err() != nil {
+				return
+			}
+			_ = r.prefetchBatch(ctx, endpoint, batch)
+		}
+	}
+}
+
+// Returns the GraphQL endpoint of a GitHub host. Enterprise servers serve it
+// next to the REST API, under /api/graphql.
+func (r *ForgeResolver) graphQLEndpoint(repo forgeRepo) string {
+	base := r.apiBase(repo)
+	if rest, ok := strings.CutSuffix(base, "/api/v3"); ok {
+		return rest + "/api/graphql"
+	}
+	return base + "/graphql"
+}
+
+// Returns the host of an API endpoint.
+func apiHost(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// Selects a commit, peeling annotated tags.
+const graphQLCommitFragment = `fragment commit on GitObject {
+  oid
+  ... on Commit { committedDate }
+  ... on Tag { target { oid ... on Commit { committedDate } } }
+}`
+
+// An object as selected by graphQLCommitFragment.
+type graphQLObject struct {
+	OID           string         `json:"oid"`
+	CommittedDate time.Time      `json:"committedDate"`
+	Target        *graphQLObject `json:"target"`
+}
+
+// Returns the commit an object is or points at.
+func (o graphQLObject) commit() prefetchedHead {
+	if o.Target != nil {
+		return o.Target.commit()
+	}
+	return prefetchedHead{rev: o.OID, date: o.CommittedDate}
+}
+
+// A ref as a lookup selects it: its target, and the comparisons aliased
+// c0, c1 and so on in the order of the lookup's revisions.
+type graphQLRef map[string]json.RawMessage
+
+// Returns how the ref compares with the i-th revision of its lookup, if it
+// could be compared.
+func (ref graphQLRef) comparison(i int) (prefetchedComparison, bool) {
+	var comparison *struct {
+		AheadBy  int `json:"aheadBy"`
+		BehindBy int `json:"behindBy"`
+	}
+	if err := json.Unmarshal(ref[fmt.Sprintf("c%d", i)], &comparison); err != nil || comparison == nil {
+		return prefetchedComparison{}, false
+	}
+	return prefetchedComparison{ahead: comparison.AheadBy, behind: comparison.BehindBy}, true
+}
+
+// The repository fields a lookup selects.
+type graphQLRepository struct {
+	Object           *graphQLObject `json:"object"`
+	Ref              graphQLRef     `json:"ref"`
+	DefaultBranchRef graphQLRef     `json:"defaultBranchRef"`
+	Refs             *struct {
+		PageInfo struct {
+			HasNextPage bool `json:"hasNextPage"`
+		} `json:"pageInfo"`
+		Nodes []struct {
+			Name   string        `json:"name"`
+			Target graphQLObject `json:"target"`
+		} `json:"nodes"`
+	} `json:"refs"`
+}
+
+// Sends one batch of lookups as a single query, with an alias per lookup,
+// and remembers the answers. Lookups the response has nothing for, such as
+// repositories the token cannot see, are left out.
+func (r *ForgeResolver) prefetchBatch(ctx context.Context, endpoint string, batch []*graphQLLookup) error {
+	var query strings.Builder
+	var params []string
+	variables := make(map[string]string)
+
+	// The ref being looked up is the base of each comparison, so behindBy
+	// counts the commits the head has that the revision lacks
+	compare := func(i int, lookup *graphQLLookup) {
+		for j, rev := range lookup.revs {
+			name := fmt.Sprintf("b%d_%d", i, j)
+			variables[name] = rev
+			params = append(params, fmt.Sprintf("$%s: String!", name))
+			fmt.Fprintf(&query, " c%d: compare(headRef: $%s) { aheadBy behindBy }", j, name)
+		}
+	}
+	for i, lookup := range batch {
+		owner, err := url.PathUnescape(lookup.repo.Owner)
+		if err != nil {
+			owner = lookup.repo.Owner
+		}
+		variables[fmt.Sprintf("o%d", i)] = owner
+		variables[fmt.Sprintf("n%d", i)] = lookup.repo.Repo
+		params = append(params, fmt.Sprintf("$o%d: String!, $n%d: String!", i, i))
+
+		fmt.Fprintf(&query, "  l%d: repository(owner: $o%d, name: $n%d) { ", i, i, i)
+		switch {
+		case lookup.tags:
+			fmt.Fprintf(&query, `refs(refPrefix: "refs/tags/", first: %d, orderBy: {field: TAG_COMMIT_DATE, direction: DESC}) { pageInfo { hasNextPage } nodes { name target { ...commit } } }`, graphQLTags)
+		case lookup.repo.Ref == "":
+			query.WriteString("defaultBranchRef { target { ...commit }")
+			compare(i, lookup)
+			query.WriteString(" }")
+		default:
+			variables[fmt.Sprintf("e%d", i)] = lookup.repo.Ref
+			params = append(params, fmt.Sprintf("$e%d: String!", i))
+			fmt.Fprintf(&query, "object(expression: $e%d) { ...commit }", i)
+			if len(lookup.revs) > 0 {
+				fmt.Fprintf(&query, " ref(qualifiedName: $e%d) {", i)
+				compare(i, lookup)
+				query.WriteString(" }")
+			}
+		}
+		query.WriteString(" }\n")
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"query":     fmt.Sprintf("query(%s) {\n%s}\n%s", strings.Join(params, ", "), query.String(), graphQLCommitFragment),
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+
+	// GitHub's GraphQL API always needs a token. Tokens scoped to a single
+	// repository do not apply to a batch.
+	host := forgeRepo{Kind: "github", Host: batch[0].repo.Host}
+	if _, ok := r.credential(host, apiHost(endpoint)); !ok {
+		return fmt.Errorf("no token for %s to use its GraphQL API with", host.Host)
+	}
+	data, err := r.request(ctx, host, http.MethodPost, endpoint, "application/json", body)
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		Data   map[string]*graphQLRepository `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return fmt.Errorf("POST %s: failed to parse response: %w", endpoint, err)
+	}
+	if response.Data == nil && len(response.Errors) > 0 {
+		return errors.New(response.Errors[0].Message)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.heads == nil {
+		r.heads = make(map[string]prefetchedHead)
+		r.tags = make(map[string][]Tag)
+		r.comparisons = make(map[string]prefetchedComparison)
+	}
+	for i, lookup := range batch {
+		repository := response.Data[fmt.Sprintf("l%d", i)]
+		switch {
+		case repository == nil:
+			continue
+		case lookup.tags:
+			if repository.Refs == nil || repository.Refs.PageInfo.HasNextPage {
+				continue
+			}
+			tags := make([]Tag, 0, len(repository.Refs.Nodes))
+			for _, node := range repository.Refs.Nodes {
+				tags = append(tags, Tag{Name: node.Name, Rev: node.Target.commit().rev})
+			}
+			r.tags[lookup.key()] = tags
+		default:
+			var head prefetchedHead
+			var ref graphQLRef
+			switch {
+			case repository.DefaultBranchRef != nil:
+				var target graphQLObject
+				if err := json.Unmarshal(repository.DefaultBranchRef["target"], &target); err != nil {
+					continue
+				}
+				head, ref = target.commit(), repository.DefaultBranchRef
+			case repository.Object != nil:
+				head, ref = repository.Object.commit(), repository.Ref
+			default:
+				continue
+			}
+
+			r.heads[lookup.key()] = head
+			for j, rev := range lookup.revs {
+				if comparison, ok := ref.comparison(j); ok {
+					r.comparisons[comparisonKey(lookup.repo, rev, head.rev)] = comparison
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Reports whether a lookup was already answered by a prefetch.
+func (r *ForgeResolver) prefetched(lookup graphQLLookup) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if lookup.tags {
+		_, ok := r.tags[lookup.key()]
+		return ok
+	}
+	head, ok := r.heads[lookup.key()]
+	if !ok {
+		return false
+	}
+	for _, rev := range lookup.revs {
+		if _, ok := r.comparisons[comparisonKey(lookup.repo, rev, head.rev)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the prefetched head of a repository's ref, if there is one.
+func (r *ForgeResolver) prefetchedHead(repo forgeRepo) (prefetchedHead, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	head, ok := r.heads[graphQLLookup{repo: repo}.key()]
+	return head, ok
+}
+
+// Returns the prefetched tags of a repository, if there are any.
+func (r *ForgeResolver) prefetchedTags(repo forgeRepo) ([]Tag, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tags, ok := r.tags[graphQLLookup{repo: repo, tags: true}.key()]
+	return tags, ok
+}
+
+// Returns how many commits head has that base lacks, if a prefetch compared
+// the two either way round.
+func (r *ForgeResolver) prefetchedCompare(repo forgeRepo, base, head string) (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if comparison, ok := r.comparisons[comparisonKey(repo, base, head)]; ok {
+		return comparison.behind, true
+	}
+	if comparison, ok := r.comparisons[comparisonKey(repo, head, base)]; ok {
+		return comparison.ahead, true
+	}
+	return 0, false
+}
@@ -0,0 +1,329 @@
+package flake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// A repository served by githubStandIn.
+type standInRepo struct {
+	defaultBranch string
+	branches      map[string]string
+	tags          map[string]string
+}
+
+// A stand-in for the parts of GitHub's REST and GraphQL APIs that resolving
+// heads, listing tags and comparing revisions use. It counts the GraphQL
+// requests, the REST requests for heads and tags, and any other requests,
+// such as comparisons. Every revision it knows is three commits ahead of
+// the locked "old" one, and of any other.
+type githubStandIn struct {
+	repos map[string]standInRepo
+
+	// Answers GraphQL requests with this status instead when set
+	graphQLStatus int
+
+	rest, graphQL, other atomic.Int64
+}
+
+const standInDate = "2025-01-02T03:04:05Z"
+
+var (
+	standInLookup     = regexp.MustCompile(`(l\d+): repository\(owner: \$(o\d+), name: \$(n\d+)\) \{ (\w+)(?:\(expression: \$(e\d+)\))?`)
+	standInComparison = regexp.MustCompile(`(c\d+): compare\(headRef: \$(b\d+_\d+)\)`)
+)
+
+// Reports whether a repository has a revision.
+func (repo standInRepo) has(rev string) bool {
+	return rev == "old" || slices.Contains(slices.Collect(maps.Values(repo.branches)), rev) ||
+		slices.Contains(slices.Collect(maps.Values(repo.tags)), rev)
+}
+
+func (s *githubStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/graphql" {
+		s.graphQL.Add(1)
+		s.serveGraphQL(w, r)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/repos/"), "/")
+	if len(parts) == 4 && parts[2] == "compare" {
+		s.other.Add(1)
+		base, head, _ := strings.Cut(parts[3], "...")
+		if repo, ok := s.repos[parts[0]+"/"+parts[1]]; !ok || !repo.has(base) || !repo.has(head) {
+			http.NotFound(w, r)
+			return
+		}
+		if head == "old" {
+			fmt.Fprint(w, `{"ahead_by": 0}`)
+		} else {
+			fmt.Fprint(w, `{"ahead_by": 3}`)
+		}
+		return
+	}
+	if len(parts) == 5 && parts[2] == "git" && parts[3] == "commits" {
+		s.other.Add(1)
+		if repo, ok := s.repos[parts[0]+"/"+parts[1]]; !ok || !repo.has(parts[4]) {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+		return
+	}
+	if len(parts) < 3 || (parts[2] != "commits" && parts[2] != "tags") {
+		s.other.Add(1)
+		http.NotFound(w, r)
+		return
+	}
+	s.rest.Add(1)
+
+	repo, ok := s.repos[parts[0]+"/"+parts[1]]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case parts[2] == "commits" && len(parts) == 4:
+		ref := parts[3]
+		if ref == "HEAD" {
+			ref = repo.defaultBranch
+		}
+		rev, ok := repo.branches[ref]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"sha": %q, "commit": {"committer": {"date": %q}}}`, rev, standInDate)
+	case parts[2] == "tags":
+		var tags []string
+		for name, rev := range repo.tags {
+			tags = append(tags, fmt.Sprintf(`{"name": %q, "commit": {"sha": %q}}`, name, rev))
+		}
+		fmt.Fprintf(w, "[%s]", strings.Join(tags, ", "))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Answers each aliased repository lookup of a query from the fixtures, with
+// null for repositories that do not exist. Lookups are one per line.
+func (s *githubStandIn) serveGraphQL(w http.ResponseWriter, r *http.Request) {
+	if s.graphQLStatus != 0 {
+		http.Error(w, "unavailable", s.graphQLStatus)
+		return
+	}
+	if r.Method != http.MethodPost || r.Header.Get("Authorization") == "" {
+		http.Error(w, "requires authentication", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		Query     string            `json:"query"`
+		Variables map[string]string `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	commit := func(rev string) map[string]any {
+		return map[string]any{"oid": rev, "committedDate": standInDate}
+	}
+	data := make(map[string]any)
+	for line := range strings.Lines(request.Query) {
+		match := standInLookup.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		alias, owner, name, field, expression := match[1], request.Variables[match[2]], request.Variables[match[3]], match[4], request.Variables[match[5]]
+		repo, ok := s.repos[owner+"/"+name]
+		if !ok {
+			data[alias] = nil
+			continue
+		}
+
+		ref := make(map[string]any)
+		for _, comparison := range standInComparison.FindAllStringSubmatch(line, -1) {
+			if repo.has(request.Variables[comparison[2]]) {
+				ref[comparison[1]] = map[string]any{"aheadBy": 0, "behindBy": 3}
+			} else {
+				ref[comparison[1]] = nil
+			}
+		}
+
+		switch field {
+		case "defaultBranchRef":
+			ref["target"] = commit(repo.branches[repo.defaultBranch])
+			data[alias] = map[string]any{"defaultBranchRef": ref}
+		case "object":
+			rev, ok := repo.branches[expression]
+			if !ok {
+				rev, ok = repo.tags[expression]
+			}
+			if ok {
+				data[alias] = map[string]any{"object": commit(rev), "ref": ref}
+			} else {
+				data[alias] = map[string]any{"object": nil, "ref": nil}
+			}
+		case "refs":
+			// Tags are served as annotated tags, which have to be peeled
+			var nodes []any
+			for name, rev := range repo.tags {
+				nodes = append(nodes, map[string]any{"name": name, "target": map[string]any{"oid": "tag-" + rev, "target": commit(rev)}})
+			}
+			data[alias] = map[string]any{"refs": map[string]any{"pageInfo": map[string]any{"hasNextPage": false}, "nodes": nodes}}
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+// Builds a stand-in serving n repositories and a lockfile with an input for
+// each, every third one locked to a release tag, plus an input whose
+// repository does not exist.
+func newGitHubStandIn(n int) (*githubStandIn, FlakeLock) {
+	standIn := &githubStandIn{repos: make(map[string]standInRepo)}
+	lock := FlakeLock{Root: "root", Nodes: map[string]Node{"root": {Inputs: map[string]any{}}}}
+
+	for i := range n {
+		name := fmt.Sprintf("repo%d", i)
+		standIn.repos["owner/"+name] = standInRepo{
+			defaultBranch: "main",
+			branches:      map[string]string{"main": "main-" + name, "release": "release-" + name},
+			tags:          map[string]string{"v1.0.0": "v1-" + name, "v1.1.0": "v11-" + name},
+		}
+
+		node := Node{
+			Locked:   &Locked{Type: "github", Owner: "owner", Repo: name, Rev: "old"},
+			Original: &Original{Type: "github", Owner: "owner", Repo: name},
+		}
+		switch i % 3 {
+		case 1:
+			node.Original.Ref = "release"
+		case 2:
+			node.Original.Ref = "v1.0.0"
+			node.Locked.Rev = "v1-" + name
+		}
+		lock.Nodes[name] = node
+		lock.Nodes["root"].Inputs[name] = name
+	}
+
+	lock.Nodes["missing"] = Node{Locked: &Locked{Type: "github", Owner: "owner", Repo: "missing", Rev: "old"}}
+	lock.Nodes["root"].Inputs["missing"] = "missing"
+	return standIn, lock
+}
+
+func newStandInResolver(server *httptest.Server, graphQL bool, token string) *ForgeResolver {
+	credentials := &Credentials{}
+	if token != "" {
+		credentials.Add("github.com", Credential{Token: token, Source: "GITHUB_TOKEN"})
+	}
+	return &ForgeResolver{
+		Client:      server.Client(),
+		APIBase:     map[string]string{"github.com": server.URL},
+		Credentials: credentials,
+		GraphQL:     graphQL,
+	}
+}
+
+func TestForgeResolver_GraphQL(t *testing.T) {
+	standIn, lock := newGitHubStandIn(60)
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	check := func(resolver *ForgeResolver, reachability bool) UpdateResults {
+		t.Helper()
+		standIn.rest.Store(0)
+		standIn.graphQL.Store(0)
+		standIn.other.Store(0)
+		results, err := CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver, CheckReachability: reachability})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return results
+	}
+
+	results := check(newStandInResolver(server, false, "token"), false)
+	if rest, other := standIn.rest.Load(), standIn.other.Load(); rest != 61 || other != 60 {
+		t.Fatalf("expected a REST request per input and a comparison per update, got %d and %d", rest, other)
+	}
+	for _, update := range results.Updates {
+		if update.InputName != "missing" && (update.Error != "" || !update.IsUpdate || update.CommitsBehind != 3) {
+			t.Fatalf("expected an update for %s, got %+v", update.InputName, update)
+		}
+	}
+
+	testCases := []struct {
+		name                 string
+		token                string
+		graphQLStatus        int
+		reachability         bool
+		graphQL, rest, other int64
+	}{
+		// 60 lookups and the missing repository fit in two batches, which
+		// also compare the branches; the 20 newer tags are compared in a
+		// third. Only the missing repository is left to REST.
+		{name: "batched", token: "token", graphQL: 3, rest: 1},
+		{name: "graphql failure falls back to REST", token: "token", graphQLStatus: http.StatusBadGateway, graphQL: 4, rest: 61, other: 60},
+		{name: "no token", graphQL: 0, rest: 61, other: 60},
+		// The prefetched comparisons show the branches are reachable; inputs
+		// locked to a tag are still looked up
+		{name: "reachability", token: "token", reachability: true, graphQL: 3, rest: 1, other: 20},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			standIn.graphQLStatus = tc.graphQLStatus
+			expected := check(newStandInResolver(server, false, tc.token), tc.reachability)
+			results := check(newStandInResolver(server, true, tc.token), tc.reachability)
+
+			graphQL, rest, other := standIn.graphQL.Load(), standIn.rest.Load(), standIn.other.Load()
+			if graphQL != tc.graphQL || rest != tc.rest || other != tc.other {
+				t.Errorf("expected %d GraphQL, %d REST and %d other requests, got %d, %d and %d", tc.graphQL, tc.rest, tc.other, graphQL, rest, other)
+			}
+			if !reflect.DeepEqual(results, expected) {
+				t.Errorf("expected the same results as over REST\nexpected: %+v\ngot:      %+v", expected, results)
+			}
+		})
+	}
+}
+
+func BenchmarkCheckUpdates_GitHub(b *testing.B) {
+	standIn, lock := newGitHubStandIn(80)
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	for _, graphQL := range []bool{false, true} {
+		name := "rest"
+		if graphQL {
+			name = "graphql"
+		}
+		b.Run(name, func(b *testing.B) {
+			standIn.rest.Store(0)
+			standIn.graphQL.Store(0)
+			standIn.other.Store(0)
+			for b.Loop() {
+				resolver := newStandInResolver(server, graphQL, "token")
+				if _, err := CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			// Every request counts, comparisons included
+			requests := standIn.rest.Load() + standIn.graphQL.Load() + standIn.other.Load()
+			if graphQL && requests/int64(b.N) > 4 {
+				b.Fatalf("expected at most 4 requests per check, got %d", requests/int64(b.N))
+			}
+			b.ReportMetric(float64(requests)/float64(b.N), "requests/op")
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package flake
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Resolves tarball and file inputs served over http(s) without downloading
+// them. The response headers identify the latest version: the immutable URL
+// advertised through a Link header (Nix's lockable tarball protocol), the
+// URL redirects lead to, such as a channel's nixexprs.tar.xz, and the
+// Last-Modified and ETag headers.
+type HTTPResolver struct {
+	Client *http.Client
+
+	// Credentials sent to the hosts they are for, e.g. for tarballs of
+	// private repositories
+	Credentials *Credentials
+}
+
+func (r *HTTPResolver) Name() string {
+	return "http"
+}
+
+var immutableLinkPattern = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?immutable"?`)
+
+func (r *HTTPResolver) Resolve(ctx context.Context, query Query) (Resolution, error) {
+	locked := query.Locked
+	if locked == nil || (locked.Type != "tarball" && locked.Type != "file") {
+		return Resolution{}, fmt.Errorf("%w: not a tarball or file input", ErrUnsupported)
+	}
+
+	// The original URL is the one that moves; the locked one may already be
+	// a redirect target or an immutable URL
+	raw := locked.URL
+	if query.Original != nil && query.Original.URL != "" {
+		raw = query.Original.URL
+	}
+	target, err := url.Parse(raw)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") {
+		return Resolution{}, fmt.Errorf("%w: %s is not an http(s) URL", ErrUnsupported, raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, target.String(), nil)
+	if err != nil {
+		return Resolution{}, err
+	}
+	req.Header.Set("User-Agent", "flint")
+	if credential, ok := r.Credentials.Lookup(target.Host, target.Path); ok {
+		if credential.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+credential.Token)
+		} else {
+			req.SetBasicAuth(credential.Username, credential.Password)
+		}
+	}
+
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Resolution{}, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Resolution{}, &HTTPError{Method: http.MethodHead, URL: target.Redacted(), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	resolution := Resolution{URL: resp.Request.URL.String(), ETag: resp.Header.Get("ETag")}
+	for _, link := range resp.Header.Values("Link") {
+		if match := immutableLinkPattern.FindStringSubmatch(link); match != nil {
+			if immutable, err := resp.Request.URL.Parse(match[1]); err == nil {
+				resolution.URL = immutable.String()
+			}
+		}
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		resolution.LastModified = modified.Unix()
+	}
+
+	if strings.EqualFold(resolution.URL, target.String()) && resolution.LastModified == 0 && resolution.ETag == "" {
+		return Resolution{}, fmt.Errorf("%s does not say when it changes", target.Redacted())
+	}
+	return resolution, nil
+}
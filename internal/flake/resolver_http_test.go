@@ -0,0 +1,209 @@
+package flake
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestHTTPResolver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			http.Error(w, "tarballs must not be downloaded", http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/channel/nixexprs.tar.xz":
+			http.Redirect(w, r, "/releases/nixos-24.05.1234/nixexprs.tar.xz", http.StatusFound)
+		case "/releases/nixos-24.05.1234/nixexprs.tar.xz":
+			w.Header().Set("Last-Modified", "Thu, 02 Jan 2025 03:04:05 GMT")
+			w.Header().Set("ETag", `"abc"`)
+		case "/lockable.tar.gz":
+			w.Header().Set("Link", `</immutable/1234.tar.gz>; rel="immutable"`)
+		case "/opaque.tar.gz":
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	resolver := &HTTPResolver{Client: server.Client()}
+
+	testCases := []struct {
+		name     string
+		url      string
+		expected Resolution
+		wantErr  bool
+	}{
+		{
+			name: "channel redirect",
+			url:  server.URL + "/channel/nixexprs.tar.xz",
+			expected: Resolution{
+				URL:          server.URL + "/releases/nixos-24.05.1234/nixexprs.tar.xz",
+				LastModified: 1735787045,
+				ETag:         `"abc"`,
+			},
+		},
+		{
+			name:     "lockable tarball",
+			url:      server.URL + "/lockable.tar.gz",
+			expected: Resolution{URL: server.URL + "/immutable/1234.tar.gz"},
+		},
+		{name: "no identifying headers", url: server.URL + "/opaque.tar.gz", wantErr: true},
+		{name: "missing", url: server.URL + "/missing.tar.gz", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query := Query{
+				Locked:   &Locked{Type: "tarball", URL: tc.url},
+				Original: &Original{Type: "tarball", URL: tc.url},
+			}
+			resolution, err := resolver.Resolve(context.Background(), query)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tc.wantErr && resolution != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, resolution)
+			}
+		})
+	}
+
+	_, err := resolver.Resolve(context.Background(), Query{Locked: &Locked{Type: "github", Owner: "o", Repo: "r"}})
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected github inputs to be unsupported, got %v", err)
+	}
+}
+
+func TestContentChanged(t *testing.T) {
+	channel := &Original{Type: "tarball", URL: "https://channels.example.com/nixos/nixexprs.tar.xz"}
+
+	testCases := []struct {
+		name       string
+		query      Query
+		resolution Resolution
+		expected   bool
+		unknown    bool
+	}{
+		{
+			name:       "same nar hash",
+			query:      Query{Locked: &Locked{Type: "tarball", URL: "https://example.com/a.tar.gz", NarHash: "sha256-a"}},
+			resolution: Resolution{NarHash: "sha256-a", LastModified: 2000},
+			expected:   false,
+		},
+		{
+			name:       "different nar hash",
+			query:      Query{Locked: &Locked{Type: "file", URL: "https://example.com/a.nix", NarHash: "sha256-a"}},
+			resolution: Resolution{NarHash: "sha256-b"},
+			expected:   true,
+		},
+		{
+			name:       "redirect moved on",
+			query:      Query{Locked: &Locked{Type: "tarball", URL: "https://releases.example.com/1/nixexprs.tar.xz"}, Original: channel},
+			resolution: Resolution{URL: "https://releases.example.com/2/nixexprs.tar.xz"},
+			expected:   true,
+		},
+		{
+			name:       "redirect unchanged",
+			query:      Query{Locked: &Locked{Type: "tarball", URL: "https://releases.example.com/1/nixexprs.tar.xz", LastModified: 1000}, Original: channel},
+			resolution: Resolution{URL: "https://releases.example.com/1/nixexprs.tar.xz", LastModified: 2000},
+			expected:   false,
+		},
+		{
+			// The locked date comes from the archive, not the server
+			name:       "uploaded after the archive was built",
+			query:      Query{Locked: &Locked{Type: "tarball", URL: "https://example.com/a.tar.gz", LastModified: 1000}},
+			resolution: Resolution{URL: "https://example.com/a.tar.gz", LastModified: 2000},
+			expected:   false,
+			unknown:    true,
+		},
+		{
+			name:       "modified since locking",
+			query:      Query{Locked: &Locked{Type: "tarball", URL: "https://example.com/a.tar.gz", LastModified: 1000}},
+			resolution: Resolution{URL: "https://example.com/a.tar.gz", LastModified: 3000, LockedLastModified: 2000},
+			expected:   true,
+		},
+		{
+			name:       "etag changed",
+			query:      Query{Locked: &Locked{Type: "file", URL: "https://example.com/a.nix"}},
+			resolution: Resolution{URL: "https://example.com/a.nix", ETag: `"y"`, LockedETag: `"x"`, LastModified: 2000, LockedLastModified: 2000},
+			expected:   true,
+		},
+		{
+			name:       "etag unchanged",
+			query:      Query{Locked: &Locked{Type: "file", URL: "https://example.com/a.nix"}},
+			resolution: Resolution{URL: "https://example.com/a.nix", ETag: `"x"`, LockedETag: `"x"`, LastModified: 3000, LockedLastModified: 2000},
+			expected:   false,
+		},
+		{
+			name:       "nothing to compare",
+			query:      Query{Locked: &Locked{Type: "tarball", URL: "https://example.com/a.tar.gz"}},
+			resolution: Resolution{URL: "https://example.com/a.tar.gz", ETag: `"x"`},
+			expected:   false,
+			unknown:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			changed, known := contentChanged(tc.query, tc.resolution)
+			if changed != tc.expected || known == tc.unknown {
+				t.Errorf("expected %v (known: %v), got %v (known: %v)", tc.expected, !tc.unknown, changed, known)
+			}
+		})
+	}
+}
+
+func TestCheckUpdatesWith_Tarball(t *testing.T) {
+	lock := FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root": {Inputs: map[string]any{"src": "src"}},
+			"src": {
+				Locked:   &Locked{Type: "tarball", URL: "https://example.com/src.tar.gz", NarHash: "sha256-old"},
+				Original: &Original{Type: "tarball", URL: "https://example.com/src.tar.gz"},
+			},
+		},
+	}
+
+	resolver := &FakeResolver{Results: map[string]Resolution{
+		"https://example.com/src.tar.gz": {URL: "https://example.com/src.tar.gz", NarHash: "sha256-new"},
+	}}
+
+	results, err := CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	update := results.Updates[0]
+	if update.Error != "" || !update.IsUpdate || update.CurrentNarHash != "sha256-old" || update.LatestNarHash != "sha256-new" {
+		t.Errorf("expected a tarball update from sha256-old to sha256-new, got %+v", update)
+	}
+}
+
+func TestCheckUpdatesWith_TarballWithoutBaseline(t *testing.T) {
+	url := "https://example.com/src.tar.gz"
+	lock := FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root": {Inputs: map[string]any{"src": "src"}},
+			"src":  {Locked: &Locked{Type: "tarball", URL: url, NarHash: "sha256-old"}},
+		},
+	}
+
+	// Without a cache there are no validators from an earlier run to go by
+	resolver := &FakeResolver{Results: map[string]Resolution{url: {URL: url, ETag: `"x"`}}}
+	results, err := CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	update := results.Updates[0]
+	if update.IsUpdate || !slices.Equal(update.Unchecked, []string{"changes"}) {
+		t.Errorf("expected the tarball to be reported as unchecked, got %+v", update)
+	}
+}
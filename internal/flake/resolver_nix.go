@@ -0,0 +1,135 @@
+package flake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Resolves inputs by running `nix flake metadata --json`, or the deprecated
+// `nix flake info --json` for Nix versions that predate it.
+type NixResolver struct {
+	Binary  string
+	Verbose bool
+	Legacy  bool
+}
+
+func (r *NixResolver) Name() string {
+	if r.Legacy {
+		return "nix-legacy"
+	}
+	return "nix"
+}
+
+func (r *NixResolver) Resolve(ctx context.Context, query Query) (Resolution, error) {
+	output, err := r.metadata(ctx, query.URL)
+	if err != nil {
+		return Resolution{}, err
+	}
+	return parseFlakeMetadata(output)
+}
+
+// Reads an input's lockfile at a revision from `nix flake metadata`, which
+// fetches the flake and includes its lockfile in the output.
+func (r *NixResolver) FetchLock(ctx context.Context, query Query, rev string) (FlakeLock, error) {
+	if query.Locked == nil {
+		return FlakeLock{}, fmt.Errorf("%w: no locked information", ErrUnsupported)
+	}
+
+	locked := *query.Locked
+	locked.Rev = rev
+	locked.NarHash = ""
+	ref := LockedRef(&locked)
+	if ref == "" {
+		return FlakeLock{}, fmt.Errorf("%w: cannot build a reference for %s", ErrUnsupported, query.URL)
+	}
+
+	output, err := r.metadata(ctx, ref)
+	if err != nil {
+		return FlakeLock{}, err
+	}
+
+	var metadata struct {
+		Locks *FlakeLock `json:"locks"`
+	}
+	if err := json.Unmarshal(output, &metadata); err != nil {
+		return FlakeLock{}, fmt.Errorf("failed to parse nix output: %w", err)
+	}
+	if metadata.Locks == nil {
+		return FlakeLock{}, fmt.Errorf("%w: nix did not report the lockfile of %s", ErrUnsupported, ref)
+	}
+	return *metadata.Locks, nil
+}
+
+// Runs `nix flake metadata --json` (or `nix flake info --json`) for a flake
+// reference and returns its output.
+func (r *NixResolver) metadata(ctx context.Context, ref string) ([]byte, error) {
+	binary := r.Binary
+	if binary == "" {
+		binary = "nix"
+	}
+
+	subcommand := "metadata"
+	if r.Legacy {
+		subcommand = "info"
+	}
+
+	cmd := exec.CommandContext(ctx, binary,
+		"--extra-experimental-features", "nix-command flakes",
+		"flake", subcommand, "--json", ref)
+
+	// Don't wait on processes nix spawned once it has been killed
+	cmd.WaitDelay = time.Second
+
+	if r.Verbose {
+		fmt.Fprintf(os.Stderr, "Running: %s\n", strings.Join(cmd.Args, " "))
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		// A killed process says nothing useful about why it was killed
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("nix flake %s: %w", subcommand, ctxErr)
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("nix flake %s failed: %s", subcommand, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("nix flake %s failed: %w", subcommand, err)
+	}
+	return output, nil
+}
+
+// Parses the JSON printed by `nix flake metadata` and `nix flake info`.
+func parseFlakeMetadata(output []byte) (Resolution, error) {
+	var metadata struct {
+		Locked       *Locked `json:"locked"`
+		LastModified int64   `json:"lastModified"`
+	}
+	if err := json.Unmarshal(output, &metadata); err != nil {
+		return Resolution{}, fmt.Errorf("failed to parse nix output: %w", err)
+	}
+
+	if metadata.Locked == nil {
+		return Resolution{}, fmt.Errorf("no locked information in nix output")
+	}
+	// Tarballs, files and paths have no revision, only their content hash
+	if metadata.Locked.Rev == "" && metadata.Locked.NarHash == "" {
+		return Resolution{}, fmt.Errorf("no revision in locked information")
+	}
+
+	lastModified := metadata.Locked.LastModified
+	if lastModified == 0 {
+		lastModified = metadata.LastModified
+	}
+
+	return Resolution{
+		URL:          buildFlakeURL(metadata.Locked),
+		Rev:          metadata.Locked.Rev,
+		LastModified: lastModified,
+		NarHash:      metadata.Locked.NarHash,
+	}, nil
+}
@@ -0,0 +1,107 @@
+package flake
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestNewResolver(t *testing.T) {
+	resolver, err := NewResolver("", ResolverOptions{})
+	if err != nil || resolver.Name() != DefaultResolver {
+		t.Errorf("expected the default resolver, got %v (%v)", resolver, err)
+	}
+
+	resolver, err = NewResolver("nix-legacy", ResolverOptions{})
+	if err != nil || resolver.Name() != "nix-legacy" {
+		t.Errorf("expected the legacy resolver, got %v (%v)", resolver, err)
+	}
+
+	if _, err := NewResolver("bogus", ResolverOptions{}); err == nil {
+		t.Error("expected an error for an unknown resolver")
+	}
+
+	opts := ResolverOptions{ForgeHosts: map[string]string{"git.example.com": "bitbucket"}}
+	if _, err := NewResolver("forge", opts); err == nil {
+		t.Error("expected an error for an unknown forge")
+	}
+}
+
+func TestParseFlakeMetadata(t *testing.T) {
+	output := `{
+  "description": "A collection of packages for the Nix package manager",
+  "lastModified": 1759381078,
+  "locked": {
+    "lastModified": 1759381078,
+    "narHash": "sha256-abc",
+    "owner": "NixOS",
+    "repo": "nixpkgs",
+    "rev": "0123456789abcdef0123456789abcdef01234567",
+    "type": "github"
+  },
+  "original": {"owner": "NixOS", "repo": "nixpkgs", "type": "github"}
+}`
+
+	resolution, err := parseFlakeMetadata([]byte(output))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := Resolution{
+		URL:          "github:NixOS/nixpkgs",
+		Rev:          "0123456789abcdef0123456789abcdef01234567",
+		LastModified: 1759381078,
+		NarHash:      "sha256-abc",
+	}
+	if resolution != expected {
+		t.Errorf("expected %+v, got %+v", expected, resolution)
+	}
+
+	for _, invalid := range []string{"not json", `{}`, `{"locked": {"type": "github"}}`} {
+		if _, err := parseFlakeMetadata([]byte(invalid)); err == nil {
+			t.Errorf("expected an error for %s", invalid)
+		}
+	}
+
+	// Tarballs have no revision, only a content hash
+	tarball := `{"locked": {"type": "tarball", "url": "https://example.com/a.tar.gz", "narHash": "sha256-def"}}`
+	resolution, err = parseFlakeMetadata([]byte(tarball))
+	if err != nil || resolution.NarHash != "sha256-def" || resolution.URL != "https://example.com/a.tar.gz" {
+		t.Errorf("unexpected tarball resolution %+v (error: %v)", resolution, err)
+	}
+}
+
+func TestNixResolver_Binary(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake nix binary is a shell script")
+	}
+
+	// A stand-in for nix that checks its arguments and prints canned metadata
+	binary := filepath.Join(t.TempDir(), "nix")
+	script := `#!/bin/sh
+case "$*" in
+  *"flake metadata --json github:NixOS/nixpkgs") ;;
+  *) echo "unexpected arguments: $*" >&2; exit 1 ;;
+esac
+echo '{"locked": {"owner": "NixOS", "repo": "nixpkgs", "rev": "abc", "type": "github"}}'
+`
+	if err := os.WriteFile(binary, []byte(script), 0o755); err != nil {
+		t.Fatalf("failed to write fake nix: %v", err)
+	}
+
+	resolver := &NixResolver{Binary: binary}
+	resolution, err := resolver.Resolve(context.Background(), Query{URL: "github:NixOS/nixpkgs"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolution.Rev != "abc" {
+		t.Errorf("expected rev abc, got %s", resolution.Rev)
+	}
+
+	// Failures carry the message nix printed
+	if _, err := resolver.Resolve(context.Background(), Query{URL: "github:other/repo"}); err == nil {
+		t.Error("expected an error when nix fails")
+	}
+}
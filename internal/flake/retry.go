@@ -0,0 +1,175 @@
+package flake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// An unexpected HTTP response from a forge or git server.
+type HTTPError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+
+	// Suggests what to do about the error, such as setting a token
+	Hint string
+}
+
+func (e *HTTPError) Error() string {
+	message := fmt.Sprintf("%s %s: %s", e.Method, e.URL, e.Status)
+	if e.Hint != "" {
+		message += " (" + e.Hint + ")"
+	}
+	return message
+}
+
+// Returned when a forge's API rate limit is used up.
+type RateLimitError struct {
+	Host string
+
+	// When requests are allowed again, zero when the forge does not say
+	Reset time.Time
+
+	// Whether the requests were made with a token, which usually comes with
+	// a much higher limit
+	Authenticated bool
+}
+
+func (e *RateLimitError) Error() string {
+	message := fmt.Sprintf("API rate limit of %s exhausted", e.Host)
+	if !e.Reset.IsZero() {
+		message += " until " + e.Reset.UTC().Format("15:04:05 UTC")
+	}
+	if !e.Authenticated {
+		message += "; set a token for it, e.g. in GITHUB_TOKEN or access-tokens in nix.conf, to raise the limit"
+	}
+	return message
+}
+
+// Rate limits that reset this soon are waited out rather than reported.
+const maxRateLimitWait = time.Minute
+
+// Returns how long to wait before a rate limit resets.
+func (e *RateLimitError) wait() time.Duration {
+	if e.Reset.IsZero() {
+		return 0
+	}
+	return max(time.Until(e.Reset), 0)
+}
+
+// Reads the rate limit headers of a response, reporting whether it was
+// refused for exceeding the limit and when the limit resets. GitHub and
+// Gitea send X-RateLimit-* headers, GitLab RateLimit-*, and secondary limits
+// come with Retry-After.
+func rateLimited(resp *http.Response) (exhausted bool, reset time.Time) {
+	header := resp.Header
+	remaining := header.Get("X-RateLimit-Remaining")
+	if remaining == "" {
+		remaining = header.Get("RateLimit-Remaining")
+	}
+
+	resetHeader := header.Get("X-RateLimit-Reset")
+	if resetHeader == "" {
+		resetHeader = header.Get("RateLimit-Reset")
+	}
+	if unix, err := strconv.ParseInt(resetHeader, 10, 64); err == nil {
+		reset = time.Unix(unix, 0)
+	}
+
+	retryAfter := header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(retryAfter); err == nil {
+		reset = time.Now().Add(time.Duration(seconds) * time.Second)
+	} else if date, err := http.ParseTime(retryAfter); err == nil {
+		reset = date
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true, reset
+	case http.StatusForbidden:
+		return remaining == "0" || retryAfter != "", reset
+	default:
+		return remaining == "0", reset
+	}
+}
+
+// Reports whether an error is likely to go away when retried: timeouts,
+// dropped connections, rate limiting and server errors.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var rateErr *RateLimitError
+	if errors.As(err, &rateErr) {
+		return rateErr.wait() <= maxRateLimitWait
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// Resolves a query, bounding each attempt by the per-request timeout and
+// retrying transient failures with exponential backoff. Cancelling ctx stops
+// both the current attempt and any further retries.
+func resolveWithRetry(ctx context.Context, resolver Resolver, query Query, opts UpdateOptions) (Resolution, error) {
+	return withRetry(ctx, opts, func(ctx context.Context) (Resolution, error) {
+		return resolver.Resolve(ctx, query)
+	})
+}
+
+// Runs a lookup with the timeout and retry policy of resolveWithRetry.
+func withRetry[T any](ctx context.Context, opts UpdateOptions, lookup func(context.Context) (T, error)) (T, error) {
+	backoff := opts.Backoff
+	if backoff <= 0 {
+		backoff = 500 * time.Millisecond
+	}
+
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if opts.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		}
+
+		result, err := lookup(attemptCtx)
+		cancel()
+
+		if err == nil || ctx.Err() != nil || attempt >= opts.Retries || !IsTransient(err) {
+			return result, err
+		}
+
+		// Retrying before a rate limit resets is bound to fail again
+		wait := backoff << attempt
+		var rateErr *RateLimitError
+		if errors.As(err, &rateErr) {
+			wait = max(wait, rateErr.wait())
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package flake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A resolver backed by a function, for exercising the scheduling around it.
+type funcResolver func(ctx context.Context, query Query) (Resolution, error)
+
+func (f funcResolver) Name() string {
+	return "func"
+}
+
+func (f funcResolver) Resolve(ctx context.Context, query Query) (Resolution, error) {
+	return f(ctx, query)
+}
+
+func TestIsTransient(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{errors.New("ref not found"), false},
+		{&HTTPError{StatusCode: http.StatusNotFound}, false},
+		{&HTTPError{StatusCode: http.StatusTooManyRequests}, true},
+		{fmt.Errorf("wrapped: %w", &HTTPError{StatusCode: http.StatusBadGateway}), true},
+		{context.DeadlineExceeded, true},
+		{context.Canceled, false},
+		{&RateLimitError{Host: "api.github.com", Reset: time.Now().Add(10 * time.Second)}, true},
+		{&RateLimitError{Host: "api.github.com", Reset: time.Now().Add(time.Hour)}, false},
+	}
+
+	for _, tc := range testCases {
+		if result := IsTransient(tc.err); result != tc.expected {
+			t.Errorf("IsTransient(%v): expected %v, got %v", tc.err, tc.expected, result)
+		}
+	}
+}
+
+func TestResolveWithRetry(t *testing.T) {
+	var attempts atomic.Int32
+	flaky := funcResolver(func(ctx context.Context, query Query) (Resolution, error) {
+		if attempts.Add(1) < 3 {
+			return Resolution{}, &HTTPError{StatusCode: http.StatusServiceUnavailable}
+		}
+		return Resolution{Rev: "abc"}, nil
+	})
+
+	opts := UpdateOptions{Retries: 2, Backoff: time.Millisecond}
+	resolution, err := resolveWithRetry(context.Background(), flaky, Query{}, opts)
+	if err != nil || resolution.Rev != "abc" || attempts.Load() != 3 {
+		t.Errorf("expected success on the third attempt, got %+v (%v) after %d attempts", resolution, err, attempts.Load())
+	}
+
+	// Permanent failures are not retried
+	attempts.Store(0)
+	permanent := funcResolver(func(ctx context.Context, query Query) (Resolution, error) {
+		attempts.Add(1)
+		return Resolution{}, &HTTPError{StatusCode: http.StatusNotFound}
+	})
+	if _, err := resolveWithRetry(context.Background(), permanent, Query{}, opts); err == nil || attempts.Load() != 1 {
+		t.Errorf("expected a single failed attempt, got %d (%v)", attempts.Load(), err)
+	}
+
+	// Each attempt is bounded by the per-request timeout
+	attempts.Store(0)
+	hanging := funcResolver(func(ctx context.Context, query Query) (Resolution, error) {
+		attempts.Add(1)
+		<-ctx.Done()
+		return Resolution{}, ctx.Err()
+	})
+	opts.Timeout = 5 * time.Millisecond
+	if _, err := resolveWithRetry(context.Background(), hanging, Query{}, opts); !errors.Is(err, context.DeadlineExceeded) || attempts.Load() != 3 {
+		t.Errorf("expected every attempt to time out, got %d attempts (%v)", attempts.Load(), err)
+	}
+}
+
+func TestCheckUpdatesWith_Concurrency(t *testing.T) {
+	lock := FlakeLock{Nodes: map[string]Node{"root": {Inputs: map[string]any{}}}, Root: "root"}
+	for i := range 20 {
+		name := fmt.Sprintf("input%02d", i)
+		lock.Nodes[name] = Node{Locked: &Locked{Type: "github", Owner: "owner", Repo: name, Rev: "old"}}
+		lock.Nodes["root"].Inputs[name] = name
+	}
+
+	var mu sync.Mutex
+	var running, peak int
+	resolver := funcResolver(func(ctx context.Context, query Query) (Resolution, error) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+
+		time.Sleep(2 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return Resolution{Rev: "new"}, nil
+	})
+
+	results, err := CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver, Parallelism: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if peak > 3 {
+		t.Errorf("expected at most 3 concurrent queries, got %d", peak)
+	}
+	if len(results.Updates) != 20 || results.Incomplete {
+		t.Fatalf("expected 20 complete results, got %d (incomplete: %v)", len(results.Updates), results.Incomplete)
+	}
+	for i, update := range results.Updates {
+		if expected := fmt.Sprintf("input%02d", i); update.InputName != expected || !update.IsUpdate {
+			t.Errorf("result %d: expected an update for %s, got %+v", i, expected, update)
+		}
+	}
+}
+
+func TestCheckUpdatesWith_Cancelled(t *testing.T) {
+	lock := FlakeLock{Nodes: map[string]Node{"root": {Inputs: map[string]any{}}}, Root: "root"}
+	for i := range 5 {
+		name := fmt.Sprintf("input%d", i)
+		lock.Nodes[name] = Node{Locked: &Locked{Type: "github", Owner: "owner", Repo: name, Rev: "old"}}
+		lock.Nodes["root"].Inputs[name] = name
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The first query succeeds and cancels the check, like Ctrl-C would
+	resolver := funcResolver(func(ctx context.Context, query Query) (Resolution, error) {
+		if query.Input == "input0" {
+			cancel()
+			return Resolution{Rev: "new"}, nil
+		}
+		<-ctx.Done()
+		return Resolution{}, ctx.Err()
+	})
+
+	results, err := CheckUpdatesWith(ctx, lock, UpdateOptions{Resolver: resolver, Parallelism: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !results.Incomplete || len(results.Updates) != 5 {
+		t.Fatalf("expected 5 incomplete results, got %d (incomplete: %v)", len(results.Updates), results.Incomplete)
+	}
+	if !results.Updates[0].IsUpdate {
+		t.Errorf("expected the resolved input to keep its result, got %+v", results.Updates[0])
+	}
+	for _, update := range results.Updates[1:] {
+		if update.Error == "" {
+			t.Errorf("expected %s to be reported as not checked", update.InputName)
+		}
+	}
+}
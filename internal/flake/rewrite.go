@@ -0,0 +1,223 @@
+package flake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A rule moving flake references elsewhere, like git's url.<base>.insteadOf:
+// references starting with InsteadOf are looked up at URL followed by the
+// rest of the reference. "github:NixOS/" with the URL
+// "git+https://git.internal/mirror/" sends github:NixOS/nixpkgs to
+// git+https://git.internal/mirror/nixpkgs.
+type Rewrite struct {
+	URL       string
+	InsteadOf string
+
+	// Also treats inputs locked from URL as coming from InsteadOf when
+	// deciding whether two inputs are the same source, see RewriteLock
+	Identity bool
+}
+
+// Rewrite rules, of which the one with the longest matching prefix applies.
+type Rewrites []Rewrite
+
+// Rewrites a reference with the rule matching the longest prefix of it. With
+// identity set, only identity rules apply, and they apply in reverse.
+func (r Rewrites) apply(ref string, identity bool) (string, bool) {
+	var best, replacement string
+	for _, rule := range r {
+		from, to := rule.InsteadOf, rule.URL
+		if identity {
+			from, to = rule.URL, rule.InsteadOf
+		}
+		if from == "" || (identity && !rule.Identity) || !strings.HasPrefix(ref, from) {
+			continue
+		}
+		if len(from) > len(best) {
+			best, replacement = from, to
+		}
+	}
+	if best == "" {
+		return ref, false
+	}
+	return replacement + strings.TrimPrefix(ref, best), true
+}
+
+// Moves the source attributes of a locked entry to those of an original,
+// keeping the revision and everything else that was locked.
+func moveLocked(locked Locked, original Original) Locked {
+	locked.Type = original.Type
+	locked.Owner = original.Owner
+	locked.Repo = original.Repo
+	locked.Host = original.Host
+	locked.URL = original.URL
+	locked.Path = original.Path
+	return locked
+}
+
+// Returns the query for where the rules send an input, or the query itself
+// when no rule matches. Rules match the reference the input was declared
+// with, without its ref or revision.
+func (r Rewrites) rewriteQuery(query Query) (Query, error) {
+	if len(r) == 0 || query.Locked == nil {
+		return query, nil
+	}
+
+	original, err := ParseRef(query.URL)
+	if err != nil {
+		return query, nil
+	}
+	repository := original
+	repository.Ref, repository.Rev = "", ""
+
+	rewritten, ok := r.apply(repository.String(), false)
+	if !ok {
+		return query, nil
+	}
+	moved, err := ParseRef(rewritten)
+	if err != nil {
+		return query, fmt.Errorf("error rewriting %s: %w", query.URL, err)
+	}
+	if moved.Ref == "" {
+		moved.Ref = original.Ref
+	}
+	if moved.Rev == "" {
+		moved.Rev = original.Rev
+	}
+
+	locked := moveLocked(*query.Locked, moved)
+	query.URL = moved.String()
+	query.Locked = &locked
+	query.Original = &moved
+	return query, nil
+}
+
+// Returns a copy of a lockfile with the locked entries of nodes locked from a
+// mirror moved back upstream by the identity rules, so that they are
+// recognised as the same source as inputs locked from upstream, and reported
+// under the upstream reference.
+func (r Rewrites) RewriteLock(flakeLock FlakeLock) FlakeLock {
+	nodes := make(map[string]Node, len(flakeLock.Nodes))
+	for name, node := range flakeLock.Nodes {
+		if node.Locked != nil {
+			repository := Original{
+				Type:  node.Locked.Type,
+				Owner: node.Locked.Owner,
+				Repo:  node.Locked.Repo,
+				Host:  node.Locked.Host,
+				URL:   node.Locked.URL,
+				Path:  node.Locked.Path,
+			}
+			if rewritten, ok := r.apply(repository.String(), true); ok {
+				if moved, err := ParseRef(rewritten); err == nil {
+					locked := moveLocked(*node.Locked, moved)
+					node.Locked = &locked
+				}
+			}
+		}
+		nodes[name] = node
+	}
+	flakeLock.Nodes = nodes
+	return flakeLock
+}
+
+// Looks inputs up where the rewrite rules send them, such as an internal
+// mirror, while reporting them under the references they were declared with.
+type RewritingResolver struct {
+	Resolver Resolver
+	Rewrites Rewrites
+}
+
+func (r *RewritingResolver) Name() string {
+	return r.Resolver.Name()
+}
+
+// Reports a resolution of a rewritten query under the original reference.
+func restoreURL(resolution Resolution, query, moved Query) Resolution {
+	if resolution.URL == moved.URL {
+		resolution.URL = query.URL
+	}
+	return resolution
+}
+
+// Calls a capability of the wrapped resolver with the query rewritten.
+// action says what the capability does, for the error returned when the
+// resolver lacks it.
+func rewrittenCall[C, T any](r *RewritingResolver, query Query, action string, call func(C, Query) (T, error)) (T, error) {
+	var zero T
+	capability, err := capabilityOf[C](r.Resolver, action)
+	if err != nil {
+		return zero, err
+	}
+	moved, err := r.Rewrites.rewriteQuery(query)
+	if err != nil {
+		return zero, err
+	}
+	return call(capability, moved)
+}
+
+func (r *RewritingResolver) Resolve(ctx context.Context, query Query) (Resolution, error) {
+	moved, err := r.Rewrites.rewriteQuery(query)
+	if err != nil {
+		return Resolution{}, err
+	}
+	resolution, err := r.Resolver.Resolve(ctx, moved)
+	return restoreURL(resolution, query, moved), err
+}
+
+func (r *RewritingResolver) ResolveBefore(ctx context.Context, query Query, before time.Time) (Resolution, error) {
+	return rewrittenCall(r, query, "look back in history", func(history HistoryResolver, moved Query) (Resolution, error) {
+		resolution, err := history.ResolveBefore(ctx, moved, before)
+		return restoreURL(resolution, query, moved), err
+	})
+}
+
+func (r *RewritingResolver) ListTags(ctx context.Context, query Query) ([]Tag, error) {
+	return rewrittenCall(r, query, "list tags", func(lister TagLister, moved Query) ([]Tag, error) {
+		return lister.ListTags(ctx, moved)
+	})
+}
+
+func (r *RewritingResolver) ListBranches(ctx context.Context, query Query, prefix string) ([]string, error) {
+	return rewrittenCall(r, query, "list branches", func(lister BranchLister, moved Query) ([]string, error) {
+		return lister.ListBranches(ctx, moved, prefix)
+	})
+}
+
+func (r *RewritingResolver) Compare(ctx context.Context, query Query, base, head string) (Comparison, error) {
+	return rewrittenCall(r, query, "compare revisions", func(comparer Comparer, moved Query) (Comparison, error) {
+		return comparer.Compare(ctx, moved, base, head)
+	})
+}
+
+func (r *RewritingResolver) FetchLock(ctx context.Context, query Query, rev string) (FlakeLock, error) {
+	return rewrittenCall(r, query, "read upstream lockfiles", func(fetcher LockFetcher, moved Query) (FlakeLock, error) {
+		return fetcher.FetchLock(ctx, moved, rev)
+	})
+}
+
+func (r *RewritingResolver) FetchChangelog(ctx context.Context, query Query, span ChangelogSpan) (Changelog, error) {
+	return rewrittenCall(r, query, "fetch changelogs", func(fetcher ChangelogFetcher, moved Query) (Changelog, error) {
+		return fetcher.FetchChangelog(ctx, moved, span)
+	})
+}
+
+func (r *RewritingResolver) Prefetch(ctx context.Context, heads, tags []Query) {
+	prefetcher, ok := r.Resolver.(Prefetcher)
+	if !ok {
+		return
+	}
+	rewrite := func(queries []Query) []Query {
+		var moved []Query
+		for _, query := range queries {
+			if query, err := r.Rewrites.rewriteQuery(query); err == nil {
+				moved = append(moved, query)
+			}
+		}
+		return moved
+	}
+	prefetcher.Prefetch(ctx, rewrite(heads), rewrite(tags))
+}
@@ -0,0 +1,148 @@
+package flake
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+var mirrorRewrites = Rewrites{
+	{URL: "git+https://git.internal/mirror/", InsteadOf: "github:NixOS/", Identity: true},
+	{URL: "git+https://git.internal/home-manager", InsteadOf: "github:nix-community/home-manager"},
+	{URL: "git+https://git.internal/community/", InsteadOf: "github:nix-community/"},
+}
+
+func TestRewrites_RewriteQuery(t *testing.T) {
+	testCases := []struct {
+		name     string
+		url      string
+		locked   Locked
+		expected string
+		lockedAs Locked
+	}{
+		{
+			name:     "branch",
+			url:      "github:NixOS/nixpkgs/nixos-24.05",
+			locked:   Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "abc"},
+			expected: "git+https://git.internal/mirror/nixpkgs?ref=nixos-24.05",
+			lockedAs: Locked{Type: "git", URL: "https://git.internal/mirror/nixpkgs", Rev: "abc"},
+		},
+		{
+			name:     "longest prefix wins",
+			url:      "github:nix-community/home-manager?dir=modules",
+			locked:   Locked{Type: "github", Owner: "nix-community", Repo: "home-manager", Rev: "abc", Dir: "modules"},
+			expected: "git+https://git.internal/home-manager?dir=modules",
+			lockedAs: Locked{Type: "git", URL: "https://git.internal/home-manager", Rev: "abc", Dir: "modules"},
+		},
+		{
+			name:     "no rule",
+			url:      "github:numtide/flake-utils",
+			locked:   Locked{Type: "github", Owner: "numtide", Repo: "flake-utils", Rev: "abc"},
+			expected: "github:numtide/flake-utils",
+			lockedAs: Locked{Type: "github", Owner: "numtide", Repo: "flake-utils", Rev: "abc"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := mirrorRewrites.rewriteQuery(Query{URL: tc.url, Locked: &tc.locked})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if query.URL != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, query.URL)
+			}
+			if *query.Locked != tc.lockedAs {
+				t.Errorf("expected locked %+v, got %+v", tc.lockedAs, *query.Locked)
+			}
+		})
+	}
+}
+
+func TestRewritingResolver(t *testing.T) {
+	lock := FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root": {Inputs: map[string]any{"nixpkgs": "nixpkgs"}},
+			"nixpkgs": {
+				Locked:   &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "old"},
+				Original: &Original{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Ref: "nixos-unstable"},
+			},
+		},
+	}
+
+	fake := &FakeResolver{Results: map[string]Resolution{
+		"git+https://git.internal/mirror/nixpkgs?ref=nixos-unstable": {URL: "git+https://git.internal/mirror/nixpkgs?ref=nixos-unstable", Rev: "new"},
+	}}
+	results, err := CheckUpdatesWith(context.Background(), lock, UpdateOptions{
+		Resolver: &RewritingResolver{Resolver: fake, Rewrites: mirrorRewrites},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	update := results.Updates[0]
+	if update.Error != "" || update.LatestRev != "new" {
+		t.Fatalf("expected the mirror to be checked, got %+v", update)
+	}
+	if expected := "github:NixOS/nixpkgs/nixos-unstable"; update.CurrentURL != expected || update.LatestURL != expected {
+		t.Errorf("expected the update to be reported as %s, got %s and %s", expected, update.CurrentURL, update.LatestURL)
+	}
+}
+
+// A resolver reporting every repository as archived.
+type archivedResolver struct{ funcResolver }
+
+func (archivedResolver) CheckRepository(ctx context.Context, query Query) (RepositoryStatus, error) {
+	return RepositoryStatus{Archived: true}, nil
+}
+
+func TestRewritingResolver_CheckRepository(t *testing.T) {
+	resolver := &RewritingResolver{Resolver: archivedResolver{}, Rewrites: mirrorRewrites}
+
+	// An archived mirror says nothing about upstream
+	mirrored := Query{URL: "github:NixOS/nixpkgs", Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs"}}
+	if status, err := resolver.CheckRepository(context.Background(), mirrored); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected rewritten inputs to be unsupported, got %+v, %v", status, err)
+	}
+
+	upstream := Query{URL: "github:numtide/flake-utils", Locked: &Locked{Type: "github", Owner: "numtide", Repo: "flake-utils"}}
+	if status, err := resolver.CheckRepository(context.Background(), upstream); err != nil || !status.Archived {
+		t.Errorf("expected inputs without a rule to be checked, got %+v, %v", status, err)
+	}
+}
+
+func TestRewrites_RewriteLock(t *testing.T) {
+	lock := FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root":        {Inputs: map[string]any{"nixpkgs": "nixpkgs", "hm": "hm", "tool": "tool"}},
+			"nixpkgs":     {Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "a"}},
+			"tool":        {Inputs: map[string]any{"nixpkgs": "nixpkgs_2"}, Locked: &Locked{Type: "github", Owner: "owner", Repo: "tool", Rev: "t"}},
+			"nixpkgs_2":   {Locked: &Locked{Type: "git", URL: "https://git.internal/mirror/nixpkgs", Rev: "b"}},
+			"hm":          {Inputs: map[string]any{"home-manager": "hm_2"}, Locked: &Locked{Type: "github", Owner: "nix-community", Repo: "home-manager", Rev: "c"}},
+			"hm_2":        {Locked: &Locked{Type: "git", URL: "https://git.internal/home-manager", Rev: "d"}},
+			"flake-utils": {Locked: &Locked{Type: "github", Owner: "numtide", Repo: "flake-utils", Rev: "e"}},
+		},
+	}
+
+	identities := func(lock FlakeLock) map[string]int {
+		counts := make(map[string]int)
+		for url := range AnalyzeFlake(lock).Deps {
+			counts[ExtractRepoIdentity(url)]++
+		}
+		return counts
+	}
+
+	rewritten := mirrorRewrites.RewriteLock(lock)
+	counts := identities(rewritten)
+	if counts["github:NixOS/nixpkgs"] != 2 {
+		t.Errorf("expected nixpkgs from upstream and the mirror to be one source, got %v", counts)
+	}
+	if counts["github:nix-community/home-manager"] != 1 || counts["git:https://git.internal/home-manager"] != 1 {
+		t.Errorf("expected rules without identity to leave sources apart, got %v", counts)
+	}
+	if lock.Nodes["nixpkgs_2"].Locked.Type != "git" {
+		t.Errorf("expected the original lockfile to be left alone")
+	}
+}
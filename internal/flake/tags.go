@@ -0,0 +1,265 @@
+package flake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// A tag in an input's repository, with the commit it points at.
+type Tag struct {
+	Name string
+	Rev  string
+}
+
+// Implemented by resolvers that can list the tags of an input's repository.
+// Listers return ErrUnsupported for inputs they cannot handle, and the tags
+// they did list along with errTagsTruncated when there were too many to list
+// them all.
+type TagLister interface {
+	ListTags(ctx context.Context, query Query) ([]Tag, error)
+}
+
+// Returned along with the tags that were listed when a repository has more
+// tags than listers read.
+var errTagsTruncated = errors.New("too many tags to list them all")
+
+// Reports whether an input's ref may be a tag worth listing tags for. Refs
+// shaped like release branches, such as nixos-24.05, are branches unless
+// the lock says otherwise, and would otherwise cost a tag listing for every
+// nixpkgs input.
+func mayBeTag(query Query) (Version, bool) {
+	version, ok := ParseVersion(query.Ref)
+	if !ok {
+		return Version{}, false
+	}
+	if query.Locked != nil && strings.HasPrefix(query.Locked.Ref, "refs/tags/") {
+		return version, true
+	}
+	return version, !channelPattern.MatchString(query.Ref)
+}
+
+// Lists tags with the first member that supports the input.
+func (c ChainResolver) ListTags(ctx context.Context, query Query) ([]Tag, error) {
+	return chainCall(c, "list tags", func(lister TagLister) ([]Tag, error) {
+		return lister.ListTags(ctx, query)
+	})
+}
+
+// Lists tags through the wrapped resolver, caching them like resolutions.
+func (c *CachingResolver) ListTags(ctx context.Context, query Query) ([]Tag, error) {
+	lister, err := capabilityOf[TagLister](c.Resolver, "list tags")
+	if err != nil {
+		return nil, err
+	}
+
+	repository := query
+	repository.Ref = ""
+	key := "tags\x00" + c.Resolver.Name() + "\x00" + queryKey(repository)
+	offline := fmt.Errorf("tags of %s are not cached and flint is offline", query.URL)
+
+	// Truncated listings are cached too, remembering that they are
+	type cachedTags struct {
+		Tags      []Tag
+		Truncated bool `json:",omitempty"`
+	}
+	cached, err := cachedCall(c, key, false, offline, func() (cachedTags, error) {
+		tags, err := lister.ListTags(ctx, query)
+		truncated := errors.Is(err, errTagsTruncated)
+		if err != nil && !truncated {
+			return cachedTags{}, err
+		}
+		return cachedTags{Tags: tags, Truncated: truncated}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cached.Truncated {
+		return cached.Tags, errTagsTruncated
+	}
+	return cached.Tags, nil
+}
+
+// Lists the tags advertised by the remote, peeling annotated tags.
+func (r *GitResolver) ListTags(ctx context.Context, query Query) ([]Tag, error) {
+	remote, _, err := gitRemote(query)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := r.listRefs(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	return refs.tags(), nil
+}
+
+// Returns the tags among the refs, peeled to the commits they point at.
+func (g gitRefs) tags() []Tag {
+	var tags []Tag
+	for name, oid := range g.refs {
+		tag, ok := strings.CutPrefix(name, "refs/tags/")
+		if !ok {
+			continue
+		}
+		if peeled, ok := g.peeled[name]; ok {
+			oid = peeled
+		}
+		tags = append(tags, Tag{Name: tag, Rev: oid})
+	}
+
+	slices.SortFunc(tags, func(a, b Tag) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return tags
+}
+
+// How many pages of tags are read from paginated forge APIs. GitHub and
+// Gitea list tags by name rather than by version, so every page counts;
+// listings cut short by this limit are reported as truncated.
+const maxTagPages = 20
+
+// Asks the forge for the repository's tags.
+func (r *ForgeResolver) ListTags(ctx context.Context, query Query) ([]Tag, error) {
+	repo, err := r.forgeRepo(query)
+	if err != nil {
+		return nil, err
+	}
+
+	type forgeTag struct {
+		Name   string `json:"name"`
+		Commit struct {
+			SHA string `json:"sha"`
+			ID  string `json:"id"`
+		} `json:"commit"`
+	}
+
+	var tags []Tag
+	truncated := false
+	collect := func(page []forgeTag) {
+		for _, tag := range page {
+			rev := tag.Commit.SHA
+			if rev == "" {
+				rev = tag.Commit.ID
+			}
+			tags = append(tags, Tag{Name: tag.Name, Rev: rev})
+		}
+	}
+
+	switch repo.Kind {
+	case "github", "gitea":
+		if prefetched, ok := r.prefetchedTags(repo); ok {
+			return prefetched, nil
+		}
+		for page := 1; page <= maxTagPages; page++ {
+			params := url.Values{"page": {fmt.Sprint(page)}}
+			if repo.Kind == "github" {
+				params.Set("per_page", "100")
+			} else {
+				params.Set("limit", "50")
+			}
+
+			var result []forgeTag
+			endpoint := fmt.Sprintf("%s/repos/%s/%s/tags?%s", r.apiBase(repo),
+				url.PathEscape(repo.Owner), url.PathEscape(repo.Repo), params.Encode())
+			if err := r.getJSON(ctx, repo, endpoint, &result); err != nil {
+				return nil, err
+			}
+			collect(result)
+			if len(result) == 0 || (repo.Kind == "github" && len(result) < 100) || (repo.Kind == "gitea" && len(result) < 50) {
+				break
+			}
+			truncated = page == maxTagPages
+		}
+
+	case "gitlab":
+		owner, err := url.PathUnescape(repo.Owner)
+		if err != nil {
+			owner = repo.Owner
+		}
+
+		// GitLab can sort by version itself, so the first page holds the
+		// newest releases; inputs locked to older ones are beyond it
+		var result []forgeTag
+		params := url.Values{"order_by": {"version"}, "sort": {"desc"}, "per_page": {"100"}}
+		endpoint := fmt.Sprintf("%s/projects/%s/repository/tags?%s", r.apiBase(repo),
+			url.PathEscape(owner+"/"+repo.Repo), params.Encode())
+		if err := r.getJSON(ctx, repo, endpoint, &result); err != nil {
+			return nil, err
+		}
+		collect(result)
+		truncated = len(result) == 100
+
+	case "sourcehut":
+		refs, err := r.sourceHutRefs(ctx, repo)
+		if err != nil {
+			return nil, err
+		}
+		tags = gitRefs{refs: refs, peeled: peeledRefs(refs)}.tags()
+	}
+
+	if truncated {
+		return tags, fmt.Errorf("%s: %w", query.URL, errTagsTruncated)
+	}
+	return tags, nil
+}
+
+// Splits the peeled entries ("refs/tags/v1^{}") out of an info/refs listing.
+func peeledRefs(refs map[string]string) map[string]string {
+	peeled := make(map[string]string)
+	for name, oid := range refs {
+		if tag, ok := strings.CutSuffix(name, "^{}"); ok {
+			peeled[tag] = oid
+			delete(refs, name)
+		}
+	}
+	return peeled
+}
+
+// The outcome of looking for a newer release of an input locked to a tag.
+type tagUpdate struct {
+	Latest   Tag
+	Bump     Bump
+	HeldBack string
+	Found    bool // whether the current ref is one of the tags at all
+}
+
+// Picks the newest tag with the same prefix as current that is at most
+// maxBump away, skipping prereleases unless current is one. The newest tag
+// beyond maxBump is reported as held back.
+func selectTag(current Version, tags []Tag, maxBump Bump) tagUpdate {
+	var result tagUpdate
+	var best, newest *Version
+	for _, tag := range tags {
+		if tag.Name == current.String() {
+			result.Found = true
+		}
+
+		version, ok := ParseVersion(tag.Name)
+		if !ok || version.Prefix != current.Prefix || version.Compare(current) <= 0 {
+			continue
+		}
+		if version.Prerelease != "" && current.Prerelease == "" {
+			continue
+		}
+
+		if newest == nil || version.Compare(*newest) > 0 {
+			newest = &version
+		}
+		if ClassifyBump(current, version) <= maxBump && (best == nil || version.Compare(*best) > 0) {
+			best = &version
+			result.Latest = tag
+		}
+	}
+
+	if best != nil {
+		result.Bump = ClassifyBump(current, *best)
+	}
+	if newest != nil && (best == nil || newest.Compare(*best) != 0) {
+		result.HeldBack = newest.String()
+	}
+	return result
+}
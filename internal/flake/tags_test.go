@@ -0,0 +1,328 @@
+package flake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSelectTag(t *testing.T) {
+	tags := []Tag{
+		{Name: "v1.4.2", Rev: "a"},
+		{Name: "v1.4.3", Rev: "b"},
+		{Name: "v1.5.0", Rev: "c"},
+		{Name: "v2.0.0", Rev: "d"},
+		{Name: "v2.1.0-rc.1", Rev: "e"},
+		{Name: "other-9.0.0", Rev: "f"},
+	}
+
+	testCases := []struct {
+		name     string
+		current  string
+		maxBump  Bump
+		latest   string
+		bump     Bump
+		heldBack string
+		found    bool
+	}{
+		{"any release", "v1.4.2", BumpMajor, "v2.0.0", BumpMajor, "", true},
+		{"minor only", "v1.4.2", BumpMinor, "v1.5.0", BumpMinor, "v2.0.0", true},
+		{"patch only", "v1.4.2", BumpPatch, "v1.4.3", BumpPatch, "v2.0.0", true},
+		{"latest release", "v2.0.0", BumpMajor, "", BumpNone, "", true},
+		{"prerelease", "v2.1.0-rc.0", BumpMajor, "v2.1.0-rc.1", BumpPatch, "", false},
+		{"branch", "v1", BumpPatch, "", BumpNone, "v2.0.0", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			current, _ := ParseVersion(tc.current)
+			selected := selectTag(current, tags, tc.maxBump)
+			if selected.Latest.Name != tc.latest || selected.Bump != tc.bump || selected.HeldBack != tc.heldBack || selected.Found != tc.found {
+				t.Errorf("expected %s (%s, held back %q, found %v), got %+v", tc.latest, tc.bump, tc.heldBack, tc.found, selected)
+			}
+		})
+	}
+}
+
+// A resolver that lists a fixed set of tags, or fails to, recording the
+// refs it listed tags for.
+type tagResolver struct {
+	*FakeResolver
+	tags   []Tag
+	err    error
+	listed *[]string
+}
+
+func (r tagResolver) ListTags(ctx context.Context, query Query) ([]Tag, error) {
+	if r.listed != nil {
+		*r.listed = append(*r.listed, query.Ref)
+	}
+	return r.tags, r.err
+}
+
+func TestCheckUpdatesWith_Tags(t *testing.T) {
+	lock := FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root": {Inputs: map[string]any{"tool": "tool", "lib": "lib", "stable": "stable"}},
+			"tool": {
+				Locked:   &Locked{Type: "github", Owner: "owner", Repo: "tool", Rev: "rev-1.4.2"},
+				Original: &Original{Type: "github", Owner: "owner", Repo: "tool", Ref: "v1.4.2"},
+			},
+			"lib": {
+				Locked:   &Locked{Type: "github", Owner: "owner", Repo: "tool", Rev: "rev-1.5.0"},
+				Original: &Original{Type: "github", Owner: "owner", Repo: "tool", Ref: "v1.5.0"},
+			},
+			"stable": {
+				Locked:   &Locked{Type: "github", Owner: "owner", Repo: "tool", Rev: "old"},
+				Original: &Original{Type: "github", Owner: "owner", Repo: "tool", Ref: "release-1.4"},
+			},
+		},
+	}
+
+	resolver := tagResolver{
+		FakeResolver: &FakeResolver{Results: map[string]Resolution{
+			"github:owner/tool/release-1.4": {Rev: "new"},
+		}},
+		tags: []Tag{
+			{Name: "v1.4.2", Rev: "rev-1.4.2"},
+			{Name: "v1.5.0", Rev: "rev-1.5.0"},
+			{Name: "v2.0.0", Rev: "rev-2.0.0"},
+		},
+	}
+
+	results, err := CheckUpdatesWith(context.Background(), lock, UpdateOptions{
+		Resolver: resolver,
+		MaxBump:  map[string]Bump{"tool": BumpMinor},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, update := range results.Updates {
+		got[update.InputName] = fmt.Sprintf("%v %s %s %s %s", update.IsUpdate, update.LatestRev, update.LatestRef, update.Bump, update.HeldBack)
+	}
+
+	expected := map[string]string{
+		"tool": "true rev-1.5.0 v1.5.0 minor v2.0.0",
+		"lib":  "true rev-2.0.0 v2.0.0 major ",
+		// Release branches are not tags, so they are checked as branches
+		"stable": "true new   ",
+	}
+	for name, want := range expected {
+		if got[name] != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got[name])
+		}
+	}
+
+	for _, update := range results.Updates {
+		if update.InputName == "tool" && update.LatestURL != "github:owner/tool/v1.5.0" {
+			t.Errorf("expected the latest URL to point at the new tag, got %s", update.LatestURL)
+		}
+	}
+}
+
+func TestCheckUpdatesWith_TagsFailing(t *testing.T) {
+	lock := FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root": {Inputs: map[string]any{"nixpkgs": "nixpkgs", "tool": "tool"}},
+			"nixpkgs": {
+				Locked:   &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "old"},
+				Original: &Original{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Ref: "nixos-24.05"},
+			},
+			"tool": {
+				Locked:   &Locked{Type: "github", Owner: "owner", Repo: "tool", Rev: "rev-1.4.2"},
+				Original: &Original{Type: "github", Owner: "owner", Repo: "tool", Ref: "v1.4.2"},
+			},
+		},
+	}
+
+	resolver := tagResolver{
+		FakeResolver: &FakeResolver{Results: map[string]Resolution{
+			"github:NixOS/nixpkgs/nixos-24.05": {Rev: "new"},
+			"github:owner/tool/v1.4.2":         {Rev: "rev-1.4.2"},
+		}},
+		err: errors.New("403 rate limited"),
+	}
+
+	results, err := CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Inputs are resolved like branches when their tags cannot be listed
+	expected := map[string]string{"nixpkgs": "true new", "tool": "false rev-1.4.2"}
+	for _, update := range results.Updates {
+		if update.Error != "" {
+			t.Errorf("%s: expected no error, got %s", update.InputName, update.Error)
+		}
+		if got := fmt.Sprintf("%v %s", update.IsUpdate, update.LatestRev); got != expected[update.InputName] {
+			t.Errorf("%s: expected %q, got %q", update.InputName, expected[update.InputName], got)
+		}
+	}
+}
+
+func TestCheckUpdatesWith_TagsTruncated(t *testing.T) {
+	lock := FlakeLock{
+		Root: "root",
+		Nodes: map[string]Node{
+			"root": {Inputs: map[string]any{"nixpkgs": "nixpkgs", "tool": "tool", "lib": "lib"}},
+			"nixpkgs": {
+				Locked:   &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "old"},
+				Original: &Original{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Ref: "nixos-24.05"},
+			},
+			"tool": {
+				Locked:   &Locked{Type: "github", Owner: "owner", Repo: "tool", Rev: "rev-1.0.0"},
+				Original: &Original{Type: "github", Owner: "owner", Repo: "tool", Ref: "v1.0.0"},
+			},
+			"lib": {
+				Locked:   &Locked{Type: "github", Owner: "owner", Repo: "tool", Rev: "rev-1.4.2"},
+				Original: &Original{Type: "github", Owner: "owner", Repo: "tool", Ref: "v1.4.2"},
+			},
+		},
+	}
+
+	var listed []string
+	resolver := tagResolver{
+		FakeResolver: &FakeResolver{Results: map[string]Resolution{
+			"github:NixOS/nixpkgs/nixos-24.05": {Rev: "new"},
+			"github:owner/tool/v1.0.0":         {Rev: "rev-1.0.0"},
+		}},
+		tags:   []Tag{{Name: "v1.4.2", Rev: "rev-1.4.2"}, {Name: "v1.5.0", Rev: "rev-1.5.0"}},
+		err:    errTagsTruncated,
+		listed: &listed,
+	}
+
+	results, err := CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Release branches are not worth listing tags for
+	for _, ref := range listed {
+		if ref == "nixos-24.05" {
+			t.Errorf("expected no tags to be listed for a release branch")
+		}
+	}
+
+	expected := map[string]string{
+		"nixpkgs": "true new []",
+		// Tags beyond the listing are checked as branches, but marked
+		"tool": "false rev-1.0.0 [tags]",
+		"lib":  "true rev-1.5.0 []",
+	}
+	for _, update := range results.Updates {
+		if got := fmt.Sprintf("%v %s %v", update.IsUpdate, update.LatestRev, update.Unchecked); got != expected[update.InputName] {
+			t.Errorf("%s: expected %q, got %q", update.InputName, expected[update.InputName], got)
+		}
+	}
+}
+
+func TestMayBeTag(t *testing.T) {
+	testCases := []struct {
+		ref      string
+		lockRef  string
+		expected bool
+	}{
+		{"v1.4.2", "", true},
+		{"release-2.3.0", "", true},
+		{"nixos-24.05", "", false},
+		{"release-24.05", "", false},
+		{"nixpkgs-24.05-darwin", "", false},
+		{"release-24.05", "refs/tags/release-24.05", true},
+		{"main", "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ref, func(t *testing.T) {
+			query := Query{Ref: tc.ref, Locked: &Locked{Type: "git", Ref: tc.lockRef}}
+			if _, ok := mayBeTag(query); ok != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, ok)
+			}
+		})
+	}
+}
+
+func TestGitResolver_ListTags(t *testing.T) {
+	for _, v2 := range []bool{false, true} {
+		server := newGitServer(t, v2, "", "")
+		defer server.Close()
+
+		resolver := &GitResolver{Client: server.Client()}
+		tags, err := resolver.ListTags(context.Background(), Query{Locked: &Locked{Type: "git", URL: server.URL + "/repo.git"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(tags) != 1 || tags[0] != (Tag{Name: "v1.0", Rev: commitOID}) {
+			t.Errorf("v2=%v: expected v1.0 peeled to %s, got %+v", v2, commitOID, tags)
+		}
+	}
+}
+
+func TestForgeResolver_ListTags(t *testing.T) {
+	server := newForgeServer(t)
+	defer server.Close()
+
+	resolver := &ForgeResolver{
+		Client:  server.Client(),
+		APIBase: map[string]string{"github.com": server.URL, "git.sr.ht": server.URL},
+	}
+
+	testCases := []struct {
+		name     string
+		locked   *Locked
+		expected []Tag
+	}{
+		{
+			name:     "github",
+			locked:   &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs"},
+			expected: []Tag{{Name: "v2.0.0", Rev: "gh-tag"}},
+		},
+		{
+			name:     "sourcehut",
+			locked:   &Locked{Type: "sourcehut", Owner: "~user", Repo: "repo"},
+			expected: []Tag{{Name: "v1.0", Rev: "srht-peeled"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tags, err := resolver.ListTags(context.Background(), Query{Locked: tc.locked})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fmt.Sprint(tags) != fmt.Sprint(tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, tags)
+			}
+		})
+	}
+}
+
+func TestForgeResolver_ListTagsTruncated(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		page := r.URL.Query().Get("page")
+		var tags []string
+		for i := range 100 {
+			tags = append(tags, fmt.Sprintf(`{"name": "v%s.%d.0", "commit": {"sha": "rev"}}`, page, i))
+		}
+		fmt.Fprint(w, "["+strings.Join(tags, ",")+"]")
+	}))
+	defer server.Close()
+
+	resolver := &ForgeResolver{Client: server.Client(), APIBase: map[string]string{"github.com": server.URL}}
+	tags, err := resolver.ListTags(context.Background(), Query{Locked: &Locked{Type: "github", Owner: "owner", Repo: "tool"}})
+	if !errors.Is(err, errTagsTruncated) {
+		t.Errorf("expected the listing to be truncated, got %v", err)
+	}
+	if requests != maxTagPages || len(tags) != maxTagPages*100 {
+		t.Errorf("expected %d full pages, got %d requests and %d tags", maxTagPages, requests, len(tags))
+	}
+}
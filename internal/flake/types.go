@@ -1,5 +1,7 @@
 package flake
 
+import "fmt"
+
 type FlakeLock struct {
 	Nodes   map[string]Node `json:"nodes"`
 	Root    string          `json:"root"`
@@ -10,6 +12,7 @@ type Node struct {
 	Locked   *Locked        `json:"locked,omitempty"`
 	Original *Original      `json:"original,omitempty"`
 	Inputs   map[string]any `json:"inputs,omitempty"`
+	Flake    *bool          `json:"flake,omitempty"`
 }
 
 type Locked struct {
@@ -22,6 +25,8 @@ type Locked struct {
 	Host         string `json:"host,omitempty"`
 	URL          string `json:"url,omitempty"`
 	Path         string `json:"path,omitempty"`
+	Ref          string `json:"ref,omitempty"`
+	Dir          string `json:"dir,omitempty"`
 }
 
 type Original struct {
@@ -29,6 +34,28 @@ type Original struct {
 	Ref   string `json:"ref,omitempty"`
 	Repo  string `json:"repo,omitempty"`
 	Type  string `json:"type,omitempty"`
+	Rev   string `json:"rev,omitempty"`
+	Host  string `json:"host,omitempty"`
+	Dir   string `json:"dir,omitempty"`
+	URL   string `json:"url,omitempty"`
+	Path  string `json:"path,omitempty"`
+	ID    string `json:"id,omitempty"`
+}
+
+// A position in a source file, used to point findings at the flake.nix
+// declaration responsible for them. Line and Column are 1-based; a zero Line
+// refers to the file as a whole.
+type Location struct {
+	File   string
+	Line   int `json:",omitempty"`
+	Column int `json:",omitempty"`
+}
+
+func (l Location) String() string {
+	if l.Line == 0 {
+		return l.File
+	}
+	return fmt.Sprintf("%s:%d:%d", l.File, l.Line, l.Column)
 }
 
 type Relations struct {
@@ -53,8 +80,82 @@ type UpdateStatus struct {
 	LatestURL  string
 	IsUpdate   bool
 	Error      string
+
+	// The branch or tag that was checked, empty for the default branch. Always
+	// present in JSON output, so that default branch checks are visible too.
+	Ref string
+
+	// Set when flake.nix pins the input to a revision, which leaves nothing
+	// to update
+	Pinned bool `json:",omitempty"`
+
+	// The input path from the root flake, e.g. ["home-manager", "nixpkgs"];
+	// the first element is the root input that pulls this input in
+	Path []string `json:",omitempty"`
+
+	// Commit dates of the locked and latest revisions as Unix timestamps,
+	// and the number of seconds between them, when known
+	CurrentDate int64 `json:",omitempty"`
+	LatestDate  int64 `json:",omitempty"`
+	AgeGap      int64 `json:",omitempty"`
+
+	// How many commits the locked revision is behind the latest one, when the
+	// resolver can tell, and a forge page listing them
+	CommitsBehind int    `json:",omitempty"`
+	CompareURL    string `json:",omitempty"`
+
+	// For inputs locked to a release tag: the newer tag to move to, how big
+	// a change that is (patch, minor or major), and the newest release that
+	// was skipped because configuration does not allow such a change
+	LatestRef string `json:",omitempty"`
+	Bump      string `json:",omitempty"`
+	HeldBack  string `json:",omitempty"`
+
+	// For inputs tracking a release branch such as nixos-24.05: a newer
+	// release branch of the same kind, which no rev update will move to
+	NewerBranch string `json:",omitempty"`
+
+	// When reachability was checked: "orphaned" when the locked revision is
+	// no longer on the branch the input tracks, as after a force-push, and
+	// "unreachable" when it cannot be found upstream at all
+	Reachability string `json:",omitempty"`
+
+	// The checks that could not be run for the input: "tags" when the
+	// repository has too many tags to tell whether the input is locked to
+	// one, "changes" when nothing tells whether an input without revisions
+	// changed upstream, and the optional "reachability" and "repository"
+	// checks when the resolver cannot run them
+	Unchecked []string `json:",omitempty"`
+
+	// Set when repositories were checked and the input's upstream repository
+	// was archived, moved or deleted
+	Repository *RepositoryStatus `json:",omitempty"`
+
+	// For inputs without revisions, such as tarballs: the NAR hashes of the
+	// locked and latest contents, when known
+	CurrentNarHash string `json:",omitempty"`
+	LatestNarHash  string `json:",omitempty"`
+
+	// Set when update policy affects the input: "ignored" for inputs ignored
+	// in configuration, "cooldown" when upstream commits are too recent to
+	// count. PolicyUntil is when that ends as a Unix timestamp, if ever, and
+	// PolicyReason the reason given in configuration.
+	Policy       string `json:",omitempty"`
+	PolicyUntil  int64  `json:",omitempty"`
+	PolicyReason string `json:",omitempty"`
+
+	// The update group the input belongs to in configuration
+	Group string `json:",omitempty"`
+
+	// What changed upstream between the current and latest revisions, when
+	// changelogs were asked for and the resolver could fetch one
+	Changelog *Changelog `json:",omitempty"`
 }
 
 type UpdateResults struct {
 	Updates []UpdateStatus
+
+	// Set when the check was cancelled or timed out before every input was
+	// resolved
+	Incomplete bool `json:",omitempty"`
 }
@@ -1,61 +1,454 @@
 package flake
 
 import (
-	"encoding/json"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
-	"os/exec"
+	"maps"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
-// Check for available updates for flake inputs
+// Settings for an update check.
+type UpdateOptions struct {
+	Resolver Resolver
+
+	// How many levels of inputs to check: 1 (the default) checks the root
+	// inputs only, 2 also checks their inputs, and so on. A negative depth
+	// checks every reachable input.
+	Depth int
+
+	// How many queries run at once, defaults to DefaultParallelism
+	Parallelism int
+
+	// Bounds each attempt at resolving a query; zero means no limit
+	Timeout time.Duration
+
+	// How often transient failures are retried, waiting Backoff before the
+	// first retry and twice as long before each one after that
+	Retries int
+	Backoff time.Duration
+
+	// Limits how far inputs locked to a release tag may move, keyed by input
+	// path such as "nixpkgs" or "home-manager/nixpkgs"; unlisted inputs may
+	// take any newer release
+	MaxBump map[string]Bump
+
+	// Cooldown, ignore rules and groups
+	Policy UpdatePolicy
+
+	// How many upstream commits to list for each available update, when the
+	// resolver can fetch changelogs; zero skips changelogs
+	Changelog int
+
+	// Also checks whether the locked revisions of inputs tracking a branch
+	// can still be fetched upstream, when the resolver can tell
+	CheckReachability bool
+
+	// Also checks whether the repositories of inputs were archived, moved
+	// or deleted upstream, when the resolver can tell
+	CheckRepositories bool
+}
+
+// The number of queries run at once when UpdateOptions leaves it unset.
+const DefaultParallelism = 8
+
+// Check for available updates for flake inputs using the default resolver
 func CheckUpdates(flakeLock FlakeLock, verbose bool) (UpdateResults, error) {
+	resolver, err := NewResolver(DefaultResolver, ResolverOptions{Verbose: verbose})
+	if err != nil {
+		return UpdateResults{}, err
+	}
+	return CheckUpdatesWith(context.Background(), flakeLock, UpdateOptions{Resolver: resolver})
+}
+
+// Check for available updates for flake inputs, asking the given resolver for
+// the latest revision of every input within the requested depth. Inputs that
+// track the same repository and ref share a single query. Results are grouped
+// by the root input that pulls them in, and sorted by input path within each
+// group.
+func CheckUpdatesWith(ctx context.Context, flakeLock FlakeLock, opts UpdateOptions) (UpdateResults, error) {
 	var results UpdateResults
-	var wg sync.WaitGroup
 
-	rootNode, exists := flakeLock.Nodes["root"]
+	if opts.Resolver == nil {
+		return results, fmt.Errorf("no resolver configured")
+	}
+
+	rootNode, exists := flakeLock.Nodes[RootName(flakeLock)]
 	if !exists || rootNode.Inputs == nil {
 		return results, fmt.Errorf("no root inputs found")
 	}
 
-	updates := make([]UpdateStatus, 0, len(rootNode.Inputs))
-	var mu sync.Mutex
+	depth := opts.Depth
+	if depth == 0 {
+		depth = 1
+	}
 
-	// Check each input for updates in parallel
-	for inputName, inputRef := range rootNode.Inputs {
-		wg.Add(1)
-		go func(name string, ref any) {
-			defer wg.Done()
+	var updates []UpdateStatus
+	pending := make(map[string]*pendingQuery)
+	queries := make(map[int]Query)
+
+	// Every locked input, including pinned and ignored ones, for the checks
+	// that look at what is locked rather than at what is upstream
+	locked := make(map[int]Query)
 
-			inputRefStr, ok := ref.(string)
-			if !ok {
-				update := UpdateStatus{
+	// Root inputs referring to missing nodes are not reachable, but are still
+	// worth reporting
+	for name, ref := range rootNode.Inputs {
+		if target, ok := ref.(string); ok {
+			if _, exists := flakeLock.Nodes[target]; !exists {
+				updates = append(updates, UpdateStatus{
 					InputName: name,
-					Error:     "invalid input reference type",
+					Path:      []string{name},
+					Error:     fmt.Sprintf("input node %s not found", target),
+				})
+			}
+		}
+	}
+
+	addQuery := func(query Query, index int) {
+		key := queryKey(query)
+		if pending[key] == nil {
+			pending[key] = &pendingQuery{key: key, query: query}
+		}
+		pending[key].updates = append(pending[key].updates, index)
+	}
+
+	// Inputs locked to a release tag are checked against newer tags of the
+	// same repository, when the resolver can list them
+	lister, canList := opts.Resolver.(TagLister)
+	tagQueries := make(map[string]*pendingTags)
+
+	// Inputs that follow another input are checked through the node they
+	// follow, so only direct references are walked
+	for nodeName, path := range InputPaths(flakeLock) {
+		if len(path) == 0 || (depth > 0 && len(path) > depth) {
+			continue
+		}
+
+		update, query, ok := prepareUpdate(flakeLock, strings.Join(path, "/"), nodeName)
+		update.Path = path
+		update.Group = opts.Policy.group(update.InputName)
+		if ok && opts.Policy.ignore(&update) {
+			ok = false
+		}
+		updates = append(updates, update)
+		if query.Locked != nil {
+			locked[len(updates)-1] = query
+		}
+		if !ok {
+			continue
+		}
+		queries[len(updates)-1] = query
+
+		if version, isTag := mayBeTag(query); canList && isTag {
+			repository := query
+			repository.Ref = ""
+			key := queryKey(repository)
+			if tagQueries[key] == nil {
+				tagQueries[key] = &pendingTags{key: key, query: query}
+			}
+			tagQueries[key].items = append(tagQueries[key].items, taggedInput{index: len(updates) - 1, query: query, version: version})
+			continue
+		}
+
+		addQuery(query, len(updates)-1)
+	}
+
+	// Every input is passed along with its own locked revision, for the
+	// resolver to compare the head against
+	if prefetcher, ok := opts.Resolver.(Prefetcher); ok {
+		var heads, tags []Query
+		for _, key := range slices.Sorted(maps.Keys(pending)) {
+			for _, i := range pending[key].updates {
+				heads = append(heads, queries[i])
+			}
+		}
+		for _, key := range slices.Sorted(maps.Keys(tagQueries)) {
+			tags = append(tags, tagQueries[key].query)
+		}
+		prefetch(ctx, prefetcher, heads, tags, opts)
+	}
+
+	runAll(ctx, slices.SortedFunc(maps.Values(tagQueries), func(a, b *pendingTags) int {
+		return strings.Compare(a.key, b.key)
+	}), opts, func(p *pendingTags) {
+		if err := ctx.Err(); err != nil {
+			p.err = err
+			return
+		}
+		p.tags, p.err = withRetry(ctx, opts, func(ctx context.Context) ([]Tag, error) {
+			return lister.ListTags(ctx, p.query)
+		})
+	})
+
+	// Refs that only look like versions, such as release branches, are
+	// checked like any other branch. So are all refs when tags cannot be
+	// listed, since most of them are branches and resolving a tag still tells
+	// whether it moved.
+	var tagged []*pendingQuery
+	for _, p := range tagQueries {
+		truncated := errors.Is(p.err, errTagsTruncated)
+		for _, item := range p.items {
+			if p.err != nil && !truncated {
+				addQuery(item.query, item.index)
+				continue
+			}
+
+			// A tag missing from a truncated listing may well be a tag, so
+			// newer releases went unchecked
+			selected := selectTag(item.version, p.tags, maxBump(opts, updates[item.index].InputName))
+			if !selected.Found {
+				if truncated {
+					updates[item.index].Unchecked = append(updates[item.index].Unchecked, "tags")
 				}
-				mu.Lock()
-				updates = append(updates, update)
-				mu.Unlock()
-				return
+				addQuery(item.query, item.index)
+				continue
 			}
 
-			update := checkInputUpdate(flakeLock, name, inputRefStr, verbose)
+			applyTagUpdate(&updates[item.index], item.query, selected)
+			tagged = append(tagged, &pendingQuery{key: queryKey(item.query), query: item.query, updates: []int{item.index}})
+		}
+	}
 
-			mu.Lock()
-			updates = append(updates, update)
-			mu.Unlock()
-		}(inputName, inputRef)
+	// Queries are dispatched in a fixed order so that runs are reproducible
+	resolveAll(ctx, slices.SortedFunc(maps.Values(pending), func(a, b *pendingQuery) int {
+		return strings.Compare(a.key, b.key)
+	}), opts)
+
+	for _, p := range pending {
+		for _, i := range p.updates {
+			applyResolution(&updates[i], p.query, p.resolution, p.err)
+		}
 	}
 
-	// Wait for all goroutines to complete
-	wg.Wait()
+	applyCooldown(ctx, updates, queries, opts)
+	compareAll(ctx, updates, append(slices.Collect(maps.Values(pending)), tagged...), opts)
+	suggestBranches(ctx, updates, slices.Collect(maps.Values(pending)), opts)
+	checkReachability(ctx, updates, slices.Collect(maps.Values(pending)), locked, opts)
+	checkRepositories(ctx, updates, locked, opts)
+	fetchChangelogs(ctx, updates, append(slices.Collect(maps.Values(pending)), tagged...), opts)
+
+	// Queries that never got to run were cut short by cancellation; what
+	// was resolved until then is still returned
+	results.Incomplete = ctx.Err() != nil
+
+	sort.Slice(updates, func(i, j int) bool {
+		a, b := updates[i].Path, updates[j].Path
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return updates[i].InputName < updates[j].InputName
+	})
 
 	results.Updates = updates
 	return results, nil
 }
 
-// Check a single input for updates
-func checkInputUpdate(flakeLock FlakeLock, inputName, inputRef string, verbose bool) UpdateStatus {
+// Lets the resolver look up everything that is about to be resolved at once.
+func prefetch(ctx context.Context, prefetcher Prefetcher, heads, tags []Query, opts UpdateOptions) {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	prefetcher.Prefetch(ctx, heads, tags)
+}
+
+// A tag listing shared by every input locked to a tag of the same repository.
+type pendingTags struct {
+	key   string
+	query Query
+	items []taggedInput
+	tags  []Tag
+	err   error
+}
+
+// An input locked to a tag, waiting for the repository's tags.
+type taggedInput struct {
+	index   int
+	query   Query
+	version Version
+}
+
+// Returns the largest version change allowed for an input.
+func maxBump(opts UpdateOptions, inputName string) Bump {
+	if bump, ok := opts.MaxBump[inputName]; ok {
+		return bump
+	}
+	return BumpMajor
+}
+
+// Records the newest acceptable tag for an input locked to a tag.
+func applyTagUpdate(update *UpdateStatus, query Query, selected tagUpdate) {
+	update.HeldBack = selected.HeldBack
+	if selected.Latest.Name == "" {
+		update.LatestRev = update.CurrentRev
+		update.LatestURL = query.URL
+		return
+	}
+
+	update.IsUpdate = true
+	update.LatestRev = selected.Latest.Rev
+	update.LatestRef = selected.Latest.Name
+	update.LatestURL = refURL(query, selected.Latest.Name)
+	update.Bump = selected.Bump.String()
+}
+
+// Returns the flake reference of an input moved to another ref.
+func refURL(query Query, ref string) string {
+	if query.Original == nil || query.Original.Type == "indirect" {
+		return query.URL
+	}
+	moved := *query.Original
+	moved.Rev = ""
+	moved.Ref = ref
+	return moved.String()
+}
+
+// A query shared by every input that tracks the same repository and ref.
+type pendingQuery struct {
+	key        string
+	query      Query
+	updates    []int
+	resolution Resolution
+	err        error
+}
+
+// Resolves queries on a bounded pool of workers. Once ctx is done, queries
+// that have not started yet fail with its error.
+func resolveAll(ctx context.Context, queries []*pendingQuery, opts UpdateOptions) {
+	runAll(ctx, queries, opts, func(p *pendingQuery) {
+		if err := ctx.Err(); err != nil {
+			p.err = err
+			return
+		}
+		p.resolution, p.err = resolveWithRetry(ctx, opts.Resolver, p.query, opts)
+	})
+}
+
+// Runs fn for every job on a pool of opts.Parallelism workers.
+func runAll[T any](ctx context.Context, jobs []T, opts UpdateOptions, fn func(T)) {
+	workers := opts.Parallelism
+	if workers <= 0 {
+		workers = DefaultParallelism
+	}
+
+	queue := make(chan T)
+	var wg sync.WaitGroup
+	for range min(workers, len(jobs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				fn(job)
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// A comparison shared by every input locked at the same revision of the same
+// repository and ref.
+type pendingComparison struct {
+	key        string
+	query      Query
+	ref        string
+	base, head string
+	updates    []int
+}
+
+// Fills in how far behind each available update is. Resolvers that cannot
+// compare revisions still get a compare URL for inputs on well-known forges;
+// failed comparisons are left out, as the update itself is still valid.
+func compareAll(ctx context.Context, updates []UpdateStatus, pending []*pendingQuery, opts UpdateOptions) {
+	comparer, canCompare := opts.Resolver.(Comparer)
+
+	comparisons := make(map[string]*pendingComparison)
+	for _, p := range pending {
+		for _, i := range p.updates {
+			update := &updates[i]
+			if !update.IsUpdate || update.CurrentRev == "" {
+				continue
+			}
+
+			update.CompareURL = CompareURL(p.query, update.CurrentRev, update.LatestRev)
+			if !canCompare {
+				continue
+			}
+
+			key := p.key + "\x00" + update.CurrentRev + "..." + update.LatestRev
+			if comparisons[key] == nil {
+				ref := cmp.Or(update.LatestRef, p.query.Ref)
+				comparisons[key] = &pendingComparison{key: key, query: p.query, ref: ref, base: update.CurrentRev, head: update.LatestRev}
+			}
+			comparisons[key].updates = append(comparisons[key].updates, i)
+		}
+	}
+
+	sorted := slices.SortedFunc(maps.Values(comparisons), func(a, b *pendingComparison) int {
+		return strings.Compare(a.key, b.key)
+	})
+
+	// Comparisons the prefetch did not answer, such as those with a newer
+	// tag, are looked up at once as heads of the ref the update moves to
+	if prefetcher, ok := opts.Resolver.(Prefetcher); ok && len(sorted) > 0 {
+		var heads []Query
+		for _, c := range sorted {
+			query := c.query
+			locked := *query.Locked
+			locked.Rev = c.base
+			query.Ref, query.Locked = c.ref, &locked
+			heads = append(heads, query)
+		}
+		prefetch(ctx, prefetcher, heads, nil, opts)
+	}
+
+	runAll(ctx, sorted, opts, func(c *pendingComparison) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		comparison, err := withRetry(ctx, opts, func(ctx context.Context) (Comparison, error) {
+			return comparer.Compare(ctx, c.query, c.base, c.head)
+		})
+		if err != nil {
+			return
+		}
+
+		for _, i := range c.updates {
+			updates[i].CommitsBehind = comparison.CommitsBehind
+			if comparison.URL != "" {
+				updates[i].CompareURL = comparison.URL
+			}
+		}
+	})
+}
+
+// Identifies queries that are bound to resolve to the same revision.
+func queryKey(query Query) string {
+	repository := buildFlakeURL(query.Locked)
+	if repository == "" {
+		repository = query.URL
+	}
+	return strings.ToLower(repository) + "#" + query.Ref
+}
+
+// Fills in what is known about an input before resolving it. The returned
+// query is only valid, and only needs resolving, when ok is true.
+func prepareUpdate(flakeLock FlakeLock, inputName, inputRef string) (UpdateStatus, Query, bool) {
 	update := UpdateStatus{
 		InputName: inputName,
 	}
@@ -64,30 +457,131 @@ func checkInputUpdate(flakeLock FlakeLock, inputName, inputRef string, verbose b
 	node, exists := flakeLock.Nodes[inputRef]
 	if !exists {
 		update.Error = fmt.Sprintf("input node %s not found", inputRef)
-		return update
+		return update, Query{}, false
 	}
 
 	if node.Locked == nil {
 		update.Error = fmt.Sprintf("input %s has no locked version", inputName)
-		return update
+		return update, Query{}, false
 	}
 
-	// Build current URL
+	// Check the reference flake.nix asked for, not just the repository
+	query := updateQuery(inputName, inputRef, node)
 	update.CurrentRev = node.Locked.Rev
-	update.CurrentURL = buildFlakeURL(node.Locked)
+	update.CurrentDate = node.Locked.LastModified
+	if node.Locked.Rev == "" {
+		update.CurrentNarHash = node.Locked.NarHash
+	}
+	update.CurrentURL = query.URL
+	update.Ref = query.Ref
 
-	// Check for update using nix flake info
-	latestURL, latestRev, err := getLatestFlakeInfo(update.CurrentURL, verbose)
+	if node.Original != nil && node.Original.Rev != "" {
+		update.Pinned = true
+		return update, query, false
+	}
+
+	return update, query, true
+}
+
+// Records the outcome of resolving an input.
+func applyResolution(update *UpdateStatus, query Query, resolution Resolution, err error) {
 	if err != nil {
 		update.Error = fmt.Sprintf("failed to get latest info: %v", err)
-		return update
+		return
+	}
+
+	update.LatestURL = resolution.URL
+	update.LatestRev = resolution.Rev
+	update.LatestDate = resolution.LastModified
+	if update.CurrentRev != "" || resolution.Rev != "" {
+		update.IsUpdate = resolution.Rev != "" && resolution.Rev != update.CurrentRev
+	} else {
+		update.LatestNarHash = resolution.NarHash
+		changed, known := contentChanged(query, resolution)
+		update.IsUpdate = changed
+		if !known {
+			update.Unchecked = append(update.Unchecked, "changes")
+		}
 	}
 
-	update.LatestURL = latestURL
-	update.LatestRev = latestRev
-	update.IsUpdate = latestRev != "" && latestRev != update.CurrentRev
+	if update.IsUpdate && update.CurrentDate > 0 && update.LatestDate > update.CurrentDate {
+		update.AgeGap = update.LatestDate - update.CurrentDate
+	}
+}
 
-	return update
+// Decides whether an input without revisions changed upstream, using the
+// most reliable evidence the resolver found: the content hash, then where
+// the original URL leads, then the validators the server sent for the locked
+// contents. The lockfile's own lastModified comes from file times inside the
+// archive rather than from the server, so it cannot be compared against
+// Last-Modified; without a baseline, there is no telling, and known is false.
+func contentChanged(query Query, resolution Resolution) (changed, known bool) {
+	locked := query.Locked
+	if locked == nil {
+		return false, false
+	}
+
+	originalURL := locked.URL
+	if query.Original != nil && query.Original.URL != "" {
+		originalURL = query.Original.URL
+	}
+
+	switch {
+	case resolution.NarHash != "" && locked.NarHash != "":
+		return resolution.NarHash != locked.NarHash, true
+	case resolution.URL != "" && locked.URL != originalURL:
+		// The lock recorded where the original URL led, which has moved on
+		return resolution.URL != locked.URL, true
+	case resolution.ETag != "" && resolution.LockedETag != "":
+		return resolution.ETag != resolution.LockedETag, true
+	case resolution.LastModified > 0 && resolution.LockedLastModified > 0:
+		return resolution.LastModified > resolution.LockedLastModified, true
+	}
+	return false, false
+}
+
+// Builds the query for an input from its original reference, so that the
+// branch or tag it was locked from is checked instead of the default branch.
+// Locked information fills in whatever the original leaves out, such as the
+// repository behind a registry entry.
+func updateQuery(inputName, nodeName string, node Node) Query {
+	query := Query{
+		Input:    inputName,
+		Node:     nodeName,
+		URL:      buildFlakeURL(node.Locked),
+		Locked:   node.Locked,
+		Original: node.Original,
+	}
+
+	original := node.Original
+	if original == nil {
+		if node.Locked.Type == "git" {
+			query.Ref = strings.TrimPrefix(node.Locked.Ref, "refs/heads/")
+		}
+		return query
+	}
+
+	query.Ref = original.Ref
+	if original.Type == "indirect" {
+		// Registry entries resolve to the locked repository, at the ref the
+		// original asked for
+		resolved := Original{
+			Type:  node.Locked.Type,
+			Owner: node.Locked.Owner,
+			Repo:  node.Locked.Repo,
+			Host:  node.Locked.Host,
+			URL:   node.Locked.URL,
+			Path:  node.Locked.Path,
+			Ref:   original.Ref,
+		}
+		query.URL = resolved.String()
+		return query
+	}
+
+	unpinned := *original
+	unpinned.Rev = ""
+	query.URL = unpinned.String()
+	return query
 }
 
 // Construct a flake URL from Locked info
@@ -113,65 +607,3 @@ func buildFlakeURL(locked *Locked) string {
 		return ""
 	}
 }
-
-// Get the latest flake information by parsing the output of `nix flake info`
-func getLatestFlakeInfo(flakeURL string, verbose bool) (string, string, error) {
-	// Run nix flake info --json to get latest information
-	cmd := exec.Command("nix", "flake", "info", "--json", flakeURL)
-
-	if verbose {
-		fmt.Printf("Running: %s\n", strings.Join(cmd.Args, " "))
-	}
-
-	output, err := cmd.Output()
-	if err != nil {
-		return "", "", fmt.Errorf("nix flake info failed: %w", err)
-	}
-
-	// Parse the JSON output
-	var flakeInfo map[string]any
-	if err := json.Unmarshal(output, &flakeInfo); err != nil {
-		return "", "", fmt.Errorf("failed to parse nix output: %w", err)
-	}
-
-	// Extract the revision from the locked information
-	locked, ok := flakeInfo["locked"].(map[string]any)
-	if !ok {
-		return "", "", fmt.Errorf("no locked information in nix output")
-	}
-
-	rev, ok := locked["rev"].(string)
-	if !ok {
-		return "", "", fmt.Errorf("no revision in locked information")
-	}
-
-	// Rebuild the URL to ensure consistency
-	var latestURL string
-	if flakeType, ok := locked["type"].(string); ok {
-		switch flakeType {
-		case "github", "gitlab", "sourcehut":
-			if owner, ok := locked["owner"].(string); ok {
-				if repo, ok := locked["repo"].(string); ok {
-					latestURL = fmt.Sprintf("%s:%s/%s", flakeType, owner, repo)
-					if host, ok := locked["host"].(string); ok && host != "github.com" && host != "gitlab.com" {
-						latestURL += fmt.Sprintf("?host=%s", host)
-					}
-				}
-			}
-		case "git":
-			if url, ok := locked["url"].(string); ok {
-				latestURL = url
-			}
-		case "path":
-			if path, ok := locked["path"].(string); ok {
-				latestURL = path
-			}
-		case "tarball":
-			if url, ok := locked["url"].(string); ok {
-				latestURL = url
-			}
-		}
-	}
-
-	return latestURL, rev, nil
-}
@@ -1,6 +1,10 @@
 package flake
 
 import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -80,18 +84,31 @@ func TestBuildFlakeURL(t *testing.T) {
 	}
 }
 
-func TestCheckInputUpdate(t *testing.T) {
+// Checks a lockfile with a single input for updates.
+func checkSingleInput(t *testing.T, flakeLock FlakeLock, resolver Resolver) UpdateStatus {
+	t.Helper()
+	results, err := CheckUpdatesWith(context.Background(), flakeLock, UpdateOptions{Resolver: resolver})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results.Updates) != 1 {
+		t.Fatalf("expected a single result, got %+v", results.Updates)
+	}
+	return results.Updates[0]
+}
+
+func TestCheckUpdatesWith_Inputs(t *testing.T) {
 	t.Run("nonexistent input", func(t *testing.T) {
 		flakeLock := FlakeLock{
 			Nodes: map[string]Node{
 				"root": {
-					Inputs: map[string]any{},
+					Inputs: map[string]any{"nonexistent": "missing"},
 				},
 			},
 			Root: "root",
 		}
 
-		update := checkInputUpdate(flakeLock, "nonexistent", "missing", false)
+		update := checkSingleInput(t, flakeLock, &FakeResolver{})
 
 		if update.InputName != "nonexistent" {
 			t.Errorf("expected input name 'nonexistent', got '%s'", update.InputName)
@@ -120,7 +137,7 @@ func TestCheckInputUpdate(t *testing.T) {
 			Root: "root",
 		}
 
-		update := checkInputUpdate(flakeLock, "no-lock", "no-lock", false)
+		update := checkSingleInput(t, flakeLock, &FakeResolver{})
 
 		if update.InputName != "no-lock" {
 			t.Errorf("expected input name 'no-lock', got '%s'", update.InputName)
@@ -153,9 +170,13 @@ func TestCheckInputUpdate(t *testing.T) {
 			Root: "root",
 		}
 
-		t.Skip("Skipping test that requires nix command in CI environment")
+		resolver := &FakeResolver{
+			Results: map[string]Resolution{
+				"github:NixOS/nixpkgs": {URL: "github:NixOS/nixpkgs", Rev: "1234567890abcdef"},
+			},
+		}
 
-		update := checkInputUpdate(flakeLock, "nixpkgs", "nixpkgs", false)
+		update := checkSingleInput(t, flakeLock, resolver)
 
 		if update.InputName != "nixpkgs" {
 			t.Errorf("expected input name 'nixpkgs', got '%s'", update.InputName)
@@ -168,6 +189,10 @@ func TestCheckInputUpdate(t *testing.T) {
 		if update.CurrentURL != "github:NixOS/nixpkgs" {
 			t.Errorf("expected current URL 'github:NixOS/nixpkgs', got '%s'", update.CurrentURL)
 		}
+
+		if !update.IsUpdate || update.LatestRev != "1234567890abcdef" {
+			t.Errorf("expected an update to '1234567890abcdef', got %+v", update)
+		}
 	})
 }
 
@@ -231,6 +256,67 @@ func TestCheckUpdates(t *testing.T) {
 		}
 	})
 
+	t.Run("multiple inputs with a fake resolver", func(t *testing.T) {
+		flakeLock := FlakeLock{
+			Nodes: map[string]Node{
+				"nixpkgs": {
+					Locked: &Locked{Owner: "NixOS", Repo: "nixpkgs", Rev: "abcdef1234567890", Type: "github"},
+				},
+				"home-manager": {
+					Locked: &Locked{Owner: "nix-community", Repo: "home-manager", Rev: "hm4567890123456", Type: "github"},
+				},
+				"broken": {
+					Locked: &Locked{Owner: "broken", Repo: "broken", Rev: "0000000000000000", Type: "github"},
+				},
+				"root": {
+					Inputs: map[string]any{
+						"nixpkgs":      "nixpkgs",
+						"home-manager": "home-manager",
+						"broken":       "broken",
+					},
+				},
+			},
+			Root: "root",
+		}
+
+		resolver := &FakeResolver{
+			Results: map[string]Resolution{
+				"github:NixOS/nixpkgs":              {URL: "github:NixOS/nixpkgs", Rev: "1234567890abcdef"},
+				"github:nix-community/home-manager": {URL: "github:nix-community/home-manager", Rev: "hm4567890123456"},
+			},
+		}
+
+		results, err := CheckUpdatesWith(context.Background(), flakeLock, UpdateOptions{Resolver: resolver})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []struct {
+			name     string
+			isUpdate bool
+			hasError bool
+		}{
+			{"broken", false, true},
+			{"home-manager", false, false},
+			{"nixpkgs", true, false},
+		}
+
+		if len(results.Updates) != len(expected) {
+			t.Fatalf("expected %d updates, got %d", len(expected), len(results.Updates))
+		}
+
+		for i, want := range expected {
+			got := results.Updates[i]
+			if got.InputName != want.name || got.IsUpdate != want.isUpdate || (got.Error != "") != want.hasError {
+				t.Errorf("update %d: expected %+v, got %+v", i, want, got)
+			}
+		}
+
+		if queries := resolver.Queries(); len(queries) != 3 {
+			t.Errorf("expected one query per input, got %+v", queries)
+		}
+	})
+
 	t.Run("no root inputs", func(t *testing.T) {
 		emptyLock := FlakeLock{
 			Nodes: map[string]Node{
@@ -269,3 +355,187 @@ func TestCheckUpdates(t *testing.T) {
 		}
 	})
 }
+
+func TestUpdateQuery(t *testing.T) {
+	testCases := []struct {
+		name        string
+		node        Node
+		expectedURL string
+		expectedRef string
+	}{
+		{
+			name: "original ref",
+			node: Node{
+				Locked:   &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "abc"},
+				Original: &Original{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Ref: "nixos-24.05"},
+			},
+			expectedURL: "github:NixOS/nixpkgs/nixos-24.05",
+			expectedRef: "nixos-24.05",
+		},
+		{
+			name: "original host and dir",
+			node: Node{
+				Locked:   &Locked{Type: "gitlab", Owner: "user", Repo: "project", Host: "gitlab.example.com", Rev: "abc"},
+				Original: &Original{Type: "gitlab", Owner: "user", Repo: "project", Host: "gitlab.example.com", Dir: "sub"},
+			},
+			expectedURL: "gitlab:user/project?host=gitlab.example.com&dir=sub",
+		},
+		{
+			name: "git with ref",
+			node: Node{
+				Locked:   &Locked{Type: "git", URL: "https://example.com/repo.git", Ref: "refs/heads/main", Rev: "abc"},
+				Original: &Original{Type: "git", URL: "https://example.com/repo.git", Ref: "main"},
+			},
+			expectedURL: "git+https://example.com/repo.git?ref=main",
+			expectedRef: "main",
+		},
+		{
+			name: "registry entry",
+			node: Node{
+				Locked:   &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "abc"},
+				Original: &Original{Type: "indirect", ID: "nixpkgs", Ref: "nixos-unstable"},
+			},
+			expectedURL: "github:NixOS/nixpkgs/nixos-unstable",
+			expectedRef: "nixos-unstable",
+		},
+		{
+			name:        "no original",
+			node:        Node{Locked: &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "abc"}},
+			expectedURL: "github:NixOS/nixpkgs",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query := updateQuery("input", "node", tc.node)
+			if query.URL != tc.expectedURL {
+				t.Errorf("expected URL %s, got %s", tc.expectedURL, query.URL)
+			}
+			if query.Ref != tc.expectedRef {
+				t.Errorf("expected ref %q, got %q", tc.expectedRef, query.Ref)
+			}
+		})
+	}
+}
+
+func TestUpdateStatus_JSONRef(t *testing.T) {
+	// Default branch checks keep their empty ref rather than leaving it out
+	data, err := json.Marshal(UpdateStatus{InputName: "nixpkgs"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), `"Ref":""`) {
+		t.Errorf("expected the checked ref in %s", data)
+	}
+}
+
+func TestCheckUpdatesWith_Pinned(t *testing.T) {
+	flakeLock := FlakeLock{
+		Nodes: map[string]Node{
+			"pinned": {
+				Locked:   &Locked{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "0123456789abcdef0123456789abcdef01234567"},
+				Original: &Original{Type: "github", Owner: "NixOS", Repo: "nixpkgs", Rev: "0123456789abcdef0123456789abcdef01234567"},
+			},
+			"root": {Inputs: map[string]any{"pinned": "pinned"}},
+		},
+		Root: "root",
+	}
+
+	resolver := &FakeResolver{}
+	update := checkSingleInput(t, flakeLock, resolver)
+
+	if !update.Pinned || update.IsUpdate || update.Error != "" {
+		t.Errorf("expected a pinned input without an update, got %+v", update)
+	}
+	if len(resolver.Queries()) != 0 {
+		t.Error("expected pinned inputs not to be resolved")
+	}
+}
+
+func TestCheckUpdatesWith_Depth(t *testing.T) {
+	lock := loadLock(t, `
+{
+  "nodes": {
+    "nixpkgs": {
+      "locked": {"owner": "NixOS", "repo": "nixpkgs", "rev": "new", "type": "github"},
+      "original": {"owner": "NixOS", "repo": "nixpkgs", "ref": "nixos-unstable", "type": "github"}
+    },
+    "nixpkgs_2": {
+      "locked": {"owner": "NixOS", "repo": "nixpkgs", "rev": "old", "type": "github"},
+      "original": {"owner": "NixOS", "repo": "nixpkgs", "ref": "nixos-unstable", "type": "github"}
+    },
+    "systems": {
+      "locked": {"owner": "nix-systems", "repo": "default", "rev": "sys", "type": "github"},
+      "original": {"owner": "nix-systems", "repo": "default", "type": "github"}
+    },
+    "home-manager": {
+      "inputs": {"nixpkgs": "nixpkgs_2", "systems": "systems"},
+      "locked": {"owner": "nix-community", "repo": "home-manager", "rev": "hm", "type": "github"},
+      "original": {"owner": "nix-community", "repo": "home-manager", "type": "github"}
+    },
+    "root": {
+      "inputs": {"home-manager": "home-manager", "nixpkgs": "nixpkgs", "pkgs": ["nixpkgs"]}
+    }
+  },
+  "root": "root",
+  "version": 7
+}
+`)
+
+	newResolver := func() *FakeResolver {
+		return &FakeResolver{
+			Results: map[string]Resolution{
+				"github:NixOS/nixpkgs/nixos-unstable": {Rev: "new"},
+				"github:nix-community/home-manager":   {Rev: "hm"},
+				"github:nix-systems/default":          {Rev: "sys"},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		depth    int
+		expected []string
+		queries  int
+	}{
+		{"root inputs", 0, []string{"home-manager", "nixpkgs"}, 2},
+		{"all inputs", -1, []string{"home-manager", "home-manager/nixpkgs", "home-manager/systems", "nixpkgs"}, 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver := newResolver()
+			results, err := CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver, Depth: tc.depth})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var names []string
+			for _, update := range results.Updates {
+				names = append(names, update.InputName)
+				if update.Error != "" {
+					t.Errorf("unexpected error for %s: %s", update.InputName, update.Error)
+				}
+			}
+			if !slices.Equal(names, tc.expected) {
+				t.Errorf("expected inputs %v, got %v", tc.expected, names)
+			}
+
+			// Both copies of nixpkgs track the same branch, so share a query
+			if queries := resolver.Queries(); len(queries) != tc.queries {
+				t.Errorf("expected %d queries, got %d", tc.queries, len(queries))
+			}
+		})
+	}
+
+	resolver := newResolver()
+	results, _ := CheckUpdatesWith(context.Background(), lock, UpdateOptions{Resolver: resolver, Depth: 2})
+	for _, update := range results.Updates {
+		if update.InputName == "home-manager/nixpkgs" && (!update.IsUpdate || update.Path[0] != "home-manager") {
+			t.Errorf("expected an update for the transitive nixpkgs, got %+v", update)
+		}
+		if update.InputName == "nixpkgs" && update.IsUpdate {
+			t.Errorf("expected the root nixpkgs to be up to date, got %+v", update)
+		}
+	}
+}
@@ -68,6 +68,25 @@ func generateRepoURL(repo Input) string {
 	}
 }
 
+// Returns the versioned URL of a node's locked entry, or an empty string if
+// the node is not locked or of an unknown type.
+func nodeURL(node Node) string {
+	if node.Locked == nil {
+		return ""
+	}
+
+	return flakeURL(map[string]any{
+		"type":    node.Locked.Type,
+		"owner":   node.Locked.Owner,
+		"repo":    node.Locked.Repo,
+		"host":    node.Locked.Host,
+		"url":     node.Locked.URL,
+		"path":    node.Locked.Path,
+		"rev":     node.Locked.Rev,
+		"narHash": node.Locked.NarHash,
+	})
+}
+
 func AnalyzeFlake(flakeLock FlakeLock) Relations {
 	deps := make(map[string][]string)
 	reverseDeps := make(map[string][]string)
@@ -75,21 +94,8 @@ func AnalyzeFlake(flakeLock FlakeLock) Relations {
 	// First we build a map from node name to its locked version key (url)
 	nodeToURL := make(map[string]string)
 	for nodeName, node := range flakeLock.Nodes {
-		if node.Locked != nil {
-			lockedMap := map[string]any{
-				"type":    node.Locked.Type,
-				"owner":   node.Locked.Owner,
-				"repo":    node.Locked.Repo,
-				"host":    node.Locked.Host,
-				"url":     node.Locked.URL,
-				"path":    node.Locked.Path,
-				"rev":     node.Locked.Rev,
-				"narHash": node.Locked.NarHash,
-			}
-			url := flakeURL(lockedMap)
-			if url != "" {
-				nodeToURL[nodeName] = url
-			}
+		if url := nodeURL(node); url != "" {
+			nodeToURL[nodeName] = url
 		}
 	}
 
@@ -141,3 +147,31 @@ func ExtractRepoIdentity(url string) string {
 	}
 	return url
 }
+
+// Returns the repository identity of a locked entry, as used to group
+// duplicates, e.g. "github:NixOS/nixpkgs".
+func LockedIdentity(locked *Locked) string {
+	return ExtractRepoIdentity(nodeURL(Node{Locked: locked}))
+}
+
+// Returns the repository identity of a flake reference such as
+// "github:NixOS/nixpkgs/nixos-unstable", without its ref or revision.
+func RefIdentity(ref string) (string, error) {
+	original, err := ParseRef(ref)
+	if err != nil {
+		return "", err
+	}
+
+	identity := generateRepoURL(Input{
+		Type:  original.Type,
+		Owner: original.Owner,
+		Repo:  original.Repo,
+		Host:  original.Host,
+		URL:   original.URL,
+		Path:  original.Path,
+	})
+	if identity == "" {
+		return "", fmt.Errorf("flake reference %q does not name a repository", ref)
+	}
+	return identity, nil
+}
@@ -0,0 +1,137 @@
+package flake
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A release version parsed from a tag such as "v1.4.2", "1.0" or
+// "release-2.3.0-rc.1". Only tags sharing a prefix are comparable.
+type Version struct {
+	Prefix     string
+	Numbers    []int
+	Prerelease string
+
+	raw string
+}
+
+var versionPattern = regexp.MustCompile(`^([A-Za-z][A-Za-z_-]*?[-_]?|)(\d+(?:\.\d+){0,3})(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// Parses a tag name as a version, reporting whether it looks like one.
+func ParseVersion(tag string) (Version, bool) {
+	match := versionPattern.FindStringSubmatch(strings.TrimPrefix(tag, "refs/tags/"))
+	if match == nil {
+		return Version{}, false
+	}
+
+	version := Version{Prefix: match[1], Prerelease: match[3], raw: strings.TrimPrefix(tag, "refs/tags/")}
+	for _, part := range strings.Split(match[2], ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return Version{}, false
+		}
+		version.Numbers = append(version.Numbers, n)
+	}
+	return version, true
+}
+
+func (v Version) String() string {
+	return v.raw
+}
+
+// Returns the version number at index i, treating missing components as 0.
+func (v Version) number(i int) int {
+	if i < len(v.Numbers) {
+		return v.Numbers[i]
+	}
+	return 0
+}
+
+// Orders versions by their numbers, then releases after prereleases, then
+// prereleases by their identifiers as semver does.
+func (v Version) Compare(other Version) int {
+	for i := range max(len(v.Numbers), len(other.Numbers)) {
+		if c := cmp.Compare(v.number(i), other.number(i)); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case v.Prerelease == other.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case other.Prerelease == "":
+		return -1
+	}
+
+	a, b := strings.Split(v.Prerelease, "."), strings.Split(other.Prerelease, ".")
+	for i := range min(len(a), len(b)) {
+		if c := comparePrerelease(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// Compares prerelease identifiers: numeric ones numerically and before
+// alphanumeric ones, which compare as strings.
+func comparePrerelease(a, b string) int {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Compare(x, y)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// How big a version change is.
+type Bump int
+
+const (
+	BumpNone Bump = iota
+	BumpPatch
+	BumpMinor
+	BumpMajor
+)
+
+var bumpNames = []string{"none", "patch", "minor", "major"}
+
+func (b Bump) String() string {
+	if b < 0 || int(b) >= len(bumpNames) {
+		return "unknown"
+	}
+	return bumpNames[b]
+}
+
+// Parses a bump name: "patch", "minor" or "major".
+func ParseBump(name string) (Bump, error) {
+	for i, candidate := range bumpNames[1:] {
+		if name == candidate {
+			return Bump(i + 1), nil
+		}
+	}
+	return BumpNone, fmt.Errorf("unknown update kind '%s'. Valid kinds are: %s", name, strings.Join(bumpNames[1:], ", "))
+}
+
+// Classifies the change from one version to a newer one.
+func ClassifyBump(from, to Version) Bump {
+	switch {
+	case from.Compare(to) == 0:
+		return BumpNone
+	case from.number(0) != to.number(0):
+		return BumpMajor
+	case from.number(1) != to.number(1):
+		return BumpMinor
+	default:
+		return BumpPatch
+	}
+}
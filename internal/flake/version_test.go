@@ -0,0 +1,103 @@
+package flake
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	testCases := []struct {
+		tag        string
+		ok         bool
+		prefix     string
+		numbers    []int
+		prerelease string
+	}{
+		{"v1.4.2", true, "v", []int{1, 4, 2}, ""},
+		{"1.0", true, "", []int{1, 0}, ""},
+		{"refs/tags/v2.0.0-rc.1", true, "v", []int{2, 0, 0}, "rc.1"},
+		{"release-23.11", true, "release-", []int{23, 11}, ""},
+		{"v1.2.3+build.5", true, "v", []int{1, 2, 3}, ""},
+		{"main", false, "", nil, ""},
+		{"nixos-unstable", false, "", nil, ""},
+		{"1.2.x", false, "", nil, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.tag, func(t *testing.T) {
+			version, ok := ParseVersion(tc.tag)
+			if ok != tc.ok {
+				t.Fatalf("expected ok=%v, got %v", tc.ok, ok)
+			}
+			if !ok {
+				return
+			}
+			if version.Prefix != tc.prefix || version.Prerelease != tc.prerelease || len(version.Numbers) != len(tc.numbers) {
+				t.Fatalf("unexpected version %+v", version)
+			}
+			for i, n := range tc.numbers {
+				if version.Numbers[i] != n {
+					t.Errorf("expected numbers %v, got %v", tc.numbers, version.Numbers)
+				}
+			}
+		})
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"v1.4.2", "v1.4.10", -1},
+		{"v1.10.0", "v1.9.9", 1},
+		{"v1.0", "v1.0.0", 0},
+		{"v1.0.0-rc.1", "v1.0.0", -1},
+		{"v1.0.0-rc.2", "v1.0.0-rc.10", -1},
+		{"v1.0.0-alpha", "v1.0.0-1", 1},
+		{"v1.0.0-alpha", "v1.0.0-alpha.1", -1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.a+" vs "+tc.b, func(t *testing.T) {
+			a, _ := ParseVersion(tc.a)
+			b, _ := ParseVersion(tc.b)
+			if got := a.Compare(b); got != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, got)
+			}
+			if got := b.Compare(a); got != -tc.expected {
+				t.Errorf("expected reverse %d, got %d", -tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestClassifyBump(t *testing.T) {
+	testCases := []struct {
+		from, to string
+		expected Bump
+	}{
+		{"v1.4.2", "v1.4.3", BumpPatch},
+		{"v1.4.2", "v1.5.0", BumpMinor},
+		{"v1.4.2", "v2.0.0", BumpMajor},
+		{"v1.4", "v1.4.1", BumpPatch},
+		{"v1.4.2", "v1.4.2", BumpNone},
+	}
+
+	for _, tc := range testCases {
+		from, _ := ParseVersion(tc.from)
+		to, _ := ParseVersion(tc.to)
+		if got := ClassifyBump(from, to); got != tc.expected {
+			t.Errorf("%s → %s: expected %s, got %s", tc.from, tc.to, tc.expected, got)
+		}
+	}
+}
+
+func TestParseBump(t *testing.T) {
+	for _, name := range []string{"patch", "minor", "major"} {
+		bump, err := ParseBump(name)
+		if err != nil || bump.String() != name {
+			t.Errorf("%s: got %s, %v", name, bump, err)
+		}
+	}
+	if _, err := ParseBump("none"); err == nil {
+		t.Error("expected an error for none")
+	}
+}
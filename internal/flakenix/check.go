@@ -0,0 +1,270 @@
+package flakenix
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	flake "notashelf.dev/flint/internal/flake"
+)
+
+type MismatchKind string
+
+const (
+	// Declared in flake.nix but missing from the lockfile
+	NotLocked MismatchKind = "not-locked"
+	// Locked but no longer declared in flake.nix
+	NotDeclared MismatchKind = "not-declared"
+	// Declared with a different reference than the one that was locked
+	RefChanged MismatchKind = "ref-changed"
+	// Declared follows that the lockfile does not reflect
+	FollowsChanged MismatchKind = "follows-changed"
+	// Declared with a different `flake` attribute than the one that was locked
+	FlakeChanged MismatchKind = "flake-changed"
+)
+
+// A difference between the inputs declared in flake.nix and what is recorded
+// in flake.lock, usually meaning that the lockfile is stale.
+type Mismatch struct {
+	Kind     MismatchKind
+	Input    string
+	Message  string
+	Declared string
+	Locked   string
+
+	// Location of the declaration in flake.nix; inputs that are only present
+	// in the lockfile point at the file as a whole
+	Location flake.Location
+}
+
+// Compares the inputs declared in flake.nix against the root node of the
+// lockfile and the originals of the nodes it points to.
+func CheckLock(file *File, flakeLock flake.FlakeLock) []Mismatch {
+	var mismatches []Mismatch
+
+	rootNode := flakeLock.Nodes[flake.RootName(flakeLock)]
+
+	for _, input := range file.Inputs {
+		ref, locked := rootNode.Inputs[input.Name]
+
+		if !locked {
+			mismatches = append(mismatches, Mismatch{
+				Kind:     NotLocked,
+				Input:    input.Name,
+				Message:  fmt.Sprintf("input %q is declared in %s but not locked", input.Name, file.Path),
+				Declared: declaredRef(input),
+				Location: file.Location(input.Pos),
+			})
+			continue
+		}
+
+		if input.Follows != "" {
+			want := splitFollows(input.Follows)
+			if got, ok := followsPath(ref); !ok || !slices.Equal(got, want) {
+				mismatches = append(mismatches, Mismatch{
+					Kind:     FollowsChanged,
+					Input:    input.Name,
+					Message:  fmt.Sprintf("input %q is declared to follow %q but is locked to %s", input.Name, input.Follows, describeRef(ref)),
+					Declared: "follows " + input.Follows,
+					Locked:   describeRef(ref),
+					Location: file.Location(input.Pos),
+				})
+			}
+			continue
+		}
+
+		nodeName, ok := ref.(string)
+		if !ok {
+			mismatches = append(mismatches, Mismatch{
+				Kind:     FollowsChanged,
+				Input:    input.Name,
+				Message:  fmt.Sprintf("input %q no longer follows anything in %s but is locked to %s", input.Name, file.Path, describeRef(ref)),
+				Declared: declaredRef(input),
+				Locked:   describeRef(ref),
+				Location: file.Location(input.Pos),
+			})
+			continue
+		}
+
+		node := flakeLock.Nodes[nodeName]
+		mismatches = append(mismatches, checkDeclaration(file, input, node)...)
+		mismatches = append(mismatches, checkOverrides(file, flakeLock, input, nodeName)...)
+	}
+
+	// Inputs that are locked but no longer declared
+	var lockedNames []string
+	for name := range rootNode.Inputs {
+		lockedNames = append(lockedNames, name)
+	}
+	sort.Strings(lockedNames)
+
+	for _, name := range lockedNames {
+		if file.Input(name) != nil {
+			continue
+		}
+
+		ref := rootNode.Inputs[name]
+		locked := describeRef(ref)
+		if nodeName, ok := ref.(string); ok {
+			original := flakeLock.Nodes[nodeName].Original
+
+			// Inputs taken from the registry through the outputs arguments
+			// never appear in the inputs attribute set
+			if original != nil && original.Type == "indirect" && original.ID == name {
+				continue
+			}
+			if original != nil {
+				locked = original.String()
+			}
+		}
+
+		mismatches = append(mismatches, Mismatch{
+			Kind:     NotDeclared,
+			Input:    name,
+			Message:  fmt.Sprintf("input %q is locked but no longer declared in %s", name, file.Path),
+			Locked:   locked,
+			Location: flake.Location{File: file.Path},
+		})
+	}
+
+	return mismatches
+}
+
+// Compares the reference and flake attribute of a declared input with the
+// locked node it resolves to.
+func checkDeclaration(file *File, input *Input, node flake.Node) []Mismatch {
+	var mismatches []Mismatch
+
+	if !input.Dynamic && node.Original != nil {
+		if declared, err := input.Original(); err == nil && !declared.Equal(*node.Original) {
+			mismatches = append(mismatches, Mismatch{
+				Kind:     RefChanged,
+				Input:    input.Name,
+				Message:  fmt.Sprintf("input %q is declared as %s but locked from %s", input.Name, declared, node.Original),
+				Declared: declared.String(),
+				Locked:   node.Original.String(),
+				Location: file.Location(input.Pos),
+			})
+		}
+	}
+
+	declaredFlake := input.Flake == nil || *input.Flake
+	lockedFlake := node.Flake == nil || *node.Flake
+	if declaredFlake != lockedFlake {
+		mismatches = append(mismatches, Mismatch{
+			Kind:     FlakeChanged,
+			Input:    input.Name,
+			Message:  fmt.Sprintf("input %q is declared with flake = %t in %s but locked with flake = %t", input.Name, declaredFlake, file.Path, lockedFlake),
+			Declared: fmt.Sprintf("flake = %t", declaredFlake),
+			Locked:   fmt.Sprintf("flake = %t", lockedFlake),
+			Location: file.Location(input.Pos),
+		})
+	}
+
+	return mismatches
+}
+
+// Checks that every follows declared on the input's own inputs is reflected
+// in the lockfile.
+func checkOverrides(file *File, flakeLock flake.FlakeLock, input *Input, nodeName string) []Mismatch {
+	var mismatches []Mismatch
+
+	for _, override := range input.Overrides {
+		path := input.Name + "/" + strings.Join(override.Path, "/")
+		want := splitFollows(override.Target)
+
+		ref, found := lookupInput(flakeLock, nodeName, override.Path)
+		if !found {
+			mismatches = append(mismatches, Mismatch{
+				Kind:     FollowsChanged,
+				Input:    path,
+				Message:  fmt.Sprintf("input %q is declared to follow %q but is not in the lockfile", path, override.Target),
+				Declared: "follows " + override.Target,
+				Location: file.Location(override.Pos),
+			})
+			continue
+		}
+
+		if got, ok := followsPath(ref); !ok || !slices.Equal(got, want) {
+			mismatches = append(mismatches, Mismatch{
+				Kind:     FollowsChanged,
+				Input:    path,
+				Message:  fmt.Sprintf("input %q is declared to follow %q but is locked to %s", path, override.Target, describeRef(ref)),
+				Declared: "follows " + override.Target,
+				Locked:   describeRef(ref),
+				Location: file.Location(override.Pos),
+			})
+		}
+	}
+
+	return mismatches
+}
+
+// Walks an input path starting at the given node, returning the raw reference
+// of the last element.
+func lookupInput(flakeLock flake.FlakeLock, nodeName string, path []string) (any, bool) {
+	current := nodeName
+	for i, name := range path {
+		ref, ok := flakeLock.Nodes[current].Inputs[name]
+		if !ok {
+			return nil, false
+		}
+		if i == len(path)-1 {
+			return ref, true
+		}
+
+		next, ok := ref.(string)
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	return nil, false
+}
+
+// Splits a follows target into the input path Nix records in the lockfile.
+// An empty target follows the root flake itself.
+func splitFollows(target string) []string {
+	if target == "" {
+		return []string{}
+	}
+	return strings.Split(target, "/")
+}
+
+func followsPath(ref any) ([]string, bool) {
+	list, ok := ref.([]any)
+	if !ok {
+		return nil, false
+	}
+
+	path := make([]string, 0, len(list))
+	for _, elem := range list {
+		name, ok := elem.(string)
+		if !ok {
+			return nil, false
+		}
+		path = append(path, name)
+	}
+	return path, true
+}
+
+func describeRef(ref any) string {
+	if path, ok := followsPath(ref); ok {
+		return fmt.Sprintf("follows %q", strings.Join(path, "/"))
+	}
+	if name, ok := ref.(string); ok {
+		return fmt.Sprintf("node %q", name)
+	}
+	return fmt.Sprintf("%v", ref)
+}
+
+func declaredRef(input *Input) string {
+	if input.Follows != "" {
+		return "follows " + input.Follows
+	}
+	if original, err := input.Original(); err == nil {
+		return original.String()
+	}
+	return ""
+}
@@ -0,0 +1,125 @@
+package flakenix
+
+import (
+	"encoding/json"
+	"testing"
+
+	flake "notashelf.dev/flint/internal/flake"
+)
+
+const checkLock = `
+{
+  "nodes": {
+    "nixpkgs": {
+      "locked": {"owner": "NixOS", "repo": "nixpkgs", "rev": "aaa", "type": "github"},
+      "original": {"owner": "NixOS", "ref": "nixos-unstable", "repo": "nixpkgs", "type": "github"}
+    },
+    "nixpkgs_2": {
+      "locked": {"owner": "NixOS", "repo": "nixpkgs", "rev": "bbb", "type": "github"},
+      "original": {"owner": "NixOS", "repo": "nixpkgs", "type": "github"}
+    },
+    "home-manager": {
+      "inputs": {"nixpkgs": "nixpkgs_2"},
+      "locked": {"owner": "nix-community", "repo": "home-manager", "rev": "hm", "type": "github"},
+      "original": {"owner": "nix-community", "repo": "home-manager", "type": "github"}
+    },
+    "old": {
+      "locked": {"owner": "old", "repo": "old", "rev": "old", "type": "github"},
+      "original": {"owner": "old", "repo": "old", "type": "github"}
+    },
+    "registry": {
+      "locked": {"owner": "NixOS", "repo": "templates", "rev": "tpl", "type": "github"},
+      "original": {"id": "registry", "type": "indirect"}
+    },
+    "root": {
+      "inputs": {
+        "home-manager": "home-manager",
+        "nixpkgs": "nixpkgs",
+        "old": "old",
+        "registry": "registry",
+        "stable": ["nixpkgs"]
+      }
+    }
+  },
+  "root": "root",
+  "version": 7
+}
+`
+
+func loadLock(t *testing.T, data string) flake.FlakeLock {
+	t.Helper()
+	var lock flake.FlakeLock
+	if err := json.Unmarshal([]byte(data), &lock); err != nil {
+		t.Fatalf("failed to unmarshal lock: %v", err)
+	}
+	return lock
+}
+
+func TestCheckLock(t *testing.T) {
+	src := `{
+  inputs = {
+    nixpkgs.url = "github:NixOS/nixpkgs/nixos-24.05";
+    home-manager = {
+      url = "github:nix-community/home-manager";
+      inputs.nixpkgs.follows = "nixpkgs";
+    };
+    stable.follows = "home-manager";
+    added.url = "github:new/input";
+  };
+  outputs = _: { };
+}`
+
+	file, err := Parse("flake.nix", []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	mismatches := CheckLock(file, loadLock(t, checkLock))
+
+	expected := []struct {
+		kind  MismatchKind
+		input string
+		line  int
+	}{
+		{RefChanged, "nixpkgs", 3},
+		{FollowsChanged, "home-manager/nixpkgs", 6},
+		{FollowsChanged, "stable", 8},
+		{NotLocked, "added", 9},
+		{NotDeclared, "old", 0},
+	}
+
+	if len(mismatches) != len(expected) {
+		t.Fatalf("expected %d mismatches, got %d: %+v", len(expected), len(mismatches), mismatches)
+	}
+
+	for i, want := range expected {
+		got := mismatches[i]
+		if got.Kind != want.kind || got.Input != want.input || got.Location.Line != want.line {
+			t.Errorf("mismatch %d: expected %s %s at line %d, got %s %s at line %d",
+				i, want.kind, want.input, want.line, got.Kind, got.Input, got.Location.Line)
+		}
+	}
+}
+
+func TestCheckLock_Consistent(t *testing.T) {
+	src := `{
+  inputs.nixpkgs.url = "github:NixOS/nixpkgs/nixos-unstable";
+  inputs.home-manager.url = "github:nix-community/home-manager";
+  inputs.stable.follows = "nixpkgs";
+  inputs.old = {
+    type = "github";
+    owner = "old";
+    repo = "old";
+  };
+  outputs = _: { };
+}`
+
+	file, err := Parse("flake.nix", []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	if mismatches := CheckLock(file, loadLock(t, checkLock)); len(mismatches) != 0 {
+		t.Errorf("expected no mismatches, got %+v", mismatches)
+	}
+}
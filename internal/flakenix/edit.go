@@ -0,0 +1,158 @@
+package flakenix
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var keywords = []string{"assert", "else", "if", "in", "inherit", "let", "or", "rec", "then", "with"}
+
+// A text insertion into the source of a flake.nix.
+type Edit struct {
+	Offset int
+	Text   string
+}
+
+// Quotes an attribute name unless it can be written as a bare identifier.
+func attrText(name string) string {
+	if name == "" || !isIdentStart(name[0]) || slices.Contains(keywords, name) {
+		return strconv.Quote(name)
+	}
+	for i := 1; i < len(name); i++ {
+		if !isIdentChar(name[i]) {
+			return strconv.Quote(name)
+		}
+	}
+	return name
+}
+
+// Renders `inputs.a.inputs.b.follows = "target";` for a relative input path.
+func followsText(path []string, target string) string {
+	var sb strings.Builder
+	for _, name := range path {
+		sb.WriteString("inputs.")
+		sb.WriteString(attrText(name))
+		sb.WriteString(".")
+	}
+	sb.WriteString("follows = ")
+	sb.WriteString(strconv.Quote(target))
+	sb.WriteString(";")
+	return sb.String()
+}
+
+// Builds the edit that declares inputs.<inputName>.inputs.<path>.follows =
+// target. The declaration is placed next to the existing declarations of the
+// input, in the same style: inside its attribute set if it has one, or as a
+// dotted binding after its last one otherwise. A nil edit means the follows
+// is already declared.
+func (f *File) AddFollows(inputName string, path []string, target string) (*Edit, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("empty follows path for input %q", inputName)
+	}
+
+	input := f.Input(inputName)
+	if input == nil {
+		return f.declareFollows(inputName, path, target), nil
+	}
+
+	if existing, ok := input.Override(path); ok {
+		if existing.Target == target {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s:%s: input %q already follows %q for %s",
+			f.Path, existing.Pos, inputName, existing.Target, strings.Join(path, "/"))
+	}
+
+	text := followsText(path, target)
+	if input.block != nil {
+		return f.insertIntoSet(input.block, text), nil
+	}
+
+	last := len(input.bindings) - 1
+	prefix := string(f.Src[input.bindings[last].start:input.nameEnds[last]])
+	return f.insertAfter(input.bindings[last], input.containers[last], prefix+"."+text), nil
+}
+
+// Declares a follows for an input that only appears implicitly, e.g. one
+// taken from the flake registry through the outputs function arguments.
+func (f *File) declareFollows(inputName string, path []string, target string) *Edit {
+	text := attrText(inputName) + "." + followsText(path, target)
+	if f.inputsSet != nil {
+		return f.insertIntoSet(f.inputsSet, text)
+	}
+	if f.lastInput != nil {
+		return f.insertAfter(f.lastInput, f.top, "inputs."+text)
+	}
+	return f.insertIntoSet(f.top, "inputs."+text)
+}
+
+func (f *File) insertIntoSet(set *attrSet, text string) *Edit {
+	if len(set.bindings) > 0 {
+		return f.insertAfter(set.bindings[len(set.bindings)-1], set, text)
+	}
+
+	openLine, _ := position(f.Src, set.open)
+	closeLine, _ := position(f.Src, set.close)
+	if openLine == closeLine {
+		return &Edit{Offset: set.open + 1, Text: " " + text}
+	}
+
+	lineStart := f.lineStart(set.close)
+	return &Edit{Offset: lineStart, Text: f.indentAt(set.close) + "  " + text + "\n"}
+}
+
+// Inserts text as a new binding after b. If the attribute set b belongs to is
+// closed on the same line, the binding is added inline instead of on a line
+// of its own.
+func (f *File) insertAfter(b *binding, container *attrSet, text string) *Edit {
+	eol := bytes.IndexByte(f.Src[b.end:], '\n')
+	if eol == -1 {
+		eol = len(f.Src)
+	} else {
+		eol += b.end
+	}
+
+	if container != nil && container.close >= b.end && container.close < eol {
+		return &Edit{Offset: b.end, Text: " " + text}
+	}
+
+	return &Edit{Offset: eol, Text: "\n" + f.indentAt(b.start) + text}
+}
+
+func (f *File) lineStart(offset int) int {
+	return bytes.LastIndexByte(f.Src[:offset], '\n') + 1
+}
+
+// Returns the leading whitespace of the line containing offset.
+func (f *File) indentAt(offset int) string {
+	start := f.lineStart(offset)
+	end := start
+	for end < len(f.Src) && (f.Src[end] == ' ' || f.Src[end] == '\t') {
+		end++
+	}
+	return string(f.Src[start:end])
+}
+
+// Applies insertions to src. Edits at the same offset are applied in the
+// order they were given.
+func Apply(src []byte, edits []Edit) []byte {
+	sorted := make([]Edit, len(edits))
+	copy(sorted, edits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Offset < sorted[j].Offset
+	})
+
+	var out bytes.Buffer
+	last := 0
+	for _, edit := range sorted {
+		out.Write(src[last:edit.Offset])
+		out.WriteString(edit.Text)
+		last = edit.Offset
+	}
+	out.Write(src[last:])
+	return out.Bytes()
+}
@@ -0,0 +1,177 @@
+package flakenix
+
+import (
+	"testing"
+)
+
+func applyFollows(t *testing.T, src string, inputName string, path []string, target string) string {
+	t.Helper()
+
+	file, err := Parse("flake.nix", []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	edit, err := file.AddFollows(inputName, path, target)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if edit == nil {
+		return src
+	}
+	return string(Apply(file.Src, []Edit{*edit}))
+}
+
+func TestAddFollows(t *testing.T) {
+	testCases := []struct {
+		name     string
+		src      string
+		input    string
+		path     []string
+		target   string
+		expected string
+	}{
+		{
+			name: "nested block",
+			src: `{
+  inputs = {
+    hm = {
+      url = "github:nix-community/home-manager"; # pinned
+    };
+  };
+}`,
+			input:  "hm",
+			path:   []string{"nixpkgs"},
+			target: "nixpkgs",
+			expected: `{
+  inputs = {
+    hm = {
+      url = "github:nix-community/home-manager"; # pinned
+      inputs.nixpkgs.follows = "nixpkgs";
+    };
+  };
+}`,
+		},
+		{
+			name: "single-line block",
+			src: `{
+  inputs = {
+    hm = { url = "github:nix-community/home-manager"; };
+  };
+}`,
+			input:  "hm",
+			path:   []string{"nixpkgs"},
+			target: "nixpkgs",
+			expected: `{
+  inputs = {
+    hm = { url = "github:nix-community/home-manager"; inputs.nixpkgs.follows = "nixpkgs"; };
+  };
+}`,
+		},
+		{
+			name: "dotted inside inputs",
+			src: `{
+  inputs = {
+    hm.url = "github:nix-community/home-manager";
+    other.url = "github:foo/bar";
+  };
+}`,
+			input:  "hm",
+			path:   []string{"utils", "systems"},
+			target: "systems",
+			expected: `{
+  inputs = {
+    hm.url = "github:nix-community/home-manager";
+    hm.inputs.utils.inputs.systems.follows = "systems";
+    other.url = "github:foo/bar";
+  };
+}`,
+		},
+		{
+			name: "flat top-level",
+			src: `{
+	inputs.nixpkgs.url = "github:NixOS/nixpkgs";
+	inputs."hm".url = "github:nix-community/home-manager";
+	outputs = _: { };
+}`,
+			input:  "hm",
+			path:   []string{"nixpkgs"},
+			target: "nixpkgs",
+			expected: `{
+	inputs.nixpkgs.url = "github:NixOS/nixpkgs";
+	inputs."hm".url = "github:nix-community/home-manager";
+	inputs."hm".inputs.nixpkgs.follows = "nixpkgs";
+	outputs = _: { };
+}`,
+		},
+		{
+			name: "undeclared input",
+			src: `{
+  inputs = {
+    nixpkgs.url = "github:NixOS/nixpkgs";
+  };
+}`,
+			input:  "registry-input",
+			path:   []string{"nixpkgs"},
+			target: "nixpkgs",
+			expected: `{
+  inputs = {
+    nixpkgs.url = "github:NixOS/nixpkgs";
+    registry-input.inputs.nixpkgs.follows = "nixpkgs";
+  };
+}`,
+		},
+		{
+			name: "already declared",
+			src: `{
+  inputs.hm = { url = "github:nix-community/home-manager"; inputs.nixpkgs.follows = "nixpkgs"; };
+}`,
+			input:  "hm",
+			path:   []string{"nixpkgs"},
+			target: "nixpkgs",
+			expected: `{
+  inputs.hm = { url = "github:nix-community/home-manager"; inputs.nixpkgs.follows = "nixpkgs"; };
+}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := applyFollows(t, tc.src, tc.input, tc.path, tc.target)
+			if result != tc.expected {
+				t.Errorf("unexpected result:\n%s\nexpected:\n%s", result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestAddFollows_Conflict(t *testing.T) {
+	src := `{
+  inputs.hm = { url = "github:nix-community/home-manager"; inputs.nixpkgs.follows = "nixpkgs-stable"; };
+}`
+
+	file, err := Parse("flake.nix", []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	if _, err := file.AddFollows("hm", []string{"nixpkgs"}, "nixpkgs"); err == nil {
+		t.Error("expected error for conflicting follows declaration")
+	}
+}
+
+func TestAttrText(t *testing.T) {
+	testCases := map[string]string{
+		"nixpkgs":       "nixpkgs",
+		"home-manager":  "home-manager",
+		"nixpkgs_24.05": `"nixpkgs_24.05"`,
+		"1password":     `"1password"`,
+		"in":            `"in"`,
+	}
+
+	for name, expected := range testCases {
+		if got := attrText(name); got != expected {
+			t.Errorf("attrText(%q): expected %s, got %s", name, expected, got)
+		}
+	}
+}
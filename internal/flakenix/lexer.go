@@ -0,0 +1,318 @@
+package flakenix
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokOther // numbers, paths, URIs and operators we don't care about
+	tokPunct
+)
+
+type token struct {
+	kind  tokenKind
+	text  string // punctuation or identifier text, decoded string contents
+	start int
+	end   int
+
+	// Set for strings that contain ${...}, whose value is not static
+	interpolated bool
+}
+
+// A lexer for the subset of the Nix grammar we need to walk a flake.nix. It
+// does not try to evaluate anything; it only needs to tell identifiers,
+// strings and brackets apart so that expressions we do not understand can be
+// skipped reliably.
+type lexer struct {
+	src []byte
+	pos int
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '\'' || c == '-'
+}
+
+func isPathChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '.' || c == '-' || c == '+'
+}
+
+func isURIChar(c byte) bool {
+	return isPathChar(c) || strings.IndexByte("%/?:@&=$,!~*'", c) != -1
+}
+
+func (l *lexer) peekByte(offset int) byte {
+	if l.pos+offset < len(l.src) {
+		return l.src[l.pos+offset]
+	}
+	return 0
+}
+
+// Skips whitespace and comments.
+func (l *lexer) skipTrivia() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case c == '/' && l.peekByte(1) == '*':
+			end := strings.Index(string(l.src[l.pos+2:]), "*/")
+			if end == -1 {
+				return fmt.Errorf("unterminated comment at offset %d", l.pos)
+			}
+			l.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipTrivia(); err != nil {
+		return token{}, err
+	}
+
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, start: start, end: start}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case c == '"':
+		return l.lexString()
+
+	case c == '\'' && l.peekByte(1) == '\'':
+		return l.lexIndentedString()
+
+	case c == '$' && l.peekByte(1) == '{':
+		l.pos += 2
+		return token{kind: tokPunct, text: "${", start: start, end: l.pos}, nil
+
+	case c == '<' && isPathChar(l.peekByte(1)):
+		// Search paths such as <nixpkgs>
+		end := l.pos + 1
+		for end < len(l.src) && (isPathChar(l.src[end]) || l.src[end] == '/') {
+			end++
+		}
+		if end < len(l.src) && l.src[end] == '>' {
+			l.pos = end + 1
+			return token{kind: tokOther, text: string(l.src[start:l.pos]), start: start, end: l.pos}, nil
+		}
+
+	case c == '~' && l.peekByte(1) == '/':
+		l.pos++
+		l.scanPath()
+		return token{kind: tokOther, text: string(l.src[start:l.pos]), start: start, end: l.pos}, nil
+	}
+
+	if isPathChar(c) || c == '/' {
+		if end := l.matchPath(); end > start {
+			l.pos = end
+			return token{kind: tokOther, text: string(l.src[start:l.pos]), start: start, end: l.pos}, nil
+		}
+	}
+
+	if isIdentStart(c) {
+		if end := l.matchURI(); end > start {
+			l.pos = end
+			return token{kind: tokOther, text: string(l.src[start:l.pos]), start: start, end: l.pos}, nil
+		}
+
+		for l.pos < len(l.src) && isIdentChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: string(l.src[start:l.pos]), start: start, end: l.pos}, nil
+	}
+
+	if c >= '0' && c <= '9' {
+		for l.pos < len(l.src) && (isPathChar(l.src[l.pos]) || l.src[l.pos] == 'e') {
+			l.pos++
+		}
+		return token{kind: tokOther, text: string(l.src[start:l.pos]), start: start, end: l.pos}, nil
+	}
+
+	for _, op := range []string{"...", "//", "==", "!=", "<=", ">=", "&&", "||", "->", "++"} {
+		if strings.HasPrefix(string(l.src[l.pos:min(l.pos+len(op), len(l.src))]), op) {
+			l.pos += len(op)
+			return token{kind: tokPunct, text: op, start: start, end: l.pos}, nil
+		}
+	}
+
+	l.pos++
+	return token{kind: tokPunct, text: string(c), start: start, end: l.pos}, nil
+}
+
+// Returns the end offset of a path literal starting at the current position,
+// or the current position if there is none. Paths must contain at least one
+// slash followed by a path character, which is what tells them apart from
+// identifiers and the division operator.
+func (l *lexer) matchPath() int {
+	end := l.pos
+	for end < len(l.src) && isPathChar(l.src[end]) {
+		end++
+	}
+
+	matched := false
+	for end < len(l.src) && l.src[end] == '/' && end+1 < len(l.src) && isPathChar(l.src[end+1]) {
+		matched = true
+		end++
+		for end < len(l.src) && isPathChar(l.src[end]) {
+			end++
+		}
+	}
+
+	if !matched {
+		return l.pos
+	}
+	return end
+}
+
+func (l *lexer) scanPath() {
+	for l.pos < len(l.src) && (isPathChar(l.src[l.pos]) || l.src[l.pos] == '/') {
+		l.pos++
+	}
+}
+
+// Returns the end offset of an unquoted URI such as https://example.com, or
+// the current position if there is none.
+func (l *lexer) matchURI() int {
+	end := l.pos
+	for end < len(l.src) && (isIdentChar(l.src[end]) || l.src[end] == '+' || l.src[end] == '.') {
+		end++
+	}
+
+	if end >= len(l.src) || l.src[end] != ':' || end+1 >= len(l.src) || !isURIChar(l.src[end+1]) {
+		return l.pos
+	}
+
+	end++
+	for end < len(l.src) && isURIChar(l.src[end]) {
+		end++
+	}
+	return end
+}
+
+// Skips over an interpolation whose opening ${ has already been consumed.
+func (l *lexer) skipInterpolation() error {
+	depth := 1
+	for depth > 0 {
+		tok, err := l.next()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case tok.kind == tokEOF:
+			return fmt.Errorf("unterminated interpolation")
+		case tok.kind == tokPunct && (tok.text == "{" || tok.text == "${"):
+			depth++
+		case tok.kind == tokPunct && tok.text == "}":
+			depth--
+		}
+	}
+	return nil
+}
+
+func (l *lexer) lexString() (token, error) {
+	start := l.pos
+	l.pos++
+
+	var sb strings.Builder
+	interpolated := false
+	for {
+		if l.pos >= len(l.src) {
+			return token{}, fmt.Errorf("unterminated string at offset %d", start)
+		}
+
+		c := l.src[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return token{kind: tokString, text: sb.String(), start: start, end: l.pos, interpolated: interpolated}, nil
+
+		case c == '\\' && l.pos+1 < len(l.src):
+			switch esc := l.src[l.pos+1]; esc {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			default:
+				sb.WriteByte(esc)
+			}
+			l.pos += 2
+
+		case c == '$' && l.peekByte(1) == '{':
+			interpolated = true
+			l.pos += 2
+			if err := l.skipInterpolation(); err != nil {
+				return token{}, err
+			}
+
+		default:
+			sb.WriteByte(c)
+			l.pos++
+		}
+	}
+}
+
+func (l *lexer) lexIndentedString() (token, error) {
+	start := l.pos
+	l.pos += 2
+
+	var sb strings.Builder
+	interpolated := false
+	for {
+		if l.pos >= len(l.src) {
+			return token{}, fmt.Errorf("unterminated indented string at offset %d", start)
+		}
+
+		c := l.src[l.pos]
+		switch {
+		case c == '\'' && l.peekByte(1) == '\'':
+			switch l.peekByte(2) {
+			case '\'':
+				sb.WriteString("''")
+				l.pos += 3
+			case '$':
+				sb.WriteByte('$')
+				l.pos += 3
+			case '\\':
+				if l.pos+3 < len(l.src) {
+					sb.WriteByte(l.src[l.pos+3])
+				}
+				l.pos += 4
+			default:
+				l.pos += 2
+				return token{kind: tokString, text: sb.String(), start: start, end: l.pos, interpolated: interpolated}, nil
+			}
+
+		case c == '$' && l.peekByte(1) == '{':
+			interpolated = true
+			l.pos += 2
+			if err := l.skipInterpolation(); err != nil {
+				return token{}, err
+			}
+
+		default:
+			sb.WriteByte(c)
+			l.pos++
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package flakenix
+
+import (
+	flake "notashelf.dev/flint/internal/flake"
+)
+
+// Maps every lock node reachable from the root to the declaration of the root
+// input that pulls it in, which is where a follows declaration for it would be
+// added.
+func NodeLocations(file *File, lock flake.FlakeLock) map[string]flake.Location {
+	locations := make(map[string]flake.Location)
+
+	for node, path := range flake.InputPaths(lock) {
+		if len(path) == 0 {
+			continue
+		}
+
+		input := file.Input(path[0])
+		if input == nil {
+			continue
+		}
+
+		locations[node] = file.Location(input.Pos)
+	}
+
+	return locations
+}
+
+// Maps the name of every input declared in flake.nix to its declaration.
+func InputLocations(file *File) map[string]flake.Location {
+	locations := make(map[string]flake.Location, len(file.Inputs))
+	for _, input := range file.Inputs {
+		locations[input.Name] = file.Location(input.Pos)
+	}
+	return locations
+}
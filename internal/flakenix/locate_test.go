@@ -0,0 +1,45 @@
+package flakenix
+
+import (
+	"testing"
+)
+
+func TestNodeLocations(t *testing.T) {
+	src := `{
+  inputs = {
+    nixpkgs.url = "github:NixOS/nixpkgs/nixos-unstable";
+    home-manager.url = "github:nix-community/home-manager";
+  };
+  outputs = _: { };
+}`
+
+	file, err := Parse("flake.nix", []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	locations := NodeLocations(file, loadLock(t, checkLock))
+
+	expected := map[string]int{
+		"nixpkgs":      3,
+		"home-manager": 4,
+		// Pulled in by home-manager, so fixed on its declaration
+		"nixpkgs_2": 4,
+	}
+
+	for node, line := range expected {
+		location, ok := locations[node]
+		if !ok {
+			t.Errorf("expected a location for %s", node)
+			continue
+		}
+		if location.File != "flake.nix" || location.Line != line {
+			t.Errorf("expected %s at flake.nix:%d, got %s", node, line, location)
+		}
+	}
+
+	// Inputs missing from flake.nix have no declaration to point at
+	if _, ok := locations["old"]; ok {
+		t.Error("expected no location for an undeclared input")
+	}
+}
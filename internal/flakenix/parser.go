@@ -0,0 +1,560 @@
+package flakenix
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	flake "notashelf.dev/flint/internal/flake"
+)
+
+type valueKind int
+
+const (
+	valueOther valueKind = iota
+	valueString
+	valueBool
+	valueAttrs
+)
+
+type value struct {
+	kind  valueKind
+	str   string
+	bool  bool
+	attrs *attrSet
+	start int
+	end   int
+}
+
+type attrName struct {
+	name  string
+	start int
+	end   int
+}
+
+type binding struct {
+	path  []attrName
+	value value
+	start int // offset of the first attribute name
+	end   int // offset just past the terminating semicolon
+}
+
+type attrSet struct {
+	open     int // offset of the opening brace
+	close    int // offset of the closing brace
+	bindings []*binding
+}
+
+type parser struct {
+	lex  lexer
+	tok  token
+	peek *token
+}
+
+func (p *parser) advance() error {
+	if p.peek != nil {
+		p.tok = *p.peek
+		p.peek = nil
+		return nil
+	}
+
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) lookahead() (token, error) {
+	if p.peek == nil {
+		tok, err := p.lex.next()
+		if err != nil {
+			return token{}, err
+		}
+		p.peek = &tok
+	}
+	return *p.peek, nil
+}
+
+func (p *parser) isPunct(text string) bool {
+	return p.tok.kind == tokPunct && p.tok.text == text
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	line, col := position(p.lex.src, p.tok.start)
+	return fmt.Errorf("%d:%d: %s", line, col, fmt.Sprintf(format, args...))
+}
+
+// Parses an attribute set whose opening brace is the current token, leaving
+// the closing brace as the current token.
+func (p *parser) parseAttrSet() (*attrSet, error) {
+	set := &attrSet{open: p.tok.start}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	for !p.isPunct("}") {
+		if p.tok.kind == tokEOF {
+			return nil, p.errorf("unexpected end of file in attribute set")
+		}
+
+		if p.tok.kind == tokIdent && p.tok.text == "inherit" {
+			if _, err := p.skipExpression(); err != nil {
+				return nil, err
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		b, err := p.parseBinding()
+		if err != nil {
+			return nil, err
+		}
+		set.bindings = append(set.bindings, b)
+	}
+
+	set.close = p.tok.start
+	return set, nil
+}
+
+// Parses `attrpath = expr;`, leaving the token after the semicolon current.
+func (p *parser) parseBinding() (*binding, error) {
+	b := &binding{start: p.tok.start}
+
+	for {
+		switch {
+		case p.tok.kind == tokIdent:
+			b.path = append(b.path, attrName{name: p.tok.text, start: p.tok.start, end: p.tok.end})
+		case p.tok.kind == tokString:
+			name := p.tok.text
+			if p.tok.interpolated {
+				name = "${...}"
+			}
+			b.path = append(b.path, attrName{name: name, start: p.tok.start, end: p.tok.end})
+		case p.isPunct("${"):
+			start := p.tok.start
+			if err := p.lex.skipInterpolation(); err != nil {
+				return nil, err
+			}
+			b.path = append(b.path, attrName{name: "${...}", start: start, end: p.lex.pos})
+		default:
+			return nil, p.errorf("expected attribute name, got %q", p.tok.text)
+		}
+
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if !p.isPunct(".") {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	if !p.isPunct("=") {
+		return nil, p.errorf("expected '=' after attribute path, got %q", p.tok.text)
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	val, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	b.value = val
+	b.end = p.tok.end
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Parses the right-hand side of a binding, leaving the terminating semicolon
+// as the current token. Only literal strings, booleans and attribute sets are
+// understood; anything else is skipped and recorded as an opaque value.
+func (p *parser) parseValue() (value, error) {
+	val := value{start: p.tok.start}
+
+	next, err := p.lookahead()
+	if err != nil {
+		return val, err
+	}
+	terminated := next.kind == tokPunct && next.text == ";"
+
+	switch {
+	case p.tok.kind == tokString && !p.tok.interpolated && terminated:
+		val.kind = valueString
+		val.str = p.tok.text
+		val.end = p.tok.end
+		return val, p.advance()
+
+	case p.tok.kind == tokIdent && (p.tok.text == "true" || p.tok.text == "false") && terminated:
+		val.kind = valueBool
+		val.bool = p.tok.text == "true"
+		val.end = p.tok.end
+		return val, p.advance()
+
+	case p.isPunct("{"):
+		// Function formals such as `{ self, ... }: ...` also start with a
+		// brace, so fall back to skipping if this is not an attribute set.
+		saved := *p
+		attrs, err := p.parseAttrSet()
+		if err != nil {
+			*p = saved
+			end, err := p.skipExpression()
+			val.end = end
+			return val, err
+		}
+		val.end = p.tok.end
+		if err := p.advance(); err != nil {
+			return val, err
+		}
+		if p.isPunct(";") {
+			val.kind = valueAttrs
+			val.attrs = attrs
+			return val, nil
+		}
+
+		// Something like `{ ... } // foo`; not a plain attribute set
+		end, err := p.skipExpression()
+		val.end = end
+		return val, err
+	}
+
+	end, err := p.skipExpression()
+	val.end = end
+	return val, err
+}
+
+// Skips tokens up to the semicolon that terminates the current expression,
+// returning the end offset of the last skipped token. let/in, with and assert
+// introduce semicolons of their own and are tracked like brackets.
+func (p *parser) skipExpression() (int, error) {
+	var stack []string
+	end := p.tok.start
+
+	for {
+		tok := p.tok
+		switch {
+		case tok.kind == tokEOF:
+			return end, p.errorf("unexpected end of file in expression")
+
+		case tok.kind == tokPunct && tok.text == ";":
+			if len(stack) == 0 {
+				return end, nil
+			}
+			if top := stack[len(stack)-1]; top == "with" || top == "assert" {
+				stack = stack[:len(stack)-1]
+			}
+
+		case tok.kind == tokPunct && (tok.text == "{" || tok.text == "${"):
+			stack = append(stack, "}")
+		case tok.kind == tokPunct && tok.text == "[":
+			stack = append(stack, "]")
+		case tok.kind == tokPunct && tok.text == "(":
+			stack = append(stack, ")")
+
+		case tok.kind == tokPunct && (tok.text == "}" || tok.text == "]" || tok.text == ")"):
+			if len(stack) == 0 || stack[len(stack)-1] != tok.text {
+				return end, p.errorf("unbalanced %q", tok.text)
+			}
+			stack = stack[:len(stack)-1]
+
+		case tok.kind == tokIdent && tok.text == "let":
+			stack = append(stack, "in")
+		case tok.kind == tokIdent && tok.text == "in":
+			if len(stack) > 0 && stack[len(stack)-1] == "in" {
+				stack = stack[:len(stack)-1]
+			}
+		case tok.kind == tokIdent && (tok.text == "with" || tok.text == "assert"):
+			stack = append(stack, tok.text)
+		}
+
+		end = tok.end
+		if err := p.advance(); err != nil {
+			return end, err
+		}
+	}
+}
+
+// Returns the 1-based line and column of a byte offset.
+func position(src []byte, offset int) (int, int) {
+	line, col := 1, 1
+	for i := 0; i < offset && i < len(src); i++ {
+		if src[i] == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
+
+// A position in flake.nix. Line and Column are 1-based; Offset is the byte
+// offset into the file.
+type Pos struct {
+	Line   int
+	Column int
+	Offset int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Returns the location of a position in this file.
+func (f *File) Location(pos Pos) flake.Location {
+	return flake.Location{File: f.Path, Line: pos.Line, Column: pos.Column}
+}
+
+// A follows declaration found in flake.nix, such as
+// inputs.home-manager.inputs.nixpkgs.follows = "nixpkgs". Path is relative to
+// the input it is declared on.
+type Follows struct {
+	Path   []string
+	Target string
+	Pos    Pos
+}
+
+// An input declared in the inputs attribute set of a flake.nix.
+type Input struct {
+	Name    string
+	Pos     Pos
+	URL     string
+	Follows string
+	Flake   *bool
+
+	// Attribute-style references such as type, owner, repo and ref
+	Attrs map[string]string
+
+	// Follows declarations for this input's own inputs
+	Overrides []Follows
+
+	// Declarations that could not be understood statically
+	Dynamic bool
+
+	bindings   []*binding
+	containers []*attrSet // attribute set each binding was declared in
+	nameEnds   []int      // end offsets of the input name in each binding path
+	block      *attrSet   // set when declared as `name = { ... };`
+}
+
+// A parsed flake.nix. Only the inputs are extracted; everything else is
+// preserved verbatim so that edits can be applied to the original source.
+type File struct {
+	Path   string
+	Src    []byte
+	Inputs []*Input
+
+	top       *attrSet
+	inputsSet *attrSet // set when inputs are declared as `inputs = { ... };`
+	lastInput *binding // last top-level binding declaring inputs
+}
+
+// Looks up a declared input by name.
+func (f *File) Input(name string) *Input {
+	for _, input := range f.Inputs {
+		if input.Name == name {
+			return input
+		}
+	}
+	return nil
+}
+
+func (f *File) pos(offset int) Pos {
+	line, col := position(f.Src, offset)
+	return Pos{Line: line, Column: col, Offset: offset}
+}
+
+// Parses the source of a flake.nix. The top-level expression must be an
+// attribute set, which is the case for every flake Nix itself accepts.
+func Parse(path string, src []byte) (*File, error) {
+	p := &parser{lex: lexer{src: src}}
+	if err := p.advance(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if !p.isPunct("{") {
+		return nil, fmt.Errorf("%s: top-level expression is not an attribute set", path)
+	}
+
+	top, err := p.parseAttrSet()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	file := &File{Path: path, Src: src, top: top}
+	for _, b := range top.bindings {
+		if b.path[0].name != "inputs" {
+			continue
+		}
+		file.lastInput = b
+
+		if len(b.path) > 1 {
+			file.addInputBinding(b, top, 1)
+			continue
+		}
+
+		if b.value.kind != valueAttrs {
+			return nil, fmt.Errorf("%s: %s: inputs is not a literal attribute set", path, file.pos(b.start))
+		}
+		file.inputsSet = b.value.attrs
+		for _, inner := range b.value.attrs.bindings {
+			file.addInputBinding(inner, b.value.attrs, 0)
+		}
+	}
+
+	sort.SliceStable(file.Inputs, func(i, j int) bool {
+		return file.Inputs[i].Pos.Offset < file.Inputs[j].Pos.Offset
+	})
+
+	return file, nil
+}
+
+// Records a binding whose path element at index names an input.
+func (f *File) addInputBinding(b *binding, container *attrSet, index int) {
+	nameElem := b.path[index]
+	input := f.Input(nameElem.name)
+	if input == nil {
+		input = &Input{
+			Name:  nameElem.name,
+			Pos:   f.pos(nameElem.start),
+			Attrs: make(map[string]string),
+		}
+		f.Inputs = append(f.Inputs, input)
+	}
+
+	input.bindings = append(input.bindings, b)
+	input.containers = append(input.containers, container)
+	input.nameEnds = append(input.nameEnds, nameElem.end)
+
+	rest := attrPath(b.path[index+1:])
+	if len(rest) == 0 && b.value.kind == valueAttrs {
+		input.block = b.value.attrs
+	}
+	f.addInputAttr(input, rest, b.value, b.path[len(b.path)-1].start)
+}
+
+// Records the value of an attribute path relative to an input, descending
+// into attribute sets so that nested and dotted forms end up the same.
+func (f *File) addInputAttr(input *Input, path []string, val value, start int) {
+	if val.kind == valueAttrs {
+		for _, inner := range val.attrs.bindings {
+			f.addInputAttr(input, append(slices.Clone(path), attrPath(inner.path)...), inner.value, inner.start)
+		}
+		return
+	}
+
+	if len(path) == 0 {
+		input.Dynamic = true
+		return
+	}
+
+	switch {
+	case len(path) == 1 && path[0] == "url" && val.kind == valueString:
+		input.URL = val.str
+	case len(path) == 1 && path[0] == "follows" && val.kind == valueString:
+		input.Follows = val.str
+	case len(path) == 1 && path[0] == "flake" && val.kind == valueBool:
+		flag := val.bool
+		input.Flake = &flag
+	case len(path) == 1 && val.kind == valueString:
+		input.Attrs[path[0]] = val.str
+	case len(path) >= 3 && path[0] == "inputs" && path[len(path)-1] == "follows" && val.kind == valueString:
+		if overridePath, ok := overridePath(path[:len(path)-1]); ok {
+			input.Overrides = append(input.Overrides, Follows{
+				Path:   overridePath,
+				Target: val.str,
+				Pos:    f.pos(start),
+			})
+		}
+	default:
+		if val.kind == valueOther {
+			input.Dynamic = true
+		}
+	}
+}
+
+// Converts inputs.a.inputs.b into [a b].
+func overridePath(path []string) ([]string, bool) {
+	if len(path)%2 != 0 {
+		return nil, false
+	}
+
+	var result []string
+	for i := 0; i < len(path); i += 2 {
+		if path[i] != "inputs" {
+			return nil, false
+		}
+		result = append(result, path[i+1])
+	}
+	return result, true
+}
+
+func attrPath(names []attrName) []string {
+	path := make([]string, len(names))
+	for i, n := range names {
+		path[i] = n.name
+	}
+	return path
+}
+
+// Looks up a follows override on this input by its relative path.
+func (i *Input) Override(path []string) (Follows, bool) {
+	for _, o := range i.Overrides {
+		if slices.Equal(o.Path, path) {
+			return o, true
+		}
+	}
+	return Follows{}, false
+}
+
+// Returns the flake reference the input was declared with, combining its url
+// with any attribute-style declarations such as type, owner, repo or dir.
+func (i *Input) Original() (flake.Original, error) {
+	var original flake.Original
+
+	if i.URL != "" {
+		parsed, err := flake.ParseRef(i.URL)
+		if err != nil {
+			return original, err
+		}
+		original = parsed
+	} else if i.Attrs["type"] == "" {
+		return original, fmt.Errorf("input %q declares neither url nor type", i.Name)
+	}
+
+	for key, v := range i.Attrs {
+		switch key {
+		case "type":
+			original.Type = v
+		case "owner":
+			original.Owner = v
+		case "repo":
+			original.Repo = v
+		case "ref":
+			original.Ref = v
+		case "rev":
+			original.Rev = v
+		case "host":
+			original.Host = v
+		case "dir":
+			original.Dir = v
+		case "url":
+			original.URL = v
+		case "path":
+			original.Path = v
+		case "id":
+			original.ID = v
+		}
+	}
+
+	return original, nil
+}
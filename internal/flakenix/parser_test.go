@@ -0,0 +1,144 @@
+package flakenix
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const nestedFlake = `{
+  description = "An example flake";
+
+  inputs = {
+    # Main package set
+    nixpkgs.url = "github:NixOS/nixpkgs/nixos-unstable";
+
+    home-manager = {
+      url = "github:nix-community/home-manager";
+      inputs.nixpkgs.follows = "nixpkgs";
+    };
+
+    "my-input" = {
+      type = "github";
+      owner = "foo";
+      repo = "bar";
+      flake = false;
+    };
+
+    devshell.url = "github:numtide/devshell";
+    devshell.inputs = {
+      systems.inputs.nixpkgs.follows = "nixpkgs";
+    };
+  };
+
+  outputs = { self, nixpkgs, ... }@inputs: let
+    inherit (nixpkgs) lib;
+    greeting = ''
+      Hello ''${world} ${lib.version}
+    '';
+  in with lib; {
+    packages = { default = "${greeting}"; };
+  };
+}
+`
+
+func TestParse_NestedInputs(t *testing.T) {
+	file, err := Parse("flake.nix", []byte(nestedFlake))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	names := make([]string, 0, len(file.Inputs))
+	for _, input := range file.Inputs {
+		names = append(names, input.Name)
+	}
+	if !slices.Equal(names, []string{"nixpkgs", "home-manager", "my-input", "devshell"}) {
+		t.Fatalf("unexpected inputs: %v", names)
+	}
+
+	nixpkgs := file.Input("nixpkgs")
+	if nixpkgs.URL != "github:NixOS/nixpkgs/nixos-unstable" {
+		t.Errorf("unexpected nixpkgs url: %s", nixpkgs.URL)
+	}
+	if nixpkgs.Pos.Line != 6 || nixpkgs.Pos.Column != 5 {
+		t.Errorf("unexpected nixpkgs position: %s", nixpkgs.Pos)
+	}
+
+	hm := file.Input("home-manager")
+	if follows, ok := hm.Override([]string{"nixpkgs"}); !ok || follows.Target != "nixpkgs" {
+		t.Errorf("expected home-manager to follow nixpkgs, got %+v", hm.Overrides)
+	}
+
+	custom := file.Input("my-input")
+	if custom.Attrs["owner"] != "foo" || custom.Attrs["repo"] != "bar" || custom.Attrs["type"] != "github" {
+		t.Errorf("unexpected attributes: %v", custom.Attrs)
+	}
+	if custom.Flake == nil || *custom.Flake {
+		t.Errorf("expected flake = false, got %v", custom.Flake)
+	}
+
+	devshell := file.Input("devshell")
+	if follows, ok := devshell.Override([]string{"systems", "nixpkgs"}); !ok || follows.Target != "nixpkgs" {
+		t.Errorf("expected devshell/systems to follow nixpkgs, got %+v", devshell.Overrides)
+	}
+}
+
+func TestParse_FlatInputs(t *testing.T) {
+	src := `{
+  inputs.nixpkgs.url = "github:NixOS/nixpkgs";
+  inputs.utils.url = "github:numtide/flake-utils";
+  inputs.utils.inputs.nixpkgs.follows = "nixpkgs";
+  /* inputs.ignored.url = "github:nope/nope"; */
+  outputs = inputs: with inputs; assert true; { };
+}`
+
+	file, err := Parse("flake.nix", []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(file.Inputs) != 2 {
+		t.Fatalf("expected 2 inputs, got %d", len(file.Inputs))
+	}
+
+	utils := file.Input("utils")
+	if utils.URL != "github:numtide/flake-utils" {
+		t.Errorf("unexpected utils url: %s", utils.URL)
+	}
+	if follows, ok := utils.Override([]string{"nixpkgs"}); !ok || follows.Pos.Line != 4 {
+		t.Errorf("expected utils follows on line 4, got %+v", utils.Overrides)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{
+			name:     "not an attribute set",
+			src:      `let x = 1; in { }`,
+			expected: "not an attribute set",
+		},
+		{
+			name:     "unterminated string",
+			src:      `{ inputs.nixpkgs.url = "github:NixOS/nixpkgs; }`,
+			expected: "unterminated string",
+		},
+		{
+			name:     "dynamic inputs",
+			src:      `{ inputs = import ./inputs.nix; outputs = _: { }; }`,
+			expected: "not a literal attribute set",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse("flake.nix", []byte(tc.src))
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("expected error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	advisory "notashelf.dev/flint/internal/advisory"
+	flake "notashelf.dev/flint/internal/flake"
+)
+
+// Validates the output format of the advisory report, which can also be
+// rendered as SARIF.
+func ValidateAdvisoryFormat(format string) error {
+	return validateFormat(format, []string{"github", "gitlab", "json", "plain", "pretty", "sarif"})
+}
+
+// Prints the locked inputs affected by advisories. Options.Locations maps
+// lock nodes to the flake.nix declarations pulling them in.
+func PrintAdvisories(matches []advisory.Match, advisories []advisory.Advisory, options Options) error {
+	// Validate output format first, even in quiet mode
+	if err := ValidateAdvisoryFormat(options.OutputFormat); err != nil {
+		return err
+	}
+
+	if options.Quiet {
+		return nil
+	}
+
+	switch options.OutputFormat {
+	case "json":
+		if matches == nil {
+			matches = []advisory.Match{}
+		}
+
+		jsonData, err := json.MarshalIndent(map[string]any{"matches": matches}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling JSON output: %w", err)
+		}
+
+		fmt.Println(string(jsonData))
+	case "plain":
+		printPlainAdvisories(matches)
+	case "github":
+		printGitHubAnnotations(advisoryFindings(matches, options))
+	case "gitlab":
+		return printGitLabReport(advisoryFindings(matches, options))
+	case "sarif":
+		return printSARIFReport(advisoryFindings(matches, options), advisoryRules(advisories))
+	default:
+		printFormattedAdvisories(matches, advisories)
+	}
+	return nil
+}
+
+// Returns the severity findings for an advisory are reported with.
+func advisorySeverity(severity advisory.Severity) Severity {
+	switch severity {
+	case advisory.SeverityHigh, advisory.SeverityCritical:
+		return SeverityError
+	case advisory.SeverityMedium:
+		return SeverityWarning
+	default:
+		return SeverityNotice
+	}
+}
+
+// Scores for each severity, in the middle of the matching CVSS band.
+var securitySeverities = map[advisory.Severity]string{
+	advisory.SeverityLow:      "2.0",
+	advisory.SeverityMedium:   "5.5",
+	advisory.SeverityHigh:     "8.0",
+	advisory.SeverityCritical: "9.5",
+}
+
+// Describes every loaded advisory as a rule, whether anything matched it or
+// not, so that code scanning can tell fixed findings from removed rules.
+func advisoryRules(advisories []advisory.Advisory) []Rule {
+	rules := make([]Rule, 0, len(advisories))
+	for _, a := range advisories {
+		rules = append(rules, Rule{
+			ID:               a.ID,
+			ShortDescription: a.Summary,
+			FullDescription:  a.Description,
+			HelpURI:          a.URL,
+			Severity:         advisorySeverity(a.Severity),
+			SecuritySeverity: securitySeverities[a.Severity],
+		})
+	}
+	return rules
+}
+
+// Describes the input a match is for, e.g. "home-manager/nixpkgs", falling
+// back to the lock node for nodes nothing refers to anymore.
+func matchInput(match advisory.Match) string {
+	if len(match.Path) == 0 {
+		return match.Node
+	}
+	return strings.Join(match.Path, "/")
+}
+
+// Builds a finding per match, reported under the advisory's ID and pointing
+// at the declaration of the root input pulling the affected node in.
+func advisoryFindings(matches []advisory.Match, options Options) []Finding {
+	findings := make([]Finding, 0, len(matches))
+	for _, match := range matches {
+		location, ok := options.Locations[match.Node]
+		if !ok {
+			location = flake.Location{File: options.LockPath}
+		}
+
+		message := fmt.Sprintf("%s is locked to %s, affected by %s: %s", matchInput(match), match.Reason, match.Advisory.ID, match.Advisory.Summary)
+		if match.Advisory.URL != "" {
+			message += " (" + match.Advisory.URL + ")"
+		}
+		findings = append(findings, Finding{
+			Rule:     match.Advisory.ID,
+			Title:    match.Advisory.Summary,
+			Severity: advisorySeverity(match.Advisory.Severity),
+			Message:  message,
+			Location: location,
+		})
+	}
+	return findings
+}
+
+func printFormattedAdvisories(matches []advisory.Match, advisories []advisory.Advisory) {
+	s := newPrettyStyles()
+
+	fmt.Println(s.header.Render("🛡 Flint - Advisory Report"))
+	fmt.Println()
+
+	if len(matches) == 0 {
+		fmt.Println(s.success.Render(fmt.Sprintf("%s No locked inputs are affected by the %d known advisories", s.successIcon, len(advisories))))
+		return
+	}
+
+	fmt.Println(s.error.Render(fmt.Sprintf("%s Found %d advisory matches in locked inputs", s.errorIcon, len(matches))))
+	fmt.Println()
+
+	for i, match := range matches {
+		a := match.Advisory
+		icon, style := s.warningIcon, s.warning
+		if advisorySeverity(a.Severity) == SeverityError {
+			icon, style = s.errorIcon, s.error
+		}
+
+		fmt.Printf("%d. %s\n", i+1, s.name.Render(matchInput(match)))
+		fmt.Printf("   %s %s\n", icon, style.Render(fmt.Sprintf("%s (%s): %s", a.ID, a.Severity, a.Summary)))
+		fmt.Printf("   %s %s\n", s.dim.Render("├─"), s.bold.Render("Locked:  ")+s.dim.Render(match.Reason))
+		if a.Description != "" {
+			fmt.Printf("   %s %s\n", s.dim.Render("├─"), s.dim.Render(a.Description))
+		}
+		if a.URL != "" {
+			fmt.Printf("   %s %s\n", s.dim.Render("├─"), s.url.Render(a.URL))
+		}
+		fmt.Printf("   %s %s\n", s.dim.Render("└─"), s.dim.Render("Node: "+match.Node))
+		fmt.Println()
+	}
+
+	fmt.Println(s.dim.Render("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"))
+	fmt.Println(s.info.Render(fmt.Sprintf("%s Update the affected inputs, or override them with follows, past the affected revisions", s.infoIcon)))
+}
+
+func printPlainAdvisories(matches []advisory.Match) {
+	s := newPlainStyles()
+
+	fmt.Println(s.title.Render("Advisory Report"))
+
+	if len(matches) == 0 {
+		fmt.Println(s.status.Render("No locked inputs are affected by known advisories."))
+		return
+	}
+
+	for _, match := range matches {
+		fmt.Println(s.error.Render(fmt.Sprintf("%s: %s (%s): %s; locked to %s",
+			matchInput(match), match.Advisory.ID, match.Advisory.Severity, match.Advisory.Summary, match.Reason)))
+	}
+}
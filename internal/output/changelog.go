@@ -0,0 +1,218 @@
+package output
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+
+	flake "notashelf.dev/flint/internal/flake"
+)
+
+// Describes the size of a changelog, e.g. "42 commits, 2 releases".
+func changelogSummary(changelog *flake.Changelog) string {
+	parts := []string{plural(changelog.TotalCommits, "commit")}
+	if len(changelog.Releases) > 0 {
+		parts = append(parts, plural(len(changelog.Releases), "release"))
+	}
+	if changelog.ReleasesError != "" {
+		parts = append(parts, "releases unavailable")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Lays out a changelog as plain text lines for the pretty and plain reports:
+// the commits, newest first, followed by the releases and their notes.
+func formatChangelog(changelog *flake.Changelog) []string {
+	var lines []string
+	for _, commit := range changelog.Commits {
+		line := shortCommit(commit.Rev) + " " + commit.Summary
+		if commit.Author != "" {
+			line += " (" + commit.Author + ")"
+		}
+		lines = append(lines, line)
+	}
+	if more := changelog.TotalCommits - len(changelog.Commits); more > 0 {
+		lines = append(lines, "… and "+moreCommits(more))
+	}
+
+	for _, release := range changelog.Releases {
+		title := "Release " + release.Tag
+		if release.Name != "" && release.Name != release.Tag {
+			title += ": " + release.Name
+		}
+		lines = append(lines, title+formatDate(release.Date))
+		for _, note := range strings.Split(release.Notes, "\n") {
+			if note = strings.TrimRight(note, " \t"); note != "" {
+				lines = append(lines, "  "+note)
+			}
+		}
+	}
+	if changelog.ReleasesError != "" {
+		lines = append(lines, "Releases could not be listed: "+changelog.ReleasesError)
+	}
+	return lines
+}
+
+// Describes the commits a truncated changelog leaves out.
+func moreCommits(n int) string {
+	if n == 1 {
+		return "1 more commit"
+	}
+	return fmt.Sprintf("%d more commits", n)
+}
+
+// Abbreviates a commit hash the way forges do.
+func shortCommit(rev string) string {
+	if len(rev) > 7 {
+		return rev[:7]
+	}
+	return rev
+}
+
+// Renders the update report as markdown for pull request descriptions: a
+// table of the available updates, followed by the changelog of each one in a
+// collapsible section.
+func formatMarkdownUpdates(results flake.UpdateResults) string {
+	var b strings.Builder
+	b.WriteString("## Flake input updates\n\n")
+
+	var updates, failed []flake.UpdateStatus
+	for _, update := range results.Updates {
+		switch {
+		case update.Error != "" || changesUnknown(update):
+			failed = append(failed, update)
+		case update.IsUpdate:
+			updates = append(updates, update)
+		}
+	}
+
+	switch {
+	case len(updates) == 0 && len(failed) > 0:
+		b.WriteString("No updates found among the inputs that could be checked.\n")
+	case len(updates) == 0:
+		b.WriteString("All inputs are up to date.\n")
+	default:
+		b.WriteString("| Input | Current | Latest | Behind |\n")
+		b.WriteString("| --- | --- | --- | --- |\n")
+		for _, update := range updates {
+			latest := "`" + latestVersion(update) + "`" + formatDate(update.LatestDate)
+			if update.LatestRef != "" {
+				latest = "`" + update.LatestRef + "` " + latest
+			}
+			behind := formatLag(update)
+			if update.CompareURL != "" {
+				behind = fmt.Sprintf("[%s](%s)", cmp.Or(behind, "compare"), update.CompareURL)
+			}
+			fmt.Fprintf(&b, "| `%s` | `%s`%s | %s | %s |\n", update.InputName,
+				currentVersion(update), formatDate(update.CurrentDate), latest, escapeMarkdownTable(behind))
+		}
+	}
+
+	for _, update := range updates {
+		if update.Changelog == nil {
+			continue
+		}
+		changelog := update.Changelog
+
+		fmt.Fprintf(&b, "\n<details>\n<summary><code>%s</code>: %s</summary>\n\n", update.InputName, changelogSummary(changelog))
+		for _, commit := range changelog.Commits {
+			rev := "`" + shortCommit(commit.Rev) + "`"
+			if commit.URL != "" {
+				rev = fmt.Sprintf("[%s](%s)", rev, commit.URL)
+			}
+			fmt.Fprintf(&b, "- %s %s", rev, escapeMarkdown(commit.Summary))
+			if commit.Author != "" {
+				fmt.Fprintf(&b, " (%s)", escapeMarkdown(commit.Author))
+			}
+			b.WriteString("\n")
+		}
+		if more := changelog.TotalCommits - len(changelog.Commits); more > 0 {
+			if update.CompareURL != "" {
+				fmt.Fprintf(&b, "- … and [%s](%s)\n", moreCommits(more), update.CompareURL)
+			} else {
+				fmt.Fprintf(&b, "- … and %s\n", moreCommits(more))
+			}
+		}
+
+		for _, release := range changelog.Releases {
+			title := release.Tag
+			if release.URL != "" {
+				title = fmt.Sprintf("[%s](%s)", release.Tag, release.URL)
+			}
+			if release.Name != "" && release.Name != release.Tag {
+				title += ": " + escapeMarkdown(release.Name)
+			}
+			fmt.Fprintf(&b, "\n#### %s\n", title)
+
+			// Release notes are markdown already; quoting keeps their
+			// headings from taking over the report
+			if release.Notes != "" {
+				b.WriteString("\n")
+				for _, line := range strings.Split(release.Notes, "\n") {
+					b.WriteString(strings.TrimRight("> "+line, " ") + "\n")
+				}
+			}
+		}
+		if changelog.ReleasesError != "" {
+			fmt.Fprintf(&b, "\n*Releases could not be listed: %s*\n", escapeMarkdown(changelog.ReleasesError))
+		}
+		b.WriteString("\n</details>\n")
+	}
+
+	var lost []flake.UpdateStatus
+	for _, update := range results.Updates {
+		if update.Reachability != "" {
+			lost = append(lost, update)
+		}
+	}
+	if len(lost) > 0 {
+		b.WriteString("\n### Locked revisions orphaned or gone upstream\n\n")
+		for _, update := range lost {
+			fmt.Fprintf(&b, "- `%s`: %s\n", update.InputName, escapeMarkdown(formatReachability(update)))
+		}
+	}
+
+	var moved []flake.UpdateStatus
+	for _, update := range results.Updates {
+		if update.Repository != nil {
+			moved = append(moved, update)
+		}
+	}
+	if len(moved) > 0 {
+		b.WriteString("\n### Upstream repositories\n\n")
+		for _, update := range moved {
+			for _, note := range repositoryNotes(update) {
+				fmt.Fprintf(&b, "- `%s`: %s\n", update.InputName, escapeMarkdown(note))
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		b.WriteString("\n### Not checked\n\n")
+		for _, update := range failed {
+			reason := update.Error
+			if reason == "" {
+				reason = "could not tell whether it changed upstream. " + unknownChangesHint
+			}
+			fmt.Fprintf(&b, "- `%s`: %s\n", update.InputName, escapeMarkdown(reason))
+		}
+	}
+
+	return b.String()
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`,
+)
+
+// Escapes text from upstream, such as commit summaries, so that it shows up
+// as written.
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// Escapes the pipes that would end a table cell early.
+func escapeMarkdownTable(text string) string {
+	return strings.ReplaceAll(text, "|", `\|`)
+}
@@ -0,0 +1,92 @@
+package output
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	flake "notashelf.dev/flint/internal/flake"
+)
+
+var changelogUpdate = flake.UpdateStatus{
+	InputName:  "tool",
+	CurrentRev: "1111111111111111111111111111111111111111",
+	LatestRev:  "2222222222222222222222222222222222222222",
+	Ref:        "v1.0.0",
+	LatestRef:  "v1.1.0",
+	IsUpdate:   true,
+	CompareURL: "https://github.com/owner/tool/compare/1111111...2222222",
+	Changelog: &flake.Changelog{
+		TotalCommits: 3,
+		Commits: []flake.Commit{
+			{Rev: "2222222222222222222222222222222222222222", Summary: "Fix <html> in *names* | tables", Author: "Alice", URL: "https://github.com/owner/tool/commit/2222222"},
+			{Rev: "1234567890", Summary: "Add feature"},
+		},
+		Releases: []flake.Release{{Tag: "v1.1.0", Name: "Faster", Notes: "## Changes\n\n- Speed", URL: "https://github.com/owner/tool/releases/v1.1.0"}},
+	},
+}
+
+func TestFormatChangelog(t *testing.T) {
+	expected := []string{
+		"2222222 Fix <html> in *names* | tables (Alice)",
+		"1234567 Add feature",
+		"… and 1 more commit",
+		"Release v1.1.0: Faster",
+		"  ## Changes",
+		"  - Speed",
+	}
+	if lines := formatChangelog(changelogUpdate.Changelog); !slices.Equal(lines, expected) {
+		t.Errorf("expected %q, got %q", expected, lines)
+	}
+	if summary := changelogSummary(changelogUpdate.Changelog); summary != "3 commits, 1 release" {
+		t.Errorf("unexpected summary %q", summary)
+	}
+	// Releases that could not be listed are not silently left out
+	missing := &flake.Changelog{TotalCommits: 1, Commits: changelogUpdate.Changelog.Commits[:1], ReleasesError: "404 Not Found"}
+	if lines := formatChangelog(missing); lines[len(lines)-1] != "Releases could not be listed: 404 Not Found" {
+		t.Errorf("expected the missing releases to be noted, got %q", lines)
+	}
+	if summary := changelogSummary(missing); summary != "1 commit, releases unavailable" {
+		t.Errorf("unexpected summary %q", summary)
+	}
+	update := changelogUpdate
+	update.Changelog = missing
+	if markdown := formatMarkdownUpdates(flake.UpdateResults{Updates: []flake.UpdateStatus{update}}); !strings.Contains(markdown, "*Releases could not be listed: 404 Not Found*") {
+		t.Errorf("expected the markdown report to note the missing releases, got:\n%s", markdown)
+	}
+}
+
+func TestFormatMarkdownUpdates(t *testing.T) {
+	results := flake.UpdateResults{Updates: []flake.UpdateStatus{
+		changelogUpdate,
+		{InputName: "broken", Error: "not found"},
+		{InputName: "current", CurrentRev: "abc", LatestRev: "abc"},
+	}}
+
+	markdown := formatMarkdownUpdates(results)
+	for _, expected := range []string{
+		"| `tool` | `11111111...` | `v1.1.0` `22222222...` | [compare](https://github.com/owner/tool/compare/1111111...2222222) |\n",
+		"<summary><code>tool</code>: 3 commits, 1 release</summary>",
+		"- [`2222222`](https://github.com/owner/tool/commit/2222222) Fix \\<html\\> in \\*names\\* \\| tables (Alice)\n",
+		"- … and [1 more commit](https://github.com/owner/tool/compare/1111111...2222222)\n",
+		"#### [v1.1.0](https://github.com/owner/tool/releases/v1.1.0): Faster\n\n> ## Changes\n>\n> - Speed\n",
+		"- `broken`: not found\n",
+	} {
+		if !strings.Contains(markdown, expected) {
+			t.Errorf("expected the report to contain %q, got:\n%s", expected, markdown)
+		}
+	}
+	if strings.Contains(markdown, "current") {
+		t.Errorf("expected inputs without updates to be left out, got:\n%s", markdown)
+	}
+
+	if markdown := formatMarkdownUpdates(flake.UpdateResults{}); !strings.Contains(markdown, "All inputs are up to date.") {
+		t.Errorf("unexpected report without updates:\n%s", markdown)
+	}
+	// Inputs that could not be checked for changes are not up to date
+	unknown := flake.UpdateResults{Updates: []flake.UpdateStatus{{InputName: "src", Unchecked: []string{"changes"}}}}
+	markdown = formatMarkdownUpdates(unknown)
+	if strings.Contains(markdown, "up to date") || !strings.Contains(markdown, "- `src`: could not tell whether it changed upstream") {
+		t.Errorf("unexpected report with an unchecked input:\n%s", markdown)
+	}
+}
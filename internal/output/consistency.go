@@ -0,0 +1,109 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+
+	flakenix "notashelf.dev/flint/internal/flakenix"
+)
+
+func PrintMismatches(mismatches []flakenix.Mismatch, flakePath string, options Options) error {
+	// Validate output format first, even in quiet mode
+	if err := ValidateOutputFormat(options.OutputFormat); err != nil {
+		return err
+	}
+
+	if options.Quiet {
+		return nil
+	}
+
+	if options.OutputFormat == "json" {
+		if mismatches == nil {
+			mismatches = []flakenix.Mismatch{}
+		}
+
+		jsonData, err := json.MarshalIndent(map[string]any{"mismatches": mismatches}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling JSON output: %w", err)
+		}
+
+		fmt.Println(string(jsonData))
+		return nil
+	}
+
+	switch options.OutputFormat {
+	case "plain":
+		printPlainMismatches(mismatches, flakePath)
+	case "github":
+		printGitHubAnnotations(mismatchFindings(mismatches))
+	case "gitlab":
+		return printGitLabReport(mismatchFindings(mismatches))
+	default:
+		printFormattedMismatches(mismatches, flakePath, options)
+	}
+	return nil
+}
+
+func printFormattedMismatches(mismatches []flakenix.Mismatch, flakePath string, options Options) {
+	s := newPrettyStyles()
+
+	fmt.Println(s.header.Render("🔍 Flint - Lockfile Consistency Report"))
+	fmt.Println()
+
+	if len(mismatches) == 0 {
+		fmt.Println(s.success.Render(fmt.Sprintf("%s flake.lock is consistent with %s", s.successIcon, flakePath)))
+		return
+	}
+
+	fmt.Println(s.warning.Render(fmt.Sprintf("%s Found %d inconsistencies between %s and the lockfile",
+		s.warningIcon, len(mismatches), flakePath)))
+	fmt.Println()
+
+	for i, mismatch := range mismatches {
+		fmt.Printf("%d. %s\n", i+1, s.name.Render(mismatch.Input))
+		fmt.Printf("   %s %s\n", s.errorIcon, s.error.Render(mismatch.Message))
+		if mismatch.Declared != "" {
+			fmt.Printf("   %s %s\n", s.dim.Render("├─"), s.bold.Render("Declared: ")+s.url.Render(mismatch.Declared))
+		}
+		if mismatch.Locked != "" {
+			fmt.Printf("   %s %s\n", s.dim.Render("├─"), s.bold.Render("Locked:   ")+s.dim.Render(mismatch.Locked))
+		}
+		if options.Verbose {
+			fmt.Printf("   %s %s\n", s.dim.Render("├─"), s.dim.Render("Kind: "+string(mismatch.Kind)))
+		}
+		fmt.Printf("   %s %s\n", s.dim.Render("└─"), s.dim.Render(mismatch.Location.String()))
+		fmt.Println()
+	}
+
+	fmt.Println(s.dim.Render("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━"))
+	fmt.Println(s.info.Render(fmt.Sprintf("%s Run 'nix flake lock' to bring the lockfile in line with %s", s.infoIcon, flakePath)))
+}
+
+func mismatchFindings(mismatches []flakenix.Mismatch) []Finding {
+	findings := make([]Finding, 0, len(mismatches))
+	for _, mismatch := range mismatches {
+		findings = append(findings, Finding{
+			Rule:     "lock-" + string(mismatch.Kind),
+			Title:    "Stale lockfile",
+			Severity: SeverityError,
+			Message:  mismatch.Message,
+			Location: mismatch.Location,
+		})
+	}
+	return findings
+}
+
+func printPlainMismatches(mismatches []flakenix.Mismatch, flakePath string) {
+	s := newPlainStyles()
+
+	fmt.Println(s.title.Render("Lockfile Consistency Report"))
+
+	if len(mismatches) == 0 {
+		fmt.Println(s.status.Render("flake.lock is consistent with flake.nix."))
+		return
+	}
+
+	for _, mismatch := range mismatches {
+		fmt.Println(s.error.Render(fmt.Sprintf("%s: %s: %s", mismatch.Location, mismatch.Kind, mismatch.Message)))
+	}
+}
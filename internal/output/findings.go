@@ -0,0 +1,431 @@
+package output
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	flake "notashelf.dev/flint/internal/flake"
+)
+
+type Severity string
+
+const (
+	SeverityNotice  Severity = "notice"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// A single problem reported in the annotation formats, pointing at the file
+// and line where it should be fixed.
+type Finding struct {
+	Rule     string
+	Title    string
+	Severity Severity
+	Message  string
+	Location flake.Location
+}
+
+// Escapes data for GitHub workflow commands.
+func escapeGitHubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// Prints findings as GitHub Actions workflow commands, which show up as
+// annotations on the referenced lines of the pull request diff.
+func printGitHubAnnotations(findings []Finding) {
+	for _, finding := range findings {
+		var props []string
+		if finding.Location.File != "" {
+			props = append(props, "file="+escapeGitHubProperty(finding.Location.File))
+		}
+		if finding.Location.Line > 0 {
+			props = append(props, fmt.Sprintf("line=%d", finding.Location.Line))
+		}
+		if finding.Location.Column > 0 {
+			props = append(props, fmt.Sprintf("col=%d", finding.Location.Column))
+		}
+		if finding.Title != "" {
+			props = append(props, "title="+escapeGitHubProperty(finding.Title))
+		}
+
+		fmt.Printf("::%s %s::%s\n", finding.Severity, strings.Join(props, ","), escapeGitHubData(finding.Message))
+	}
+}
+
+type gitLabIssue struct {
+	Description string         `json:"description"`
+	CheckName   string         `json:"check_name"`
+	Fingerprint string         `json:"fingerprint"`
+	Severity    string         `json:"severity"`
+	Location    gitLabLocation `json:"location"`
+}
+
+type gitLabLocation struct {
+	Path  string      `json:"path"`
+	Lines gitLabLines `json:"lines"`
+}
+
+type gitLabLines struct {
+	Begin int `json:"begin"`
+}
+
+// Prints findings as a GitLab Code Quality report, which GitLab displays in
+// merge request widgets and diffs when uploaded as a codequality artifact.
+func printGitLabReport(findings []Finding) error {
+	issues := make([]gitLabIssue, 0, len(findings))
+	for _, finding := range findings {
+		severity := "info"
+		switch finding.Severity {
+		case SeverityWarning:
+			severity = "minor"
+		case SeverityError:
+			severity = "major"
+		}
+
+		// GitLab requires a line; findings about a whole file use the first
+		line := max(finding.Location.Line, 1)
+
+		sum := sha256.Sum256([]byte(finding.Rule + "\x00" + finding.Location.File + "\x00" + finding.Message))
+		issues = append(issues, gitLabIssue{
+			Description: finding.Message,
+			CheckName:   finding.Rule,
+			Fingerprint: hex.EncodeToString(sum[:16]),
+			Severity:    severity,
+			Location: gitLabLocation{
+				Path:  finding.Location.File,
+				Lines: gitLabLines{Begin: line},
+			},
+		})
+	}
+
+	jsonData, err := json.MarshalIndent(issues, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON output: %w", err)
+	}
+
+	fmt.Println(string(jsonData))
+	return nil
+}
+
+// Describes a rule findings are reported under, for formats that carry rule
+// metadata along with the findings.
+type Rule struct {
+	ID               string
+	ShortDescription string
+	FullDescription  string
+	HelpURI          string
+	Severity         Severity
+
+	// A score from 0.0 to 10.0, like CVSS, that code scanning tools rank
+	// security findings by; empty for other rules
+	SecuritySeverity string
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	FullDescription      *sarifMessage      `json:"fullDescription,omitempty"`
+	HelpURI              string             `json:"helpUri,omitempty"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+	Properties           map[string]any     `json:"properties,omitempty"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// Returns the SARIF level of a severity.
+func sarifLevel(severity Severity) string {
+	switch severity {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// Prints findings as a SARIF 2.1.0 log, which GitHub code scanning and other
+// tools import, along with the metadata of the rules they are reported under.
+func printSARIFReport(findings []Finding, rules []Rule) error {
+	driver := sarifDriver{
+		Name:           "flint",
+		InformationURI: "https://github.com/NotAShelf/flint",
+		Rules:          make([]sarifRule, 0, len(rules)),
+	}
+	for _, rule := range rules {
+		sarif := sarifRule{
+			ID:                   rule.ID,
+			ShortDescription:     sarifMessage{Text: rule.ShortDescription},
+			HelpURI:              rule.HelpURI,
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevel(rule.Severity)},
+		}
+		if rule.FullDescription != "" {
+			sarif.FullDescription = &sarifMessage{Text: rule.FullDescription}
+		}
+		if rule.SecuritySeverity != "" {
+			sarif.Properties = map[string]any{"security-severity": rule.SecuritySeverity, "tags": []string{"security"}}
+		}
+		driver.Rules = append(driver.Rules, sarif)
+	}
+
+	results := make([]sarifResult, 0, len(findings))
+	for _, finding := range findings {
+		location := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: finding.Location.File}}
+		if finding.Location.Line > 0 {
+			location.Region = &sarifRegion{StartLine: finding.Location.Line, StartColumn: finding.Location.Column}
+		}
+		results = append(results, sarifResult{
+			RuleID:    finding.Rule,
+			Level:     sarifLevel(finding.Severity),
+			Message:   sarifMessage{Text: finding.Message},
+			Locations: []sarifLocation{{PhysicalLocation: location}},
+		})
+	}
+
+	jsonData, err := json.MarshalIndent(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling SARIF output: %w", err)
+	}
+
+	fmt.Println(string(jsonData))
+	return nil
+}
+
+// Builds one finding per dependant that pulls in its own copy of a duplicated
+// repository. Findings point at the flake.nix declaration of the root input
+// responsible when it is known, and at the lockfile otherwise.
+func duplicateFindings(duplicateDeps map[string][]string, urlToDependants map[string][]string, options Options) []Finding {
+	var findings []Finding
+
+	identities := make([]string, 0, len(duplicateDeps))
+	for identity := range duplicateDeps {
+		identities = append(identities, identity)
+	}
+	sort.Strings(identities)
+
+	for _, identity := range identities {
+		urls := duplicateDeps[identity]
+		sort.Strings(urls)
+
+		for _, url := range urls {
+			dependants := urlToDependants[url]
+			sort.Strings(dependants)
+
+			for _, dependant := range dependants {
+				// The root flake's own copy is the one the others should follow
+				if dependant == "root" {
+					continue
+				}
+
+				location, ok := options.Locations[dependant]
+				if !ok {
+					location = flake.Location{File: options.LockPath}
+				}
+
+				findings = append(findings, Finding{
+					Rule:     "duplicate-input",
+					Title:    "Duplicate input",
+					Severity: SeverityWarning,
+					Message: fmt.Sprintf("%s is locked at %d versions; %s pulls in %s. Add a follows declaration to deduplicate it.",
+						identity, len(urls), dependant, url),
+					Location: location,
+				})
+			}
+		}
+	}
+
+	return findings
+}
+
+// Formats a list of dependants, adding the flake.nix location responsible for
+// each one when it is known.
+func formatDependants(dependants []string, options Options) string {
+	formatted := make([]string, len(dependants))
+	for i, dependant := range dependants {
+		formatted[i] = dependant
+		if location, ok := options.Locations[dependant]; ok {
+			formatted[i] += " (" + location.String() + ")"
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// Builds a notice per available update and a warning per input that could not
+// be checked or tracks an outdated release branch, pointing at the flake.nix
+// declaration of the input when known.
+func updateFindings(results flake.UpdateResults, options Options) []Finding {
+	var findings []Finding
+	for _, update := range results.Updates {
+		// Transitive inputs are fixed through the root input pulling them in
+		location, ok := options.Locations[updateRoot(update)]
+		if !ok {
+			location = flake.Location{File: options.LockPath}
+		}
+
+		switch {
+		case update.Error != "":
+			findings = append(findings, Finding{
+				Rule:     "update-check-failed",
+				Title:    "Update check failed",
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("%s could not be checked for updates: %s", update.InputName, update.Error),
+				Location: location,
+			})
+		case update.IsUpdate:
+			message := fmt.Sprintf("%s (%s) can be updated from %s to %s",
+				update.InputName, checkedRef(update), update.CurrentRev, update.LatestRev)
+			switch {
+			case update.LatestRef != "":
+				message = fmt.Sprintf("%s can be updated to release %s", update.InputName, formatRelease(update))
+			case update.CurrentRev == "":
+				message = fmt.Sprintf("%s has changed upstream since it was locked (now %s)", update.InputName, latestVersion(update))
+			}
+			if lag := formatLag(update); lag != "" {
+				message += fmt.Sprintf(", %s behind", lag)
+			}
+			if update.CompareURL != "" {
+				message += ": " + update.CompareURL
+			}
+
+			findings = append(findings, Finding{
+				Rule:     "update-available",
+				Title:    "Update available",
+				Severity: SeverityNotice,
+				Message:  message,
+				Location: location,
+			})
+		}
+
+		if update.NewerBranch != "" {
+			findings = append(findings, Finding{
+				Rule:     "newer-release-branch",
+				Title:    "Newer release branch",
+				Severity: SeverityWarning,
+				Message: fmt.Sprintf("%s tracks %s, but %s is available. Point it at the newer release branch to keep receiving updates.",
+					update.InputName, update.Ref, update.NewerBranch),
+				Location: location,
+			})
+		}
+
+		switch flake.Reachability(update.Reachability) {
+		case flake.Orphaned:
+			findings = append(findings, Finding{
+				Rule:     "orphaned-revision",
+				Title:    "Locked revision orphaned upstream",
+				Severity: SeverityWarning,
+				Message: fmt.Sprintf("%s is locked to %s, which is no longer on %s, as after a force-push. Update it before the revision is garbage collected upstream.",
+					update.InputName, update.CurrentRev, checkedRef(update)),
+				Location: location,
+			})
+		case flake.Unreachable:
+			findings = append(findings, Finding{
+				Rule:     "unreachable-revision",
+				Title:    "Locked revision unreachable upstream",
+				Severity: SeverityError,
+				Message: fmt.Sprintf("%s is locked to %s, which no longer exists upstream. Fresh checkouts cannot fetch it until the input is updated.",
+					update.InputName, update.CurrentRev),
+				Location: location,
+			})
+		}
+
+		if status := update.Repository; status != nil {
+			if status.Missing {
+				findings = append(findings, Finding{
+					Rule:     "missing-repository",
+					Title:    "Upstream repository not found",
+					Severity: SeverityError,
+					Message: fmt.Sprintf("The repository of %s was not found upstream. It was deleted, or is private and needs a token.",
+						update.InputName),
+					Location: location,
+				})
+			}
+			if status.Owner != "" {
+				message := fmt.Sprintf("The repository of %s moved to %s/%s.", update.InputName, status.Owner, status.Repo)
+				if status.MovedTo != "" {
+					message += fmt.Sprintf(" Point the input at %s before the redirect goes away.", status.MovedTo)
+				}
+				findings = append(findings, Finding{
+					Rule:     "moved-repository",
+					Title:    "Upstream repository moved",
+					Severity: SeverityWarning,
+					Message:  message,
+					Location: location,
+				})
+			}
+			if status.Archived {
+				findings = append(findings, Finding{
+					Rule:     "archived-repository",
+					Title:    "Upstream repository archived",
+					Severity: SeverityWarning,
+					Message:  fmt.Sprintf("The repository of %s is archived upstream and gets no further updates.", update.InputName),
+					Location: location,
+				})
+			}
+		}
+	}
+	return findings
+}
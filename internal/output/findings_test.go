@@ -0,0 +1,132 @@
+package output
+
+import (
+	"testing"
+
+	advisory "notashelf.dev/flint/internal/advisory"
+	flake "notashelf.dev/flint/internal/flake"
+)
+
+func TestDuplicateFindings(t *testing.T) {
+	duplicateDeps := map[string][]string{
+		"github:NixOS/nixpkgs": {"github:NixOS/nixpkgs?rev=bbb", "github:NixOS/nixpkgs?rev=aaa"},
+	}
+	urlToDependants := map[string][]string{
+		"github:NixOS/nixpkgs?rev=aaa": {"root"},
+		"github:NixOS/nixpkgs?rev=bbb": {"home-manager", "agenix"},
+	}
+	options := Options{
+		LockPath: "flake.lock",
+		Locations: map[string]flake.Location{
+			"home-manager": {File: "flake.nix", Line: 4, Column: 5},
+		},
+	}
+
+	findings := duplicateFindings(duplicateDeps, urlToDependants, options)
+
+	// The root flake's copy is not reported, and findings are sorted
+	expected := []flake.Location{
+		{File: "flake.lock"},
+		{File: "flake.nix", Line: 4, Column: 5},
+	}
+
+	if len(findings) != len(expected) {
+		t.Fatalf("expected %d findings, got %d: %+v", len(expected), len(findings), findings)
+	}
+
+	for i, want := range expected {
+		if findings[i].Location != want {
+			t.Errorf("finding %d: expected location %s, got %s", i, want, findings[i].Location)
+		}
+		if findings[i].Severity != SeverityWarning {
+			t.Errorf("finding %d: expected warning severity, got %s", i, findings[i].Severity)
+		}
+	}
+}
+
+func TestUpdateFindings(t *testing.T) {
+	results := flake.UpdateResults{Updates: []flake.UpdateStatus{
+		{InputName: "nixpkgs", Ref: "nixos-24.05", CurrentRev: "aaa", LatestRev: "aaa", NewerBranch: "nixos-24.11"},
+		{InputName: "tool", Ref: "v1.4.2", CurrentRev: "aaa", LatestRev: "bbb", IsUpdate: true, LatestRef: "v1.5.0", Bump: "minor"},
+		{InputName: "broken", Error: "not found", Repository: &flake.RepositoryStatus{Missing: true}},
+		{InputName: "forced", Ref: "main", CurrentRev: "aaa", LatestRev: "bbb", IsUpdate: true, Reachability: "orphaned"},
+	}}
+	options := Options{
+		LockPath:  "flake.lock",
+		Locations: map[string]flake.Location{"nixpkgs": {File: "flake.nix", Line: 3, Column: 5}},
+	}
+
+	findings := updateFindings(results, options)
+
+	expected := []struct {
+		rule    string
+		message string
+	}{
+		{"newer-release-branch", "nixpkgs tracks nixos-24.05, but nixos-24.11 is available. Point it at the newer release branch to keep receiving updates."},
+		{"update-available", "tool can be updated to release v1.4.2 → v1.5.0 (minor)"},
+		{"update-check-failed", "broken could not be checked for updates: not found"},
+		{"missing-repository", "The repository of broken was not found upstream. It was deleted, or is private and needs a token."},
+		{"update-available", "forced (main) can be updated from aaa to bbb"},
+		{"orphaned-revision", "forced is locked to aaa, which is no longer on main, as after a force-push. Update it before the revision is garbage collected upstream."},
+	}
+
+	if len(findings) != len(expected) {
+		t.Fatalf("expected %d findings, got %d: %+v", len(expected), len(findings), findings)
+	}
+	for i, want := range expected {
+		if findings[i].Rule != want.rule || findings[i].Message != want.message {
+			t.Errorf("finding %d: expected %s %q, got %s %q", i, want.rule, want.message, findings[i].Rule, findings[i].Message)
+		}
+	}
+	if findings[0].Location.Line != 3 {
+		t.Errorf("expected the branch finding to point at flake.nix, got %s", findings[0].Location)
+	}
+}
+
+func TestAdvisoryFindings(t *testing.T) {
+	compromised := advisory.Advisory{ID: "FLINT-1", Severity: advisory.SeverityCritical, Summary: "Compromised commit", URL: "https://example.com/1"}
+	stale := advisory.Advisory{ID: "FLINT-2", Severity: advisory.SeverityLow, Summary: "Old release"}
+	matches := []advisory.Match{
+		{Advisory: compromised, Node: "nixpkgs", Path: []string{"nixpkgs"}, Reason: "revision 0123456"},
+		{Advisory: stale, Node: "tool_2", Path: []string{"home-manager", "tool"}, Reason: "release v1.0.0"},
+	}
+	options := Options{
+		LockPath:  "flake.lock",
+		Locations: map[string]flake.Location{"nixpkgs": {File: "flake.nix", Line: 3, Column: 5}},
+	}
+
+	findings := advisoryFindings(matches, options)
+
+	expected := []struct {
+		rule     string
+		severity Severity
+		location flake.Location
+		message  string
+	}{
+		{"FLINT-1", SeverityError, flake.Location{File: "flake.nix", Line: 3, Column: 5},
+			"nixpkgs is locked to revision 0123456, affected by FLINT-1: Compromised commit (https://example.com/1)"},
+		{"FLINT-2", SeverityNotice, flake.Location{File: "flake.lock"},
+			"home-manager/tool is locked to release v1.0.0, affected by FLINT-2: Old release"},
+	}
+
+	if len(findings) != len(expected) {
+		t.Fatalf("expected %d findings, got %d: %+v", len(expected), len(findings), findings)
+	}
+	for i, want := range expected {
+		got := findings[i]
+		if got.Rule != want.rule || got.Severity != want.severity || got.Location != want.location || got.Message != want.message {
+			t.Errorf("finding %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+
+	rules := advisoryRules([]advisory.Advisory{compromised, stale})
+	if len(rules) != 2 || rules[0].SecuritySeverity != "9.5" || rules[0].HelpURI != compromised.URL || rules[1].Severity != SeverityNotice {
+		t.Errorf("unexpected rules: %+v", rules)
+	}
+}
+
+func TestEscapeGitHubProperty(t *testing.T) {
+	if result := escapeGitHubProperty("a,b:c%\n"); result != "a%2Cb%3Ac%25%0A" {
+		t.Errorf("unexpected escaped property: %s", result)
+	}
+}
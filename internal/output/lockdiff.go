@@ -0,0 +1,156 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	flake "notashelf.dev/flint/internal/flake"
+)
+
+func PrintLockDiff(diff flake.LockDiff, options Options) error {
+	// Validate output format first, even in quiet mode
+	if err := ValidateOutputFormat(options.OutputFormat); err != nil {
+		return err
+	}
+
+	if options.Quiet {
+		return nil
+	}
+
+	if options.OutputFormat == "json" {
+		if diff.Changes == nil {
+			diff.Changes = []flake.InputChange{}
+		}
+
+		jsonData, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling JSON output: %w", err)
+		}
+
+		fmt.Println(string(jsonData))
+		return nil
+	}
+
+	// Only new duplicates are worth annotating; the changes are the point
+	findings := duplicateFindings(diff.NewDuplicates, diff.Dependants, options)
+	switch options.OutputFormat {
+	case "plain":
+		printPlainLockDiff(diff)
+	case "github":
+		printGitHubAnnotations(findings)
+	case "gitlab":
+		return printGitLabReport(findings)
+	default:
+		printFormattedLockDiff(diff, options)
+	}
+	return nil
+}
+
+func printFormattedLockDiff(diff flake.LockDiff, options Options) {
+	s := newPrettyStyles()
+
+	fmt.Println(s.header.Render("🔍 Flint - Update Report"))
+	fmt.Println()
+
+	if len(diff.Command) > 0 {
+		verb := "Ran"
+		if diff.DryRun {
+			verb = "Would run"
+		}
+		fmt.Println(s.info.Render(fmt.Sprintf("%s %s: ", s.infoIcon, verb)) + s.dim.Render(strings.Join(diff.Command, " ")))
+		fmt.Println()
+	}
+
+	if len(diff.Changes) == 0 {
+		fmt.Println(s.success.Render(fmt.Sprintf("%s No inputs changed", s.successIcon)))
+	} else {
+		verb := "Updated"
+		if diff.DryRun {
+			verb = "Would update"
+		}
+		fmt.Println(s.warning.Render(fmt.Sprintf("%s %s %s", s.warningIcon, verb, plural(len(diff.Changes), "input"))))
+		fmt.Println()
+
+		for i, change := range diff.Changes {
+			fmt.Printf("%d. %s\n", i+1, s.name.Render(change.Input))
+			switch {
+			case change.OldURL == "":
+				fmt.Printf("   %s %s\n", s.dim.Render("└─"), s.bold.Render("Added:   ")+s.url.Render(change.NewURL))
+			case change.NewURL == "":
+				fmt.Printf("   %s %s\n", s.dim.Render("└─"), s.bold.Render("Removed: ")+s.url.Render(change.OldURL))
+			default:
+				fmt.Printf("   %s %s\n", s.dim.Render("├─"), s.bold.Render("From: ")+s.dim.Render(changeVersion(change.OldRev, change.OldURL)+formatDate(change.OldDate)))
+				fmt.Printf("   %s %s\n", s.dim.Render("└─"), s.bold.Render("To:   ")+s.success.Render(changeVersion(change.NewRev, change.NewURL))+s.dim.Render(formatDate(change.NewDate)))
+			}
+			if options.Verbose && change.OldURL != "" && change.NewURL != "" {
+				fmt.Printf("      %s\n", s.url.Render(change.NewURL))
+			}
+		}
+	}
+
+	if len(diff.NewDuplicates) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(s.error.Render(fmt.Sprintf("%s The update introduces %s", s.errorIcon, plural(len(diff.NewDuplicates), "duplicate input"))))
+	for _, identity := range slices.Sorted(maps.Keys(diff.NewDuplicates)) {
+		fmt.Printf("   %s %s\n", s.dim.Render("•"), s.name.Render(identity))
+		urls := diff.NewDuplicates[identity]
+		for i, url := range urls {
+			branch := "├─"
+			if i == len(urls)-1 {
+				branch = "└─"
+			}
+			fmt.Printf("     %s %s %s\n", s.dim.Render(branch), s.url.Render(url),
+				s.dim.Render("("+formatDependants(diff.Dependants[url], options)+")"))
+		}
+	}
+	fmt.Println()
+	fmt.Println(s.info.Render(fmt.Sprintf("%s Run 'flint fix' to add follows declarations that deduplicate them", s.infoIcon)))
+}
+
+func printPlainLockDiff(diff flake.LockDiff) {
+	s := newPlainStyles()
+
+	title := "Update Report"
+	if diff.DryRun {
+		title += " (dry run)"
+	}
+	fmt.Println(s.title.Render(title))
+
+	if len(diff.Command) > 0 {
+		fmt.Printf("Command: %s\n", strings.Join(diff.Command, " "))
+	}
+
+	if len(diff.Changes) == 0 {
+		fmt.Println(s.status.Render("No inputs changed."))
+	}
+	for _, change := range diff.Changes {
+		switch {
+		case change.OldURL == "":
+			fmt.Printf("%s: added %s\n", s.input.Render(change.Input), change.NewURL)
+		case change.NewURL == "":
+			fmt.Printf("%s: removed %s\n", s.input.Render(change.Input), change.OldURL)
+		default:
+			fmt.Printf("%s: %s -> %s\n", s.input.Render(change.Input),
+				changeVersion(change.OldRev, change.OldURL), changeVersion(change.NewRev, change.NewURL))
+		}
+	}
+
+	for _, identity := range slices.Sorted(maps.Keys(diff.NewDuplicates)) {
+		fmt.Println(s.error.Render(fmt.Sprintf("New duplicate: %s (%s)", identity, strings.Join(diff.NewDuplicates[identity], ", "))))
+	}
+}
+
+// Shows a locked version by its abbreviated revision, or its URL for inputs
+// without one.
+func changeVersion(rev, url string) string {
+	if rev != "" {
+		return shortRev(rev, "")
+	}
+	return url
+}
@@ -3,8 +3,10 @@ package output
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"slices"
 	"strings"
+	"time"
 
 	gloss "github.com/charmbracelet/lipgloss"
 	flake "notashelf.dev/flint/internal/flake"
@@ -37,13 +39,27 @@ type Options struct {
 	Merge                  bool
 	FailIfMultipleVersions bool
 	Quiet                  bool
+
+	// Maps the names shown in a report (lock nodes for the dependency report,
+	// input names for the update report) to their flake.nix declarations, and
+	// names the lockfile for findings that cannot be traced back to flake.nix
+	Locations map[string]flake.Location
+	LockPath  string
 }
 
 // You cannot imagine how much I'm missing clap right now.
 // Or Rust in general...
 func ValidateOutputFormat(format string) error {
-	validFormats := []string{"json", "plain", "pretty"}
+	return validateFormat(format, []string{"github", "gitlab", "json", "plain", "pretty"})
+}
 
+// Validates the output format of the update report, which can also be
+// rendered as markdown.
+func ValidateUpdateFormat(format string) error {
+	return validateFormat(format, []string{"github", "gitlab", "json", "markdown", "plain", "pretty"})
+}
+
+func validateFormat(format string, validFormats []string) error {
 	if slices.Contains(validFormats, format) {
 		return nil
 	}
@@ -62,7 +78,7 @@ func ShouldFailOnDuplicates(options Options, deps map[string][]string) bool {
 
 func PrintUpdates(results flake.UpdateResults, options Options) error {
 	// Validate output format first, even in quiet mode
-	if err := ValidateOutputFormat(options.OutputFormat); err != nil {
+	if err := ValidateUpdateFormat(options.OutputFormat); err != nil {
 		return err
 	}
 
@@ -84,6 +100,12 @@ func PrintUpdates(results flake.UpdateResults, options Options) error {
 	switch options.OutputFormat {
 	case "plain":
 		printPlainUpdateOutput(results, options)
+	case "markdown":
+		fmt.Print(formatMarkdownUpdates(results))
+	case "github":
+		printGitHubAnnotations(updateFindings(results, options))
+	case "gitlab":
+		return printGitLabReport(updateFindings(results, options))
 	case "pretty":
 		printFormattedUpdateOutput(results, options)
 	default:
@@ -128,6 +150,9 @@ func PrintDependencies(deps map[string][]string, reverseDeps map[string][]string
 			"reverse_dependencies": reverseDeps,
 			"duplicates":           duplicateDeps,
 		}
+		if len(options.Locations) > 0 {
+			output["locations"] = options.Locations
+		}
 
 		jsonData, err := json.MarshalIndent(output, "", "  ")
 		if err != nil {
@@ -142,6 +167,10 @@ func PrintDependencies(deps map[string][]string, reverseDeps map[string][]string
 	switch options.OutputFormat {
 	case "plain":
 		printPlainOutput(deps, urlToDependants, options)
+	case "github":
+		printGitHubAnnotations(duplicateFindings(duplicateDeps, urlToDependants, options))
+	case "gitlab":
+		return printGitLabReport(duplicateFindings(duplicateDeps, urlToDependants, options))
 	case "pretty":
 		printFormattedOutput(deps, urlToDependants, options)
 	default:
@@ -300,7 +329,7 @@ func printFormattedOutput(deps map[string][]string, urlToDependants map[string][
 					dependants = append(dependants, dependant)
 				}
 				fmt.Printf("   %s %s\n", dimStyle.Render("└─"), dependantStyle.Render(fmt.Sprintf("Used by: %s",
-					strings.Join(dependants, ", "))))
+					formatDependants(dependants, options))))
 			} else {
 				fmt.Printf("   %s %s\n", dimStyle.Render("└─"), dimStyle.Render("No direct dependants"))
 			}
@@ -343,7 +372,7 @@ func printFormattedOutput(deps map[string][]string, urlToDependants map[string][
 						subConnector = " "
 					}
 					fmt.Printf("   %s     %s %s\n", dimStyle.Render(subConnector), dimStyle.Render("└─"),
-						dependantStyle.Render(fmt.Sprintf("Used by: %s", strings.Join(dependants, ", "))))
+						dependantStyle.Render(fmt.Sprintf("Used by: %s", formatDependants(dependants, options))))
 				}
 
 				if options.Verbose {
@@ -364,9 +393,6 @@ func printFormattedOutput(deps map[string][]string, urlToDependants map[string][
 	fmt.Println(boldStyle.Render("📊 Summary:"))
 	fmt.Println()
 
-	// TODO: surely this can be done in a less generic way; "haha fix your inputs" is not a good message
-	// and maybe we should suggest using `follows` in the flake.nix for each input that is detected. If
-	// I can find a good way, I can even add --patch flag to generate an actually actionable patch.
 	if duplicateInputs > 0 {
 		fmt.Println(errorStyle.Render(fmt.Sprintf("%s %d repositories have duplicate versions",
 			errorIcon, duplicateInputs)))
@@ -379,6 +405,9 @@ func printFormattedOutput(deps map[string][]string, urlToDependants map[string][
 		fmt.Println()
 		fmt.Println(dimStyle.Render("   Example:"))
 		fmt.Println(dimStyle.Render("   inputs.someInput.inputs.nixpkgs.follows = \"nixpkgs\";"))
+		fmt.Println()
+		fmt.Println("   Run 'flint fix' to preview the follows declarations Flint can add for")
+		fmt.Println("   you, or 'flint fix --write' to apply them to flake.nix.")
 	}
 }
 
@@ -447,13 +476,13 @@ func printPlainOutput(deps map[string][]string, urlToDependants map[string][]str
 				for dependant := range dependantsSet {
 					dependants = append(dependants, dependant)
 				}
-				fmt.Println(depStyle.Render(fmt.Sprintf("  Dependants: %s", strings.Join(dependants, ", "))))
+				fmt.Println(depStyle.Render(fmt.Sprintf("  Dependants: %s", formatDependants(dependants, options))))
 			}
 		} else {
 			for _, url := range urls {
 				fmt.Println(aliasStyle.Render(fmt.Sprintf("  Version: %s", url)))
 				if dependants, exists := urlToDependants[url]; exists && len(dependants) > 0 {
-					fmt.Println(depStyle.Render(fmt.Sprintf("    Dependants: %s", strings.Join(dependants, ", "))))
+					fmt.Println(depStyle.Render(fmt.Sprintf("    Dependants: %s", formatDependants(dependants, options))))
 				}
 				if options.Verbose {
 					fmt.Println(depStyle.Render(fmt.Sprintf("    [Debug] %d inputs depend on this version", len(urlToDependants[url]))))
@@ -547,6 +576,10 @@ func printFormattedUpdateOutput(results flake.UpdateResults, _ Options) {
 	totalInputs := len(results.Updates)
 	availableUpdates := 0
 	errors := 0
+	newerBranches := 0
+	lostRevisions := 0
+	changedRepositories := 0
+	unknownChanges := 0
 
 	for _, update := range results.Updates {
 		if update.IsUpdate {
@@ -555,6 +588,18 @@ func printFormattedUpdateOutput(results flake.UpdateResults, _ Options) {
 		if update.Error != "" {
 			errors++
 		}
+		if update.NewerBranch != "" {
+			newerBranches++
+		}
+		if update.Reachability != "" {
+			lostRevisions++
+		}
+		if update.Repository != nil {
+			changedRepositories++
+		}
+		if changesUnknown(update) {
+			unknownChanges++
+		}
 	}
 
 	if totalInputs == 0 {
@@ -564,7 +609,7 @@ func printFormattedUpdateOutput(results flake.UpdateResults, _ Options) {
 
 	fmt.Println(infoStyle.Render(fmt.Sprintf("%s Checked %d inputs for updates...", infoIcon, totalInputs)))
 
-	if availableUpdates == 0 && errors == 0 {
+	if availableUpdates == 0 && errors == 0 && newerBranches == 0 && lostRevisions == 0 && changedRepositories == 0 && unknownChanges == 0 {
 		fmt.Println(successStyle.Render(fmt.Sprintf("%s All inputs are up to date!", successIcon)))
 		return
 	}
@@ -572,6 +617,18 @@ func printFormattedUpdateOutput(results flake.UpdateResults, _ Options) {
 	if availableUpdates > 0 {
 		fmt.Println(warningStyle.Render(fmt.Sprintf("%s %d updates available", warningIcon, availableUpdates)))
 	}
+	if newerBranches > 0 {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("%s %d inputs track an outdated release branch", warningIcon, newerBranches)))
+	}
+	if lostRevisions > 0 {
+		fmt.Println(errorStyle.Render(fmt.Sprintf("%s %d inputs are locked to revisions orphaned or gone upstream", errorIcon, lostRevisions)))
+	}
+	if changedRepositories > 0 {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("%s %d inputs come from archived, moved or missing repositories", warningIcon, changedRepositories)))
+	}
+	if unknownChanges > 0 {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("%s %d inputs could not be checked for changes", warningIcon, unknownChanges)))
+	}
 	if errors > 0 {
 		fmt.Println(errorStyle.Render(fmt.Sprintf("%s %d errors encountered", errorIcon, errors)))
 	}
@@ -581,19 +638,78 @@ func printFormattedUpdateOutput(results flake.UpdateResults, _ Options) {
 	fmt.Println(boldStyle.Render("📋 Detailed Results:"))
 	fmt.Println()
 
+	grouped := hasTransitiveUpdates(results)
+	currentRoot := ""
 	for i, update := range results.Updates {
+		if root := updateRoot(update); grouped && root != currentRoot {
+			currentRoot = root
+			fmt.Println(boldStyle.Render("📦 " + root))
+			fmt.Println()
+		}
+
 		fmt.Printf("%d. %s\n", i+1, inputStyle.Render(update.InputName))
 
 		if update.Error != "" {
 			fmt.Printf("   %s %s\n", errorIcon, errorStyle.Render("Error: "+update.Error))
+		} else if update.Pinned {
+			fmt.Printf("   %s %s\n", infoIcon, infoStyle.Render("Pinned to a revision, not updatable"))
+			fmt.Printf("   %s %s\n", dimStyle.Render("└─"), dimStyle.Render(currentVersion(update)))
+		} else if update.Policy == flake.PolicyIgnored {
+			fmt.Printf("   %s %s\n", infoIcon, infoStyle.Render(formatPolicy(update)))
+			fmt.Printf("   %s %s\n", dimStyle.Render("└─"), dimStyle.Render(currentVersion(update)))
+		} else if update.Policy == flake.PolicyCooldown && !update.IsUpdate {
+			fmt.Printf("   %s %s\n", infoIcon, infoStyle.Render(formatPolicy(update)))
+			fmt.Printf("   %s %s\n", dimStyle.Render("├─"), boldStyle.Render("Current: ")+dimStyle.Render(currentVersion(update))+dimStyle.Render(formatDate(update.CurrentDate)))
+			fmt.Printf("   %s %s\n", dimStyle.Render("└─"), boldStyle.Render("Latest:  ")+dimStyle.Render(latestVersion(update))+dimStyle.Render(formatDate(update.LatestDate)))
 		} else if update.IsUpdate {
 			fmt.Printf("   %s %s\n", warningIcon, warningStyle.Render("Update available"))
-			fmt.Printf("   %s %s\n", dimStyle.Render("├─"), boldStyle.Render("Current: ")+dimStyle.Render(update.CurrentRev[:8]+"..."))
-			fmt.Printf("   %s %s\n", dimStyle.Render("├─"), boldStyle.Render("Latest:  ")+successStyle.Render(update.LatestRev[:8]+"..."))
+			if update.Group != "" {
+				fmt.Printf("   %s %s\n", dimStyle.Render("├─"), boldStyle.Render("Group:   ")+dimStyle.Render(update.Group))
+			}
+			if update.Policy == flake.PolicyCooldown {
+				fmt.Printf("   %s %s\n", dimStyle.Render("├─"), boldStyle.Render("Cooldown: ")+dimStyle.Render("newer commits are too recent and held back"))
+			}
+			fmt.Printf("   %s %s\n", dimStyle.Render("├─"), boldStyle.Render("Ref:     ")+dimStyle.Render(checkedRef(update)))
+			fmt.Printf("   %s %s\n", dimStyle.Render("├─"), boldStyle.Render("Current: ")+dimStyle.Render(currentVersion(update))+dimStyle.Render(formatDate(update.CurrentDate)))
+			fmt.Printf("   %s %s\n", dimStyle.Render("├─"), boldStyle.Render("Latest:  ")+successStyle.Render(latestVersion(update))+dimStyle.Render(formatDate(update.LatestDate)))
+			if update.LatestRef != "" {
+				fmt.Printf("   %s %s\n", dimStyle.Render("├─"), boldStyle.Render("Release: ")+successStyle.Render(formatRelease(update)))
+			}
+			if update.HeldBack != "" {
+				fmt.Printf("   %s %s\n", dimStyle.Render("├─"), boldStyle.Render("Held back: ")+dimStyle.Render(update.HeldBack))
+			}
+			if lag := formatLag(update); lag != "" {
+				fmt.Printf("   %s %s\n", dimStyle.Render("├─"), boldStyle.Render("Behind:  ")+warningStyle.Render(lag))
+			}
+			if update.CompareURL != "" {
+				fmt.Printf("   %s %s\n", dimStyle.Render("├─"), boldStyle.Render("Compare: ")+urlStyle.Render(update.CompareURL))
+			}
+			if update.Changelog != nil {
+				fmt.Printf("   %s %s\n", dimStyle.Render("├─"), boldStyle.Render("Changes: ")+dimStyle.Render(changelogSummary(update.Changelog)))
+				for _, line := range formatChangelog(update.Changelog) {
+					fmt.Printf("   %s    %s\n", dimStyle.Render("│"), dimStyle.Render(line))
+				}
+			}
 			fmt.Printf("   %s %s\n", dimStyle.Render("└─"), urlStyle.Render(update.CurrentURL))
+		} else if changesUnknown(update) {
+			fmt.Printf("   %s %s\n", warningIcon, warningStyle.Render("Not checked for changes"))
+			fmt.Printf("   %s %s\n", dimStyle.Render("└─"), dimStyle.Render(currentVersion(update)))
 		} else {
 			fmt.Printf("   %s %s\n", successIcon, successStyle.Render("Up to date"))
-			fmt.Printf("   %s %s\n", dimStyle.Render("└─"), dimStyle.Render(update.CurrentRev[:8]+"..."))
+			fmt.Printf("   %s %s\n", dimStyle.Render("├─"), boldStyle.Render("Ref: ")+dimStyle.Render(checkedRef(update)))
+			if update.HeldBack != "" {
+				fmt.Printf("   %s %s\n", dimStyle.Render("├─"), boldStyle.Render("Held back: ")+dimStyle.Render(update.HeldBack))
+			}
+			fmt.Printf("   %s %s\n", dimStyle.Render("└─"), dimStyle.Render(currentVersion(update)))
+		}
+		if update.NewerBranch != "" {
+			fmt.Printf("   %s %s\n", warningIcon, warningStyle.Render("Newer release branch available: ")+successStyle.Render(update.NewerBranch))
+		}
+		if update.Reachability != "" {
+			fmt.Printf("   %s %s\n", errorIcon, errorStyle.Render(formatReachability(update)))
+		}
+		for _, note := range repositoryNotes(update) {
+			fmt.Printf("   %s %s\n", warningIcon, warningStyle.Render(note))
 		}
 		fmt.Println()
 	}
@@ -607,6 +723,35 @@ func printFormattedUpdateOutput(results flake.UpdateResults, _ Options) {
 		fmt.Println(warningStyle.Render(fmt.Sprintf("%s %d inputs have updates available", warningIcon, availableUpdates)))
 		fmt.Println(infoStyle.Render("Run 'nix flake update' to update all inputs, or update specific inputs:"))
 		fmt.Println(dimStyle.Render("  nix flake update <input-name>"))
+		for _, group := range updateGroups(results) {
+			fmt.Println(infoStyle.Render(fmt.Sprintf("Update the %s group together:", group.Name)))
+			fmt.Println(dimStyle.Render("  nix flake update " + strings.Join(group.Inputs, " ")))
+		}
+		fmt.Println()
+	}
+
+	if newerBranches > 0 {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("%s %d inputs track an outdated release branch", warningIcon, newerBranches)))
+		fmt.Println(infoStyle.Render("Point them at the newer release branch in flake.nix, then run 'nix flake update'."))
+		fmt.Println()
+	}
+
+	if lostRevisions > 0 {
+		fmt.Println(errorStyle.Render(fmt.Sprintf("%s %d inputs are locked to revisions orphaned or gone upstream", errorIcon, lostRevisions)))
+		fmt.Println(infoStyle.Render("Fresh checkouts may fail to fetch them. Update them to a revision on the branch:"))
+		fmt.Println(dimStyle.Render("  nix flake update <input-name>"))
+		fmt.Println()
+	}
+
+	if changedRepositories > 0 {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("%s %d inputs come from archived, moved or missing repositories", warningIcon, changedRepositories)))
+		fmt.Println(infoStyle.Render("Point moved inputs at their new location in flake.nix, and look for replacements for archived and missing ones."))
+		fmt.Println()
+	}
+
+	if unknownChanges > 0 {
+		fmt.Println(warningStyle.Render(fmt.Sprintf("%s %d inputs could not be checked for changes", warningIcon, unknownChanges)))
+		fmt.Println(infoStyle.Render(unknownChangesHint))
 		fmt.Println()
 	}
 
@@ -616,11 +761,216 @@ func printFormattedUpdateOutput(results flake.UpdateResults, _ Options) {
 		fmt.Println()
 	}
 
-	if availableUpdates == 0 && errors == 0 {
+	if availableUpdates == 0 && errors == 0 && newerBranches == 0 && lostRevisions == 0 && changedRepositories == 0 && unknownChanges == 0 {
 		fmt.Println(successStyle.Render(fmt.Sprintf("%s All inputs are at the latest version", successIcon)))
 	}
 }
 
+// Reports whether any result is for an input below the root inputs, in which
+// case results are shown grouped by root input.
+func hasTransitiveUpdates(results flake.UpdateResults) bool {
+	for _, update := range results.Updates {
+		if len(update.Path) > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the root input that pulls in an input.
+func updateRoot(update flake.UpdateStatus) string {
+	if len(update.Path) > 0 {
+		return update.Path[0]
+	}
+	return update.InputName
+}
+
+// Describes the ref an update check followed.
+func checkedRef(update flake.UpdateStatus) string {
+	if update.Ref == "" {
+		return "default branch"
+	}
+	return update.Ref
+}
+
+// Describes how update policy affects an input, e.g. "Ignored until
+// 2025-06-30: waiting for upstream fix".
+func formatPolicy(update flake.UpdateStatus) string {
+	var description string
+	switch update.Policy {
+	case flake.PolicyIgnored:
+		description = "Ignored"
+		if update.PolicyUntil > 0 {
+			description += " until " + time.Unix(update.PolicyUntil, 0).UTC().Format("2006-01-02")
+		}
+		if update.PolicyReason != "" {
+			description += ": " + update.PolicyReason
+		}
+	case flake.PolicyCooldown:
+		description = "Update cooling down"
+		if update.PolicyUntil > 0 {
+			description += " until " + time.Unix(update.PolicyUntil, 0).UTC().Format("2006-01-02 15:04 UTC")
+		}
+	}
+	return description
+}
+
+// An update group with the inputs in it that have updates.
+type updateGroup struct {
+	Name   string
+	Inputs []string
+}
+
+// Returns the update groups that have updates, sorted by name.
+func updateGroups(results flake.UpdateResults) []updateGroup {
+	inputs := make(map[string][]string)
+	for _, update := range results.Updates {
+		if update.IsUpdate && update.Group != "" {
+			inputs[update.Group] = append(inputs[update.Group], update.InputName)
+		}
+	}
+
+	groups := make([]updateGroup, 0, len(inputs))
+	for _, name := range slices.Sorted(maps.Keys(inputs)) {
+		groups = append(groups, updateGroup{Name: name, Inputs: inputs[name]})
+	}
+	return groups
+}
+
+// Explains why inputs without revisions could not be checked for changes.
+const unknownChangesHint = "Without a content hash, flint compares the server's ETag and Last-Modified with those it saw on an earlier run, which needs the cache."
+
+// Reports whether nothing told if an input without revisions changed
+// upstream, which is not the same as it being up to date.
+func changesUnknown(update flake.UpdateStatus) bool {
+	return !update.IsUpdate && update.Error == "" && slices.Contains(update.Unchecked, "changes")
+}
+
+// Describes what happened to a locked revision that is no longer on the
+// branch an input tracks.
+func formatReachability(update flake.UpdateStatus) string {
+	switch flake.Reachability(update.Reachability) {
+	case flake.Orphaned:
+		return fmt.Sprintf("Locked revision %s is no longer on %s and may be garbage collected upstream", currentVersion(update), checkedRef(update))
+	case flake.Unreachable:
+		return fmt.Sprintf("Locked revision %s no longer exists upstream", currentVersion(update))
+	default:
+		return "Locked revision " + currentVersion(update) + " is " + update.Reachability
+	}
+}
+
+// Describes what became of an input's upstream repository, one line for
+// each thing that happened to it.
+func repositoryNotes(update flake.UpdateStatus) []string {
+	status := update.Repository
+	if status == nil {
+		return nil
+	}
+
+	var notes []string
+	if status.Missing {
+		notes = append(notes, "Repository not found upstream; it was deleted, or is private and needs a token")
+	}
+	if status.Owner != "" {
+		note := fmt.Sprintf("Repository moved to %s/%s", status.Owner, status.Repo)
+		if status.MovedTo != "" {
+			note += ", use " + status.MovedTo
+		}
+		notes = append(notes, note)
+	}
+	if status.Archived {
+		notes = append(notes, "Repository is archived upstream and gets no further updates")
+	}
+	return notes
+}
+
+// Abbreviates a revision for display, falling back to the NAR hash for
+// inputs without revisions. Either may be short or missing.
+func shortRev(rev, narHash string) string {
+	switch {
+	case len(rev) > 8:
+		return rev[:8] + "..."
+	case rev != "":
+		return rev
+	case len(narHash) > 19:
+		return narHash[:19] + "..."
+	case narHash != "":
+		return narHash
+	default:
+		return "unknown"
+	}
+}
+
+// Describes the locked version of an input.
+func currentVersion(update flake.UpdateStatus) string {
+	return shortRev(update.CurrentRev, update.CurrentNarHash)
+}
+
+// Describes the latest version of an input. Tarballs that are identified by
+// where their URL leads are shown by that URL.
+func latestVersion(update flake.UpdateStatus) string {
+	if update.LatestRev == "" && update.LatestNarHash == "" && update.LatestURL != "" {
+		return update.LatestURL
+	}
+	return shortRev(update.LatestRev, update.LatestNarHash)
+}
+
+// Describes the release an input locked to a tag can move to, e.g.
+// "v1.4.2 → v1.5.0 (minor)".
+func formatRelease(update flake.UpdateStatus) string {
+	release := update.Ref + " → " + update.LatestRef
+	if update.Bump != "" {
+		release += " (" + update.Bump + ")"
+	}
+	return release
+}
+
+// Formats a commit date for display after a revision, or returns "" when it
+// is unknown.
+func formatDate(unix int64) string {
+	if unix <= 0 {
+		return ""
+	}
+	return " (" + time.Unix(unix, 0).UTC().Format("2006-01-02") + ")"
+}
+
+// Describes how far behind an update is, e.g. "42 commits, 3 weeks", using
+// whatever the resolver could find out.
+func formatLag(update flake.UpdateStatus) string {
+	var parts []string
+	if update.CommitsBehind > 0 {
+		parts = append(parts, plural(update.CommitsBehind, "commit"))
+	}
+	if update.AgeGap > 0 {
+		parts = append(parts, formatAge(time.Duration(update.AgeGap)*time.Second))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Formats an age roughly, at the largest unit that reads naturally.
+func formatAge(age time.Duration) string {
+	days := int(age.Hours() / 24)
+	switch {
+	case days < 1:
+		return "less than a day"
+	case days < 14:
+		return plural(days, "day")
+	case days < 60:
+		return plural(days/7, "week")
+	case days < 730:
+		return plural(days/30, "month")
+	default:
+		return plural(days/365, "year")
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", unit)
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
 func printPlainUpdateOutput(results flake.UpdateResults, _ Options) {
 	// Simple styles for backward compatibility
 	var titleStyle, inputStyle, statusStyle, errorStyle gloss.Style
@@ -654,6 +1004,10 @@ func printPlainUpdateOutput(results flake.UpdateResults, _ Options) {
 
 	availableUpdates := 0
 	errors := 0
+	newerBranches := 0
+	lostRevisions := 0
+	changedRepositories := 0
+	unknownChanges := 0
 
 	for _, update := range results.Updates {
 		if update.IsUpdate {
@@ -662,26 +1016,96 @@ func printPlainUpdateOutput(results flake.UpdateResults, _ Options) {
 		if update.Error != "" {
 			errors++
 		}
+		if update.NewerBranch != "" {
+			newerBranches++
+		}
+		if update.Reachability != "" {
+			lostRevisions++
+		}
+		if update.Repository != nil {
+			changedRepositories++
+		}
+		if changesUnknown(update) {
+			unknownChanges++
+		}
 	}
 
-	if availableUpdates == 0 && errors == 0 {
+	if availableUpdates == 0 && errors == 0 && newerBranches == 0 && lostRevisions == 0 && changedRepositories == 0 && unknownChanges == 0 {
 		fmt.Println(statusStyle.Render("All inputs are up to date."))
 		return
 	}
 
+	grouped := hasTransitiveUpdates(results)
+	currentRoot := ""
 	for _, update := range results.Updates {
+		if root := updateRoot(update); grouped && root != currentRoot {
+			currentRoot = root
+			fmt.Println(titleStyle.Render(fmt.Sprintf("Root input: %s", root)))
+		}
+
 		fmt.Println(inputStyle.Render(fmt.Sprintf("Input: %s", update.InputName)))
 
 		if update.Error != "" {
 			fmt.Println(errorStyle.Render(fmt.Sprintf("  Error: %s", update.Error)))
+		} else if update.Pinned {
+			fmt.Println(statusStyle.Render("  Status: Pinned, not updatable"))
+			fmt.Printf("  Version: %s\n", currentVersion(update))
+		} else if update.Policy == flake.PolicyIgnored {
+			fmt.Println(statusStyle.Render("  Status: " + formatPolicy(update)))
+			fmt.Printf("  Version: %s\n", currentVersion(update))
+		} else if update.Policy == flake.PolicyCooldown && !update.IsUpdate {
+			fmt.Println(statusStyle.Render("  Status: " + formatPolicy(update)))
+			fmt.Printf("  Current: %s\n", currentVersion(update)+formatDate(update.CurrentDate))
+			fmt.Printf("  Latest:  %s\n", latestVersion(update)+formatDate(update.LatestDate))
 		} else if update.IsUpdate {
 			fmt.Println(statusStyle.Render("  Status: Update available"))
-			fmt.Printf("  Current: %s\n", update.CurrentRev[:8]+"...")
-			fmt.Printf("  Latest:  %s\n", update.LatestRev[:8]+"...")
+			if update.Group != "" {
+				fmt.Printf("  Group: %s\n", update.Group)
+			}
+			if update.Policy == flake.PolicyCooldown {
+				fmt.Println("  Cooldown: newer commits are too recent and held back")
+			}
+			fmt.Printf("  Ref: %s\n", checkedRef(update))
+			fmt.Printf("  Current: %s\n", currentVersion(update)+formatDate(update.CurrentDate))
+			fmt.Printf("  Latest:  %s\n", latestVersion(update)+formatDate(update.LatestDate))
+			if update.LatestRef != "" {
+				fmt.Printf("  Release: %s\n", formatRelease(update))
+			}
+			if update.HeldBack != "" {
+				fmt.Printf("  Held back: %s\n", update.HeldBack)
+			}
+			if lag := formatLag(update); lag != "" {
+				fmt.Printf("  Behind: %s\n", lag)
+			}
+			if update.CompareURL != "" {
+				fmt.Printf("  Compare: %s\n", update.CompareURL)
+			}
+			if update.Changelog != nil {
+				fmt.Printf("  Changes: %s\n", changelogSummary(update.Changelog))
+				for _, line := range formatChangelog(update.Changelog) {
+					fmt.Printf("    %s\n", line)
+				}
+			}
 			fmt.Printf("  URL: %s\n", update.CurrentURL)
+		} else if changesUnknown(update) {
+			fmt.Println(statusStyle.Render("  Status: Not checked for changes"))
+			fmt.Printf("  Version: %s\n", currentVersion(update))
 		} else {
 			fmt.Println(statusStyle.Render("  Status: Up to date"))
-			fmt.Printf("  Version: %s\n", update.CurrentRev[:8]+"...")
+			fmt.Printf("  Ref: %s\n", checkedRef(update))
+			if update.HeldBack != "" {
+				fmt.Printf("  Held back: %s\n", update.HeldBack)
+			}
+			fmt.Printf("  Version: %s\n", currentVersion(update))
+		}
+		if update.NewerBranch != "" {
+			fmt.Printf("  Newer release branch: %s\n", update.NewerBranch)
+		}
+		if update.Reachability != "" {
+			fmt.Printf("  Locked revision: %s\n", formatReachability(update))
+		}
+		for _, note := range repositoryNotes(update) {
+			fmt.Printf("  Repository: %s\n", note)
 		}
 		fmt.Println()
 	}
@@ -690,6 +1114,21 @@ func printPlainUpdateOutput(results flake.UpdateResults, _ Options) {
 	if availableUpdates > 0 {
 		fmt.Printf("%d inputs have updates available\n", availableUpdates)
 	}
+	for _, group := range updateGroups(results) {
+		fmt.Printf("Group %s: nix flake update %s\n", group.Name, strings.Join(group.Inputs, " "))
+	}
+	if newerBranches > 0 {
+		fmt.Printf("%d inputs track an outdated release branch\n", newerBranches)
+	}
+	if lostRevisions > 0 {
+		fmt.Printf("%d inputs are locked to revisions orphaned or gone upstream\n", lostRevisions)
+	}
+	if changedRepositories > 0 {
+		fmt.Printf("%d inputs come from archived, moved or missing repositories\n", changedRepositories)
+	}
+	if unknownChanges > 0 {
+		fmt.Printf("%d inputs could not be checked for changes\n", unknownChanges)
+	}
 	if errors > 0 {
 		fmt.Printf("%d inputs could not be checked\n", errors)
 	}
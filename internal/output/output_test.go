@@ -3,6 +3,8 @@ package output
 import (
 	"strings"
 	"testing"
+
+	flake "notashelf.dev/flint/internal/flake"
 )
 
 func TestValidateOutputFormat(t *testing.T) {
@@ -26,6 +28,16 @@ func TestValidateOutputFormat(t *testing.T) {
 			format:      "pretty",
 			expectError: false,
 		},
+		{
+			name:        "valid github format",
+			format:      "github",
+			expectError: false,
+		},
+		{
+			name:        "valid gitlab format",
+			format:      "gitlab",
+			expectError: false,
+		},
 		{
 			name:        "invalid format",
 			format:      "invalid",
@@ -184,3 +196,133 @@ func TestPrintDependenciesQuietMode(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatLag(t *testing.T) {
+	testCases := []struct {
+		name     string
+		update   flake.UpdateStatus
+		expected string
+	}{
+		{"nothing known", flake.UpdateStatus{}, ""},
+		{"commits only", flake.UpdateStatus{CommitsBehind: 1}, "1 commit"},
+		{"hours", flake.UpdateStatus{AgeGap: 3600}, "less than a day"},
+		{"days", flake.UpdateStatus{CommitsBehind: 12, AgeGap: 3 * 86400}, "12 commits, 3 days"},
+		{"weeks", flake.UpdateStatus{AgeGap: 21 * 86400}, "3 weeks"},
+		{"months", flake.UpdateStatus{AgeGap: 95 * 86400}, "3 months"},
+		{"years", flake.UpdateStatus{AgeGap: 800 * 86400}, "2 years"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := formatLag(tc.update); got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestShortRev(t *testing.T) {
+	testCases := []struct {
+		rev, narHash string
+		expected     string
+	}{
+		{"0123456789abcdef", "", "01234567..."},
+		{"abc", "", "abc"},
+		{"", "sha256-0123456789abcdefghijklmnop=", "sha256-0123456789ab..."},
+		{"", "sha256-short", "sha256-short"},
+		{"", "", "unknown"},
+	}
+
+	for _, tc := range testCases {
+		if got := shortRev(tc.rev, tc.narHash); got != tc.expected {
+			t.Errorf("shortRev(%q, %q): expected %q, got %q", tc.rev, tc.narHash, tc.expected, got)
+		}
+	}
+}
+
+func TestPrintUpdates_ShortRevs(t *testing.T) {
+	results := flake.UpdateResults{Updates: []flake.UpdateStatus{
+		{InputName: "short", CurrentRev: "abc", LatestRev: "def", IsUpdate: true, Changelog: &flake.Changelog{
+			TotalCommits: 1, Commits: []flake.Commit{{Rev: "def", Summary: "Short"}},
+		}},
+		{InputName: "pinned", CurrentRev: "abc", Pinned: true},
+		{InputName: "tarball", CurrentNarHash: "sha256-old", LatestURL: "https://example.com/2.tar.gz", IsUpdate: true},
+		{InputName: "path"},
+	}}
+
+	// Inputs without full revisions used to make the renderers panic
+	for _, format := range []string{"pretty", "plain", "github", "gitlab", "json", "markdown"} {
+		t.Run(format, func(t *testing.T) {
+			if err := PrintUpdates(results, Options{OutputFormat: format}); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestFormatPolicy(t *testing.T) {
+	testCases := []struct {
+		name     string
+		update   flake.UpdateStatus
+		expected string
+	}{
+		{"none", flake.UpdateStatus{}, ""},
+		{"ignored", flake.UpdateStatus{Policy: flake.PolicyIgnored}, "Ignored"},
+		{
+			"ignored until",
+			flake.UpdateStatus{Policy: flake.PolicyIgnored, PolicyUntil: 1751241600, PolicyReason: "waiting for a fix"},
+			"Ignored until 2025-06-30: waiting for a fix",
+		},
+		{"cooling down", flake.UpdateStatus{Policy: flake.PolicyCooldown, PolicyUntil: 1751286600}, "Update cooling down until 2025-06-30 12:30 UTC"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := formatPolicy(tc.update); got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestUpdateGroups(t *testing.T) {
+	results := flake.UpdateResults{Updates: []flake.UpdateStatus{
+		{InputName: "nixpkgs", Group: "nixpkgs-family", IsUpdate: true},
+		{InputName: "flake-utils", IsUpdate: true},
+		{InputName: "home-manager", Group: "nixpkgs-family", IsUpdate: true},
+		{InputName: "treefmt-nix", Group: "tooling"},
+	}}
+
+	groups := updateGroups(results)
+	if len(groups) != 1 || groups[0].Name != "nixpkgs-family" || strings.Join(groups[0].Inputs, " ") != "nixpkgs home-manager" {
+		t.Errorf("expected only the nixpkgs-family group with updates, got %+v", groups)
+	}
+}
+
+func TestPrintLockDiff(t *testing.T) {
+	diff := flake.LockDiff{
+		Command: []string{"nix", "flake", "update", "hm"},
+		Changes: []flake.InputChange{
+			{Input: "hm", OldURL: "github:nix-community/home-manager?rev=a", NewURL: "github:nix-community/home-manager?rev=b", OldRev: "a", NewRev: "b"},
+			{Input: "hm/nixpkgs", NewURL: "github:NixOS/nixpkgs?rev=e", NewRev: "e"},
+			{Input: "old", OldURL: "https://example.com/old.tar.gz"},
+		},
+		NewDuplicates: map[string][]string{"github:NixOS/nixpkgs": {"github:NixOS/nixpkgs?rev=d", "github:NixOS/nixpkgs?rev=e"}},
+		Dependants:    map[string][]string{"github:NixOS/nixpkgs?rev=d": {"root"}, "github:NixOS/nixpkgs?rev=e": {"hm"}},
+	}
+
+	for _, format := range []string{"pretty", "plain", "github", "gitlab", "json"} {
+		t.Run(format, func(t *testing.T) {
+			if err := PrintLockDiff(diff, Options{OutputFormat: format}); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if err := PrintLockDiff(flake.LockDiff{DryRun: true}, Options{OutputFormat: format}); err != nil {
+				t.Errorf("unexpected error for an empty diff: %v", err)
+			}
+		})
+	}
+
+	if err := PrintLockDiff(diff, Options{OutputFormat: "yaml"}); err == nil {
+		t.Error("expected an error for an invalid format")
+	}
+}
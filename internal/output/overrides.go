@@ -0,0 +1,64 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	flake "notashelf.dev/flint/internal/flake"
+)
+
+var overrideFormats = []string{"args", "json", "shell"}
+
+// Formats --override-input arguments for consumption by wrapper scripts:
+// "args" prints one argument per line, "shell" a ready-to-run nix flake lock
+// command, and "json" an array of arguments.
+func FormatOverrides(overrides []flake.OverrideInput, format string) (string, error) {
+	if !slices.Contains(overrideFormats, format) {
+		return "", fmt.Errorf("invalid output format '%s'. Valid formats are: %s", format, strings.Join(overrideFormats, ", "))
+	}
+
+	args := []string{}
+	for _, override := range overrides {
+		args = append(args, override.Args()...)
+	}
+
+	switch format {
+	case "json":
+		// Flake references routinely contain '&', which should stay readable
+		var sb strings.Builder
+		encoder := json.NewEncoder(&sb)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(args); err != nil {
+			return "", fmt.Errorf("error marshaling JSON output: %w", err)
+		}
+		return sb.String(), nil
+
+	case "shell":
+		var sb strings.Builder
+		sb.WriteString("nix flake lock")
+		for _, override := range overrides {
+			fmt.Fprintf(&sb, " \\\n  --override-input %s %s", shellQuote(override.InputPath()), shellQuote(override.URL))
+		}
+		sb.WriteString("\n")
+		return sb.String(), nil
+
+	default:
+		if len(args) == 0 {
+			return "", nil
+		}
+		return strings.Join(args, "\n") + "\n", nil
+	}
+}
+
+// Quotes a string for POSIX shells, leaving it alone when that is not needed.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:@%+=,", r))
+	}) == -1 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
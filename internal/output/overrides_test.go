@@ -0,0 +1,79 @@
+package output
+
+import (
+	"testing"
+
+	flake "notashelf.dev/flint/internal/flake"
+)
+
+func TestFormatOverrides(t *testing.T) {
+	overrides := []flake.OverrideInput{
+		{Path: []string{"home-manager", "nixpkgs"}, URL: "github:NixOS/nixpkgs/abc"},
+		{Path: []string{"foo"}, URL: "https://example.com/a.tar.gz?narHash=sha256-x&dir=a b"},
+	}
+
+	testCases := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format: "args",
+			expected: `--override-input
+home-manager/nixpkgs
+github:NixOS/nixpkgs/abc
+--override-input
+foo
+https://example.com/a.tar.gz?narHash=sha256-x&dir=a b
+`,
+		},
+		{
+			format: "shell",
+			expected: `nix flake lock \
+  --override-input home-manager/nixpkgs github:NixOS/nixpkgs/abc \
+  --override-input foo 'https://example.com/a.tar.gz?narHash=sha256-x&dir=a b'
+`,
+		},
+		{
+			format: "json",
+			expected: `[
+  "--override-input",
+  "home-manager/nixpkgs",
+  "github:NixOS/nixpkgs/abc",
+  "--override-input",
+  "foo",
+  "https://example.com/a.tar.gz?narHash=sha256-x&dir=a b"
+]
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			result, err := FormatOverrides(overrides, tc.format)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tc.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, result)
+			}
+		})
+	}
+
+	if _, err := FormatOverrides(overrides, "pretty"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	testCases := map[string]string{
+		"github:NixOS/nixpkgs": "github:NixOS/nixpkgs",
+		"":                     "''",
+		"it's":                 `'it'\''s'`,
+	}
+
+	for input, expected := range testCases {
+		if result := shellQuote(input); result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	}
+}
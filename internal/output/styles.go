@@ -0,0 +1,72 @@
+package output
+
+import (
+	gloss "github.com/charmbracelet/lipgloss"
+	util "notashelf.dev/flint/internal/util"
+)
+
+// The styles and symbols shared by the pretty reports, with plain fallbacks
+// when NO_COLOR is set.
+type prettyStyles struct {
+	header, success, warning, error, info, dim, bold, url, name gloss.Style
+
+	successIcon, warningIcon, errorIcon, infoIcon string
+}
+
+func newPrettyStyles() prettyStyles {
+	if util.IsNoColor() {
+		emptyStyle := gloss.NewStyle()
+		return prettyStyles{
+			header:  emptyStyle,
+			success: emptyStyle,
+			warning: emptyStyle,
+			error:   emptyStyle,
+			info:    emptyStyle,
+			dim:     emptyStyle,
+			bold:    emptyStyle,
+			url:     emptyStyle,
+			name:    emptyStyle,
+
+			successIcon: "[✓]",
+			warningIcon: "[!]",
+			errorIcon:   "[✗]",
+			infoIcon:    "[i]",
+		}
+	}
+
+	return prettyStyles{
+		header:  gloss.NewStyle().Foreground(gloss.Color("12")).Bold(true).Underline(true),
+		success: gloss.NewStyle().Foreground(gloss.Color("10")).Bold(true),
+		warning: gloss.NewStyle().Foreground(gloss.Color("11")).Bold(true),
+		error:   gloss.NewStyle().Foreground(gloss.Color("9")).Bold(true),
+		info:    gloss.NewStyle().Foreground(gloss.Color("14")).Bold(true),
+		dim:     gloss.NewStyle().Foreground(gloss.Color("8")),
+		bold:    gloss.NewStyle().Bold(true),
+		url:     gloss.NewStyle().Foreground(gloss.Color("6")).Underline(true),
+		name:    gloss.NewStyle().Foreground(gloss.Color("13")).Italic(true),
+
+		successIcon: "✓",
+		warningIcon: "⚠",
+		errorIcon:   "✗",
+		infoIcon:    "ℹ",
+	}
+}
+
+// The styles used by the plain reports.
+type plainStyles struct {
+	title, input, status, error gloss.Style
+}
+
+func newPlainStyles() plainStyles {
+	if util.IsNoColor() {
+		emptyStyle := gloss.NewStyle()
+		return plainStyles{title: emptyStyle, input: emptyStyle, status: emptyStyle, error: emptyStyle}
+	}
+
+	return plainStyles{
+		title:  gloss.NewStyle().Foreground(gloss.Color("5")).Bold(true).Underline(true),
+		input:  gloss.NewStyle().Foreground(gloss.Color("6")).Bold(true),
+		status: gloss.NewStyle().Foreground(gloss.Color("2")),
+		error:  gloss.NewStyle().Foreground(gloss.Color("9")).Bold(true),
+	}
+}